@@ -14,6 +14,7 @@
 package http
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -36,6 +37,7 @@ import (
 	"github.com/mendersoftware/deployments/app"
 	"github.com/mendersoftware/deployments/model"
 	"github.com/mendersoftware/deployments/store"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
 )
 
 const (
@@ -49,6 +51,9 @@ const (
 const (
 	GetDeploymentForDeviceQueryArtifact   = "artifact_name"
 	GetDeploymentForDeviceQueryDeviceType = "device_type"
+	GetDeploymentForDeviceQueryWait       = "wait"
+
+	GetDeploymentStatsTimelineQueryInterval = "interval"
 )
 
 // Errors
@@ -56,13 +61,22 @@ var (
 	ErrIDNotUUIDv4                    = errors.New("ID is not UUIDv4")
 	ErrArtifactUsedInActiveDeployment = errors.New("Artifact is used in active deployment")
 	ErrInvalidExpireParam             = errors.New("Invalid expire parameter")
+	ErrInvalidWaitParam               = errors.New("Invalid wait parameter")
+	ErrInvalidIntervalParam           = errors.New("Invalid interval parameter")
+	ErrMissingDeviceProvides          = errors.New("Missing device provides")
 
 	ErrInternal                   = errors.New("Internal error")
 	ErrDeploymentAlreadyFinished  = errors.New("Deployment already finished")
 	ErrUnexpectedDeploymentStatus = errors.New("Unexpected deployment status")
 	ErrMissingIdentity            = errors.New("Missing identity data")
+	ErrNoGatewayReports           = errors.New("No reports")
+	ErrTooManyGatewayReports      = errors.New("Too many reports")
 )
 
+// maxGatewayReports limits the number of reports a gateway may submit in a
+// single request.
+const maxGatewayReports = 100
+
 type DeploymentsApiHandlers struct {
 	view  RESTView
 	store store.DataStore
@@ -77,6 +91,31 @@ func NewDeploymentsApiHandlers(store store.DataStore, view RESTView, app app.App
 	}
 }
 
+// health
+
+// AliveHandler responds as long as the service is able to serve requests.
+func (d *DeploymentsApiHandlers) AliveHandler(w rest.ResponseWriter, r *rest.Request) {
+	d.view.RenderEmptySuccessResponse(w)
+}
+
+// HealthCheckHandler checks the service dependencies; responds with 503 if
+// any of them is not reachable.
+func (d *DeploymentsApiHandlers) HealthCheckHandler(w rest.ResponseWriter, r *rest.Request) {
+	l := requestlog.GetRequestLogger(r)
+
+	report := d.app.HealthCheck(r.Context())
+	if !report.IsHealthy() {
+		for _, dep := range report.Dependencies {
+			if dep.Status != model.HealthStatusOK {
+				l.Errorf("health check of %s failed: %s", dep.Name, dep.Error)
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	d.view.RenderSuccessGet(w, report)
+}
+
 func (d *DeploymentsApiHandlers) GetReleases(w rest.ResponseWriter, r *rest.Request) {
 	l := requestlog.GetRequestLogger(r)
 
@@ -128,6 +167,48 @@ func (d *DeploymentsApiHandlers) GetLimit(w rest.ResponseWriter, r *rest.Request
 	})
 }
 
+type limitRequest struct {
+	Limit *uint64 `json:"limit"`
+}
+
+// SetLimitForTenantHandler sets the value of the tenant's limit.
+func (d *DeploymentsApiHandlers) SetLimitForTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	l := requestlog.GetRequestLogger(r)
+
+	tenantID := r.PathParam("tenant")
+	name := r.PathParam("name")
+
+	if !model.IsValidLimit(name) {
+		d.view.RenderError(w, r,
+			errors.Errorf("unsupported limit %s", name),
+			http.StatusBadRequest, l)
+		return
+	}
+
+	var req limitRequest
+	if err := r.DecodeJsonPayload(&req); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if req.Limit == nil {
+		d.view.RenderError(w, r, errors.New("limit value is required"),
+			http.StatusBadRequest, l)
+		return
+	}
+
+	ctx := r.Context()
+	if tenantID != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenantID})
+	}
+
+	if err := d.app.SetLimit(ctx, model.Limit{Name: name, Value: *req.Limit}); err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	d.view.RenderSuccessPut(w)
+}
+
 // images
 
 func (d *DeploymentsApiHandlers) GetImage(w rest.ResponseWriter, r *rest.Request) {
@@ -472,6 +553,88 @@ func (d *DeploymentsApiHandlers) GetDeploymentStats(w rest.ResponseWriter, r *re
 	d.view.RenderSuccessGet(w, stats)
 }
 
+// GetDeploymentProgress returns the progress aggregated over the devices
+// downloading or installing the deployment.
+func (d *DeploymentsApiHandlers) GetDeploymentProgress(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	id := r.PathParam("id")
+
+	if !govalidator.IsUUIDv4(id) {
+		d.view.RenderError(w, r, ErrIDNotUUIDv4, http.StatusBadRequest, l)
+		return
+	}
+
+	progress, err := d.app.GetDeploymentProgress(ctx, id)
+	switch {
+	case err != nil:
+		d.view.RenderInternalError(w, r, err, l)
+	case progress == nil:
+		d.view.RenderErrorNotFound(w, r, l)
+	default:
+		d.view.RenderSuccessGet(w, progress)
+	}
+}
+
+// GetDeploymentStatsTimeline returns the statistics of the deployment at the
+// end of each interval of the given number of seconds, since its creation.
+func (d *DeploymentsApiHandlers) GetDeploymentStatsTimeline(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	id := r.PathParam("id")
+
+	if !govalidator.IsUUIDv4(id) {
+		d.view.RenderError(w, r, ErrIDNotUUIDv4, http.StatusBadRequest, l)
+		return
+	}
+
+	seconds, err := strconv.ParseUint(
+		r.URL.Query().Get(GetDeploymentStatsTimelineQueryInterval), 10, 32)
+	if err != nil || seconds == 0 {
+		d.view.RenderError(w, r, ErrInvalidIntervalParam, http.StatusBadRequest, l)
+		return
+	}
+
+	timeline, err := d.app.GetDeploymentStatsTimeline(ctx, id,
+		time.Duration(seconds)*time.Second)
+	switch {
+	case errors.Cause(err) == model.ErrInvalidStatsTimelineInterval:
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+	case err != nil:
+		d.view.RenderInternalError(w, r, err, l)
+	case timeline == nil:
+		d.view.RenderErrorNotFound(w, r, l)
+	default:
+		d.view.RenderSuccessGet(w, timeline)
+	}
+}
+
+// GetDeploymentFailureSummary groups the failed devices of the deployment by
+// substate, device type and signature of their logs.
+func (d *DeploymentsApiHandlers) GetDeploymentFailureSummary(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	id := r.PathParam("id")
+
+	if !govalidator.IsUUIDv4(id) {
+		d.view.RenderError(w, r, ErrIDNotUUIDv4, http.StatusBadRequest, l)
+		return
+	}
+
+	summary, err := d.app.GetDeploymentFailureSummary(ctx, id)
+	switch {
+	case err != nil:
+		d.view.RenderInternalError(w, r, err, l)
+	case summary == nil:
+		d.view.RenderErrorNotFound(w, r, l)
+	default:
+		d.view.RenderSuccessGet(w, summary)
+	}
+}
+
 func (d *DeploymentsApiHandlers) AbortDeployment(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
@@ -535,12 +698,65 @@ func (d *DeploymentsApiHandlers) GetDeploymentForDevice(w rest.ResponseWriter, r
 		DeviceType: q.Get(GetDeploymentForDeviceQueryDeviceType),
 	}
 
+	d.getDeploymentForDevice(w, r, idata, installed)
+}
+
+// PostDeploymentForDevice is the variant of GetDeploymentForDevice for
+// devices reporting all their provides.
+func (d *DeploymentsApiHandlers) PostDeploymentForDevice(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	idata := identity.FromContext(ctx)
+	if idata == nil {
+		d.view.RenderError(w, r, ErrMissingIdentity, http.StatusBadRequest, l)
+		return
+	}
+
+	var provides model.DeviceProvides
+	if err := r.DecodeJsonPayload(&provides); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if provides.Provides == nil {
+		d.view.RenderError(w, r, ErrMissingDeviceProvides, http.StatusBadRequest, l)
+		return
+	}
+
+	d.getDeploymentForDevice(w, r, idata, provides.InstalledDeviceDeployment())
+}
+
+func (d *DeploymentsApiHandlers) getDeploymentForDevice(w rest.ResponseWriter, r *rest.Request,
+	idata *identity.Identity, installed model.InstalledDeviceDeployment) {
+
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
 	if err := installed.Validate(); err != nil {
 		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
 		return
 	}
 
-	deployment, err := d.app.GetDeploymentForDeviceWithCurrent(ctx, idata.Subject, installed)
+	// optionally wait up to the given number of seconds for a deployment
+	var wait time.Duration
+	if param := r.URL.Query().Get(GetDeploymentForDeviceQueryWait); param != "" {
+		seconds, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			d.view.RenderError(w, r, ErrInvalidWaitParam, http.StatusBadRequest, l)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	var deployment *model.DeploymentInstructions
+	var err error
+	if wait > 0 {
+		deployment, err = d.app.WaitForDeploymentForDevice(ctx,
+			idata.Subject, installed, wait)
+	} else {
+		deployment, err = d.app.GetDeploymentForDeviceWithCurrent(ctx,
+			idata.Subject, installed)
+	}
 	if err != nil {
 		d.view.RenderInternalError(w, r, err, l)
 		return
@@ -580,9 +796,13 @@ func (d *DeploymentsApiHandlers) PutDeploymentStatusForDevice(w rest.ResponseWri
 		idata.Subject, model.DeviceDeploymentStatus{
 			Status:   report.Status,
 			SubState: report.SubState,
+			Progress: report.DeviceDeploymentProgress(),
 		}); err != nil {
 
-		if err == app.ErrDeploymentAborted || err == app.ErrDeviceDecommissioned {
+		if err == app.ErrDeploymentAborted || err == app.ErrDeviceDecommissioned ||
+			err == app.ErrModelStatusConflict {
+			d.view.RenderError(w, r, err, http.StatusConflict, l)
+		} else if errors.Cause(err) == model.ErrInvalidStatusTransition {
 			d.view.RenderError(w, r, err, http.StatusConflict, l)
 		} else {
 			d.view.RenderInternalError(w, r, err, l)
@@ -604,7 +824,37 @@ func (d *DeploymentsApiHandlers) GetDeviceStatusesForDeployment(w rest.ResponseW
 		return
 	}
 
-	statuses, err := d.app.GetDeviceStatusesForDeployment(ctx, did)
+	query, err := ParseDeviceDeploymentsQuery(r.URL.Query())
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	query.DeploymentID = did
+
+	// large deployments are streamed, if the client accepts it
+	mediaType := d.view.NegotiateMediaType(r, view.MediaTypeJSON,
+		view.MediaTypeCSV, view.MediaTypeNDJSON)
+	if mediaType != view.MediaTypeJSON {
+		d.exportDeviceStatusesForDeployment(w, r, query, mediaType)
+		return
+	}
+
+	// clients not asking for a page get all the devices, as they did
+	// before paging was added
+	vals := r.URL.Query()
+	paged := vals.Get(rest_utils.PageName) != "" ||
+		vals.Get(rest_utils.PerPageName) != ""
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if paged {
+		query.Skip = int((page - 1) * perPage)
+		query.Limit = int(perPage)
+	}
+
+	statuses, total, err := d.app.GetDeviceStatusesForDeployment(ctx, query)
 	if err != nil {
 		switch err {
 		case app.ErrModelDeploymentNotFound:
@@ -616,9 +866,127 @@ func (d *DeploymentsApiHandlers) GetDeviceStatusesForDeployment(w rest.ResponseW
 		}
 	}
 
+	if paged {
+		hasNext := query.Skip+len(statuses) < total
+		links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+		for _, link := range links {
+			w.Header().Add("Link", link)
+		}
+	}
+	w.Header().Set(view.HttpHeaderTotalCount, strconv.Itoa(total))
+
 	d.view.RenderSuccessGet(w, statuses)
 }
 
+// ParseDeviceDeploymentsQuery parses the filters and the sorting of the
+// device deployments of a deployment; sort is a field optionally followed by
+// the direction, e.g. "finished:desc".
+func ParseDeviceDeploymentsQuery(vals url.Values) (model.DeviceDeploymentsQuery, error) {
+	query := model.DeviceDeploymentsQuery{}
+
+	status := vals.Get("status")
+	if status != "" {
+		known := false
+		for _, s := range model.AllDeviceDeploymentStatuses() {
+			if s == status {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return query, errors.Errorf("unknown status %s", status)
+		}
+		query.Status = status
+	}
+
+	query.DeviceType = vals.Get("device_type")
+
+	logAvailable := vals.Get("log")
+	if logAvailable != "" {
+		isLogAvailable, err := strconv.ParseBool(logAvailable)
+		if err != nil {
+			return query, errors.Errorf("invalid log parameter %s", logAvailable)
+		}
+		query.IsLogAvailable = &isLogAvailable
+	}
+
+	var err error
+	query.SortBy, query.SortDescending, err = parseSortParam(vals.Get("sort"),
+		model.DeviceDeploymentsSortCreated, model.DeviceDeploymentsSortFinished)
+	if err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// parseSortParam parses the sort parameter, one of the fields optionally
+// followed by the order, e.g. "created:desc"; ascending by default.
+func parseSortParam(value string, fields ...string) (string, bool, error) {
+	if value == "" {
+		return "", false, nil
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	known := false
+	for _, field := range fields {
+		if field == parts[0] {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "", false, errors.Errorf("unknown sort field %s", parts[0])
+	}
+
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "asc":
+		case "desc":
+			return parts[0], true, nil
+		default:
+			return "", false, errors.Errorf("unknown sort order %s", parts[1])
+		}
+	}
+	return parts[0], false, nil
+}
+
+// exportDeviceStatusesForDeployment streams the device deployments selected
+// by the query in CSV or NDJSON; all of them, the paging does not apply.
+func (d *DeploymentsApiHandlers) exportDeviceStatusesForDeployment(w rest.ResponseWriter,
+	r *rest.Request, query model.DeviceDeploymentsQuery, mediaType string) {
+
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	encoder, err := d.view.NewDeviceDeploymentEncoder(w, mediaType)
+	if err != nil {
+		l.Errorf("failed to export device deployments: %s", err.Error())
+		d.view.RenderInternalError(w, r, ErrInternal, l)
+		return
+	}
+	err = d.app.IterateDeviceStatusesForDeployment(ctx, query,
+		encoder.Encode)
+	// flush what was encoded, even if the iteration failed midway
+	if err == nil || encoder.Started() {
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	switch {
+	case err == nil:
+	case err == app.ErrModelDeploymentNotFound && !encoder.Started():
+		d.view.RenderError(w, r, err, http.StatusNotFound, l)
+	default:
+		l.Errorf("failed to export device deployments: %s", err.Error())
+		// too late to render the error if the response was started
+		if !encoder.Started() {
+			d.view.RenderInternalError(w, r, ErrInternal, l)
+		}
+	}
+}
+
 func ParseLookupQuery(vals url.Values) (model.Query, error) {
 	query := model.Query{}
 
@@ -645,6 +1013,34 @@ func ParseLookupQuery(vals url.Values) (model.Query, error) {
 		}
 	}
 
+	finishedBefore := vals.Get("finished_before")
+	if finishedBefore != "" {
+		finishedBeforeTime, err := parseEpochToTimestamp(finishedBefore)
+		if err != nil {
+			return query, errors.Wrap(err, "timestamp parsing failed for finished_before parameter")
+		}
+		query.FinishedBefore = &finishedBeforeTime
+	}
+
+	finishedAfter := vals.Get("finished_after")
+	if finishedAfter != "" {
+		finishedAfterTime, err := parseEpochToTimestamp(finishedAfter)
+		if err != nil {
+			return query, errors.Wrap(err, "timestamp parsing failed for finished_after parameter")
+		}
+		query.FinishedAfter = &finishedAfterTime
+	}
+
+	query.ArtifactName = vals.Get("artifact_name")
+	query.DeviceID = vals.Get("device_id")
+
+	var err error
+	query.SortBy, query.SortDescending, err = parseSortParam(vals.Get("sort"),
+		model.DeploymentsSortCreated, model.DeploymentsSortFinished)
+	if err != nil {
+		return query, err
+	}
+
 	status := vals.Get("status")
 	switch status {
 	case "inprogress":
@@ -667,7 +1063,7 @@ func ParseLookupQuery(vals url.Values) (model.Query, error) {
 
 func parseEpochToTimestamp(epoch string) (time.Time, error) {
 	if epochInt64, err := strconv.ParseInt(epoch, 10, 64); err != nil {
-		return time.Time{}, errors.Errorf("invalid timestamp: " + epoch)
+		return time.Time{}, errors.Errorf("invalid timestamp: %s", epoch)
 	} else {
 		return time.Unix(epochInt64, 0).UTC(), nil
 	}
@@ -689,27 +1085,22 @@ func (d *DeploymentsApiHandlers) LookupDeployment(w rest.ResponseWriter, r *rest
 		return
 	}
 	query.Skip = int((page - 1) * perPage)
-	query.Limit = int(perPage + 1)
+	query.Limit = int(perPage)
 
-	deps, err := d.app.LookupDeployment(ctx, query)
+	deps, total, err := d.app.LookupDeployment(ctx, query)
 	if err != nil {
 		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
 		return
 	}
 
-	len := len(deps)
-	hasNext := false
-	if uint64(len) > perPage {
-		hasNext = true
-		len = int(perPage)
-	}
-
+	hasNext := query.Skip+len(deps) < total
 	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
 	for _, l := range links {
 		w.Header().Add("Link", l)
 	}
+	w.Header().Set(view.HttpHeaderTotalCount, strconv.Itoa(total))
 
-	d.view.RenderSuccessGet(w, deps[:len])
+	d.view.RenderSuccessGet(w, deps)
 }
 
 func (d *DeploymentsApiHandlers) PutDeploymentLogForDevice(w rest.ResponseWriter, r *rest.Request) {
@@ -748,6 +1139,42 @@ func (d *DeploymentsApiHandlers) PutDeploymentLogForDevice(w rest.ResponseWriter
 	d.view.RenderEmptySuccessResponse(w)
 }
 
+// AppendDeploymentLogForDevice adds a chunk of the deployment log uploaded
+// while the deployment is still in progress.
+func (d *DeploymentsApiHandlers) AppendDeploymentLogForDevice(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	did := r.PathParam("id")
+
+	idata := identity.FromContext(ctx)
+	if idata == nil {
+		d.view.RenderError(w, r, ErrMissingIdentity, http.StatusBadRequest, l)
+		return
+	}
+
+	var chunk model.LogChunk
+
+	err := r.DecodeJsonPayload(&chunk)
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+
+	if err := d.app.AppendDeviceDeploymentLog(ctx, idata.Subject,
+		did, chunk); err != nil {
+
+		if err == app.ErrModelDeploymentNotFound {
+			d.view.RenderError(w, r, err, http.StatusNotFound, l)
+		} else {
+			d.view.RenderInternalError(w, r, err, l)
+		}
+		return
+	}
+
+	d.view.RenderEmptySuccessResponse(w)
+}
+
 func (d *DeploymentsApiHandlers) GetDeploymentLogForDevice(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
@@ -770,6 +1197,23 @@ func (d *DeploymentsApiHandlers) GetDeploymentLogForDevice(w rest.ResponseWriter
 	d.view.RenderDeploymentLog(w, *depl)
 }
 
+func (d *DeploymentsApiHandlers) GetDeviceDeploymentTransitions(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	transitions, err := d.app.GetDeviceDeploymentTransitions(ctx,
+		r.PathParam("id"), r.PathParam("devid"))
+
+	switch errors.Cause(err) {
+	case nil:
+		d.view.RenderSuccessGet(w, transitions)
+	case app.ErrModelDeploymentNotFound:
+		d.view.RenderErrorNotFound(w, r, l)
+	default:
+		d.view.RenderInternalError(w, r, err, l)
+	}
+}
+
 func (d *DeploymentsApiHandlers) DecommissionDevice(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
@@ -788,13 +1232,92 @@ func (d *DeploymentsApiHandlers) DecommissionDevice(w rest.ResponseWriter, r *re
 	}
 }
 
-// tenants
-
-func (d *DeploymentsApiHandlers) ProvisionTenantsHandler(w rest.ResponseWriter, r *rest.Request) {
-	ctx := r.Context()
-	l := requestlog.GetRequestLogger(r)
+func ParseDeviceDeploymentHistoryQuery(vals url.Values) (model.DeviceDeploymentHistoryQuery, error) {
+	query := model.DeviceDeploymentHistoryQuery{}
 
-	defer r.Body.Close()
+	status := vals.Get("status")
+	if status != "" {
+		known := false
+		for _, s := range model.AllDeviceDeploymentStatuses() {
+			if s == status {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return query, errors.Errorf("unknown status %s", status)
+		}
+		query.Status = status
+	}
+
+	createdBefore := vals.Get("created_before")
+	if createdBefore != "" {
+		createdBeforeTime, err := parseEpochToTimestamp(createdBefore)
+		if err != nil {
+			return query, errors.Wrap(err, "timestamp parsing failed for created_before parameter")
+		}
+		query.CreatedBefore = &createdBeforeTime
+	}
+
+	createdAfter := vals.Get("created_after")
+	if createdAfter != "" {
+		createdAfterTime, err := parseEpochToTimestamp(createdAfter)
+		if err != nil {
+			return query, errors.Wrap(err, "timestamp parsing failed for created_after parameter")
+		}
+		query.CreatedAfter = &createdAfterTime
+	}
+
+	return query, nil
+}
+
+func (d *DeploymentsApiHandlers) GetDeviceDeploymentHistory(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	query, err := ParseDeviceDeploymentHistoryQuery(r.URL.Query())
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	query.DeviceID = r.PathParam("id")
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	query.Skip = int((page - 1) * perPage)
+	query.Limit = int(perPage + 1)
+
+	history, err := d.app.GetDeviceDeploymentHistory(ctx, query)
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	len := len(history)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+	for _, l := range links {
+		w.Header().Add("Link", l)
+	}
+
+	d.view.RenderSuccessGet(w, history[:len])
+}
+
+// tenants
+
+func (d *DeploymentsApiHandlers) ProvisionTenantsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	defer r.Body.Close()
 
 	tenant, err := model.ParseNewTenantReq(r.Body)
 	if err != nil {
@@ -811,6 +1334,46 @@ func (d *DeploymentsApiHandlers) ProvisionTenantsHandler(w rest.ResponseWriter,
 	w.WriteHeader(http.StatusCreated)
 }
 
+// DeprovisionTenantHandler schedules the removal of all data of the tenant,
+// done in the background. Safe to retry; the progress is available from
+// GetTenantDeprovisioningHandler.
+func (d *DeploymentsApiHandlers) DeprovisionTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	tenantID := r.PathParam("tenant")
+
+	if err := d.app.DeprovisionTenant(ctx, tenantID); err != nil {
+		if err == app.ErrModelInvalidTenantID {
+			d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		} else {
+			d.view.RenderInternalError(w, r, err, l)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (d *DeploymentsApiHandlers) GetTenantDeprovisioningHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	tenantID := r.PathParam("tenant")
+
+	deprovisioning, err := d.app.GetTenantDeprovisioning(ctx, tenantID)
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+	if deprovisioning == nil {
+		d.view.RenderErrorNotFound(w, r, l)
+		return
+	}
+
+	d.view.RenderSuccessGet(w, deprovisioning)
+}
+
 func (d *DeploymentsApiHandlers) DeploymentsPerTenantHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 	l := requestlog.GetRequestLogger(r)
@@ -831,9 +1394,10 @@ func (d *DeploymentsApiHandlers) DeploymentsPerTenantHandler(w rest.ResponseWrit
 	ident := &identity.Identity{Tenant: tenantID}
 	ctx = identity.WithContext(r.Context(), ident)
 
-	if deps, err := d.app.LookupDeployment(ctx, query); err != nil {
+	if deps, total, err := d.app.LookupDeployment(ctx, query); err != nil {
 		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
 	} else {
+		w.Header().Set(view.HttpHeaderTotalCount, strconv.Itoa(total))
 		w.WriteJson(deps)
 	}
 }
@@ -884,3 +1448,330 @@ func (d *DeploymentsApiHandlers) NewImageForTenantHandler(w rest.ResponseWriter,
 		d.view.RenderError(w, r, cause, http.StatusBadRequest, l)
 	}
 }
+
+// RecomputeStatsHandler recomputes cached deployment stats. The scope is
+// selected with the optional 'tenant_id' and 'deployment_id' query
+// parameters; with neither of them, all deployments of all tenants are
+// processed.
+func (d *DeploymentsApiHandlers) RecomputeStatsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	q := r.URL.Query()
+	tenantID := q.Get("tenant_id")
+	deploymentID := q.Get("deployment_id")
+
+	if deploymentID != "" && !govalidator.IsUUIDv4(deploymentID) {
+		d.view.RenderError(w, r, ErrIDNotUUIDv4, http.StatusBadRequest, l)
+		return
+	}
+
+	if tenantID != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenantID})
+	}
+
+	var corrections []model.StatsCorrection
+	var err error
+	if tenantID == "" && deploymentID == "" {
+		corrections, err = d.app.RecomputeStatsAllTenants(ctx)
+	} else {
+		corrections, err = d.app.RecomputeStats(ctx, deploymentID)
+	}
+
+	switch err {
+	case nil:
+		d.view.RenderSuccessGet(w, corrections)
+	case app.ErrModelDeploymentNotFound:
+		d.view.RenderError(w, r, err, http.StatusNotFound, l)
+	default:
+		d.view.RenderInternalError(w, r, err, l)
+	}
+}
+
+// retention
+
+func (d *DeploymentsApiHandlers) ListArchivedDeployments(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+
+	archived, err := d.app.ListArchivedDeployments(ctx,
+		int((page-1)*perPage), int(perPage+1))
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	len := len(archived)
+	hasNext := false
+	if uint64(len) > perPage {
+		hasNext = true
+		len = int(perPage)
+	}
+
+	links := rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext)
+	for _, l := range links {
+		w.Header().Add("Link", l)
+	}
+
+	d.view.RenderSuccessGet(w, archived[:len])
+}
+
+func (d *DeploymentsApiHandlers) RestoreArchivedDeployment(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	id := r.PathParam("id")
+
+	if !govalidator.IsUUIDv4(id) {
+		d.view.RenderError(w, r, ErrIDNotUUIDv4, http.StatusBadRequest, l)
+		return
+	}
+
+	switch err := d.app.RestoreArchivedDeployment(ctx, id); err {
+	case nil:
+		d.view.RenderEmptySuccessResponse(w)
+	case app.ErrModelArchivedDeploymentNotFound:
+		d.view.RenderError(w, r, err, http.StatusNotFound, l)
+	case app.ErrModelDeploymentExists:
+		d.view.RenderError(w, r, err, http.StatusConflict, l)
+	default:
+		d.view.RenderInternalError(w, r, err, l)
+	}
+}
+
+func (d *DeploymentsApiHandlers) SetGatewayDevices(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	var devices model.GatewayDevices
+	if err := r.DecodeJsonPayload(&devices); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if err := devices.Validate(); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if devices.Devices == nil {
+		devices.Devices = []string{}
+	}
+
+	if err := d.app.SetGatewayDevices(ctx, r.PathParam("id"),
+		devices); err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	d.view.RenderEmptySuccessResponse(w)
+}
+
+func (d *DeploymentsApiHandlers) GetGatewayDevices(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	devices, err := d.app.GetGatewayDevices(ctx, r.PathParam("id"))
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+	if devices == nil {
+		d.view.RenderErrorNotFound(w, r, l)
+		return
+	}
+
+	d.view.RenderSuccessGet(w, devices)
+}
+
+// gatewayReportResult is the outcome of a single report submitted by a
+// gateway; the code is the HTTP status the device would get reporting on
+// its own.
+type gatewayReportResult struct {
+	DeploymentID string `json:"deployment_id,omitempty"`
+	DeviceID     string `json:"device_id,omitempty"`
+	Code         int    `json:"code"`
+	Error        string `json:"error,omitempty"`
+}
+
+// SubmitGatewayReports lets a gateway report the status and/or upload the
+// deployment logs of many of its devices at once.
+func (d *DeploymentsApiHandlers) SubmitGatewayReports(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	idata := identity.FromContext(ctx)
+	if idata == nil {
+		d.view.RenderError(w, r, ErrMissingIdentity, http.StatusBadRequest, l)
+		return
+	}
+
+	// items are decoded one by one, so that an invalid one fails alone
+	var raw []json.RawMessage
+	if err := r.DecodeJsonPayload(&raw); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return
+	}
+	if len(raw) == 0 {
+		d.view.RenderError(w, r, ErrNoGatewayReports, http.StatusBadRequest, l)
+		return
+	}
+	if len(raw) > maxGatewayReports {
+		d.view.RenderError(w, r,
+			errors.Wrapf(ErrTooManyGatewayReports, "limit is %d",
+				maxGatewayReports),
+			http.StatusBadRequest, l)
+		return
+	}
+
+	results := make([]gatewayReportResult, len(raw))
+	reports := make([]model.GatewayReport, 0, len(raw))
+	indexes := make([]int, 0, len(raw))
+	for i, item := range raw {
+		var report model.GatewayReport
+		if err := json.Unmarshal(item, &report); err != nil {
+			results[i] = gatewayReportResult{
+				Code:  http.StatusBadRequest,
+				Error: err.Error(),
+			}
+			continue
+		}
+		results[i].DeploymentID = report.DeploymentID
+		results[i].DeviceID = report.DeviceID
+		reports = append(reports, report)
+		indexes = append(indexes, i)
+	}
+
+	errs, err := d.app.SubmitGatewayReports(ctx, idata.Subject, reports)
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	for j, err := range errs {
+		result := &results[indexes[j]]
+		result.Code = gatewayReportResultCode(err)
+		switch {
+		case err == nil:
+		case result.Code == http.StatusInternalServerError:
+			l.Errorf("gateway report for device %s, deployment %s: %v",
+				result.DeviceID, result.DeploymentID, err)
+			result.Error = "internal error"
+		default:
+			result.Error = err.Error()
+		}
+	}
+
+	d.view.RenderSuccessGet(w, results)
+}
+
+func gatewayReportResultCode(err error) int {
+	switch errors.Cause(err) {
+	case nil:
+		return http.StatusNoContent
+	case model.ErrInvalidGatewayReport:
+		return http.StatusBadRequest
+	case app.ErrGatewayNotAuthorized:
+		return http.StatusForbidden
+	case app.ErrModelDeploymentNotFound:
+		return http.StatusNotFound
+	case app.ErrDeploymentAborted, app.ErrDeviceDecommissioned,
+		model.ErrInvalidStatusTransition:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeMaintenanceWindows reads the windows from the request body, or
+// renders the error; returns nil in that case.
+func (d *DeploymentsApiHandlers) decodeMaintenanceWindows(w rest.ResponseWriter,
+	r *rest.Request) *model.MaintenanceWindows {
+
+	l := requestlog.GetRequestLogger(r)
+
+	var windows model.MaintenanceWindows
+	if err := r.DecodeJsonPayload(&windows); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return nil
+	}
+	if err := windows.Validate(); err != nil {
+		d.view.RenderError(w, r, err, http.StatusBadRequest, l)
+		return nil
+	}
+	if windows.Windows == nil {
+		windows.Windows = []model.MaintenanceWindow{}
+	}
+	return &windows
+}
+
+func (d *DeploymentsApiHandlers) SetTenantMaintenanceWindows(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	windows := d.decodeMaintenanceWindows(w, r)
+	if windows == nil {
+		return
+	}
+
+	if err := d.app.SetTenantMaintenanceWindows(ctx, *windows); err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	d.view.RenderEmptySuccessResponse(w)
+}
+
+func (d *DeploymentsApiHandlers) GetTenantMaintenanceWindows(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	windows, err := d.app.GetTenantMaintenanceWindows(ctx)
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+	if windows == nil {
+		windows = &model.MaintenanceWindows{Windows: []model.MaintenanceWindow{}}
+	}
+
+	d.view.RenderSuccessGet(w, windows)
+}
+
+func (d *DeploymentsApiHandlers) SetDeviceMaintenanceWindows(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	windows := d.decodeMaintenanceWindows(w, r)
+	if windows == nil {
+		return
+	}
+
+	if err := d.app.SetDeviceMaintenanceWindows(ctx, r.PathParam("id"),
+		*windows); err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+
+	d.view.RenderEmptySuccessResponse(w)
+}
+
+func (d *DeploymentsApiHandlers) GetDeviceMaintenanceWindows(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+	l := requestlog.GetRequestLogger(r)
+
+	windows, err := d.app.GetDeviceMaintenanceWindows(ctx, r.PathParam("id"))
+	if err != nil {
+		d.view.RenderInternalError(w, r, err, l)
+		return
+	}
+	if windows == nil {
+		windows = &model.MaintenanceWindows{Windows: []model.MaintenanceWindow{}}
+	}
+
+	d.view.RenderSuccessGet(w, windows)
+}
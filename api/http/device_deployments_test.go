@@ -0,0 +1,194 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/pointers"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeviceStatusesForDeployment(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	dd := model.DeviceDeployment{
+		DeviceId:   pointers.StringToPointer("device"),
+		Status:     pointers.StringToPointer(model.DeviceDeploymentStatusFailure),
+		DeviceType: pointers.StringToPointer("foo"),
+	}
+	withLog := true
+
+	testCases := map[string]struct {
+		query string
+
+		appQuery    *model.DeviceDeploymentsQuery
+		appStatuses []model.DeviceDeployment
+		appTotal    int
+		appErr      error
+
+		checker mt.ResponseChecker
+		total   string
+		hasNext bool
+	}{
+		"ok": {
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID: deploymentID,
+			},
+			appStatuses: []model.DeviceDeployment{dd},
+			appTotal:    1,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeployment{dd}),
+			total: "1",
+		},
+		"ok, filters, sorting and next page": {
+			query: "?status=failure&device_type=foo&log=true" +
+				"&sort=finished:desc&page=2&per_page=1",
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID:   deploymentID,
+				Status:         model.DeviceDeploymentStatusFailure,
+				DeviceType:     "foo",
+				IsLogAvailable: &withLog,
+				SortBy:         model.DeviceDeploymentsSortFinished,
+				SortDescending: true,
+				Skip:           1,
+				Limit:          1,
+			},
+			appStatuses: []model.DeviceDeployment{dd},
+			appTotal:    3,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeployment{dd}),
+			total:   "3",
+			hasNext: true,
+		},
+		"ok, default page size": {
+			query: "?page=1",
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID: deploymentID,
+				Limit:        20,
+			},
+			appStatuses: []model.DeviceDeployment{dd},
+			appTotal:    21,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeployment{dd}),
+			total:   "21",
+			hasNext: true,
+		},
+		"ok, last page": {
+			query: "?sort=created:asc&page=3&per_page=1",
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID: deploymentID,
+				SortBy:       model.DeviceDeploymentsSortCreated,
+				Skip:         2,
+				Limit:        1,
+			},
+			appStatuses: []model.DeviceDeployment{dd},
+			appTotal:    3,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeployment{dd}),
+			total: "3",
+		},
+		"error, unknown status": {
+			query: "?status=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown status foo")),
+		},
+		"error, invalid log": {
+			query: "?log=maybe",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("invalid log parameter maybe")),
+		},
+		"error, unknown sort field": {
+			query: "?sort=status",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown sort field status")),
+		},
+		"error, unknown sort order": {
+			query: "?sort=created:up",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown sort order up")),
+		},
+		"error, not found": {
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID: deploymentID,
+			},
+			appErr: app.ErrModelDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(app.ErrModelDeploymentNotFound.Error())),
+		},
+		"error, internal": {
+			appQuery: &model.DeviceDeploymentsQuery{
+				DeploymentID: deploymentID,
+			},
+			appErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.appQuery != nil {
+				mockApp.On("GetDeviceStatusesForDeployment", mock.Anything, *tc.appQuery).
+					Return(tc.appStatuses, tc.appTotal, tc.appErr)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsDevices,
+				rest.Get, d.GetDeviceStatusesForDeployment)
+
+			url := strings.Replace(ApiUrlManagementDeploymentsDevices,
+				":id", deploymentID, 1)
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+url+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+
+			assert.Equal(t, tc.total,
+				recorded.Recorder.HeaderMap.Get(view.HttpHeaderTotalCount))
+			hasNext := false
+			for _, link := range recorded.Recorder.HeaderMap["Link"] {
+				if strings.Contains(link, `rel="next"`) {
+					hasNext = true
+				}
+			}
+			assert.Equal(t, tc.hasNext, hasNext)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeviceDeploymentHistory(t *testing.T) {
+	created := time.Unix(1546300800, 0).UTC()
+	after := time.Unix(1546300000, 0).UTC()
+	substate := "checking"
+
+	entry := model.DeviceDeploymentHistoryEntry{
+		DeploymentID:   "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1",
+		DeploymentName: "foo",
+		ArtifactName:   "bar",
+		Status:         model.DeviceDeploymentStatusInstalling,
+		SubState:       &substate,
+		Created:        &created,
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		appQuery   *model.DeviceDeploymentHistoryQuery
+		appHistory []model.DeviceDeploymentHistoryEntry
+		appErr     error
+
+		checker mt.ResponseChecker
+		hasNext bool
+	}{
+		"ok": {
+			appQuery: &model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Limit:    21,
+			},
+			appHistory: []model.DeviceDeploymentHistoryEntry{entry},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeploymentHistoryEntry{entry}),
+		},
+		"ok, filters and next page": {
+			query: "?status=installing&created_after=1546300000&page=2&per_page=1",
+			appQuery: &model.DeviceDeploymentHistoryQuery{
+				DeviceID:     "device",
+				Status:       model.DeviceDeploymentStatusInstalling,
+				CreatedAfter: &after,
+				Skip:         1,
+				Limit:        2,
+			},
+			appHistory: []model.DeviceDeploymentHistoryEntry{entry, entry},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeploymentHistoryEntry{entry}),
+			hasNext: true,
+		},
+		"ok, empty": {
+			appQuery: &model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Limit:    21,
+			},
+			appHistory: []model.DeviceDeploymentHistoryEntry{},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeploymentHistoryEntry{}),
+		},
+		"error, unknown status": {
+			query: "?status=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown status foo")),
+		},
+		"error, invalid timestamp": {
+			query: "?created_before=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					"timestamp parsing failed for created_before parameter: invalid timestamp: foo")),
+		},
+		"error, internal": {
+			appQuery: &model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Limit:    21,
+			},
+			appErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.appQuery != nil {
+				mockApp.On("GetDeviceDeploymentHistory", mock.Anything, *tc.appQuery).
+					Return(tc.appHistory, tc.appErr)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsDeviceHistory,
+				rest.Get, d.GetDeviceDeploymentHistory)
+
+			url := strings.Replace(ApiUrlManagementDeploymentsDeviceHistory,
+				":id", "device", 1)
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+url+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+
+			hasNext := false
+			for _, link := range recorded.Recorder.HeaderMap["Link"] {
+				if strings.Contains(link, `rel="next"`) {
+					hasNext = true
+				}
+			}
+			assert.Equal(t, tc.hasNext, hasNext)
+		})
+	}
+}
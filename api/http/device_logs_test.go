@@ -0,0 +1,139 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestAppendDeploymentLogForDevice(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	timestamp := time.Unix(1546300800, 0).UTC()
+	chunk := model.LogChunk{
+		Sequence: 3,
+		Messages: []model.LogMessage{
+			{Timestamp: &timestamp, Level: "info", Message: "installing"},
+		},
+	}
+
+	testCases := map[string]struct {
+		body     interface{}
+		identity *identity.Identity
+
+		appChunk *model.LogChunk
+		appErr   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body:     chunk,
+			identity: &identity.Identity{Subject: "device", IsDevice: true},
+			appChunk: &chunk,
+			checker:  mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, no sequence number": {
+			body: map[string]interface{}{
+				"messages": chunk.Messages,
+			},
+			identity: &identity.Identity{Subject: "device", IsDevice: true},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("no sequence number: invalid log chunk")),
+		},
+		"error, no messages": {
+			body: map[string]interface{}{
+				"sequence": 1,
+				"messages": []model.LogMessage{},
+			},
+			identity: &identity.Identity{Subject: "device", IsDevice: true},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("no messages: invalid log chunk")),
+		},
+		"error, no identity": {
+			body: chunk,
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrMissingIdentity.Error())),
+		},
+		"error, deployment not found": {
+			body:     chunk,
+			identity: &identity.Identity{Subject: "device", IsDevice: true},
+			appChunk: &chunk,
+			appErr:   app.ErrModelDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(app.ErrModelDeploymentNotFound.Error())),
+		},
+		"error, internal": {
+			body:     chunk,
+			identity: &identity.Identity{Subject: "device", IsDevice: true},
+			appChunk: &chunk,
+			appErr:   errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.appChunk != nil {
+				mockApp.On("AppendDeviceDeploymentLog", mock.Anything,
+					"device", deploymentID, *tc.appChunk).
+					Return(tc.appErr)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			handler := func(w rest.ResponseWriter, r *rest.Request) {
+				if tc.identity != nil {
+					r.Request = r.WithContext(
+						identity.WithContext(r.Context(), tc.identity))
+				}
+				d.AppendDeploymentLogForDevice(w, r)
+			}
+			api := deployments_testing.SetUpTestApi(ApiUrlDevicesDeploymentsLog,
+				rest.Post, handler)
+
+			url := strings.Replace(ApiUrlDevicesDeploymentsLog, ":id", deploymentID, 1)
+			req := test.MakeSimpleRequest("POST", "http://1.2.3.4"+url, tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestPostDeploymentForDevice(t *testing.T) {
+	provides := map[string]string{
+		"artifact_name":         "foo",
+		"device_type":           "bar",
+		"rootfs-image.checksum": "abc",
+	}
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "foo",
+		DeviceType: "bar",
+		Provides:   provides,
+	}
+	instructions := &model.DeploymentInstructions{
+		ID: "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1",
+		Artifact: model.ArtifactDeploymentInstructions{
+			ArtifactName:          "baz",
+			DeviceTypesCompatible: []string{"bar"},
+		},
+	}
+
+	testCases := map[string]struct {
+		query string
+		body  interface{}
+
+		installed    *model.InstalledDeviceDeployment
+		wait         time.Duration
+		instructions *model.DeploymentInstructions
+		err          error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body:         model.DeviceProvides{Provides: provides},
+			installed:    &installed,
+			instructions: instructions,
+			checker:      mt.NewJSONResponse(http.StatusOK, nil, instructions),
+		},
+		"ok, no deployment": {
+			body:      model.DeviceProvides{Provides: provides},
+			installed: &installed,
+			checker:   mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"ok, wait": {
+			query:        "?wait=30",
+			body:         model.DeviceProvides{Provides: provides},
+			installed:    &installed,
+			wait:         30 * time.Second,
+			instructions: instructions,
+			checker:      mt.NewJSONResponse(http.StatusOK, nil, instructions),
+		},
+		"error, no provides": {
+			body: map[string]interface{}{},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrMissingDeviceProvides.Error())),
+		},
+		"error, no device type": {
+			body: model.DeviceProvides{Provides: map[string]string{
+				"artifact_name": "foo",
+			}},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					"DeviceType: non zero value required")),
+		},
+		"error, internal": {
+			body:      model.DeviceProvides{Provides: provides},
+			installed: &installed,
+			err:       errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.installed != nil && tc.wait > 0 {
+				mockApp.On("WaitForDeploymentForDevice", mock.Anything,
+					"device", *tc.installed, tc.wait).
+					Return(tc.instructions, tc.err)
+			} else if tc.installed != nil {
+				mockApp.On("GetDeploymentForDeviceWithCurrent", mock.Anything,
+					"device", *tc.installed).
+					Return(tc.instructions, tc.err)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			handler := func(w rest.ResponseWriter, r *rest.Request) {
+				r.Request = r.WithContext(identity.WithContext(r.Context(),
+					&identity.Identity{Subject: "device", IsDevice: true}))
+				d.PostDeploymentForDevice(w, r)
+			}
+			api := deployments_testing.SetUpTestApi(ApiUrlDevicesDeploymentsNext,
+				rest.Post, handler)
+
+			req := test.MakeSimpleRequest("POST", "http://1.2.3.4"+
+				ApiUrlDevicesDeploymentsNext+tc.query, tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/pointers"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestExportDeviceStatusesForDeployment(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	dds := []*model.DeviceDeployment{
+		{
+			DeviceId: pointers.StringToPointer("dev1"),
+			Status:   pointers.StringToPointer(model.DeviceDeploymentStatusPending),
+		},
+		{
+			DeviceId: pointers.StringToPointer("dev2"),
+			Status:   pointers.StringToPointer(model.DeviceDeploymentStatusSuccess),
+		},
+	}
+
+	testCases := map[string]struct {
+		accept string
+		params string
+		query  model.DeviceDeploymentsQuery
+		dds    []*model.DeviceDeployment
+		err    error
+
+		code        int
+		contentType string
+		body        string
+		checker     mt.ResponseChecker
+	}{
+		"ok, csv": {
+			accept:      "text/csv",
+			dds:         dds,
+			code:        http.StatusOK,
+			contentType: view.MediaTypeCSV,
+			body: "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n" +
+				"dev1,pending,,,,,,,false\n" +
+				"dev2,success,,,,,,,false\n",
+		},
+		"ok, ndjson": {
+			accept:      "application/x-ndjson",
+			dds:         dds,
+			code:        http.StatusOK,
+			contentType: view.MediaTypeNDJSON,
+			body: `{"id":"dev1","status":"pending","created":null,"log":false}` + "\n" +
+				`{"id":"dev2","status":"success","created":null,"log":false}` + "\n",
+		},
+		"ok, filtered and sorted": {
+			accept: "text/csv",
+			params: "?status=success&sort=finished:desc&page=2",
+			query: model.DeviceDeploymentsQuery{
+				Status:         model.DeviceDeploymentStatusSuccess,
+				SortBy:         model.DeviceDeploymentsSortFinished,
+				SortDescending: true,
+			},
+			dds:         dds[1:],
+			code:        http.StatusOK,
+			contentType: view.MediaTypeCSV,
+			body: "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n" +
+				"dev2,success,,,,,,,false\n",
+		},
+		"error, invalid filter": {
+			accept: "text/csv",
+			params: "?status=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown status foo")),
+		},
+		"error, not found": {
+			accept: "text/csv",
+			err:    app.ErrModelDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(app.ErrModelDeploymentNotFound.Error())),
+		},
+		"error, internal": {
+			accept: "application/x-ndjson",
+			err:    errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+		"error, after started": {
+			accept:      "text/csv",
+			dds:         dds,
+			err:         errors.New("connection failed"),
+			code:        http.StatusOK,
+			contentType: view.MediaTypeCSV,
+			body: "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n" +
+				"dev1,pending,,,,,,,false\n" +
+				"dev2,success,,,,,,,false\n",
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			query := tc.query
+			query.DeploymentID = deploymentID
+
+			mockApp := &app_mocks.App{}
+			// not called for invalid parameters
+			if tc.checker == nil || tc.err != nil {
+				mockApp.On("IterateDeviceStatusesForDeployment", mock.Anything,
+					query, mock.AnythingOfType("func(*model.DeviceDeployment) error")).
+					Return(func(ctx context.Context, query model.DeviceDeploymentsQuery,
+						fn func(*model.DeviceDeployment) error) error {
+						for _, dd := range tc.dds {
+							if err := fn(dd); err != nil {
+								return err
+							}
+						}
+						return tc.err
+					})
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsDevices, rest.Get,
+				d.GetDeviceStatusesForDeployment)
+
+			url := strings.Replace(ApiUrlManagementDeploymentsDevices,
+				":id", deploymentID, 1)
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+url+tc.params, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+			req.Header.Set("Accept", tc.accept)
+
+			recorded := test.RunRequest(t, api, req)
+
+			if tc.checker != nil {
+				mt.CheckResponse(t, tc.checker, recorded)
+			} else {
+				assert.Equal(t, tc.code, recorded.Recorder.Code)
+				assert.Equal(t, tc.contentType,
+					recorded.Recorder.HeaderMap.Get("Content-Type"))
+				assert.Equal(t, tc.body, recorded.Recorder.Body.String())
+			}
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
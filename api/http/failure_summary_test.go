@@ -0,0 +1,114 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeploymentFailureSummary(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	summary := &model.FailureSummary{
+		Failed: 2,
+		BySubState: []model.FailureGroup{
+			{Key: "", Count: 2, SampleDevices: []string{"dev1", "dev2"}},
+		},
+		ByDeviceType: []model.FailureGroup{
+			{Key: "rpi3", Count: 2, SampleDevices: []string{"dev1", "dev2"}},
+		},
+		BySignature: []model.FailureGroup{
+			{Key: "disk full", Count: 1, SampleDevices: []string{"dev1"}},
+			{Key: "timeout after <n>s", Count: 1, SampleDevices: []string{"dev2"}},
+		},
+	}
+
+	testCases := map[string]struct {
+		id      string
+		call    bool
+		summary *model.FailureSummary
+		err     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			id:      deploymentID,
+			call:    true,
+			summary: summary,
+			checker: mt.NewJSONResponse(http.StatusOK, nil, summary),
+		},
+		"error, not found": {
+			id:   deploymentID,
+			call: true,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(view.ErrNotFound.Error())),
+		},
+		"error, bad id": {
+			id: "foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, internal": {
+			id:   deploymentID,
+			call: true,
+			err:  errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.call {
+				mockApp.On("GetDeploymentFailureSummary", mock.Anything,
+					tc.id).Return(tc.summary, tc.err)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsFailures, rest.Get,
+				d.GetDeploymentFailureSummary)
+
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+
+				strings.Replace(ApiUrlManagementDeploymentsFailures,
+					":id", tc.id, 1), nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestSubmitGatewayReports(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	gateway := &identity.Identity{Subject: "gateway", IsDevice: true}
+
+	report := func(device string) map[string]interface{} {
+		return map[string]interface{}{
+			"deployment_id": deploymentID,
+			"device_id":     device,
+			"status":        map[string]interface{}{"status": "success"},
+		}
+	}
+	appReport := func(device string) model.GatewayReport {
+		return model.GatewayReport{
+			DeploymentID: deploymentID,
+			DeviceID:     device,
+			Status: &model.StatusReport{
+				Status: model.DeviceDeploymentStatusSuccess,
+			},
+		}
+	}
+
+	tooMany := make([]interface{}, maxGatewayReports+1)
+	for i := range tooMany {
+		tooMany[i] = report("a")
+	}
+
+	testCases := map[string]struct {
+		body     interface{}
+		identity *identity.Identity
+
+		appReports []model.GatewayReport
+		appResults []error
+		appErr     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: []interface{}{
+				report("a"),
+				map[string]interface{}{
+					"deployment_id": deploymentID,
+					"device_id":     "b",
+					"status":        map[string]interface{}{"status": "bogus"},
+				},
+				report("c"),
+				report("d"),
+				report("e"),
+				report("f"),
+			},
+			identity: gateway,
+			appReports: []model.GatewayReport{
+				appReport("a"),
+				appReport("c"),
+				appReport("d"),
+				appReport("e"),
+				appReport("f"),
+			},
+			appResults: []error{
+				nil,
+				app.ErrGatewayNotAuthorized,
+				app.ErrDeploymentAborted,
+				app.ErrModelDeploymentNotFound,
+				errors.New("connection failed"),
+			},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]gatewayReportResult{
+					{
+						DeploymentID: deploymentID,
+						DeviceID:     "a",
+						Code:         http.StatusNoContent,
+					},
+					{
+						Code:  http.StatusBadRequest,
+						Error: model.ErrBadStatus.Error(),
+					},
+					{
+						DeploymentID: deploymentID,
+						DeviceID:     "c",
+						Code:         http.StatusForbidden,
+						Error:        app.ErrGatewayNotAuthorized.Error(),
+					},
+					{
+						DeploymentID: deploymentID,
+						DeviceID:     "d",
+						Code:         http.StatusConflict,
+						Error:        app.ErrDeploymentAborted.Error(),
+					},
+					{
+						DeploymentID: deploymentID,
+						DeviceID:     "e",
+						Code:         http.StatusNotFound,
+						Error:        app.ErrModelDeploymentNotFound.Error(),
+					},
+					{
+						DeploymentID: deploymentID,
+						DeviceID:     "f",
+						Code:         http.StatusInternalServerError,
+						Error:        "internal error",
+					},
+				}),
+		},
+		"error, no identity": {
+			body: []interface{}{report("a")},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrMissingIdentity.Error())),
+		},
+		"error, no reports": {
+			body:     []interface{}{},
+			identity: gateway,
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrNoGatewayReports.Error())),
+		},
+		"error, too many reports": {
+			body:     tooMany,
+			identity: gateway,
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("limit is 100: Too many reports")),
+		},
+		"error, internal": {
+			body:       []interface{}{report("a")},
+			identity:   gateway,
+			appReports: []model.GatewayReport{appReport("a")},
+			appErr:     errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.appReports != nil {
+				mockApp.On("SubmitGatewayReports", mock.Anything,
+					"gateway", tc.appReports).
+					Return(tc.appResults, tc.appErr)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			handler := func(w rest.ResponseWriter, r *rest.Request) {
+				if tc.identity != nil {
+					r.Request = r.WithContext(
+						identity.WithContext(r.Context(), tc.identity))
+				}
+				d.SubmitGatewayReports(w, r)
+			}
+			api := deployments_testing.SetUpTestApi(ApiUrlDevicesGatewayReports,
+				rest.Post, handler)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4"+ApiUrlDevicesGatewayReports, tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGatewayDevices(t *testing.T) {
+	url := strings.Replace(ApiUrlManagementGatewayDevices, ":id", "gateway", 1)
+
+	devices := model.GatewayDevices{Devices: []string{"a", "b"}}
+
+	testCases := map[string]struct {
+		method string
+		body   interface{}
+
+		appDevices *model.GatewayDevices
+		appErr     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, set": {
+			method:     http.MethodPut,
+			body:       devices,
+			appDevices: &devices,
+			checker:    mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"ok, set none": {
+			method:     http.MethodPut,
+			body:       map[string]interface{}{},
+			appDevices: &model.GatewayDevices{Devices: []string{}},
+			checker:    mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, set empty device id": {
+			method: http.MethodPut,
+			body:   model.GatewayDevices{Devices: []string{""}},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("empty device ID")),
+		},
+		"error, set internal": {
+			method:     http.MethodPut,
+			body:       devices,
+			appDevices: &devices,
+			appErr:     errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+		"ok, get": {
+			method:     http.MethodGet,
+			appDevices: &devices,
+			checker:    mt.NewJSONResponse(http.StatusOK, nil, devices),
+		},
+		"error, get not found": {
+			method: http.MethodGet,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError("Resource not found")),
+		},
+		"error, get internal": {
+			method: http.MethodGet,
+			appErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			var api http.Handler
+			if tc.method == http.MethodPut {
+				if tc.appDevices != nil {
+					mockApp.On("SetGatewayDevices", mock.Anything,
+						"gateway", *tc.appDevices).Return(tc.appErr)
+				}
+				api = deployments_testing.SetUpTestApi(
+					ApiUrlManagementGatewayDevices, rest.Put,
+					d.SetGatewayDevices)
+			} else {
+				mockApp.On("GetGatewayDevices", mock.Anything, "gateway").
+					Return(tc.appDevices, tc.appErr)
+				api = deployments_testing.SetUpTestApi(
+					ApiUrlManagementGatewayDevices, rest.Get,
+					d.GetGatewayDevices)
+			}
+
+			req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+url,
+				tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
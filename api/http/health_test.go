@@ -0,0 +1,106 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestAlive(t *testing.T) {
+	d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+		new(view.RESTView), &app_mocks.App{})
+
+	api := deployments_testing.SetUpTestApi(ApiUrlInternalAlive, rest.Get, d.AliveHandler)
+
+	recorded := test.RunRequest(t, api,
+		test.MakeSimpleRequest("GET", "http://1.2.3.4"+ApiUrlInternalAlive, nil))
+	recorded.CodeIs(http.StatusNoContent)
+}
+
+func TestHealthCheck(t *testing.T) {
+	okReport := model.NewHealthReport(
+		model.NewDependencyHealth(model.HealthDependencyDatabase, time.Millisecond, nil),
+		model.NewDependencyHealth(model.HealthDependencyFileStorage, time.Second, nil),
+	)
+	errReport := model.NewHealthReport(
+		model.NewDependencyHealth(model.HealthDependencyDatabase, time.Millisecond, nil),
+		model.NewDependencyHealth(model.HealthDependencyFileStorage, time.Second,
+			errors.New("bucket not found")),
+	)
+
+	testCases := map[string]struct {
+		report  *model.HealthReport
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			report: okReport,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				map[string]interface{}{
+					"status": "ok",
+					"dependencies": []map[string]interface{}{
+						{"name": "mongo", "status": "ok", "latency": "1ms"},
+						{"name": "storage", "status": "ok", "latency": "1s"},
+					},
+				}),
+		},
+		"error": {
+			report: errReport,
+			checker: mt.NewJSONResponse(http.StatusServiceUnavailable, nil,
+				map[string]interface{}{
+					"status": "error",
+					"dependencies": []map[string]interface{}{
+						{"name": "mongo", "status": "ok", "latency": "1ms"},
+						{"name": "storage", "status": "error", "latency": "1s",
+							"error": "bucket not found"},
+					},
+				}),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			app := &app_mocks.App{}
+			app.On("HealthCheck", deployments_testing.ContextMatcher()).
+				Return(tc.report)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), app)
+
+			api := deployments_testing.SetUpTestApi(ApiUrlInternalHealth,
+				rest.Get, d.HealthCheckHandler)
+
+			recorded := test.RunRequest(t, api,
+				test.MakeSimpleRequest("GET", "http://1.2.3.4"+ApiUrlInternalHealth, nil))
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			app.AssertExpectations(t)
+		})
+	}
+}
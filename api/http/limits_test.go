@@ -20,11 +20,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/requestlog"
 	"github.com/stretchr/testify/assert"
@@ -118,3 +120,96 @@ func TestGetLimits(t *testing.T) {
 		})
 	}
 }
+
+func TestSetLimitForTenant(t *testing.T) {
+
+	testCases := []struct {
+		name   string
+		tenant string
+		body   interface{}
+		code   int
+		limit  *model.Limit
+		err    error
+	}{
+		{
+			name:   "retention_days",
+			tenant: "foo",
+			body:   map[string]interface{}{"limit": 30},
+			code:   http.StatusNoContent,
+			limit: &model.Limit{
+				Name:  "retention_days",
+				Value: 30,
+			},
+		},
+		{
+			name:   "retention_days",
+			tenant: "foo",
+			body:   map[string]interface{}{"limit": 0},
+			code:   http.StatusNoContent,
+			limit: &model.Limit{
+				Name:  "retention_days",
+				Value: 0,
+			},
+		},
+		{
+			name:   "storage",
+			tenant: "foo",
+			body:   map[string]interface{}{"limit": 100},
+			code:   http.StatusInternalServerError,
+			limit: &model.Limit{
+				Name:  "storage",
+				Value: 100,
+			},
+			err: errors.New("failed"),
+		},
+		{
+			name:   "retention_days",
+			tenant: "foo",
+			body:   map[string]interface{}{},
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "retention_days",
+			tenant: "foo",
+			body:   map[string]interface{}{"limit": -1},
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "foobar",
+			tenant: "foo",
+			body:   map[string]interface{}{"limit": 1},
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			app := &app_mocks.App{}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), app)
+
+			api := setUpRestTest(ApiUrlInternalTenantLimitsName, rest.Put,
+				d.SetLimitForTenantHandler)
+
+			if tc.limit != nil {
+				app.On("SetLimit",
+					mock.MatchedBy(func(ctx context.Context) bool {
+						id := identity.FromContext(ctx)
+						return id != nil && id.Tenant == tc.tenant
+					}),
+					*tc.limit).
+					Return(tc.err)
+			}
+
+			url := strings.NewReplacer(":tenant", tc.tenant, ":name", tc.name).
+				Replace(ApiUrlInternalTenantLimitsName)
+			recorded := test.RunRequest(t, api.MakeHandler(),
+				test.MakeSimpleRequest("PUT", "http://localhost"+url, tc.body))
+			recorded.CodeIs(tc.code)
+			app.AssertExpectations(t)
+		})
+	}
+}
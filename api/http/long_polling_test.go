@@ -0,0 +1,130 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeploymentForDeviceWait(t *testing.T) {
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "foo",
+		DeviceType: "bar",
+	}
+	instructions := &model.DeploymentInstructions{
+		ID: "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1",
+		Artifact: model.ArtifactDeploymentInstructions{
+			ArtifactName:          "baz",
+			DeviceTypesCompatible: []string{"bar"},
+		},
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		wait         time.Duration
+		instructions *model.DeploymentInstructions
+		err          error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, no wait": {
+			instructions: instructions,
+			checker:      mt.NewJSONResponse(http.StatusOK, nil, instructions),
+		},
+		"ok, wait": {
+			query:        "&wait=30",
+			wait:         30 * time.Second,
+			instructions: instructions,
+			checker:      mt.NewJSONResponse(http.StatusOK, nil, instructions),
+		},
+		"ok, wait timed out": {
+			query:   "&wait=30",
+			wait:    30 * time.Second,
+			checker: mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"ok, zero wait": {
+			query:   "&wait=0",
+			checker: mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, invalid wait": {
+			query: "&wait=-1",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrInvalidWaitParam.Error())),
+		},
+		"error, internal": {
+			query: "&wait=30",
+			wait:  30 * time.Second,
+			err:   errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("GetDeploymentForDeviceWithCurrent", mock.Anything,
+				"device", installed).Return(tc.instructions, tc.err)
+			mockApp.On("WaitForDeploymentForDevice", mock.Anything,
+				"device", installed, tc.wait).Return(tc.instructions, tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			handler := func(w rest.ResponseWriter, r *rest.Request) {
+				r.Request = r.WithContext(identity.WithContext(r.Context(),
+					&identity.Identity{Subject: "device", IsDevice: true}))
+				d.GetDeploymentForDevice(w, r)
+			}
+			api := deployments_testing.SetUpTestApi(ApiUrlDevicesDeploymentsNext,
+				rest.Get, handler)
+
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+
+				ApiUrlDevicesDeploymentsNext+
+				"?artifact_name=foo&device_type=bar"+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.wait > 0 {
+				mockApp.AssertNotCalled(t, "GetDeploymentForDeviceWithCurrent",
+					mock.Anything, mock.Anything, mock.Anything)
+			} else {
+				mockApp.AssertNotCalled(t, "WaitForDeploymentForDevice",
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestLookupDeployment(t *testing.T) {
+	created := time.Unix(1546300800, 0).UTC()
+	finishedAfter := time.Unix(1546300000, 0).UTC()
+
+	name, artifact, id := "foo", "bar", "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+	deployment := &model.Deployment{
+		DeploymentConstructor: &model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+		},
+		Id:          &id,
+		Created:     &created,
+		DeviceCount: 2,
+		Stats:       model.NewDeviceDeploymentStats(),
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		appQuery       *model.Query
+		appDeployments []*model.Deployment
+		appTotal       int
+		appErr         error
+
+		checker mt.ResponseChecker
+		total   string
+		hasNext bool
+	}{
+		"ok": {
+			appQuery: &model.Query{
+				Limit: 20,
+			},
+			appDeployments: []*model.Deployment{deployment},
+			appTotal:       1,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]*model.Deployment{deployment}),
+			total: "1",
+		},
+		"ok, filters, sorting and next page": {
+			query: "?status=aborted&artifact_name=bar&device_id=dev1" +
+				"&finished_after=1546300000&sort=finished:desc&page=2&per_page=1",
+			appQuery: &model.Query{
+				Status:         model.StatusQueryAborted,
+				ArtifactName:   "bar",
+				DeviceID:       "dev1",
+				FinishedAfter:  &finishedAfter,
+				SortBy:         model.DeploymentsSortFinished,
+				SortDescending: true,
+				Skip:           1,
+				Limit:          1,
+			},
+			appDeployments: []*model.Deployment{deployment},
+			appTotal:       3,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]*model.Deployment{deployment}),
+			total:   "3",
+			hasNext: true,
+		},
+		"ok, empty": {
+			query: "?sort=created",
+			appQuery: &model.Query{
+				SortBy: model.DeploymentsSortCreated,
+				Limit:  20,
+			},
+			appDeployments: []*model.Deployment{},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]*model.Deployment{}),
+			total: "0",
+		},
+		"error, invalid timestamp": {
+			query: "?finished_before=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					"timestamp parsing failed for finished_before parameter: invalid timestamp: foo")),
+		},
+		"error, unknown sort field": {
+			query: "?sort=name",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError("unknown sort field name")),
+		},
+		"error, app": {
+			appQuery: &model.Query{
+				Limit: 20,
+			},
+			appErr: errors.New("searching for deployments: connection failed"),
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					"searching for deployments: connection failed")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.appQuery != nil {
+				mockApp.On("LookupDeployment", mock.Anything, *tc.appQuery).
+					Return(tc.appDeployments, tc.appTotal, tc.appErr)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeployments, rest.Get, d.LookupDeployment)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4"+ApiUrlManagementDeployments+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+
+			assert.Equal(t, tc.total,
+				recorded.Recorder.HeaderMap.Get(view.HttpHeaderTotalCount))
+			hasNext := false
+			for _, link := range recorded.Recorder.HeaderMap["Link"] {
+				if strings.Contains(link, `rel="next"`) {
+					hasNext = true
+				}
+			}
+			assert.Equal(t, tc.hasNext, hasNext)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	windows := model.MaintenanceWindows{
+		Windows: []model.MaintenanceWindow{{
+			Start:    "02:00",
+			End:      "04:00",
+			TimeZone: "Europe/Oslo",
+			Weekdays: []string{"monday"},
+		}},
+	}
+	none := model.MaintenanceWindows{Windows: []model.MaintenanceWindow{}}
+
+	testCases := map[string]struct {
+		method string
+		device bool
+		body   interface{}
+
+		appWindows *model.MaintenanceWindows
+		appErr     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, set for the tenant": {
+			method:     http.MethodPut,
+			body:       windows,
+			appWindows: &windows,
+			checker:    mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"ok, set none for the device": {
+			method:     http.MethodPut,
+			device:     true,
+			body:       map[string]interface{}{},
+			appWindows: &none,
+			checker:    mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, set invalid window": {
+			method: http.MethodPut,
+			body: model.MaintenanceWindows{
+				Windows: []model.MaintenanceWindow{{Start: "2", End: "04:00"}},
+			},
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					`start "2": invalid maintenance window`)),
+		},
+		"error, set internal": {
+			method:     http.MethodPut,
+			device:     true,
+			body:       windows,
+			appWindows: &windows,
+			appErr:     errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+		"ok, get for the device": {
+			method:     http.MethodGet,
+			device:     true,
+			appWindows: &windows,
+			checker:    mt.NewJSONResponse(http.StatusOK, nil, windows),
+		},
+		"ok, get never set": {
+			method:  http.MethodGet,
+			checker: mt.NewJSONResponse(http.StatusOK, nil, none),
+		},
+		"error, get internal": {
+			method: http.MethodGet,
+			appErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			route := ApiUrlManagementMaintenanceWindows
+			url := ApiUrlManagementMaintenanceWindows
+			var handler rest.HandlerFunc
+			switch {
+			case tc.method == http.MethodPut && tc.device:
+				route = ApiUrlManagementDeviceMaintenanceWindows
+				handler = d.SetDeviceMaintenanceWindows
+				if tc.appWindows != nil {
+					mockApp.On("SetDeviceMaintenanceWindows", mock.Anything,
+						"device", *tc.appWindows).Return(tc.appErr)
+				}
+			case tc.method == http.MethodPut:
+				handler = d.SetTenantMaintenanceWindows
+				if tc.appWindows != nil {
+					mockApp.On("SetTenantMaintenanceWindows", mock.Anything,
+						*tc.appWindows).Return(tc.appErr)
+				}
+			case tc.device:
+				route = ApiUrlManagementDeviceMaintenanceWindows
+				handler = d.GetDeviceMaintenanceWindows
+				mockApp.On("GetDeviceMaintenanceWindows", mock.Anything,
+					"device").Return(tc.appWindows, tc.appErr)
+			default:
+				handler = d.GetTenantMaintenanceWindows
+				mockApp.On("GetTenantMaintenanceWindows", mock.Anything).
+					Return(tc.appWindows, tc.appErr)
+			}
+			if tc.device {
+				url = strings.Replace(route, ":id", "device", 1)
+			}
+
+			var api http.Handler
+			if tc.method == http.MethodPut {
+				api = deployments_testing.SetUpTestApi(route, rest.Put, handler)
+			} else {
+				api = deployments_testing.SetUpTestApi(route, rest.Get, handler)
+			}
+
+			req := test.MakeSimpleRequest(tc.method, "http://1.2.3.4"+url,
+				tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
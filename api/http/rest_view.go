@@ -19,6 +19,7 @@ import (
 	"github.com/mendersoftware/go-lib-micro/log"
 
 	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
 )
 
 type RESTView interface {
@@ -32,4 +33,7 @@ type RESTView interface {
 	RenderDeploymentLog(w rest.ResponseWriter, dlog model.DeploymentLog)
 	RenderSuccessDelete(w rest.ResponseWriter)
 	RenderSuccessPut(w rest.ResponseWriter)
+	NegotiateMediaType(r *rest.Request, offers ...string) string
+	NewDeviceDeploymentEncoder(w rest.ResponseWriter,
+		mediaType string) (view.DeviceDeploymentEncoder, error)
 }
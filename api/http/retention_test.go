@@ -0,0 +1,178 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestListArchivedDeployments(t *testing.T) {
+	created := time.Unix(1546300800, 0).UTC()
+	archived := model.ArchivedDeployment{
+		Id:           "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1",
+		Name:         "foo",
+		ArtifactName: "bar",
+		Created:      &created,
+		Finished:     &created,
+		DeviceCount:  2,
+		Archived:     created,
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		skip, limit int
+		archived    []model.ArchivedDeployment
+		err         error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			limit:    21,
+			archived: []model.ArchivedDeployment{archived},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.ArchivedDeployment{archived}),
+		},
+		"ok, page": {
+			query:    "?page=3&per_page=1",
+			skip:     2,
+			limit:    2,
+			archived: []model.ArchivedDeployment{archived, archived},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.ArchivedDeployment{archived}),
+		},
+		"error, internal": {
+			limit: 21,
+			err:   errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("ListArchivedDeployments", mock.Anything, tc.skip, tc.limit).
+				Return(tc.archived, tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(ApiUrlManagementDeploymentsArchived,
+				rest.Get, d.ListArchivedDeployments)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4"+ApiUrlManagementDeploymentsArchived+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestRestoreArchivedDeployment(t *testing.T) {
+	const id = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	testCases := map[string]struct {
+		id string
+
+		callApp bool
+		err     error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			id:      id,
+			callApp: true,
+			checker: mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, invalid id": {
+			id: "foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, not found": {
+			id:      id,
+			callApp: true,
+			err:     app.ErrModelArchivedDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(app.ErrModelArchivedDeploymentNotFound.Error())),
+		},
+		"error, deployment exists": {
+			id:      id,
+			callApp: true,
+			err:     app.ErrModelDeploymentExists,
+			checker: mt.NewJSONResponse(http.StatusConflict, nil,
+				deployments_testing.RestError(app.ErrModelDeploymentExists.Error())),
+		},
+		"error, internal": {
+			id:      id,
+			callApp: true,
+			err:     errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.callApp {
+				mockApp.On("RestoreArchivedDeployment", mock.Anything, tc.id).
+					Return(tc.err)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsArchivedRestore,
+				rest.Post, d.RestoreArchivedDeployment)
+
+			url := strings.Replace(ApiUrlManagementDeploymentsArchivedRestore,
+				":id", tc.id, 1)
+			req := test.MakeSimpleRequest("POST", "http://1.2.3.4"+url, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
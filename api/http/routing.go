@@ -15,9 +15,14 @@
 package http
 
 import (
+	"context"
+	"time"
+
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
 
 	"github.com/mendersoftware/deployments/app"
 	dconfig "github.com/mendersoftware/deployments/config"
@@ -39,22 +44,44 @@ const (
 	ApiUrlManagementDeployments           = ApiUrlManagement + "/deployments"
 	ApiUrlManagementDeploymentsId         = ApiUrlManagement + "/deployments/:id"
 	ApiUrlManagementDeploymentsStatistics = ApiUrlManagement + "/deployments/:id/statistics"
+	ApiUrlManagementDeploymentsTimeline   = ApiUrlManagement + "/deployments/:id/statistics/timeline"
+	ApiUrlManagementDeploymentsFailures   = ApiUrlManagement + "/deployments/:id/statistics/failures"
+	ApiUrlManagementDeploymentsProgress   = ApiUrlManagement + "/deployments/:id/statistics/progress"
 	ApiUrlManagementDeploymentsStatus     = ApiUrlManagement + "/deployments/:id/status"
 	ApiUrlManagementDeploymentsDevices    = ApiUrlManagement + "/deployments/:id/devices"
 	ApiUrlManagementDeploymentsLog        = ApiUrlManagement + "/deployments/:id/devices/:devid/log"
 	ApiUrlManagementDeploymentsDeviceId   = ApiUrlManagement + "/deployments/devices/:id"
 
+	ApiUrlManagementDeploymentsTransitions = ApiUrlManagement + "/deployments/:id/devices/:devid/transitions"
+
+	ApiUrlManagementDeploymentsDeviceHistory = ApiUrlManagement + "/deployments/devices/:id/history"
+
+	ApiUrlManagementDeploymentsArchived        = ApiUrlManagement + "/deployments/archived"
+	ApiUrlManagementDeploymentsArchivedRestore = ApiUrlManagement + "/deployments/archived/:id/restore"
+
 	ApiUrlManagementReleases = ApiUrlManagement + "/deployments/releases"
 
 	ApiUrlManagementLimitsName = ApiUrlManagement + "/limits/:name"
 
+	ApiUrlManagementGatewayDevices = ApiUrlManagement + "/gateways/:id/devices"
+
+	ApiUrlManagementMaintenanceWindows       = ApiUrlManagement + "/maintenance_windows"
+	ApiUrlManagementDeviceMaintenanceWindows = ApiUrlManagement + "/deployments/devices/:id/maintenance_windows"
+
 	ApiUrlDevicesDeploymentsNext  = ApiUrlDevices + "/device/deployments/next"
 	ApiUrlDevicesDeploymentStatus = ApiUrlDevices + "/device/deployments/:id/status"
 	ApiUrlDevicesDeploymentsLog   = ApiUrlDevices + "/device/deployments/:id/log"
+	ApiUrlDevicesGatewayReports   = ApiUrlDevices + "/device/gateway/reports"
 
 	ApiUrlInternalTenants           = ApiUrlInternal + "/tenants"
+	ApiUrlInternalTenant            = ApiUrlInternal + "/tenants/:tenant"
+	ApiUrlInternalTenantDeprovision = ApiUrlInternal + "/tenants/:tenant/deprovisioning"
 	ApiUrlInternalTenantDeployments = ApiUrlInternal + "/tenants/:tenant/deployments"
 	ApiUrlInternalTenantArtifacts   = ApiUrlInternal + "/tenants/:tenant/artifacts"
+	ApiUrlInternalTenantLimitsName  = ApiUrlInternal + "/tenants/:tenant/limits/:name"
+	ApiUrlInternalHealth            = ApiUrlInternal + "/health"
+	ApiUrlInternalAlive             = ApiUrlInternal + "/alive"
+	ApiUrlInternalStatsRecompute    = ApiUrlInternal + "/stats/recompute"
 )
 
 func SetupS3(c config.Reader) (s3.FileStorage, error) {
@@ -92,7 +119,22 @@ func NewRouter(c config.Reader) (rest.App, error) {
 	}
 	mongoStorage := mongo.NewDataStoreMongoWithSession(dbSession)
 
-	app := app.NewDeployments(mongoStorage, fileStorage, app.ArtifactContentType)
+	app := app.NewDeployments(mongoStorage, fileStorage, app.ArtifactContentType).
+		WithLogsInFileStorage(c.GetBool(dconfig.SettingDeviceLogsFileStorage)).
+		WithLenientStatusTransitions(c.GetBool(dconfig.SettingStatusTransitionsLenient)).
+		WithMaxDeviceWait(c.GetDuration(dconfig.SettingDeviceWaitMax)).
+		WithAdmissionTimeout(c.GetDuration(dconfig.SettingMaxConcurrentAdmissionTimeout))
+
+	switch notifier := c.GetString(dconfig.SettingDeviceWaitNotifier); notifier {
+	case dconfig.DeviceWaitNotifierLocal:
+	case dconfig.DeviceWaitNotifierMongo:
+		mongoNotifier := mongo.NewDeploymentNotifier(dbSession)
+		app = app.WithDeploymentNotifier(mongoNotifier)
+		go watchDeploymentNotifications(mongoNotifier, app.WakeDevices)
+	default:
+		return nil, errors.Errorf("invalid %s: %s",
+			dconfig.SettingDeviceWaitNotifier, notifier)
+	}
 
 	deploymentsHandlers := NewDeploymentsApiHandlers(mongoStorage, new(view.RESTView), app)
 
@@ -102,8 +144,12 @@ func NewRouter(c config.Reader) (rest.App, error) {
 	limitsRoutes := NewLimitsResourceRoutes(deploymentsHandlers)
 	tenantsRoutes := TenantRoutes(deploymentsHandlers)
 	releasesRoutes := ReleasesRoutes(deploymentsHandlers)
+	healthRoutes := HealthRoutes(deploymentsHandlers)
+	statsRoutes := StatsRoutes(deploymentsHandlers)
 
 	routes := append(releasesRoutes, deploymentsRoutes...)
+	routes = append(routes, healthRoutes...)
+	routes = append(routes, statsRoutes...)
 	routes = append(routes, limitsRoutes...)
 	routes = append(routes, tenantsRoutes...)
 	routes = append(routes, imageRoutes...)
@@ -111,6 +157,23 @@ func NewRouter(c config.Reader) (rest.App, error) {
 	return rest.MakeRouter(restutil.AutogenOptionsRoutes(restutil.NewOptionsHandler, routes...)...)
 }
 
+// Delay before watching deployment notifications again after a failure
+const watchRetryInterval = 10 * time.Second
+
+// watchDeploymentNotifications wakes the devices waiting on this replica
+// whenever any replica creates a deployment or frees a slot in one;
+// reconnects on errors.
+func watchDeploymentNotifications(notifier *mongo.DeploymentNotifier,
+	wake func(tenant string, devices []string)) {
+
+	l := log.New(log.Ctx{})
+	for {
+		err := notifier.Watch(context.Background(), wake)
+		l.Errorf("watching deployment notifications: %v", err)
+		time.Sleep(watchRetryInterval)
+	}
+}
+
 func NewImagesResourceRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
 
 	if controller == nil {
@@ -140,22 +203,53 @@ func NewDeploymentsResourceRoutes(controller *DeploymentsApiHandlers) []*rest.Ro
 		// Deployments
 		rest.Post(ApiUrlManagementDeployments, controller.PostDeployment),
 		rest.Get(ApiUrlManagementDeployments, controller.LookupDeployment),
+		// defined before ApiUrlManagementDeploymentsId, which matches as well
+		rest.Get(ApiUrlManagementDeploymentsArchived,
+			controller.ListArchivedDeployments),
+		rest.Post(ApiUrlManagementDeploymentsArchivedRestore,
+			controller.RestoreArchivedDeployment),
 		rest.Get(ApiUrlManagementDeploymentsId, controller.GetDeployment),
 		rest.Get(ApiUrlManagementDeploymentsStatistics, controller.GetDeploymentStats),
+		rest.Get(ApiUrlManagementDeploymentsTimeline, controller.GetDeploymentStatsTimeline),
+		rest.Get(ApiUrlManagementDeploymentsFailures, controller.GetDeploymentFailureSummary),
+		rest.Get(ApiUrlManagementDeploymentsProgress, controller.GetDeploymentProgress),
 		rest.Put(ApiUrlManagementDeploymentsStatus, controller.AbortDeployment),
 		rest.Get(ApiUrlManagementDeploymentsDevices,
 			controller.GetDeviceStatusesForDeployment),
 		rest.Get(ApiUrlManagementDeploymentsLog,
 			controller.GetDeploymentLogForDevice),
+		rest.Get(ApiUrlManagementDeploymentsTransitions,
+			controller.GetDeviceDeploymentTransitions),
 		rest.Delete(ApiUrlManagementDeploymentsDeviceId,
 			controller.DecommissionDevice),
+		rest.Get(ApiUrlManagementDeploymentsDeviceHistory,
+			controller.GetDeviceDeploymentHistory),
 
 		// Devices
 		rest.Get(ApiUrlDevicesDeploymentsNext, controller.GetDeploymentForDevice),
+		rest.Post(ApiUrlDevicesDeploymentsNext, controller.PostDeploymentForDevice),
 		rest.Put(ApiUrlDevicesDeploymentStatus,
 			controller.PutDeploymentStatusForDevice),
 		rest.Put(ApiUrlDevicesDeploymentsLog,
 			controller.PutDeploymentLogForDevice),
+		rest.Post(ApiUrlDevicesDeploymentsLog,
+			controller.AppendDeploymentLogForDevice),
+		rest.Post(ApiUrlDevicesGatewayReports,
+			controller.SubmitGatewayReports),
+
+		// Gateways
+		rest.Put(ApiUrlManagementGatewayDevices, controller.SetGatewayDevices),
+		rest.Get(ApiUrlManagementGatewayDevices, controller.GetGatewayDevices),
+
+		// Maintenance windows
+		rest.Put(ApiUrlManagementMaintenanceWindows,
+			controller.SetTenantMaintenanceWindows),
+		rest.Get(ApiUrlManagementMaintenanceWindows,
+			controller.GetTenantMaintenanceWindows),
+		rest.Put(ApiUrlManagementDeviceMaintenanceWindows,
+			controller.SetDeviceMaintenanceWindows),
+		rest.Get(ApiUrlManagementDeviceMaintenanceWindows,
+			controller.GetDeviceMaintenanceWindows),
 	}
 }
 
@@ -178,8 +272,11 @@ func TenantRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
 
 	return []*rest.Route{
 		rest.Post(ApiUrlInternalTenants, controller.ProvisionTenantsHandler),
+		rest.Delete(ApiUrlInternalTenant, controller.DeprovisionTenantHandler),
+		rest.Get(ApiUrlInternalTenantDeprovision, controller.GetTenantDeprovisioningHandler),
 		rest.Get(ApiUrlInternalTenantDeployments, controller.DeploymentsPerTenantHandler),
 		rest.Post(ApiUrlInternalTenantArtifacts, controller.NewImageForTenantHandler),
+		rest.Put(ApiUrlInternalTenantLimitsName, controller.SetLimitForTenantHandler),
 	}
 }
 
@@ -192,3 +289,24 @@ func ReleasesRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
 		rest.Get(ApiUrlManagementReleases, controller.GetReleases),
 	}
 }
+
+func HealthRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
+	if controller == nil {
+		return []*rest.Route{}
+	}
+
+	return []*rest.Route{
+		rest.Get(ApiUrlInternalAlive, controller.AliveHandler),
+		rest.Get(ApiUrlInternalHealth, controller.HealthCheckHandler),
+	}
+}
+
+func StatsRoutes(controller *DeploymentsApiHandlers) []*rest.Route {
+	if controller == nil {
+		return []*rest.Route{}
+	}
+
+	return []*rest.Route{
+		rest.Post(ApiUrlInternalStatsRecompute, controller.RecomputeStatsHandler),
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestRecomputeStats(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	correction := model.StatsCorrection{
+		Tenant:       "foo",
+		DeploymentID: deploymentID,
+		OldStats:     model.Stats{"pending": 1},
+		NewStats:     model.Stats{"pending": 0, "success": 1},
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		tenant       string
+		deploymentID string
+		allTenants   bool
+		corrections  []model.StatsCorrection
+		err          error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, all tenants": {
+			allTenants:  true,
+			corrections: []model.StatsCorrection{correction},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.StatsCorrection{correction}),
+		},
+		"ok, tenant": {
+			query:       "?tenant_id=foo",
+			tenant:      "foo",
+			corrections: []model.StatsCorrection{},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.StatsCorrection{}),
+		},
+		"ok, deployment": {
+			query:        "?tenant_id=foo&deployment_id=" + deploymentID,
+			tenant:       "foo",
+			deploymentID: deploymentID,
+			corrections:  []model.StatsCorrection{correction},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.StatsCorrection{correction}),
+		},
+		"error, invalid deployment id": {
+			query: "?deployment_id=foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, deployment not found": {
+			query:        "?deployment_id=" + deploymentID,
+			deploymentID: deploymentID,
+			err:          app.ErrModelDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(app.ErrModelDeploymentNotFound.Error())),
+		},
+		"error, internal": {
+			allTenants: true,
+			err:        errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			tenantMatcher := mock.MatchedBy(func(ctx context.Context) bool {
+				id := identity.FromContext(ctx)
+				if tc.tenant == "" {
+					return id == nil
+				}
+				return id != nil && id.Tenant == tc.tenant
+			})
+
+			mockApp := &app_mocks.App{}
+			if tc.allTenants {
+				mockApp.On("RecomputeStatsAllTenants", tenantMatcher).
+					Return(tc.corrections, tc.err)
+			} else {
+				mockApp.On("RecomputeStats", tenantMatcher, tc.deploymentID).
+					Return(tc.corrections, tc.err)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(ApiUrlInternalStatsRecompute,
+				rest.Post, d.RecomputeStatsHandler)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4"+ApiUrlInternalStatsRecompute+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestGetDeploymentStats(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	testCases := map[string]struct {
+		id string
+
+		stats    model.Stats
+		statsErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			id:    deploymentID,
+			stats: model.Stats{"pending": 1, "downloading": 2},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				map[string]interface{}{"pending": 1, "downloading": 2}),
+		},
+		"error, invalid id": {
+			id: "foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, not found": {
+			id: deploymentID,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError("Resource not found")),
+		},
+		"error, stats": {
+			id:       deploymentID,
+			statsErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("GetDeploymentStats", mock.Anything, tc.id).
+				Return(tc.stats, tc.statsErr)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsStatistics,
+				rest.Get, d.GetDeploymentStats)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4"+strings.Replace(
+					ApiUrlManagementDeploymentsStatistics,
+					":id", tc.id, 1), nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertNotCalled(t, "GetDeploymentProgress",
+				mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestGetDeploymentProgress(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	percent := 42.5
+	progress := &model.DeploymentProgress{
+		Devices:         2,
+		BytesDownloaded: 100,
+		BytesTotal:      1000,
+		Percent:         &percent,
+	}
+
+	testCases := map[string]struct {
+		id string
+
+		progress    *model.DeploymentProgress
+		progressErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			id:       deploymentID,
+			progress: progress,
+			checker:  mt.NewJSONResponse(http.StatusOK, nil, progress),
+		},
+		"ok, no progress reported": {
+			id:       deploymentID,
+			progress: &model.DeploymentProgress{},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				map[string]interface{}{
+					"devices":          0,
+					"bytes_downloaded": 0,
+					"bytes_total":      0,
+				}),
+		},
+		"error, invalid id": {
+			id: "foo",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, not found": {
+			id: deploymentID,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError("Resource not found")),
+		},
+		"error, progress": {
+			id:          deploymentID,
+			progressErr: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("GetDeploymentProgress", mock.Anything, tc.id).
+				Return(tc.progress, tc.progressErr)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsProgress,
+				rest.Get, d.GetDeploymentProgress)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4"+strings.Replace(
+					ApiUrlManagementDeploymentsProgress,
+					":id", tc.id, 1), nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeploymentStatsTimeline(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	stats := model.NewDeviceDeploymentStats()
+	stats[model.DeviceDeploymentStatusSuccess] = 2
+	timeline := []model.StatsTimelineBucket{{
+		Time:        time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC),
+		Stats:       stats,
+		Transitions: stats,
+	}}
+
+	testCases := map[string]struct {
+		id       string
+		query    string
+		interval time.Duration
+		timeline []model.StatsTimelineBucket
+		err      error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			id:       deploymentID,
+			query:    "?interval=300",
+			interval: 5 * time.Minute,
+			timeline: timeline,
+			checker:  mt.NewJSONResponse(http.StatusOK, nil, timeline),
+		},
+		"error, not found": {
+			id:       deploymentID,
+			query:    "?interval=300",
+			interval: 5 * time.Minute,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(view.ErrNotFound.Error())),
+		},
+		"error, bad id": {
+			id:    "foo",
+			query: "?interval=300",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrIDNotUUIDv4.Error())),
+		},
+		"error, no interval": {
+			id: deploymentID,
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrInvalidIntervalParam.Error())),
+		},
+		"error, zero interval": {
+			id:    deploymentID,
+			query: "?interval=0",
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(ErrInvalidIntervalParam.Error())),
+		},
+		"error, too many intervals": {
+			id:       deploymentID,
+			query:    "?interval=1",
+			interval: time.Second,
+			err: errors.Wrap(model.ErrInvalidStatsTimelineInterval,
+				"more than 1000 intervals"),
+			checker: mt.NewJSONResponse(http.StatusBadRequest, nil,
+				deployments_testing.RestError(
+					"more than 1000 intervals: invalid interval")),
+		},
+		"error, internal": {
+			id:       deploymentID,
+			query:    "?interval=300",
+			interval: 5 * time.Minute,
+			err:      errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			if tc.interval > 0 {
+				mockApp.On("GetDeploymentStatsTimeline", mock.Anything,
+					tc.id, tc.interval).Return(tc.timeline, tc.err)
+			}
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsTimeline, rest.Get,
+				d.GetDeploymentStatsTimeline)
+
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+
+				strings.Replace(ApiUrlManagementDeploymentsTimeline,
+					":id", tc.id, 1)+tc.query, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestPutDeploymentStatusForDevice(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	testCases := map[string]struct {
+		status string
+		err    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			status:  model.DeviceDeploymentStatusInstalling,
+			checker: mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error, invalid transition": {
+			status: model.DeviceDeploymentStatusDownloading,
+			err: errors.Wrap(model.ErrInvalidStatusTransition,
+				"success to downloading"),
+			checker: mt.NewJSONResponse(http.StatusConflict, nil,
+				deployments_testing.RestError(
+					"success to downloading: invalid status transition")),
+		},
+		"error, aborted": {
+			status: model.DeviceDeploymentStatusSuccess,
+			err:    app.ErrDeploymentAborted,
+			checker: mt.NewJSONResponse(http.StatusConflict, nil,
+				deployments_testing.RestError(app.ErrDeploymentAborted.Error())),
+		},
+		"error, concurrent update": {
+			status: model.DeviceDeploymentStatusSuccess,
+			err:    app.ErrModelStatusConflict,
+			checker: mt.NewJSONResponse(http.StatusConflict, nil,
+				deployments_testing.RestError(app.ErrModelStatusConflict.Error())),
+		},
+		"error, internal": {
+			status: model.DeviceDeploymentStatusSuccess,
+			err:    errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("UpdateDeviceDeploymentStatus", mock.Anything,
+				deploymentID, "device",
+				model.DeviceDeploymentStatus{Status: tc.status}).
+				Return(tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			handler := func(w rest.ResponseWriter, r *rest.Request) {
+				r.Request = r.WithContext(identity.WithContext(r.Context(),
+					&identity.Identity{Subject: "device", IsDevice: true}))
+				d.PutDeploymentStatusForDevice(w, r)
+			}
+			api := deployments_testing.SetUpTestApi(ApiUrlDevicesDeploymentStatus,
+				rest.Put, handler)
+
+			req := test.MakeSimpleRequest("PUT", "http://1.2.3.4"+
+				strings.Replace(ApiUrlDevicesDeploymentStatus, ":id",
+					deploymentID, 1),
+				model.StatusReport{Status: tc.status})
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/stretchr/testify/mock"
+
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestDeprovisionTenant(t *testing.T) {
+	testCases := map[string]struct {
+		err error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(http.StatusAccepted, nil, nil),
+		},
+		"error, internal": {
+			err: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("DeprovisionTenant", mock.Anything, "foo").
+				Return(tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(ApiUrlInternalTenant,
+				rest.Delete, d.DeprovisionTenantHandler)
+
+			url := strings.Replace(ApiUrlInternalTenant, ":tenant", "foo", 1)
+			req := test.MakeSimpleRequest("DELETE", "http://1.2.3.4"+url, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetTenantDeprovisioning(t *testing.T) {
+	started := time.Unix(1546300800, 0).UTC()
+	deprovisioning := &model.TenantDeprovisioning{
+		TenantID:       "foo",
+		Status:         model.TenantDeprovisioningInProgress,
+		ObjectsDeleted: 1000,
+		Started:        started,
+		Updated:        started.Add(time.Minute),
+	}
+
+	testCases := map[string]struct {
+		deprovisioning *model.TenantDeprovisioning
+		err            error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			deprovisioning: deprovisioning,
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				deprovisioning),
+		},
+		"error, not found": {
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError("Resource not found")),
+		},
+		"error, internal": {
+			err: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("GetTenantDeprovisioning", mock.Anything, "foo").
+				Return(tc.deprovisioning, tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+
+			api := deployments_testing.SetUpTestApi(ApiUrlInternalTenantDeprovision,
+				rest.Get, d.GetTenantDeprovisioningHandler)
+
+			url := strings.Replace(ApiUrlInternalTenantDeprovision, ":tenant", "foo", 1)
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+url, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/app"
+	app_mocks "github.com/mendersoftware/deployments/app/mocks"
+	"github.com/mendersoftware/deployments/model"
+	store_mocks "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/restutil/view"
+	deployments_testing "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestGetDeviceDeploymentTransitions(t *testing.T) {
+	const deploymentID = "4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1"
+
+	now := time.Now().UTC().Round(time.Second)
+	substate := "ArtifactReboot_Enter"
+	transitions := []model.DeviceDeploymentTransition{
+		{
+			From:      model.DeviceDeploymentStatusPending,
+			To:        model.DeviceDeploymentStatusDownloading,
+			Timestamp: now.Add(-time.Minute),
+		},
+		{
+			From:      model.DeviceDeploymentStatusDownloading,
+			To:        model.DeviceDeploymentStatusRebooting,
+			SubState:  &substate,
+			Timestamp: now,
+		},
+	}
+
+	testCases := map[string]struct {
+		transitions []model.DeviceDeploymentTransition
+		err         error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			transitions: transitions,
+			checker:     mt.NewJSONResponse(http.StatusOK, nil, transitions),
+		},
+		"ok, no transitions": {
+			transitions: []model.DeviceDeploymentTransition{},
+			checker: mt.NewJSONResponse(http.StatusOK, nil,
+				[]model.DeviceDeploymentTransition{}),
+		},
+		"error, not found": {
+			err: app.ErrModelDeploymentNotFound,
+			checker: mt.NewJSONResponse(http.StatusNotFound, nil,
+				deployments_testing.RestError(view.ErrNotFound.Error())),
+		},
+		"error, internal": {
+			err: errors.New("connection failed"),
+			checker: mt.NewJSONResponse(http.StatusInternalServerError, nil,
+				deployments_testing.RestError("internal error")),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			mockApp := &app_mocks.App{}
+			mockApp.On("GetDeviceDeploymentTransitions", mock.Anything,
+				deploymentID, "device").Return(tc.transitions, tc.err)
+
+			d := NewDeploymentsApiHandlers(&store_mocks.DataStore{},
+				new(view.RESTView), mockApp)
+			api := deployments_testing.SetUpTestApi(
+				ApiUrlManagementDeploymentsTransitions, rest.Get,
+				d.GetDeviceDeploymentTransitions)
+
+			url := strings.Replace(ApiUrlManagementDeploymentsTransitions,
+				":id", deploymentID, 1)
+			url = strings.Replace(url, ":devid", "device", 1)
+			req := test.MakeSimpleRequest("GET", "http://1.2.3.4"+url, nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			mockApp.AssertExpectations(t)
+		})
+	}
+}
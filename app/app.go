@@ -38,6 +38,15 @@ const (
 	ArtifactContentType = "application/vnd.mender-artifact"
 
 	DefaultUpdateDownloadLinkExpire = 24 * time.Hour
+
+	// Number of times the status of a device deployment is read and
+	// updated, if changed concurrently in between
+	maxStatusUpdateAttempts = 3
+
+	// DefaultAdmissionTimeout is how long devices hold the slots of
+	// deployments limiting concurrent devices before they are considered
+	// gone and the slots are given to other devices.
+	DefaultAdmissionTimeout = 24 * time.Hour
 )
 
 // Errors expected from App interface
@@ -63,15 +72,24 @@ var (
 	ErrStorageNotFound         = errors.New("Not found")
 	ErrDeploymentAborted       = errors.New("Deployment aborted")
 	ErrDeviceDecommissioned    = errors.New("Device decommissioned")
+	ErrModelStatusConflict     = errors.New("Device deployment status changed concurrently")
 	ErrNoArtifact              = errors.New("No artifact for the deployment")
 )
 
 //deployments
 
 type App interface {
+	// health
+	HealthCheck(ctx context.Context) *model.HealthReport
+
 	// limits
 	GetLimit(ctx context.Context, name string) (*model.Limit, error)
+	SetLimit(ctx context.Context, limit model.Limit) error
 	ProvisionTenant(ctx context.Context, tenant_id string) error
+	DeprovisionTenant(ctx context.Context, tenantID string) error
+	DeprovisionTenants(ctx context.Context) (int, error)
+	GetTenantDeprovisioning(ctx context.Context,
+		tenantID string) (*model.TenantDeprovisioning, error)
 
 	// images
 	ListImages(ctx context.Context,
@@ -92,37 +110,142 @@ type App interface {
 	IsDeploymentFinished(ctx context.Context, deploymentID string) (bool, error)
 	AbortDeployment(ctx context.Context, deploymentID string) error
 	GetDeploymentStats(ctx context.Context, deploymentID string) (model.Stats, error)
+	GetDeploymentStatsTimeline(ctx context.Context, deploymentID string,
+		interval time.Duration) ([]model.StatsTimelineBucket, error)
+	GetDeploymentFailureSummary(ctx context.Context,
+		deploymentID string) (*model.FailureSummary, error)
+	GetDeploymentProgress(ctx context.Context,
+		deploymentID string) (*model.DeploymentProgress, error)
 	GetDeploymentForDeviceWithCurrent(ctx context.Context, deviceID string,
 		current model.InstalledDeviceDeployment) (*model.DeploymentInstructions, error)
+	WaitForDeploymentForDevice(ctx context.Context, deviceID string,
+		current model.InstalledDeviceDeployment,
+		timeout time.Duration) (*model.DeploymentInstructions, error)
 	HasDeploymentForDevice(ctx context.Context, deploymentID string,
 		deviceID string) (bool, error)
 	UpdateDeviceDeploymentStatus(ctx context.Context, deploymentID string,
 		deviceID string, status model.DeviceDeploymentStatus) error
 	GetDeviceStatusesForDeployment(ctx context.Context,
-		deploymentID string) ([]model.DeviceDeployment, error)
+		query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error)
+	IterateDeviceStatusesForDeployment(ctx context.Context,
+		query model.DeviceDeploymentsQuery,
+		fn func(*model.DeviceDeployment) error) error
 	LookupDeployment(ctx context.Context,
-		query model.Query) ([]*model.Deployment, error)
+		query model.Query) ([]*model.Deployment, int, error)
 	SaveDeviceDeploymentLog(ctx context.Context, deviceID string,
 		deploymentID string, logs []model.LogMessage) error
+	AppendDeviceDeploymentLog(ctx context.Context, deviceID string,
+		deploymentID string, chunk model.LogChunk) error
 	GetDeviceDeploymentLog(ctx context.Context,
 		deviceID, deploymentID string) (*model.DeploymentLog, error)
+	GetDeviceDeploymentTransitions(ctx context.Context,
+		deploymentID, deviceID string) ([]model.DeviceDeploymentTransition, error)
 	DecommissionDevice(ctx context.Context, deviceID string) error
+	GetDeviceDeploymentHistory(ctx context.Context,
+		query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeploymentHistoryEntry, error)
+
+	// stats
+	RecomputeStats(ctx context.Context,
+		deploymentID string) ([]model.StatsCorrection, error)
+	RecomputeStatsAllTenants(ctx context.Context) ([]model.StatsCorrection, error)
+
+	// retention
+	ArchiveDeployments(ctx context.Context,
+		defaultDays int) ([]model.ArchivedDeployment, error)
+	ArchiveDeploymentsAllTenants(ctx context.Context,
+		defaultDays int) ([]model.ArchivedDeployment, error)
+	ListArchivedDeployments(ctx context.Context,
+		skip, limit int) ([]model.ArchivedDeployment, error)
+	RestoreArchivedDeployment(ctx context.Context, id string) error
+
+	// gateways
+	SetGatewayDevices(ctx context.Context, gatewayID string,
+		devices model.GatewayDevices) error
+	GetGatewayDevices(ctx context.Context,
+		gatewayID string) (*model.GatewayDevices, error)
+	SubmitGatewayReports(ctx context.Context, gatewayID string,
+		reports []model.GatewayReport) ([]error, error)
+
+	// maintenance windows
+	SetTenantMaintenanceWindows(ctx context.Context,
+		windows model.MaintenanceWindows) error
+	GetTenantMaintenanceWindows(ctx context.Context) (*model.MaintenanceWindows, error)
+	SetDeviceMaintenanceWindows(ctx context.Context, deviceID string,
+		windows model.MaintenanceWindows) error
+	GetDeviceMaintenanceWindows(ctx context.Context,
+		deviceID string) (*model.MaintenanceWindows, error)
 }
 
 type Deployments struct {
 	db               store.DataStore
 	fileStorage      s3.FileStorage
 	imageContentType string
+
+	// store device deployment logs in the file storage
+	logsInFileStorage bool
+
+	// log invalid device deployment status transitions instead of
+	// rejecting them
+	lenientStatusTransitions bool
+
+	// devices waiting for a deployment
+	waiters       *deviceWaiters
+	notifier      DeploymentNotifier
+	maxDeviceWait time.Duration
+
+	// expiry of the slots of deployments limiting concurrent devices
+	admissionTimeout time.Duration
 }
 
 func NewDeployments(storage store.DataStore, fileStorage s3.FileStorage, imageContentType string) *Deployments {
+	waiters := newDeviceWaiters()
 	return &Deployments{
 		db:               storage,
 		fileStorage:      fileStorage,
 		imageContentType: imageContentType,
+		waiters:          waiters,
+		notifier:         &localNotifier{waiters: waiters},
+		admissionTimeout: DefaultAdmissionTimeout,
 	}
 }
 
+// WithAdmissionTimeout sets how long devices hold the slots of deployments
+// limiting concurrent devices; 0 disables the expiry.
+func (d *Deployments) WithAdmissionTimeout(timeout time.Duration) *Deployments {
+	d.admissionTimeout = timeout
+	return d
+}
+
+// WithLogsInFileStorage makes device deployment logs, and the chunks
+// appended to them, saved gzip-compressed in the file storage instead of the
+// database.
+func (d *Deployments) WithLogsInFileStorage(enabled bool) *Deployments {
+	d.logsInFileStorage = enabled
+	return d
+}
+
+// WithLenientStatusTransitions makes invalid transitions of device
+// deployment statuses logged and applied instead of rejected.
+func (d *Deployments) WithLenientStatusTransitions(enabled bool) *Deployments {
+	d.lenientStatusTransitions = enabled
+	return d
+}
+
+// HealthCheck checks the database and file storage connectivity.
+func (d *Deployments) HealthCheck(ctx context.Context) *model.HealthReport {
+	start := time.Now()
+	dbErr := d.db.Ping(ctx)
+	dbHealth := model.NewDependencyHealth(model.HealthDependencyDatabase,
+		time.Since(start), dbErr)
+
+	start = time.Now()
+	fsErr := d.fileStorage.HealthCheck(ctx)
+	fsHealth := model.NewDependencyHealth(model.HealthDependencyFileStorage,
+		time.Since(start), fsErr)
+
+	return model.NewHealthReport(dbHealth, fsHealth)
+}
+
 func (d *Deployments) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
 	limit, err := d.db.GetLimit(ctx, name)
 	if err == mongo.ErrLimitNotFound {
@@ -137,6 +260,13 @@ func (d *Deployments) GetLimit(ctx context.Context, name string) (*model.Limit,
 	return limit, nil
 }
 
+func (d *Deployments) SetLimit(ctx context.Context, limit model.Limit) error {
+	if err := d.db.UpsertLimit(ctx, limit); err != nil {
+		return errors.Wrap(err, "failed to store limit")
+	}
+	return nil
+}
+
 func (d *Deployments) ProvisionTenant(ctx context.Context, tenant_id string) error {
 	if err := d.db.ProvisionTenant(ctx, tenant_id); err != nil {
 		return errors.Wrap(err, "failed to provision tenant")
@@ -447,6 +577,24 @@ func getMetaFromArchive(r *io.Reader) (*model.SoftwareImageMetaArtifactConstruct
 	metaArtifact.Info = getArtifactInfo(aReader.GetInfo())
 	metaArtifact.DeviceTypesCompatible = aReader.GetCompatibleDevices()
 	metaArtifact.Name = aReader.GetArtifactName()
+	metaArtifact.Provides = map[string]string{
+		model.ProvidesKeyArtifactName: metaArtifact.Name,
+	}
+	metaArtifact.Depends = map[string][]string{
+		model.ProvidesKeyDeviceType: metaArtifact.DeviceTypesCompatible,
+	}
+	if provides := aReader.GetArtifactProvides(); provides != nil &&
+		provides.ArtifactGroup != "" {
+		metaArtifact.Provides[model.ProvidesKeyArtifactGroup] = provides.ArtifactGroup
+	}
+	if depends := aReader.GetArtifactDepends(); depends != nil {
+		if len(depends.ArtifactName) > 0 {
+			metaArtifact.Depends[model.ProvidesKeyArtifactName] = depends.ArtifactName
+		}
+		if len(depends.ArtifactGroup) > 0 {
+			metaArtifact.Depends[model.ProvidesKeyArtifactGroup] = depends.ArtifactGroup
+		}
+	}
 
 	for _, p := range aReader.GetHandlers() {
 		uFiles, err := getUpdateFiles(p.GetUpdateFiles())
@@ -459,6 +607,26 @@ func getMetaFromArchive(r *io.Reader) (*model.SoftwareImageMetaArtifactConstruct
 			return nil, errors.Wrap(err, "Cannot get update metadata")
 		}
 
+		uProvides, err := p.GetUpdateProvides()
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot get update provides")
+		}
+		if uProvides != nil {
+			for key, value := range *uProvides {
+				metaArtifact.Provides[key] = value
+			}
+		}
+
+		uDepends, err := p.GetUpdateDepends()
+		if err != nil {
+			return nil, errors.Wrap(err, "Cannot get update depends")
+		}
+		if uDepends != nil {
+			for key, value := range *uDepends {
+				metaArtifact.Depends[key] = []string{value}
+			}
+		}
+
 		metaArtifact.Updates = append(
 			metaArtifact.Updates,
 			model.Update{
@@ -532,6 +700,7 @@ func (d *Deployments) CreateDeployment(ctx context.Context,
 
 	// Set initial statistics cache values
 	deployment.Stats[model.DeviceDeploymentStatusPending] = len(constructor.Devices)
+	deployment.DeviceCount = len(constructor.Devices)
 
 	if err := d.db.InsertDeployment(ctx, deployment); err != nil {
 		return "", errors.Wrap(err, "Storing deployment data")
@@ -545,6 +714,8 @@ func (d *Deployments) CreateDeployment(ctx context.Context,
 		return "", errors.Wrap(err, "Storing assigned deployments to devices")
 	}
 
+	d.notifyDevices(ctx, constructor.Devices)
+
 	return *deployment.Id, nil
 }
 
@@ -570,6 +741,17 @@ func (d *Deployments) GetDeployment(ctx context.Context,
 	if err != nil {
 		return nil, errors.Wrap(err, "Searching for deployment by ID")
 	}
+	if deployment == nil {
+		return nil, nil
+	}
+
+	sets, err := d.deploymentMaintenanceWindows(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) > 0 {
+		deployment.Maintenance = model.NewMaintenanceStatus(time.Now(), sets...)
+	}
 
 	return deployment, nil
 }
@@ -640,7 +822,14 @@ func (d *Deployments) assignArtifact(
 	// First case is for backward compatibility.
 	// It is possible that there is old deployment structure in the system.
 	// In such case we need to select artifact using name and device type.
-	if deployment.Artifacts == nil || len(deployment.Artifacts) == 0 {
+	if installed.Provides != nil {
+		// Devices reporting their provides get the first artifact with
+		// satisfied depends.
+		artifact, err = d.artifactForProvides(ctx, deployment, installed.Provides)
+		if err != nil {
+			return errors.Wrap(err, "assigning artifact to device deployment")
+		}
+	} else if deployment.Artifacts == nil || len(deployment.Artifacts) == 0 {
 		artifact, err = d.db.ImageByNameAndDeviceType(ctx, installed.Artifact, installed.DeviceType)
 		if err != nil {
 			return errors.Wrap(err, "assigning artifact to device deployment")
@@ -670,7 +859,8 @@ func (d *Deployments) assignArtifact(
 	}
 
 	if err := d.db.AssignArtifact(
-		ctx, *deviceDeployment.DeviceId, *deviceDeployment.DeploymentId, artifact); err != nil {
+		ctx, *deviceDeployment.DeviceId, *deviceDeployment.DeploymentId, artifact,
+		installed.DeviceType); err != nil {
 		return errors.Wrap(err, "Assigning artifact to the device deployment")
 	}
 
@@ -680,6 +870,79 @@ func (d *Deployments) assignArtifact(
 	return nil
 }
 
+// deploymentArtifacts returns the artifacts of the deployment.
+func (d *Deployments) deploymentArtifacts(ctx context.Context,
+	deployment *model.Deployment) ([]*model.SoftwareImage, error) {
+
+	images, err := d.db.ImagesByName(ctx, *deployment.ArtifactName)
+	if err != nil {
+		return nil, errors.Wrap(err, "Searching for artifacts of the deployment")
+	}
+
+	// deployments created before the artifacts were recorded use all the
+	// artifacts with the name
+	if len(deployment.Artifacts) == 0 {
+		return images, nil
+	}
+
+	artifacts := images[:0]
+	for _, image := range images {
+		for _, id := range deployment.Artifacts {
+			if image.Id == id {
+				artifacts = append(artifacts, image)
+				break
+			}
+		}
+	}
+	return artifacts, nil
+}
+
+func (d *Deployments) artifactForProvides(ctx context.Context,
+	deployment *model.Deployment,
+	provides map[string]string) (*model.SoftwareImage, error) {
+
+	artifacts, err := d.deploymentArtifacts(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, artifact := range artifacts {
+		if artifact.DependsSatisfied(provides) {
+			return artifact, nil
+		}
+	}
+	return nil, nil
+}
+
+// isAlreadyInstalled checks if the artifact of the deployment is installed on
+// the device. Without the provides of the device only the names are compared.
+func (d *Deployments) isAlreadyInstalled(ctx context.Context,
+	deployment *model.Deployment,
+	installed model.InstalledDeviceDeployment) (bool, error) {
+
+	if installed.Provides == nil {
+		return installed.Artifact != "" &&
+			*deployment.ArtifactName == installed.Artifact, nil
+	}
+
+	artifacts, err := d.deploymentArtifacts(ctx, deployment)
+	if err != nil {
+		return false, err
+	}
+
+	for _, artifact := range artifacts {
+		if !artifact.IsInstalled(installed.Provides) {
+			continue
+		}
+		for _, deviceType := range artifact.DeviceTypesCompatible {
+			if deviceType == installed.DeviceType {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 // GetDeploymentForDeviceWithCurrent returns deployment for the device
 func (d *Deployments) GetDeploymentForDeviceWithCurrent(ctx context.Context, deviceID string,
 	installed model.InstalledDeviceDeployment) (*model.DeploymentInstructions, error) {
@@ -706,7 +969,12 @@ func (d *Deployments) GetDeploymentForDeviceWithCurrent(ctx context.Context, dev
 		return nil, nil
 	}
 
-	if installed.Artifact != "" && *deployment.ArtifactName == installed.Artifact {
+	alreadyInstalled, err := d.isAlreadyInstalled(ctx, deployment, installed)
+	if err != nil {
+		return nil, err
+	}
+
+	if alreadyInstalled {
 		// pretend there is no deployment for this device, but update
 		// its status to already installed first
 
@@ -721,8 +989,22 @@ func (d *Deployments) GetDeploymentForDeviceWithCurrent(ctx context.Context, dev
 		return nil, nil
 	}
 
-	// assign artifact only if the artifact was not assigned previously or the device type has changed
-	if deviceDeployment.Image == nil || deviceDeployment.DeviceType == nil || *deviceDeployment.DeviceType != installed.DeviceType {
+	// devices start installing new deployments only within the maintenance windows
+	if deviceDeployment.Status != nil &&
+		*deviceDeployment.Status == model.DeviceDeploymentStatusPending {
+		open, err := d.inMaintenanceWindow(ctx, deployment, deviceID, time.Now())
+		if err != nil {
+			return nil, errors.Wrap(err, "Checking maintenance windows")
+		}
+		if !open {
+			return nil, nil
+		}
+	}
+
+	// assign artifact only if the artifact was not assigned previously, the device type has changed
+	// or the reported provides do not satisfy the depends of the assigned artifact anymore
+	if deviceDeployment.Image == nil || deviceDeployment.DeviceType == nil || *deviceDeployment.DeviceType != installed.DeviceType ||
+		(installed.Provides != nil && !deviceDeployment.Image.DependsSatisfied(installed.Provides)) {
 		if err := d.assignArtifact(ctx, deployment, deviceDeployment, installed); err != nil {
 			return nil, err
 		}
@@ -732,6 +1014,18 @@ func (d *Deployments) GetDeploymentForDeviceWithCurrent(ctx context.Context, dev
 		return nil, nil
 	}
 
+	// only up to max concurrent devices may start installing at once
+	if deployment.MaxConcurrent > 0 && !deviceDeployment.Admitted &&
+		*deviceDeployment.Status == model.DeviceDeploymentStatusPending {
+		admitted, err := d.admitDeviceDeployment(ctx, deviceID, deployment)
+		if err != nil {
+			return nil, errors.Wrap(err, "Admitting the device to the deployment")
+		}
+		if !admitted {
+			return nil, nil
+		}
+	}
+
 	link, err := d.fileStorage.GetRequest(ctx, deviceDeployment.Image.Id,
 		DefaultUpdateDownloadLinkExpire, d.imageContentType)
 	if err != nil {
@@ -759,59 +1053,206 @@ func (d *Deployments) UpdateDeviceDeploymentStatus(ctx context.Context, deployme
 
 	l.Infof("New status: %s for device %s deployment: %v", ddStatus.Status, deviceID, deploymentID)
 
+	now := time.Now()
 	var finishTime *time.Time = nil
 	if model.IsDeviceDeploymentStatusFinished(ddStatus.Status) {
-		now := time.Now()
 		finishTime = &now
 	}
 
-	currentStatus, err := d.db.GetDeviceDeploymentStatus(ctx,
-		deploymentID, deviceID)
-	if err != nil {
-		return err
+	// the status is read again if changed by a concurrent request
+	var old string
+	for attempt := 1; ; attempt++ {
+		currentStatus, err := d.db.GetDeviceDeploymentStatus(ctx,
+			deploymentID, deviceID)
+		if err != nil {
+			return err
+		}
+		if currentStatus == "" {
+			return mongo.ErrStorageNotFound
+		}
+
+		if err := checkDeviceDeploymentStatus(currentStatus); err != nil {
+			return err
+		}
+
+		// nothing to do, unless the device reports its progress; repeated
+		// reports, e.g. of a device rebooting over and over, are recorded
+		if ddStatus.Status == currentStatus && ddStatus.Progress == nil {
+			if model.IsDeviceDeploymentStatusFinished(currentStatus) {
+				return nil
+			}
+			return d.addStatusTransition(ctx, deviceID, deploymentID,
+				currentStatus, ddStatus, now)
+		}
+
+		if err := d.checkStatusTransition(ctx, deviceID, deploymentID,
+			currentStatus, ddStatus.Status); err != nil {
+			return err
+		}
+
+		// The update is conditional on the status not having changed in
+		// the meantime, and records the transition along with the status;
+		// concurrent reports thus never apply the same transition to the
+		// stats twice.
+		ddStatus.PreviousStatus = currentStatus
+		ddStatus.Timestamp = time.Time{}
+		if ddStatus.Status != currentStatus {
+			ddStatus.Timestamp = now
+		}
+		ddStatus.FinishTime = finishTime
+
+		old, err = d.db.UpdateDeviceDeploymentStatus(ctx,
+			deviceID, deploymentID, ddStatus)
+		if err == mongo.ErrStorageNotFound {
+			if attempt < maxStatusUpdateAttempts {
+				continue
+			}
+			return ErrModelStatusConflict
+		} else if err != nil {
+			return err
+		}
+		break
 	}
 
-	if currentStatus == model.DeviceDeploymentStatusAborted {
-		return ErrDeploymentAborted
+	if old == ddStatus.Status {
+		return nil
 	}
 
-	if currentStatus == model.DeviceDeploymentStatusDecommissioned {
-		return ErrDeviceDecommissioned
+	// stats are updated and the deployment is marked as finished (if this
+	// was the last active device) in a single write
+	err := d.updateDeploymentStats(ctx, deploymentID, old, ddStatus.Status)
+
+	// let the next device in, if the deployment limits concurrent devices;
+	// the device is done whatever happens to the stats
+	if model.IsDeviceDeploymentStatusFinished(ddStatus.Status) {
+		d.releaseDeviceDeployment(ctx, deviceID, deploymentID)
+	}
+	return err
+}
+
+// admitDeviceDeployment gives the device one of the slots of the deployment
+// limiting concurrent devices, if any is free. The slots of the devices
+// admitted longer than the admission timeout ago are freed first if none is.
+func (d *Deployments) admitDeviceDeployment(ctx context.Context,
+	deviceID string, deployment *model.Deployment) (bool, error) {
+
+	admitted, err := d.db.AdmitDeviceDeployment(ctx, deviceID,
+		*deployment.Id, deployment.MaxConcurrent)
+	if err != nil || admitted || d.admissionTimeout <= 0 {
+		return admitted, err
 	}
 
-	// nothing to do
-	if ddStatus.Status == currentStatus {
-		return nil
+	released, err := d.db.ReleaseDeviceDeploymentsAdmittedBefore(ctx,
+		*deployment.Id, time.Now().Add(-d.admissionTimeout))
+	if err != nil {
+		return false, errors.Wrap(err, "failed to release expired device deployments")
 	}
+	if released == 0 {
+		return false, nil
+	}
+	log.FromContext(ctx).Warnf("released %d devices admitted to deployment %s "+
+		"more than %s ago", released, *deployment.Id, d.admissionTimeout)
+
+	return d.db.AdmitDeviceDeployment(ctx, deviceID,
+		*deployment.Id, deployment.MaxConcurrent)
+}
 
-	// update finish time
-	ddStatus.FinishTime = finishTime
+// releaseDeviceDeployment frees the slot the device took in the deployment,
+// if any, and wakes the devices waiting for one. The device is done either
+// way, so a failure is only logged; the slot is then freed once the
+// admission times out.
+func (d *Deployments) releaseDeviceDeployment(ctx context.Context,
+	deviceID, deploymentID string) {
 
-	old, err := d.db.UpdateDeviceDeploymentStatus(ctx,
-		deviceID, deploymentID, ddStatus)
+	released, err := d.db.ReleaseDeviceDeployment(ctx, deviceID, deploymentID)
 	if err != nil {
-		return err
+		log.FromContext(ctx).Warnf("failed to release device %s "+
+			"of deployment %s: %v", deviceID, deploymentID, err)
+		return
+	}
+	if released {
+		d.notifyDevices(ctx, []string{deploymentWaiterKey(deploymentID)})
 	}
+}
 
-	if err = d.db.UpdateStats(ctx, deploymentID, old, ddStatus.Status); err != nil {
-		return err
+// updateDeploymentStats applies the status change of a device deployment to
+// the stats of the deployment. The stats live in another document than the
+// status, which is already changed; if updating them fails, e.g. on repeated
+// conflicts with concurrent updates, they are recomputed from the device
+// deployments rather than left off.
+func (d *Deployments) updateDeploymentStats(ctx context.Context,
+	deploymentID, from, to string) error {
+
+	err := d.db.UpdateStats(ctx, deploymentID, from, to)
+	if err == nil {
+		return nil
 	}
 
-	// fetch deployment stats and update finished field if needed
-	deployment, err := d.db.FindDeploymentByID(ctx, deploymentID)
-	if err != nil {
-		return errors.Wrap(err, "failed when searching for deployment")
+	log.FromContext(ctx).Warnf(
+		"failed to update stats of deployment %s: %s, recomputing them",
+		deploymentID, err.Error())
+	if _, rerr := d.recomputeDeploymentStats(ctx, deploymentID); rerr != nil {
+		return errors.Wrap(err, "failed to update deployment stats")
+	}
+	return nil
+}
+
+func (d *Deployments) addStatusTransition(ctx context.Context,
+	deviceID, deploymentID, from string, ddStatus model.DeviceDeploymentStatus,
+	when time.Time) error {
+
+	err := d.db.AddDeviceDeploymentTransition(ctx, deviceID, deploymentID,
+		model.DeviceDeploymentTransition{
+			From:      from,
+			To:        ddStatus.Status,
+			SubState:  ddStatus.SubState,
+			Timestamp: when,
+		})
+	return errors.Wrap(err, "failed to record status transition")
+}
+
+// checkStatusTransition returns an error if the device deployment must not
+// change from one status to the other, or the device reports progress before
+// getting the artifact, unless transitions are lenient.
+func (d *Deployments) checkStatusTransition(ctx context.Context,
+	deviceID, deploymentID, from, to string) error {
+
+	// missing device deployments are reported by the store
+	if from == "" {
+		return nil
 	}
 
-	if deployment.IsFinished() {
-		// TODO: Make this part of UpdateStats() call as currently we are doing two
-		// write operations on DB - as well as it's safer to keep them in single transaction.
-		l.Infof("Finish deployment: %s", deploymentID)
-		if err := d.db.Finish(ctx, deploymentID, time.Now()); err != nil {
-			return errors.Wrap(err, "failed to mark deployment as finished")
+	err := model.CheckDeviceDeploymentStatusTransition(from, to)
+	if err == nil && from == model.DeviceDeploymentStatusPending &&
+		model.IsDeviceDeploymentStatusWithArtifact(to) {
+
+		deviceDeployment, derr := d.db.GetDeviceDeployment(ctx,
+			deploymentID, deviceID)
+		if derr != nil {
+			return derr
+		}
+		if deviceDeployment != nil && deviceDeployment.Image == nil {
+			err = errors.Wrapf(model.ErrInvalidStatusTransition,
+				"%s to %s without artifact", from, to)
 		}
 	}
+	if err != nil && d.lenientStatusTransitions {
+		log.FromContext(ctx).Warnf("device %s deployment %s: %s",
+			deviceID, deploymentID, err.Error())
+		return nil
+	}
+	return err
+}
 
+// checkDeviceDeploymentStatus returns an error if status of the device
+// deployment must not be changed anymore.
+func checkDeviceDeploymentStatus(status string) error {
+	switch status {
+	case model.DeviceDeploymentStatusAborted:
+		return ErrDeploymentAborted
+	case model.DeviceDeploymentStatusDecommissioned:
+		return ErrDeviceDecommissioned
+	}
 	return nil
 }
 
@@ -831,49 +1272,187 @@ func (d *Deployments) GetDeploymentStats(ctx context.Context,
 	return d.db.AggregateDeviceDeploymentByStatus(ctx, deploymentID)
 }
 
+// GetDeploymentStatsTimeline returns the statistics of the deployment at the
+// end of each interval since its creation, until it finished; nil if the
+// deployment does not exist.
+func (d *Deployments) GetDeploymentStatsTimeline(ctx context.Context,
+	deploymentID string, interval time.Duration) ([]model.StatsTimelineBucket, error) {
+
+	deployment, err := d.db.FindDeploymentByID(ctx, deploymentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking deployment id")
+	}
+	if deployment == nil {
+		return nil, nil
+	}
+
+	to := time.Now()
+	if deployment.Finished != nil {
+		to = *deployment.Finished
+	}
+	timeline, err := model.NewEmptyStatsTimeline(*deployment.Created,
+		to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	// device deployments are streamed, the deployment may have many
+	err = d.db.IterateDeviceDeploymentTransitions(ctx, deploymentID,
+		func(dd *model.DeviceDeployment) error {
+			timeline.Add(dd)
+			return nil
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device deployments")
+	}
+
+	return timeline.Buckets(), nil
+}
+
+// GetDeploymentFailureSummary groups the failed devices of the deployment by
+// substate, device type and signature of their logs; nil if the deployment
+// does not exist.
+func (d *Deployments) GetDeploymentFailureSummary(ctx context.Context,
+	deploymentID string) (*model.FailureSummary, error) {
+
+	deployment, err := d.db.FindDeploymentByID(ctx, deploymentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking deployment id")
+	}
+	if deployment == nil {
+		return nil, nil
+	}
+
+	failures, _, err := d.db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{
+			DeploymentID: deploymentID,
+			Status:       model.DeviceDeploymentStatusFailure,
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device deployments")
+	}
+
+	// devices whose log cannot be read are summarized without it
+	signatures := make(map[string]string)
+	for _, dd := range failures {
+		if !dd.IsLogAvailable || dd.DeviceId == nil {
+			continue
+		}
+		signature, err := d.getFailureSignature(ctx, *dd.DeviceId, deploymentID)
+		if err != nil {
+			log.FromContext(ctx).Warnf("failed to get log of device %s: %v",
+				*dd.DeviceId, err)
+			continue
+		}
+		signatures[*dd.DeviceId] = signature
+	}
+
+	return model.NewFailureSummary(failures, signatures), nil
+}
+
+// getFailureSignature returns the failure signature of the device deployment
+// log, keeping only the messages making it while reading the log; empty if
+// the device did not upload a log.
+func (d *Deployments) getFailureSignature(ctx context.Context,
+	deviceID, deploymentID string) (string, error) {
+
+	dlog, err := d.db.GetDeviceDeploymentLog(ctx, deviceID, deploymentID)
+	if err != nil || dlog == nil {
+		return "", err
+	}
+
+	dlog, err = d.downloadDeviceDeploymentLog(ctx, dlog,
+		model.FailureSignatureMessages)
+	if err != nil {
+		return "", err
+	}
+	dlog.MergeChunks()
+
+	return model.FailureSignature(dlog.Messages), nil
+}
+
+// GetDeploymentProgress returns the aggregated progress of the devices
+// downloading or installing the deployment, empty if none reported progress;
+// nil if the deployment does not exist.
+func (d *Deployments) GetDeploymentProgress(ctx context.Context,
+	deploymentID string) (*model.DeploymentProgress, error) {
+
+	deployment, err := d.db.FindDeploymentByID(ctx, deploymentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking deployment id")
+	}
+	if deployment == nil {
+		return nil, nil
+	}
+
+	progress, err := d.db.AggregateDeviceDeploymentProgress(ctx, deploymentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to aggregate progress")
+	}
+	if progress == nil {
+		progress = &model.DeploymentProgress{}
+	}
+	return progress, nil
+}
+
 //GetDeviceStatusesForDeployment retrieve device deployment statuses for a given deployment.
+// Returns the page of the device deployments selected by the query along with
+// the total number of the matching ones.
 func (d *Deployments) GetDeviceStatusesForDeployment(ctx context.Context,
-	deploymentID string) ([]model.DeviceDeployment, error) {
+	query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error) {
 
-	deployment, err := d.db.FindDeploymentByID(ctx, deploymentID)
+	deployment, err := d.db.FindDeploymentByID(ctx, query.DeploymentID)
 	if err != nil {
-		return nil, ErrModelInternal
+		return nil, 0, ErrModelInternal
 	}
 
 	if deployment == nil {
-		return nil, ErrModelDeploymentNotFound
+		return nil, 0, ErrModelDeploymentNotFound
 	}
 
-	statuses, err := d.db.GetDeviceStatusesForDeployment(ctx, deploymentID)
+	statuses, total, err := d.db.GetDeviceStatusesForDeployment(ctx, query)
 	if err != nil {
-		return nil, ErrModelInternal
+		return nil, 0, ErrModelInternal
+	}
+	if statuses == nil {
+		statuses = []model.DeviceDeployment{}
 	}
 
-	return statuses, nil
+	return statuses, total, nil
 }
 
-func (d *Deployments) LookupDeployment(ctx context.Context,
-	query model.Query) ([]*model.Deployment, error) {
-	list, err := d.db.Find(ctx, query)
+// IterateDeviceStatusesForDeployment calls fn for each device deployment
+// selected by the query, in its order, without reading them all at once;
+// the paging of the query does not apply. Returns ErrModelDeploymentNotFound,
+// before calling fn, if the deployment does not exist.
+func (d *Deployments) IterateDeviceStatusesForDeployment(ctx context.Context,
+	query model.DeviceDeploymentsQuery,
+	fn func(*model.DeviceDeployment) error) error {
 
+	deployment, err := d.db.FindDeploymentByID(ctx, query.DeploymentID)
 	if err != nil {
-		return nil, errors.Wrap(err, "searching for deployments")
+		return errors.Wrap(err, "checking deployment id")
+	}
+	if deployment == nil {
+		return ErrModelDeploymentNotFound
 	}
 
-	if list == nil {
-		return make([]*model.Deployment, 0), nil
+	return d.db.IterateDeviceStatusesForDeployment(ctx, query, fn)
+}
+
+func (d *Deployments) LookupDeployment(ctx context.Context,
+	query model.Query) ([]*model.Deployment, int, error) {
+	list, total, err := d.db.Find(ctx, query)
+
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "searching for deployments")
 	}
 
-	for _, deployment := range list {
-		if deviceCount, err := d.db.DeviceCountByDeployment(ctx,
-			*deployment.Id); err != nil {
-			return nil, errors.Wrap(err, "counting device deployments")
-		} else {
-			deployment.DeviceCount = deviceCount
-		}
+	if list == nil {
+		return make([]*model.Deployment, 0), total, nil
 	}
 
-	return list, nil
+	return list, total, nil
 }
 
 // SaveDeviceDeploymentLog will save the deployment log for device of
@@ -888,7 +1467,37 @@ func (d *Deployments) SaveDeviceDeploymentLog(ctx context.Context, deviceID stri
 		Messages:     logs,
 	}
 	if err := dlog.Validate(); err != nil {
-		return errors.Wrapf(err, ErrStorageInvalidLog.Error())
+		return errors.Wrap(err, ErrStorageInvalidLog.Error())
+	}
+
+	if has, err := d.HasDeploymentForDevice(ctx, deploymentID, deviceID); !has {
+		if err != nil {
+			return err
+		} else {
+			return ErrModelDeploymentNotFound
+		}
+	}
+
+	if d.logsInFileStorage {
+		if err := d.uploadDeviceDeploymentLog(ctx, dlog); err != nil {
+			return err
+		}
+	} else if err := d.db.SaveDeviceDeploymentLog(ctx, dlog); err != nil {
+		return err
+	}
+
+	return d.db.UpdateDeviceDeploymentLogAvailability(ctx,
+		deviceID, deploymentID, true)
+}
+
+// AppendDeviceDeploymentLog adds the chunk of the deployment log uploaded
+// by the device of ID `deviceID`. Chunks re-sent with the same sequence
+// number are ignored.
+func (d *Deployments) AppendDeviceDeploymentLog(ctx context.Context, deviceID string,
+	deploymentID string, chunk model.LogChunk) error {
+
+	if err := chunk.Validate(); err != nil {
+		return errors.Wrap(err, ErrStorageInvalidLog.Error())
 	}
 
 	if has, err := d.HasDeploymentForDevice(ctx, deploymentID, deviceID); !has {
@@ -899,7 +1508,13 @@ func (d *Deployments) SaveDeviceDeploymentLog(ctx context.Context, deviceID stri
 		}
 	}
 
-	if err := d.db.SaveDeviceDeploymentLog(ctx, dlog); err != nil {
+	if d.logsInFileStorage {
+		if err := d.appendDeviceDeploymentLogObject(ctx,
+			deviceID, deploymentID, chunk); err != nil {
+			return err
+		}
+	} else if err := d.db.AppendDeviceDeploymentLog(ctx,
+		deviceID, deploymentID, chunk); err != nil {
 		return err
 	}
 
@@ -907,11 +1522,43 @@ func (d *Deployments) SaveDeviceDeploymentLog(ctx context.Context, deviceID stri
 		deviceID, deploymentID, true)
 }
 
+// GetDeviceDeploymentLog returns the deployment log of the device, reading
+// the messages from the file storage if stored there and merging the
+// appended chunks.
 func (d *Deployments) GetDeviceDeploymentLog(ctx context.Context,
 	deviceID, deploymentID string) (*model.DeploymentLog, error) {
 
-	return d.db.GetDeviceDeploymentLog(ctx,
+	dlog, err := d.db.GetDeviceDeploymentLog(ctx,
 		deviceID, deploymentID)
+	if err != nil || dlog == nil {
+		return dlog, err
+	}
+
+	if dlog, err = d.downloadDeviceDeploymentLog(ctx, dlog, nil); err != nil {
+		return nil, err
+	}
+	dlog.MergeChunks()
+
+	return dlog, nil
+}
+
+// GetDeviceDeploymentTransitions returns the status transitions of the device
+// deployment, oldest first.
+func (d *Deployments) GetDeviceDeploymentTransitions(ctx context.Context,
+	deploymentID, deviceID string) ([]model.DeviceDeploymentTransition, error) {
+
+	deviceDeployment, err := d.db.GetDeviceDeployment(ctx, deploymentID, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get device deployment")
+	}
+	if deviceDeployment == nil {
+		return nil, ErrModelDeploymentNotFound
+	}
+
+	if deviceDeployment.Transitions == nil {
+		return []model.DeviceDeploymentTransition{}, nil
+	}
+	return deviceDeployment.Transitions, nil
 }
 
 func (d *Deployments) HasDeploymentForDevice(ctx context.Context,
@@ -926,6 +1573,12 @@ func (d *Deployments) AbortDeployment(ctx context.Context, deploymentID string)
 		return err
 	}
 
+	// no device gets the deployment anymore
+	if _, err := d.db.ReleaseDeviceDeploymentsAdmittedBefore(ctx,
+		deploymentID, time.Now()); err != nil {
+		return errors.Wrap(err, "failed to release device deployments")
+	}
+
 	stats, err := d.db.AggregateDeviceDeploymentByStatus(
 		ctx, deploymentID)
 	if err != nil {
@@ -958,6 +1611,8 @@ func (d *Deployments) DecommissionDevice(ctx context.Context, deviceId string) e
 
 	for _, deviceDeployment := range deviceDeployments {
 
+		d.releaseDeviceDeployment(ctx, deviceId, *deviceDeployment.DeploymentId)
+
 		stats, err := d.db.AggregateDeviceDeploymentByStatus(
 			ctx, *deviceDeployment.DeploymentId)
 		if err != nil {
@@ -971,3 +1626,57 @@ func (d *Deployments) DecommissionDevice(ctx context.Context, deviceId string) e
 
 	return nil
 }
+
+// GetDeviceDeploymentHistory returns the deployments the device took part
+// in, newest first, along with the artifact and status of each.
+func (d *Deployments) GetDeviceDeploymentHistory(ctx context.Context,
+	query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeploymentHistoryEntry, error) {
+
+	deviceDeployments, err := d.db.FindDeviceDeploymentHistory(ctx, query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for device deployments")
+	}
+
+	ids := make([]string, 0, len(deviceDeployments))
+	for _, dd := range deviceDeployments {
+		ids = append(ids, *dd.DeploymentId)
+	}
+	found, err := d.db.FindDeploymentsByIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for deployments")
+	}
+	deployments := make(map[string]*model.Deployment, len(found))
+	for _, deployment := range found {
+		deployments[*deployment.Id] = deployment
+	}
+
+	history := make([]model.DeviceDeploymentHistoryEntry, 0, len(deviceDeployments))
+	for _, dd := range deviceDeployments {
+		deployment := deployments[*dd.DeploymentId]
+
+		entry := model.DeviceDeploymentHistoryEntry{
+			DeploymentID:   *dd.DeploymentId,
+			Status:         *dd.Status,
+			SubState:       dd.SubState,
+			Created:        dd.Created,
+			Finished:       dd.Finished,
+			IsLogAvailable: dd.IsLogAvailable,
+		}
+		// the deployment may have been removed together with its tenant data
+		if deployment != nil && deployment.DeploymentConstructor != nil {
+			if deployment.Name != nil {
+				entry.DeploymentName = *deployment.Name
+			}
+			if deployment.ArtifactName != nil {
+				entry.ArtifactName = *deployment.ArtifactName
+			}
+		}
+		if dd.Image != nil {
+			entry.ArtifactID = dd.Image.Id
+		}
+
+		history = append(history, entry)
+	}
+
+	return history, nil
+}
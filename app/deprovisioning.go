@@ -0,0 +1,156 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+// Number of file storage objects listed and removed at once
+const deprovisionBatchSize = 1000
+
+// Errors expected from deprovisioning
+var (
+	ErrModelInvalidTenantID = errors.New("Invalid tenant ID")
+)
+
+// DeprovisionTenant schedules the removal of all data of the tenant, done in
+// the background by DeprovisionTenants, as it takes long for large tenants.
+// Scheduling it again before it finishes is a noop, and so is deprovisioning
+// an already removed tenant, so the request can be safely retried.
+func (d *Deployments) DeprovisionTenant(ctx context.Context, tenantID string) error {
+	if tenantID == "" {
+		return ErrModelInvalidTenantID
+	}
+
+	existing, err := d.db.GetTenantDeprovisioning(ctx, tenantID)
+	if err != nil {
+		return errors.Wrap(err, "failed to get deprovisioning progress")
+	}
+	if existing != nil && existing.Status != model.TenantDeprovisioningFinished {
+		return nil
+	}
+
+	now := time.Now()
+	if err := d.db.SaveTenantDeprovisioning(ctx, model.TenantDeprovisioning{
+		TenantID: tenantID,
+		Status:   model.TenantDeprovisioningPending,
+		Started:  now,
+		Updated:  now,
+	}); err != nil {
+		return errors.Wrap(err, "failed to save deprovisioning progress")
+	}
+
+	return nil
+}
+
+// DeprovisionTenants removes the data of the tenants scheduled for
+// deprovisioning, resuming the interrupted deprovisionings. Returns the
+// number of deprovisioned tenants. Running it on several instances at once
+// only repeats the removals.
+func (d *Deployments) DeprovisionTenants(ctx context.Context) (int, error) {
+	deprovisionings, err := d.db.FindUnfinishedTenantDeprovisionings(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to search for deprovisionings")
+	}
+
+	for i, progress := range deprovisionings {
+		if err := d.deprovisionTenant(ctx, progress); err != nil {
+			return i, errors.Wrapf(err,
+				"failed to deprovision tenant %q", progress.TenantID)
+		}
+	}
+
+	return len(deprovisionings), nil
+}
+
+// deprovisionTenant removes the file storage objects under the tenant's
+// prefix and the tenant's database. The progress is recorded after every
+// batch of removed objects.
+func (d *Deployments) deprovisionTenant(ctx context.Context,
+	progress model.TenantDeprovisioning) error {
+
+	l := log.FromContext(ctx)
+	tenantID := progress.TenantID
+	tctx := identity.WithContext(ctx, &identity.Identity{Tenant: tenantID})
+
+	progress.Status = model.TenantDeprovisioningInProgress
+	progress.Updated = time.Now()
+	if err := d.db.SaveTenantDeprovisioning(ctx, progress); err != nil {
+		return errors.Wrap(err, "failed to save deprovisioning progress")
+	}
+
+	after := ""
+	for {
+		objectIDs, err := d.fileStorage.ListObjects(tctx, "", after,
+			deprovisionBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to list files")
+		}
+		if len(objectIDs) == 0 {
+			break
+		}
+
+		for _, objectID := range objectIDs {
+			if err := d.fileStorage.Delete(tctx, objectID); err != nil {
+				return errors.Wrapf(err, "failed to remove file %s", objectID)
+			}
+		}
+		after = objectIDs[len(objectIDs)-1]
+
+		progress.ObjectsDeleted += len(objectIDs)
+		progress.Updated = time.Now()
+		if err := d.db.SaveTenantDeprovisioning(ctx, progress); err != nil {
+			return errors.Wrap(err, "failed to save deprovisioning progress")
+		}
+		l.Infof("deprovisioning tenant %s: removed %d files",
+			tenantID, progress.ObjectsDeleted)
+	}
+
+	if err := d.db.DeprovisionTenant(ctx, tenantID); err != nil {
+		return errors.Wrap(err, "failed to remove tenant database")
+	}
+
+	finished := time.Now()
+	progress.Status = model.TenantDeprovisioningFinished
+	progress.Updated = finished
+	progress.Finished = &finished
+	if err := d.db.SaveTenantDeprovisioning(ctx, progress); err != nil {
+		return errors.Wrap(err, "failed to save deprovisioning progress")
+	}
+	l.Infof("deprovisioned tenant %s: removed %d files",
+		tenantID, progress.ObjectsDeleted)
+
+	return nil
+}
+
+// GetTenantDeprovisioning returns the progress of the last deprovisioning
+// of the tenant, nil if the tenant was never deprovisioned.
+func (d *Deployments) GetTenantDeprovisioning(ctx context.Context,
+	tenantID string) (*model.TenantDeprovisioning, error) {
+
+	deprovisioning, err := d.db.GetTenantDeprovisioning(ctx, tenantID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deprovisioning progress")
+	}
+	return deprovisioning, nil
+}
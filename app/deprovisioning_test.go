@@ -0,0 +1,151 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestDeprovisionTenant(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	fooCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "foo"})
+	barCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "bar"})
+
+	assert.NoError(t, db.ProvisionTenant(ctx, "foo"))
+	assert.NoError(t, db.ProvisionTenant(ctx, "bar"))
+	insertFinishedDeployment(t, fooCtx, db, 40)
+	bar := insertFinishedDeployment(t, barCtx, db, 40)
+
+	// more than a single batch of objects
+	objectCount := deprovisionBatchSize + 10
+	for i := 0; i < objectCount; i++ {
+		objects.objects[fmt.Sprintf("foo/%d", i)] = []byte("data")
+	}
+	objects.objects["bar/0"] = []byte("data")
+	objects.objects["foobar/0"] = []byte("data")
+
+	assert.Equal(t, ErrModelInvalidTenantID, d.DeprovisionTenant(ctx, ""))
+
+	deprovisioning, err := d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, deprovisioning)
+
+	// scheduled, the data is removed in the background
+	assert.NoError(t, d.DeprovisionTenant(ctx, "foo"))
+	assert.Len(t, objects.objects, objectCount+2)
+	deprovisioning, err = d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, deprovisioning) {
+		assert.Equal(t, model.TenantDeprovisioningPending, deprovisioning.Status)
+	}
+
+	deprovisioned, err := d.DeprovisionTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deprovisioned)
+
+	assert.Len(t, objects.objects, 2)
+	assert.Contains(t, objects.objects, "bar/0")
+	assert.Contains(t, objects.objects, "foobar/0")
+
+	tenants, err := db.ListTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, tenants)
+
+	dep, err := db.FindDeploymentByID(barCtx, *bar.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, dep)
+
+	deprovisioning, err = d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, deprovisioning) {
+		assert.Equal(t, model.TenantDeprovisioningFinished, deprovisioning.Status)
+		assert.Equal(t, objectCount, deprovisioning.ObjectsDeleted)
+		assert.NotNil(t, deprovisioning.Finished)
+	}
+
+	deprovisioned, err = d.DeprovisionTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deprovisioned)
+
+	// retrying is a noop
+	assert.NoError(t, d.DeprovisionTenant(ctx, "foo"))
+	deprovisioned, err = d.DeprovisionTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deprovisioned)
+	deprovisioning, err = d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, deprovisioning) {
+		assert.Equal(t, model.TenantDeprovisioningFinished, deprovisioning.Status)
+		assert.Equal(t, 0, deprovisioning.ObjectsDeleted)
+	}
+	assert.Len(t, objects.objects, 2)
+}
+
+func TestDeprovisionTenantFileStorageError(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	assert.NoError(t, db.ProvisionTenant(ctx, "foo"))
+
+	fs := &fs_mocks.FileStorage{}
+	fs.On("ListObjects", mock.Anything, "", "", deprovisionBatchSize).
+		Return([]string{"a", "b"}, nil)
+	fs.On("Delete", mock.Anything, "a").Return(nil)
+	fs.On("Delete", mock.Anything, "b").Return(errors.New("connection failed"))
+
+	d := NewDeployments(db, fs, ArtifactContentType)
+	assert.NoError(t, d.DeprovisionTenant(ctx, "foo"))
+	deprovisioned, err := d.DeprovisionTenants(ctx)
+	assert.EqualError(t, err,
+		`failed to deprovision tenant "foo": failed to remove file b: connection failed`)
+	assert.Equal(t, 0, deprovisioned)
+
+	// the database is kept until the files are removed
+	tenants, err := db.ListTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, tenants)
+
+	deprovisioning, err := d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, deprovisioning) {
+		assert.Equal(t, model.TenantDeprovisioningInProgress, deprovisioning.Status)
+		assert.Nil(t, deprovisioning.Finished)
+	}
+
+	// scheduling again keeps the interrupted deprovisioning, which is
+	// resumed
+	assert.NoError(t, d.DeprovisionTenant(ctx, "foo"))
+	interrupted, err := d.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, deprovisioning, interrupted)
+
+	unfinished, err := db.FindUnfinishedTenantDeprovisionings(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, unfinished, 1)
+}
@@ -0,0 +1,329 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+const (
+	// Number of file storage objects listed at once when reading or
+	// removing the chunks of a log
+	logChunksBatchSize = 1000
+)
+
+func deviceDeploymentLogObjectID(deploymentID, deviceID string) string {
+	return "logs/" + deploymentID + "/" + deviceID + ".json.gz"
+}
+
+func deviceDeploymentLogChunksPrefix(deploymentID, deviceID string) string {
+	return "logs/" + deploymentID + "/" + deviceID + "/"
+}
+
+func deviceDeploymentLogChunkObjectID(prefix string, sequence uint64) string {
+	return prefix + strconv.FormatUint(sequence, 10) + ".json.gz"
+}
+
+// logFilter reduces the messages of a log as they are read, for callers
+// which need only part of them.
+type logFilter func(messages []model.LogMessage) []model.LogMessage
+
+// storedDeploymentLog is the content of the log object in the file storage.
+type storedDeploymentLog struct {
+	Messages []model.LogMessage `json:"messages"`
+	// chunks appended after the last complete upload, by the versions of
+	// the service storing them along with the messages
+	Chunks []model.LogChunk `json:"chunks,omitempty"`
+}
+
+// uploadGzipJSON stores the value gzip-compressed JSON-encoded in the file
+// storage.
+func (d *Deployments) uploadGzipJSON(ctx context.Context,
+	objectID string, v interface{}) error {
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		return errors.Wrap(err, "failed to compress")
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "failed to compress")
+	}
+
+	return d.fileStorage.UploadArtifact(ctx, objectID, int64(buf.Len()),
+		&buf, GzipContentType)
+}
+
+// uploadDeviceDeploymentLog stores the log messages gzip-compressed in the
+// file storage, keeping only a reference in the database. The chunks
+// appended before are removed.
+func (d *Deployments) uploadDeviceDeploymentLog(ctx context.Context,
+	dlog model.DeploymentLog) error {
+
+	objectID := deviceDeploymentLogObjectID(dlog.DeploymentID, dlog.DeviceID)
+	if err := d.uploadGzipJSON(ctx, objectID, storedDeploymentLog{
+		Messages: dlog.Messages,
+		Chunks:   dlog.Chunks,
+	}); err != nil {
+		return errors.Wrap(err, "failed to upload deployment log")
+	}
+
+	if err := d.db.SaveDeviceDeploymentLogObject(ctx,
+		dlog.DeviceID, dlog.DeploymentID, objectID); err != nil {
+		return err
+	}
+
+	prefix := deviceDeploymentLogChunksPrefix(dlog.DeploymentID, dlog.DeviceID)
+	if err := d.deleteObjects(ctx, prefix); err != nil {
+		log.FromContext(ctx).Warnf("failed to remove log chunks %s: %v",
+			prefix, err)
+	}
+	return nil
+}
+
+// appendDeviceDeploymentLogObject stores the chunk in an object of its own
+// in the file storage. A re-sent chunk replaces the object of the chunk with
+// the same sequence number, so concurrent appends never lose chunks.
+func (d *Deployments) appendDeviceDeploymentLogObject(ctx context.Context,
+	deviceID, deploymentID string, chunk model.LogChunk) error {
+
+	prefix := deviceDeploymentLogChunksPrefix(deploymentID, deviceID)
+	if err := d.uploadGzipJSON(ctx,
+		deviceDeploymentLogChunkObjectID(prefix, chunk.Sequence),
+		chunk); err != nil {
+		return errors.Wrap(err, "failed to upload deployment log chunk")
+	}
+
+	return d.db.SaveDeviceDeploymentLogChunksPrefix(ctx,
+		deviceID, deploymentID, prefix)
+}
+
+// listObjects calls fn for each batch of IDs of the file storage objects
+// with the prefix.
+func (d *Deployments) listObjects(ctx context.Context, prefix string,
+	fn func(objectIDs []string) error) error {
+
+	after := ""
+	for {
+		objectIDs, err := d.fileStorage.ListObjects(ctx, prefix, after,
+			logChunksBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to list files")
+		}
+		if len(objectIDs) == 0 {
+			return nil
+		}
+		if err := fn(objectIDs); err != nil {
+			return err
+		}
+		after = objectIDs[len(objectIDs)-1]
+	}
+}
+
+// deleteObjects removes the file storage objects with the prefix.
+func (d *Deployments) deleteObjects(ctx context.Context, prefix string) error {
+	return d.listObjects(ctx, prefix, func(objectIDs []string) error {
+		for _, objectID := range objectIDs {
+			if err := d.fileStorage.Delete(ctx, objectID); err != nil {
+				return errors.Wrapf(err, "failed to remove file %s", objectID)
+			}
+		}
+		return nil
+	})
+}
+
+// downloadDeviceDeploymentLog reads the messages and chunks of the log stored
+// in the file storage, if any, reduced by the filter unless nil.
+func (d *Deployments) downloadDeviceDeploymentLog(ctx context.Context,
+	dlog *model.DeploymentLog, filter logFilter) (*model.DeploymentLog, error) {
+
+	if dlog.ObjectID != "" {
+		r, err := d.openGzipObject(ctx, dlog.ObjectID)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to download deployment log")
+		}
+		defer r.Close()
+
+		stored, err := decodeDeploymentLog(r, filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode deployment log")
+		}
+		dlog.Messages = stored.Messages
+		// chunks appended to the database before the log was moved are kept
+		dlog.Chunks = append(dlog.Chunks, stored.Chunks...)
+	}
+
+	if dlog.ChunksPrefix == "" {
+		return dlog, nil
+	}
+	err := d.listObjects(ctx, dlog.ChunksPrefix, func(objectIDs []string) error {
+		for _, objectID := range objectIDs {
+			chunk, err := d.downloadDeviceDeploymentLogChunk(ctx, objectID)
+			if err != nil {
+				return err
+			}
+			if filter != nil {
+				chunk.Messages = filter(chunk.Messages)
+			}
+			dlog.Chunks = append(dlog.Chunks, *chunk)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dlog, nil
+}
+
+func (d *Deployments) downloadDeviceDeploymentLogChunk(ctx context.Context,
+	objectID string) (*model.LogChunk, error) {
+
+	r, err := d.openGzipObject(ctx, objectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download deployment log chunk")
+	}
+	defer r.Close()
+
+	var chunk model.LogChunk
+	if err := json.NewDecoder(r).Decode(&chunk); err != nil {
+		return nil, errors.Wrap(err, "failed to decode deployment log chunk")
+	}
+	return &chunk, nil
+}
+
+// gzipObjectReader decompresses a file storage object.
+type gzipObjectReader struct {
+	*gzip.Reader
+	object io.ReadCloser
+}
+
+func (r *gzipObjectReader) Close() error {
+	r.Reader.Close()
+	return r.object.Close()
+}
+
+// openGzipObject returns the decompressed content of the file storage object.
+func (d *Deployments) openGzipObject(ctx context.Context,
+	objectID string) (io.ReadCloser, error) {
+
+	r, err := d.fileStorage.GetObject(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		r.Close()
+		return nil, errors.Wrap(err, "failed to decompress")
+	}
+	return &gzipObjectReader{Reader: zr, object: r}, nil
+}
+
+// decodeDeploymentLog decodes the messages and chunks of the stored log one
+// at a time, instead of buffering the whole document before decoding it. The
+// filter, unless nil, is applied after each message, and to each chunk.
+func decodeDeploymentLog(r io.Reader,
+	filter logFilter) (*storedDeploymentLog, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	stored := &storedDeploymentLog{Messages: []model.LogMessage{}}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "messages":
+			err = decodeList(dec, func() error {
+				var message model.LogMessage
+				if err := dec.Decode(&message); err != nil {
+					return err
+				}
+				stored.Messages = append(stored.Messages, message)
+				if filter != nil {
+					stored.Messages = filter(stored.Messages)
+				}
+				return nil
+			})
+		case "chunks":
+			err = decodeList(dec, func() error {
+				var chunk model.LogChunk
+				if err := dec.Decode(&chunk); err != nil {
+					return err
+				}
+				if filter != nil {
+					chunk.Messages = filter(chunk.Messages)
+				}
+				stored.Chunks = append(stored.Chunks, chunk)
+				return nil
+			})
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stored, expectDelim(dec, '}')
+}
+
+// decodeList calls decodeItem for each item of the list the decoder is at;
+// null is an empty list.
+func decodeList(dec *json.Decoder, decodeItem func() error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if token != json.Delim('[') {
+		return errors.Errorf("unexpected %v, expected [", token)
+	}
+	for dec.More() {
+		if err := decodeItem(); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return errors.Errorf("unexpected %v, expected %v", token, delim)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestDeviceDeploymentLogInFileStorage(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+
+	deployment := insertDeployment(t, ctx, db,
+		model.Stats{model.DeviceDeploymentStatusFailure: 1}, nil)
+	dd, err := model.NewDeviceDeployment("device-1", *deployment.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertMany(ctx, dd))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	messages := []model.LogMessage{
+		{Timestamp: &now, Level: "info", Message: "installing"},
+		{Timestamp: &now, Level: "error", Message: "failed"},
+	}
+
+	// a log saved in the database before enabling the file storage
+	d := NewDeployments(db, fs, ArtifactContentType)
+	assert.NoError(t, d.SaveDeviceDeploymentLog(ctx, "device-1", *deployment.Id,
+		messages[:1]))
+	assert.Empty(t, objects.objects)
+
+	d.WithLogsInFileStorage(true)
+	dlog, err := d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Equal(t, messages[:1], dlog.Messages)
+	}
+
+	assert.NoError(t, d.SaveDeviceDeploymentLog(ctx, "device-1", *deployment.Id,
+		messages))
+	assert.Len(t, objects.objects, 1)
+
+	stored, err := db.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, stored) {
+		assert.Empty(t, stored.Messages)
+		assert.NotEmpty(t, stored.ObjectID)
+	}
+
+	dlog, err = d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Equal(t, "device-1", dlog.DeviceID)
+		assert.Equal(t, *deployment.Id, dlog.DeploymentID)
+		assert.Equal(t, messages, dlog.Messages)
+	}
+
+	dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+	assert.NoError(t, err)
+	if assert.Len(t, dds, 1) {
+		assert.True(t, dds[0].IsLogAvailable)
+	}
+}
+
+func TestAppendDeviceDeploymentLog(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+
+	deployment := insertDeployment(t, ctx, db,
+		model.Stats{model.DeviceDeploymentStatusInstalling: 1}, nil)
+	dd, err := model.NewDeviceDeployment("device-1", *deployment.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertMany(ctx, dd))
+
+	at := func(sec int) *time.Time {
+		tm := time.Unix(1546300800+int64(sec), 0).UTC()
+		return &tm
+	}
+	chunks := []model.LogChunk{
+		{
+			Sequence: 0,
+			Messages: []model.LogMessage{
+				{Timestamp: at(0), Level: "info", Message: "downloading"},
+			},
+		},
+		{
+			Sequence: 1,
+			Messages: []model.LogMessage{
+				{Timestamp: at(10), Level: "info", Message: "installing"},
+			},
+		},
+	}
+
+	for _, logsInFileStorage := range []bool{false, true} {
+		d := NewDeployments(db, fs, ArtifactContentType).
+			WithLogsInFileStorage(logsInFileStorage)
+
+		err = d.AppendDeviceDeploymentLog(ctx, "device-2", *deployment.Id, chunks[0])
+		assert.Equal(t, ErrModelDeploymentNotFound, err)
+
+		err = d.AppendDeviceDeploymentLog(ctx, "device-1", *deployment.Id,
+			model.LogChunk{Sequence: 2})
+		assert.EqualError(t, err, "Invalid deployment log: no messages: invalid log chunk")
+
+		// the second chunk arrives first and is re-sent
+		for _, i := range []int{1, 0, 1} {
+			assert.NoError(t, d.AppendDeviceDeploymentLog(ctx,
+				"device-1", *deployment.Id, chunks[i]))
+		}
+
+		dlog, err := d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, dlog) {
+			assert.Equal(t, append(chunks[0].Messages, chunks[1].Messages...),
+				dlog.Messages)
+			assert.Empty(t, dlog.Chunks)
+		}
+
+		// the chunks are stored as objects of their own, not in the
+		// database
+		stored, err := db.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, stored) {
+			if logsInFileStorage {
+				assert.Empty(t, stored.Chunks)
+				assert.Empty(t, stored.ObjectID)
+				assert.NotEmpty(t, stored.ChunksPrefix)
+				assert.Len(t, objects.objects, 2)
+			} else {
+				assert.Len(t, stored.Chunks, 2)
+				assert.Empty(t, stored.ObjectID)
+			}
+		}
+
+		dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+			model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+		assert.NoError(t, err)
+		if assert.Len(t, dds, 1) {
+			assert.True(t, dds[0].IsLogAvailable)
+		}
+
+		// the complete log uploaded at the end replaces the chunks
+		final := []model.LogMessage{
+			{Timestamp: at(0), Level: "info", Message: "downloading"},
+			{Timestamp: at(10), Level: "info", Message: "installing"},
+			{Timestamp: at(20), Level: "info", Message: "rebooting"},
+		}
+		assert.NoError(t, d.SaveDeviceDeploymentLog(ctx,
+			"device-1", *deployment.Id, final))
+
+		dlog, err = d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, dlog) {
+			assert.Equal(t, final, dlog.Messages)
+		}
+		if logsInFileStorage {
+			assert.Len(t, objects.objects, 1)
+		}
+
+		// chunks appended after the complete upload are merged
+		late := model.LogChunk{
+			Sequence: 5,
+			Messages: []model.LogMessage{
+				{Timestamp: at(15), Level: "info", Message: "late"},
+			},
+		}
+		assert.NoError(t, d.AppendDeviceDeploymentLog(ctx,
+			"device-1", *deployment.Id, late))
+		dlog, err = d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, dlog) && assert.Len(t, dlog.Messages, 4) {
+			assert.Equal(t, "late", dlog.Messages[2].Message)
+		}
+
+		assert.NoError(t, db.DeleteDeviceDeploymentLogs(ctx, *deployment.Id))
+	}
+}
+
+func TestDecodeDeploymentLog(t *testing.T) {
+	tm := time.Unix(1546300800, 0).UTC()
+
+	testCases := map[string]struct {
+		doc      string
+		filter   logFilter
+		messages []model.LogMessage
+		chunks   []model.LogChunk
+		err      string
+	}{
+		"ok": {
+			doc: `{"messages":[` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"info","message":"foo"},` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"error","message":"bar"}]}`,
+			messages: []model.LogMessage{
+				{Timestamp: &tm, Level: "info", Message: "foo"},
+				{Timestamp: &tm, Level: "error", Message: "bar"},
+			},
+		},
+		"ok, other fields": {
+			doc: `{"version":{"major":1},"messages":[` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"info","message":"foo"}],"tags":["a"]}`,
+			messages: []model.LogMessage{
+				{Timestamp: &tm, Level: "info", Message: "foo"},
+			},
+		},
+		"ok, chunks": {
+			doc: `{"messages":[],"chunks":[` +
+				`{"sequence":1,"messages":[{"timestamp":"2019-01-01T00:00:00Z","level":"info","message":"foo"}]}]}`,
+			messages: []model.LogMessage{},
+			chunks: []model.LogChunk{
+				{
+					Sequence: 1,
+					Messages: []model.LogMessage{
+						{Timestamp: &tm, Level: "info", Message: "foo"},
+					},
+				},
+			},
+		},
+		"ok, failure signature messages": {
+			doc: `{"messages":[` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"error","message":"foo"},` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"error","message":"bar"},` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"info","message":"baz"},` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"error","message":"qux"},` +
+				`{"timestamp":"2019-01-01T00:00:00Z","level":"error","message":"quux"}],"chunks":[` +
+				`{"sequence":1,"messages":[{"timestamp":"2019-01-01T00:00:00Z","level":"info","message":"foo"}]}]}`,
+			filter: model.FailureSignatureMessages,
+			messages: []model.LogMessage{
+				{Timestamp: &tm, Level: "error", Message: "bar"},
+				{Timestamp: &tm, Level: "error", Message: "qux"},
+				{Timestamp: &tm, Level: "error", Message: "quux"},
+			},
+			chunks: []model.LogChunk{
+				{Sequence: 1, Messages: []model.LogMessage{}},
+			},
+		},
+		"ok, no messages": {
+			doc:      `{}`,
+			messages: []model.LogMessage{},
+		},
+		"ok, null messages": {
+			doc:      `{"messages":null}`,
+			messages: []model.LogMessage{},
+		},
+		"error, not an object": {
+			doc: `[]`,
+			err: "unexpected [, expected {",
+		},
+		"error, messages not a list": {
+			doc: `{"messages":{}}`,
+			err: "unexpected {, expected [",
+		},
+		"error, truncated": {
+			doc: `{"messages":[{"timestamp":"2019-01-01T00:00:00Z"`,
+			err: "unexpected EOF",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			stored, err := decodeDeploymentLog(strings.NewReader(tc.doc), tc.filter)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.messages, stored.Messages)
+				assert.Equal(t, tc.chunks, stored.Chunks)
+			}
+		})
+	}
+}
+
+func TestAppendDeviceDeploymentLogConcurrently(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, _ := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType).WithLogsInFileStorage(true)
+
+	deployment := insertDeployment(t, ctx, db,
+		model.Stats{model.DeviceDeploymentStatusInstalling: 1}, nil)
+	dd, err := model.NewDeviceDeployment("device-1", *deployment.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertMany(ctx, dd))
+
+	const count = 20
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tm := time.Unix(1546300800+int64(i), 0).UTC()
+			assert.NoError(t, d.AppendDeviceDeploymentLog(ctx,
+				"device-1", *deployment.Id, model.LogChunk{
+					Sequence: uint64(i),
+					Messages: []model.LogMessage{
+						{Timestamp: &tm, Level: "info", Message: strconv.Itoa(i)},
+					},
+				}))
+		}(i)
+	}
+	wg.Wait()
+
+	dlog, err := d.GetDeviceDeploymentLog(ctx, "device-1", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) && assert.Len(t, dlog.Messages, count) {
+		for i, message := range dlog.Messages {
+			assert.Equal(t, strconv.Itoa(i), message.Message)
+		}
+	}
+}
@@ -0,0 +1,618 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+	mstore "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/store/mongo"
+	"github.com/mendersoftware/deployments/utils/pointers"
+)
+
+func TestUpdateDeviceDeploymentStatus(t *testing.T) {
+	const deploymentID = "d6ff7d08-2a2c-4c4f-a9e1-2b8c6b2d4a7b"
+
+	percent := 40
+	progress := &model.DeviceDeploymentProgress{Percent: &percent}
+
+	testCases := map[string]struct {
+		status   string
+		progress *model.DeviceDeploymentProgress
+
+		currentStatus    string
+		replacedStatus   string
+		updateErr        error
+		statusAfterRace  string
+		updateStatsCalls bool
+		updateStatsErr   error
+		recomputeErr     error
+		transition       bool
+		lenient          bool
+
+		err string
+	}{
+		"ok": {
+			status:           model.DeviceDeploymentStatusSuccess,
+			currentStatus:    model.DeviceDeploymentStatusInstalling,
+			updateStatsCalls: true,
+		},
+		"ok, same status": {
+			status:        model.DeviceDeploymentStatusInstalling,
+			currentStatus: model.DeviceDeploymentStatusInstalling,
+			transition:    true,
+		},
+		"ok, same final status": {
+			status:        model.DeviceDeploymentStatusSuccess,
+			currentStatus: model.DeviceDeploymentStatusSuccess,
+		},
+		"ok, progress": {
+			status:           model.DeviceDeploymentStatusInstalling,
+			progress:         progress,
+			currentStatus:    model.DeviceDeploymentStatusDownloading,
+			updateStatsCalls: true,
+		},
+		"ok, progress in same status": {
+			status:        model.DeviceDeploymentStatusInstalling,
+			progress:      progress,
+			currentStatus: model.DeviceDeploymentStatusInstalling,
+		},
+		"error, aborted": {
+			status:        model.DeviceDeploymentStatusSuccess,
+			currentStatus: model.DeviceDeploymentStatusAborted,
+			err:           ErrDeploymentAborted.Error(),
+		},
+		"error, decommissioned": {
+			status:        model.DeviceDeploymentStatusSuccess,
+			currentStatus: model.DeviceDeploymentStatusDecommissioned,
+			err:           ErrDeviceDecommissioned.Error(),
+		},
+		"error, aborted concurrently": {
+			status:          model.DeviceDeploymentStatusSuccess,
+			currentStatus:   model.DeviceDeploymentStatusInstalling,
+			updateErr:       mongo.ErrStorageNotFound,
+			statusAfterRace: model.DeviceDeploymentStatusAborted,
+			err:             ErrDeploymentAborted.Error(),
+		},
+		"error, not found": {
+			status:        model.DeviceDeploymentStatusSuccess,
+			currentStatus: model.DeviceDeploymentStatusInstalling,
+			updateErr:     mongo.ErrStorageNotFound,
+			err:           mongo.ErrStorageNotFound.Error(),
+		},
+		"error, invalid transition": {
+			status:        model.DeviceDeploymentStatusDownloading,
+			currentStatus: model.DeviceDeploymentStatusSuccess,
+			err:           "success to downloading: invalid status transition",
+		},
+		"ok, invalid transition, lenient": {
+			status:           model.DeviceDeploymentStatusDownloading,
+			currentStatus:    model.DeviceDeploymentStatusSuccess,
+			lenient:          true,
+			updateStatsCalls: true,
+		},
+		"error, invalid transition concurrently": {
+			status:          model.DeviceDeploymentStatusInstalling,
+			currentStatus:   model.DeviceDeploymentStatusDownloading,
+			updateErr:       mongo.ErrStorageNotFound,
+			statusAfterRace: model.DeviceDeploymentStatusFailure,
+			err:             "failure to installing: invalid status transition",
+		},
+		"ok, same status concurrently": {
+			status:          model.DeviceDeploymentStatusSuccess,
+			currentStatus:   model.DeviceDeploymentStatusInstalling,
+			updateErr:       mongo.ErrStorageNotFound,
+			statusAfterRace: model.DeviceDeploymentStatusSuccess,
+		},
+		"ok, same status replaced concurrently": {
+			status:         model.DeviceDeploymentStatusSuccess,
+			currentStatus:  model.DeviceDeploymentStatusInstalling,
+			replacedStatus: model.DeviceDeploymentStatusSuccess,
+		},
+		"ok, stats conflict, recomputed": {
+			status:           model.DeviceDeploymentStatusSuccess,
+			currentStatus:    model.DeviceDeploymentStatusInstalling,
+			updateStatsCalls: true,
+			updateStatsErr:   mongo.ErrStorageConflict,
+		},
+		"error, stats conflict, recomputing failed": {
+			status:           model.DeviceDeploymentStatusSuccess,
+			currentStatus:    model.DeviceDeploymentStatusInstalling,
+			updateStatsCalls: true,
+			updateStatsErr:   mongo.ErrStorageConflict,
+			recomputeErr:     errors.New("connection failed"),
+			err: "failed to update deployment stats: " +
+				mongo.ErrStorageConflict.Error(),
+		},
+		"error, update failed": {
+			status:        model.DeviceDeploymentStatusSuccess,
+			currentStatus: model.DeviceDeploymentStatusInstalling,
+			updateErr:     errors.New("connection failed"),
+			err:           "connection failed",
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			replacedStatus := tc.currentStatus
+			if tc.replacedStatus != "" {
+				replacedStatus = tc.replacedStatus
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetDeviceDeploymentStatus", mock.Anything,
+				deploymentID, "foo").Return(tc.currentStatus, nil).Once()
+			db.On("GetDeviceDeploymentStatus", mock.Anything,
+				deploymentID, "foo").Return(tc.statusAfterRace, nil).Once()
+			db.On("UpdateDeviceDeploymentStatus", mock.Anything,
+				"foo", deploymentID,
+				mock.MatchedBy(func(s model.DeviceDeploymentStatus) bool {
+					return s.Status == tc.status &&
+						(s.FinishTime != nil) ==
+							model.IsDeviceDeploymentStatusFinished(tc.status) &&
+						s.Progress == tc.progress &&
+						s.PreviousStatus == tc.currentStatus &&
+						s.Timestamp.IsZero() == (tc.status == tc.currentStatus)
+				})).Return(replacedStatus, tc.updateErr)
+			db.On("UpdateStats", mock.Anything,
+				deploymentID, tc.currentStatus, tc.status).
+				Return(tc.updateStatsErr)
+			// recomputing the stats after a failed update
+			deployment := &model.Deployment{
+				Id:    pointers.StringToPointer(deploymentID),
+				Stats: model.NewDeviceDeploymentStats(),
+			}
+			deployment.Stats[tc.currentStatus] = 1
+			stats := model.NewDeviceDeploymentStats()
+			stats[tc.status] = 1
+			db.On("FindDeploymentByID", mock.Anything, deploymentID).
+				Return(deployment, tc.recomputeErr)
+			db.On("AggregateDeviceDeploymentByStatus", mock.Anything,
+				deploymentID).Return(stats, nil)
+			db.On("GetDeviceStatusesForDeployment", mock.Anything,
+				mock.AnythingOfType("model.DeviceDeploymentsQuery")).
+				Return([]model.DeviceDeployment{}, 0, nil)
+			db.On("ReplaceStats", mock.Anything, deploymentID,
+				model.Stats(deployment.Stats), stats, mock.Anything).Return(nil)
+			db.On("ReleaseDeviceDeployment", mock.Anything,
+				"foo", deploymentID).Return(false, nil)
+			db.On("AddDeviceDeploymentTransition", mock.Anything,
+				"foo", deploymentID,
+				mock.MatchedBy(func(tr model.DeviceDeploymentTransition) bool {
+					return tr.From == tc.currentStatus && tr.To == tc.status &&
+						!tr.Timestamp.IsZero()
+				})).Return(nil)
+
+			d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType).
+				WithLenientStatusTransitions(tc.lenient)
+
+			err := d.UpdateDeviceDeploymentStatus(context.Background(),
+				deploymentID, "foo", model.DeviceDeploymentStatus{
+					Status:   tc.status,
+					Progress: tc.progress,
+				})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.updateStatsCalls {
+				db.AssertCalled(t, "UpdateStats", mock.Anything,
+					deploymentID, tc.currentStatus, tc.status)
+			} else {
+				db.AssertNotCalled(t, "UpdateStats", mock.Anything,
+					mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.transition {
+				db.AssertCalled(t, "AddDeviceDeploymentTransition",
+					mock.Anything, "foo", deploymentID, mock.Anything)
+			} else {
+				db.AssertNotCalled(t, "AddDeviceDeploymentTransition",
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			// released even if updating the stats fails
+			if tc.updateStatsCalls &&
+				model.IsDeviceDeploymentStatusFinished(tc.status) {
+				db.AssertCalled(t, "ReleaseDeviceDeployment", mock.Anything,
+					"foo", deploymentID)
+			} else {
+				db.AssertNotCalled(t, "ReleaseDeviceDeployment", mock.Anything,
+					mock.Anything, mock.Anything)
+			}
+			if tc.updateStatsErr != nil && tc.recomputeErr == nil {
+				db.AssertCalled(t, "ReplaceStats", mock.Anything,
+					deploymentID, model.Stats(deployment.Stats), stats, mock.Anything)
+			} else {
+				db.AssertNotCalled(t, "ReplaceStats", mock.Anything,
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.progress != nil {
+				db.AssertCalled(t, "UpdateDeviceDeploymentStatus",
+					mock.Anything, "foo", deploymentID, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestDeploymentProgress(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"device"},
+		})
+	assert.NoError(t, err)
+	deployment.Stats[model.DeviceDeploymentStatusPending] = 4
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+	image := insertImage(t, ctx, db, artifact)
+	for _, device := range []string{"a", "b", "c", "d"} {
+		dd, err := model.NewDeviceDeployment(device, *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+		assert.NoError(t, db.AssignArtifact(ctx, device, *deployment.Id,
+			image, "foo"))
+	}
+
+	progress, err := d.GetDeploymentProgress(ctx,
+		"d1b2b5a8-0c2e-4f5d-9a43-7b7d1f3e8c11")
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	progress, err = d.GetDeploymentProgress(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.DeploymentProgress{}, progress)
+
+	int64Ptr := func(v int64) *int64 { return &v }
+	intPtr := func(v int) *int { return &v }
+	reports := []struct {
+		device   string
+		status   string
+		progress *model.DeviceDeploymentProgress
+	}{
+		{"a", model.DeviceDeploymentStatusDownloading,
+			&model.DeviceDeploymentProgress{
+				BytesDownloaded: int64Ptr(100),
+				BytesTotal:      int64Ptr(1000),
+			}},
+		// the latest report replaces the previous one
+		{"a", model.DeviceDeploymentStatusDownloading,
+			&model.DeviceDeploymentProgress{
+				BytesDownloaded: int64Ptr(500),
+				BytesTotal:      int64Ptr(1000),
+				Percent:         intPtr(50),
+			}},
+		{"b", model.DeviceDeploymentStatusInstalling,
+			&model.DeviceDeploymentProgress{
+				Percent: intPtr(10),
+			}},
+		// finished devices do not count
+		{"c", model.DeviceDeploymentStatusDownloading,
+			&model.DeviceDeploymentProgress{
+				BytesDownloaded: int64Ptr(1000),
+				BytesTotal:      int64Ptr(1000),
+			}},
+		{"c", model.DeviceDeploymentStatusSuccess, nil},
+		// neither do devices which did not report progress
+		{"d", model.DeviceDeploymentStatusDownloading, nil},
+	}
+	for _, r := range reports {
+		assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, *deployment.Id,
+			r.device, model.DeviceDeploymentStatus{
+				Status:   r.status,
+				Progress: r.progress,
+			}))
+	}
+
+	statuses, _, err := d.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+	assert.NoError(t, err)
+	for _, dd := range statuses {
+		switch *dd.DeviceId {
+		case "a":
+			assert.Equal(t, reports[1].progress, dd.Progress)
+		case "b":
+			assert.Equal(t, reports[2].progress, dd.Progress)
+		default:
+			assert.Nil(t, dd.Progress)
+		}
+	}
+
+	progress, err = d.GetDeploymentProgress(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	percent := float64(30)
+	assert.Equal(t, &model.DeploymentProgress{
+		Devices:         2,
+		BytesDownloaded: 500,
+		BytesTotal:      1000,
+		Percent:         &percent,
+	}, progress)
+
+	stats, err := d.GetDeploymentStats(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats[model.DeviceDeploymentStatusDownloading])
+	assert.Equal(t, 1, stats[model.DeviceDeploymentStatusInstalling])
+}
+
+func TestUpdateDeviceDeploymentStatusConcurrent(t *testing.T) {
+	const (
+		devices = 20
+		// number of reporters sending the final status for each device,
+		// e.g. a device retrying a request
+		reporters = 3
+	)
+
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"device"},
+		})
+	assert.NoError(t, err)
+	deployment.Stats[model.DeviceDeploymentStatusPending] = devices
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+	image := insertImage(t, ctx, db, artifact)
+
+	for i := 0; i < devices; i++ {
+		dd, err := model.NewDeviceDeployment(fmt.Sprintf("device-%d", i),
+			*deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+		assert.NoError(t, db.AssignArtifact(ctx, *dd.DeviceId,
+			*deployment.Id, image, "foo"))
+	}
+
+	final := []string{
+		model.DeviceDeploymentStatusSuccess,
+		model.DeviceDeploymentStatusFailure,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < devices; i++ {
+		wg.Add(1)
+		go func(device string, last string) {
+			defer wg.Done()
+			for _, status := range []string{
+				model.DeviceDeploymentStatusDownloading,
+				model.DeviceDeploymentStatusInstalling,
+				model.DeviceDeploymentStatusRebooting,
+			} {
+				err := d.UpdateDeviceDeploymentStatus(ctx,
+					*deployment.Id, device,
+					model.DeviceDeploymentStatus{Status: status})
+				assert.NoError(t, err)
+			}
+
+			var rwg sync.WaitGroup
+			for r := 0; r < reporters; r++ {
+				rwg.Add(1)
+				go func() {
+					defer rwg.Done()
+					err := d.UpdateDeviceDeploymentStatus(ctx,
+						*deployment.Id, device,
+						model.DeviceDeploymentStatus{Status: last})
+					assert.NoError(t, err)
+				}()
+			}
+			rwg.Wait()
+		}(fmt.Sprintf("device-%d", i), final[i%len(final)])
+	}
+	wg.Wait()
+
+	stats, err := db.AggregateDeviceDeploymentByStatus(ctx, *deployment.Id)
+	assert.NoError(t, err)
+
+	deployment, err = db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, stats, model.Stats(deployment.Stats))
+	assert.NotNil(t, deployment.Finished)
+}
+
+func TestUpdateDeviceDeploymentStatusConflict(t *testing.T) {
+	const deploymentID = "d6ff7d08-2a2c-4c4f-a9e1-2b8c6b2d4a7b"
+
+	// the status keeps changing between reading and updating it
+	db := &mstore.DataStore{}
+	db.On("GetDeviceDeploymentStatus", mock.Anything,
+		deploymentID, "foo").Return(model.DeviceDeploymentStatusInstalling, nil)
+	db.On("UpdateDeviceDeploymentStatus", mock.Anything,
+		"foo", deploymentID, mock.AnythingOfType("model.DeviceDeploymentStatus")).
+		Return("", mongo.ErrStorageNotFound)
+
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+	err := d.UpdateDeviceDeploymentStatus(context.Background(),
+		deploymentID, "foo", model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusSuccess,
+		})
+	assert.Equal(t, ErrModelStatusConflict, err)
+	db.AssertNumberOfCalls(t, "UpdateDeviceDeploymentStatus",
+		maxStatusUpdateAttempts)
+}
+
+func TestGetDeviceDeploymentHistory(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	// three deployments of "device", one per hour, and one of another device
+	ids := make([]string, 3)
+	for i := range ids {
+		name, artifact := fmt.Sprintf("deployment-%d", i), fmt.Sprintf("artifact-%d", i)
+		deployment, err := model.NewDeploymentFromConstructor(
+			&model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &artifact,
+				Devices:      []string{"device"},
+			})
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertDeployment(ctx, deployment))
+		ids[i] = *deployment.Id
+
+		dd, err := model.NewDeviceDeployment("device", *deployment.Id)
+		assert.NoError(t, err)
+		created := base.Add(time.Duration(i) * time.Hour)
+		dd.Created = &created
+		if i < 2 {
+			status := model.DeviceDeploymentStatusSuccess
+			dd.Status = &status
+			dd.IsLogAvailable = i == 0
+		}
+		dd.Image = &model.SoftwareImage{Id: fmt.Sprintf("image-%d", i)}
+
+		other, err := model.NewDeviceDeployment("other", *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd, other))
+	}
+
+	testCases := map[string]struct {
+		query model.DeviceDeploymentHistoryQuery
+
+		deployments []string
+	}{
+		"all": {
+			query:       model.DeviceDeploymentHistoryQuery{DeviceID: "device"},
+			deployments: []string{ids[2], ids[1], ids[0]},
+		},
+		"status": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Status:   model.DeviceDeploymentStatusSuccess,
+			},
+			deployments: []string{ids[1], ids[0]},
+		},
+		"created range": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID:      "device",
+				CreatedAfter:  timePtr(base.Add(time.Minute)),
+				CreatedBefore: timePtr(base.Add(90 * time.Minute)),
+			},
+			deployments: []string{ids[1]},
+		},
+		"skip, limit": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Skip:     1,
+				Limit:    1,
+			},
+			deployments: []string{ids[1]},
+		},
+		"skip past the end": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Skip:     3,
+			},
+			deployments: []string{},
+		},
+		"unknown device": {
+			query:       model.DeviceDeploymentHistoryQuery{DeviceID: "foo"},
+			deployments: []string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			history, err := d.GetDeviceDeploymentHistory(ctx, tc.query)
+			assert.NoError(t, err)
+
+			deployments := []string{}
+			for _, entry := range history {
+				deployments = append(deployments, entry.DeploymentID)
+			}
+			assert.Equal(t, tc.deployments, deployments)
+		})
+	}
+
+	history, err := d.GetDeviceDeploymentHistory(ctx,
+		model.DeviceDeploymentHistoryQuery{DeviceID: "device", Skip: 2})
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		entry := history[0]
+		assert.Equal(t, "deployment-0", entry.DeploymentName)
+		assert.Equal(t, "artifact-0", entry.ArtifactName)
+		assert.Equal(t, "image-0", entry.ArtifactID)
+		assert.Equal(t, model.DeviceDeploymentStatusSuccess, entry.Status)
+		assert.True(t, entry.IsLogAvailable)
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestGetDeviceStatusesForDeploymentDeviceType(t *testing.T) {
+	ctx := context.Background()
+
+	db := inmem.NewDataStoreInMem()
+	fs := &fs_mocks.FileStorage{}
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+
+	// the device type is the one reported when getting the deployment
+	instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx, "a",
+		model.InstalledDeviceDeployment{Artifact: "baz", DeviceType: "foo"})
+	assert.NoError(t, err)
+	assert.NotNil(t, instructions)
+
+	statuses, total, err := d.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: id, DeviceType: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, "a", *statuses[0].DeviceId)
+		assert.Equal(t, "foo", *statuses[0].DeviceType)
+	}
+
+	statuses, total, err = d.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: id, DeviceType: "bar"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Empty(t, statuses)
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func insertDeltaImage(t *testing.T, ctx context.Context, db *inmem.DataStoreInMem,
+	deviceType, from, to string) *model.SoftwareImage {
+
+	uid, err := uuid.NewV4()
+	assert.NoError(t, err)
+
+	image := model.NewSoftwareImage(
+		uid.String(),
+		&model.SoftwareImageMetaConstructor{},
+		&model.SoftwareImageMetaArtifactConstructor{
+			Name:                  "v2",
+			DeviceTypesCompatible: []string{deviceType},
+			Info: &model.ArtifactInfo{
+				Format:  "mender",
+				Version: 3,
+			},
+			Provides: map[string]string{
+				"artifact_name":         "v2",
+				"rootfs-image.checksum": to,
+			},
+			Depends: map[string][]string{
+				"device_type":           {deviceType},
+				"rootfs-image.checksum": {from},
+			},
+		},
+		4)
+	assert.NoError(t, db.InsertImage(ctx, image))
+
+	return image
+}
+
+func TestGetDeploymentForDeviceWithProvides(t *testing.T) {
+	ctx := context.Background()
+
+	provides := func(deviceType, artifact, checksum string) model.InstalledDeviceDeployment {
+		return model.DeviceProvides{
+			Provides: map[string]string{
+				"artifact_name":         artifact,
+				"device_type":           deviceType,
+				"rootfs-image.checksum": checksum,
+			},
+		}.InstalledDeviceDeployment()
+	}
+
+	testCases := map[string]struct {
+		installed model.InstalledDeviceDeployment
+
+		image  string
+		status string
+	}{
+		"ok, artifact matching the depends": {
+			installed: provides("foo", "v1", "a"),
+			image:     "foo",
+			status:    model.DeviceDeploymentStatusPending,
+		},
+		"ok, artifact of another device type": {
+			installed: provides("bar", "v1", "b"),
+			image:     "bar",
+			status:    model.DeviceDeploymentStatusPending,
+		},
+		"ok, depends not satisfied": {
+			installed: provides("foo", "v1", "b"),
+			status:    model.DeviceDeploymentStatusNoArtifact,
+		},
+		"ok, already installed": {
+			installed: provides("foo", "v2", "c"),
+			status:    model.DeviceDeploymentStatusAlreadyInst,
+		},
+		"ok, same name, other provides": {
+			installed: provides("foo", "v2", "x"),
+			status:    model.DeviceDeploymentStatusNoArtifact,
+		},
+		"ok, artifact not in the deployment": {
+			installed: provides("baz", "v1", "a"),
+			status:    model.DeviceDeploymentStatusNoArtifact,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			db := inmem.NewDataStoreInMem()
+			fs := &fs_mocks.FileStorage{}
+			d := NewDeployments(db, fs, ArtifactContentType)
+
+			images := map[string]*model.SoftwareImage{
+				"foo": insertDeltaImage(t, ctx, db, "foo", "a", "c"),
+				"bar": insertDeltaImage(t, ctx, db, "bar", "b", "c"),
+			}
+			name, artifact := "foo", "v2"
+			id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &artifact,
+				Devices:      []string{"device"},
+			})
+			assert.NoError(t, err)
+			// artifacts uploaded after the deployment was created are
+			// not part of it
+			insertDeltaImage(t, ctx, db, "baz", "a", "c")
+
+			if tc.image != "" {
+				fs.On("GetRequest", mock.Anything, images[tc.image].Id,
+					DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+					Return(&model.Link{Uri: "http://foo"}, nil)
+			}
+
+			instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+				"device", tc.installed)
+			assert.NoError(t, err)
+			if tc.image != "" {
+				if assert.NotNil(t, instructions) {
+					assert.Equal(t, id, instructions.ID)
+				}
+			} else {
+				assert.Nil(t, instructions)
+			}
+
+			status, err := db.GetDeviceDeploymentStatus(ctx, id, "device")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, status)
+			fs.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestIterateDeviceStatusesForDeployment(t *testing.T) {
+	ctx := context.Background()
+
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b", "c"},
+	})
+	assert.NoError(t, err)
+
+	var devices []string
+	err = d.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: id},
+		func(dd *model.DeviceDeployment) error {
+			assert.Equal(t, id, *dd.DeploymentId)
+			assert.Equal(t, model.DeviceDeploymentStatusPending, *dd.Status)
+			devices = append(devices, *dd.DeviceId)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, devices)
+
+	// filtered and sorted as requested, not paged
+	assert.NoError(t, db.UpdateDeviceDeploymentLogAvailability(ctx,
+		"a", id, true))
+	devices = nil
+	isLogAvailable := false
+	err = d.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{
+			DeploymentID:   id,
+			IsLogAvailable: &isLogAvailable,
+			SortDescending: true,
+			Limit:          1,
+		},
+		func(dd *model.DeviceDeployment) error {
+			devices = append(devices, *dd.DeviceId)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "b"}, devices)
+
+	// errors of the callback stop the iteration
+	calls := 0
+	err = d.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: id},
+		func(dd *model.DeviceDeployment) error {
+			calls++
+			return errors.New("write failed")
+		})
+	assert.EqualError(t, err, "write failed")
+	assert.Equal(t, 1, calls)
+
+	err = d.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{
+			DeploymentID: "3f3a4c4e-cbbb-4e3c-8fe6-4e5b2a7d9f0e",
+		},
+		func(dd *model.DeviceDeployment) error {
+			t.Error("unexpected device deployment")
+			return nil
+		})
+	assert.Equal(t, ErrModelDeploymentNotFound, err)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestGetDeploymentFailureSummary(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+	d := NewDeployments(db, fs, ArtifactContentType).
+		WithLogsInFileStorage(true)
+
+	summary, err := d.GetDeploymentFailureSummary(ctx,
+		"4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1")
+	assert.NoError(t, err)
+	assert.Nil(t, summary)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b", "c", "d", "e"},
+	})
+	assert.NoError(t, err)
+
+	now := time.Now()
+	subState := "ArtifactInstall"
+	logs := map[string][]model.LogMessage{
+		"a": {
+			{Timestamp: &now, Level: "info", Message: "installing"},
+			{Timestamp: &now, Level: "error", Message: "write to /dev/mmcblk0p2 failed: no space left"},
+		},
+		"b": {
+			{Timestamp: &now, Level: "error", Message: "write to /dev/mmcblk0p3 failed: no space left"},
+			{Timestamp: &now, Level: "info", Message: "rolling back"},
+		},
+		"c": {
+			{Timestamp: &now, Level: "info", Message: "installing"},
+		},
+		"e": {
+			{Timestamp: &now, Level: "error", Message: "connection refused"},
+		},
+	}
+	for _, device := range []string{"a", "b", "c", "d", "e"} {
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			device, installed)
+		assert.NoError(t, err)
+		assert.NotNil(t, instructions)
+
+		status := model.DeviceDeploymentStatusFailure
+		if device == "d" {
+			status = model.DeviceDeploymentStatusSuccess
+		}
+		assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, device,
+			model.DeviceDeploymentStatus{
+				Status:   status,
+				SubState: &subState,
+			}))
+		if messages, ok := logs[device]; ok {
+			assert.NoError(t, d.SaveDeviceDeploymentLog(ctx, device, id,
+				messages))
+		}
+	}
+
+	// the log of e cannot be read anymore
+	delete(objects.objects, deviceDeploymentLogObjectID(id, "e"))
+
+	summary, err = d.GetDeploymentFailureSummary(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.FailureSummary{
+		Failed: 4,
+		BySubState: []model.FailureGroup{{
+			Key:           "ArtifactInstall",
+			Count:         4,
+			SampleDevices: []string{"a", "b", "c", "e"},
+		}},
+		ByDeviceType: []model.FailureGroup{{
+			Key:           "foo",
+			Count:         4,
+			SampleDevices: []string{"a", "b", "c", "e"},
+		}},
+		BySignature: []model.FailureGroup{{
+			Key:           "",
+			Count:         2,
+			SampleDevices: []string{"c", "e"},
+		}, {
+			Key:           "write to /dev/mmcblk<n>p<n> failed: no space left",
+			Count:         2,
+			SampleDevices: []string{"a", "b"},
+		}},
+	}, summary)
+}
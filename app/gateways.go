@@ -0,0 +1,111 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+var (
+	ErrGatewayNotAuthorized = errors.New("Gateway not authorized for the device")
+)
+
+// SetGatewayDevices replaces the list of devices the gateway of ID
+// `gatewayID` may submit reports for.
+func (d *Deployments) SetGatewayDevices(ctx context.Context, gatewayID string,
+	devices model.GatewayDevices) error {
+
+	if err := d.db.SetGatewayDevices(ctx, gatewayID, devices); err != nil {
+		return errors.Wrap(err, "failed to save gateway devices")
+	}
+	return nil
+}
+
+// GetGatewayDevices returns the devices the gateway may submit reports for,
+// nil if they were never set.
+func (d *Deployments) GetGatewayDevices(ctx context.Context,
+	gatewayID string) (*model.GatewayDevices, error) {
+
+	devices, err := d.db.GetGatewayDevices(ctx, gatewayID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get gateway devices")
+	}
+	return devices, nil
+}
+
+// SubmitGatewayReports applies the reports submitted by the gateway on
+// behalf of its devices, as if each device reported on its own: the log is
+// saved first, then the status is updated. Returns the error of each report,
+// in the order of the reports; nil for those applied successfully.
+func (d *Deployments) SubmitGatewayReports(ctx context.Context, gatewayID string,
+	reports []model.GatewayReport) ([]error, error) {
+
+	gateway, err := d.GetGatewayDevices(ctx, gatewayID)
+	if err != nil {
+		return nil, err
+	}
+	authorized := map[string]bool{}
+	if gateway != nil {
+		for _, device := range gateway.Devices {
+			authorized[device] = true
+		}
+	}
+
+	results := make([]error, len(reports))
+	for i, report := range reports {
+		if err := report.Validate(); err != nil {
+			results[i] = err
+			continue
+		}
+		if !authorized[report.DeviceID] {
+			results[i] = ErrGatewayNotAuthorized
+			continue
+		}
+		results[i] = d.submitGatewayReport(ctx, report)
+	}
+
+	return results, nil
+}
+
+func (d *Deployments) submitGatewayReport(ctx context.Context,
+	report model.GatewayReport) error {
+
+	if report.Log != nil {
+		if err := d.SaveDeviceDeploymentLog(ctx, report.DeviceID,
+			report.DeploymentID, report.Log.Messages); err != nil {
+			return err
+		}
+	}
+
+	if report.Status != nil {
+		err := d.UpdateDeviceDeploymentStatus(ctx, report.DeploymentID,
+			report.DeviceID, model.DeviceDeploymentStatus{
+				Status:   report.Status.Status,
+				SubState: report.Status.SubState,
+				Progress: report.Status.DeviceDeploymentProgress(),
+			})
+		if err == mongo.ErrStorageNotFound {
+			return ErrModelDeploymentNotFound
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+	mstore "github.com/mendersoftware/deployments/store/mocks"
+)
+
+func TestSubmitGatewayReports(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"device"},
+		})
+	assert.NoError(t, err)
+	deployment.Stats[model.DeviceDeploymentStatusPending] = 3
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+	for _, device := range []string{"a", "b", "c"} {
+		dd, err := model.NewDeviceDeployment(device, *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+	assert.NoError(t, db.DecommissionDeviceDeployments(ctx, "b"))
+
+	assert.NoError(t, d.SetGatewayDevices(ctx, "gateway",
+		model.GatewayDevices{Devices: []string{"a", "b", "d"}}))
+
+	log := &model.DeploymentLog{
+		Messages: []model.LogMessage{{
+			Timestamp: timePtr(time.Now()),
+			Level:     "error",
+			Message:   "install failed",
+		}},
+	}
+
+	reports := []model.GatewayReport{
+		// log and status of an authorized device
+		{
+			DeploymentID: *deployment.Id,
+			DeviceID:     "a",
+			Status: &model.StatusReport{
+				Status: model.DeviceDeploymentStatusFailure,
+			},
+			Log: log,
+		},
+		// device not assigned to the gateway
+		{
+			DeploymentID: *deployment.Id,
+			DeviceID:     "c",
+			Status: &model.StatusReport{
+				Status: model.DeviceDeploymentStatusFailure,
+			},
+		},
+		// decommissioned device
+		{
+			DeploymentID: *deployment.Id,
+			DeviceID:     "b",
+			Status: &model.StatusReport{
+				Status: model.DeviceDeploymentStatusSuccess,
+			},
+		},
+		// authorized, but not part of the deployment
+		{
+			DeploymentID: *deployment.Id,
+			DeviceID:     "d",
+			Status: &model.StatusReport{
+				Status: model.DeviceDeploymentStatusSuccess,
+			},
+		},
+		// invalid
+		{
+			DeploymentID: *deployment.Id,
+			DeviceID:     "a",
+		},
+	}
+
+	results, err := d.SubmitGatewayReports(ctx, "gateway", reports)
+	assert.NoError(t, err)
+	if assert.Len(t, results, len(reports)) {
+		assert.NoError(t, results[0])
+		assert.Equal(t, ErrGatewayNotAuthorized, results[1])
+		assert.Equal(t, ErrDeviceDecommissioned, results[2])
+		assert.Equal(t, ErrModelDeploymentNotFound, results[3])
+		assert.Equal(t, model.ErrInvalidGatewayReport, errors.Cause(results[4]))
+	}
+
+	status, err := db.GetDeviceDeploymentStatus(ctx, *deployment.Id, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceDeploymentStatusFailure, status)
+	dlog, err := d.GetDeviceDeploymentLog(ctx, "a", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Len(t, dlog.Messages, 1)
+	}
+
+	status, err = db.GetDeviceDeploymentStatus(ctx, *deployment.Id, "c")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceDeploymentStatusPending, status)
+
+	// unknown gateways are not authorized for any device
+	results, err = d.SubmitGatewayReports(ctx, "other", reports[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, []error{ErrGatewayNotAuthorized}, results)
+}
+
+func TestSubmitGatewayReportsError(t *testing.T) {
+	db := &mstore.DataStore{}
+	db.On("GetGatewayDevices", mock.Anything, "gateway").
+		Return(nil, errors.New("connection failed"))
+
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	results, err := d.SubmitGatewayReports(context.Background(), "gateway",
+		[]model.GatewayReport{{}})
+	assert.EqualError(t, err,
+		"failed to get gateway devices: connection failed")
+	assert.Nil(t, results)
+}
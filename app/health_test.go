@@ -0,0 +1,76 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	mstore "github.com/mendersoftware/deployments/store/mocks"
+	h "github.com/mendersoftware/deployments/utils/testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	testCases := map[string]struct {
+		dbErr error
+		fsErr error
+
+		status   string
+		statuses []string
+	}{
+		"ok": {
+			status:   model.HealthStatusOK,
+			statuses: []string{model.HealthStatusOK, model.HealthStatusOK},
+		},
+		"error, db": {
+			dbErr:    errors.New("no reachable servers"),
+			status:   model.HealthStatusError,
+			statuses: []string{model.HealthStatusError, model.HealthStatusOK},
+		},
+		"error, storage": {
+			fsErr:    errors.New("access denied"),
+			status:   model.HealthStatusError,
+			statuses: []string{model.HealthStatusOK, model.HealthStatusError},
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("Ping", h.ContextMatcher()).Return(tc.dbErr)
+
+			fs := &fs_mocks.FileStorage{}
+			fs.On("HealthCheck", h.ContextMatcher()).Return(tc.fsErr)
+
+			d := NewDeployments(db, fs, ArtifactContentType)
+
+			report := d.HealthCheck(context.Background())
+			assert.Equal(t, tc.status, report.Status)
+			assert.Len(t, report.Dependencies, 2)
+			assert.Equal(t, model.HealthDependencyDatabase, report.Dependencies[0].Name)
+			assert.Equal(t, model.HealthDependencyFileStorage, report.Dependencies[1].Name)
+			for i, dep := range report.Dependencies {
+				assert.Equal(t, tc.statuses[i], dep.Status)
+			}
+		})
+	}
+}
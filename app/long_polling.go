@@ -0,0 +1,272 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+// DeploymentNotifier tells devices waiting for a deployment that one may
+// have become available for them. Notifiers shared by many replicas of the
+// service call WakeDevices of each of them.
+type DeploymentNotifier interface {
+	// NotifyDevices notifies the devices of the tenant from the context.
+	NotifyDevices(ctx context.Context, devices []string) error
+}
+
+// deviceWaiters keeps track of the requests waiting for a deployment, by
+// tenant and device ID.
+type deviceWaiters struct {
+	lock    sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func newDeviceWaiters() *deviceWaiters {
+	return &deviceWaiters{
+		waiters: map[string]map[chan struct{}]struct{}{},
+	}
+}
+
+func deviceWaiterKey(tenant, device string) string {
+	return tenant + "/" + device
+}
+
+// deploymentWaiterKey stands for the devices waiting for a slot in the
+// deployment limiting concurrent devices; it is notified like a device.
+func deploymentWaiterKey(deploymentID string) string {
+	return "deployment:" + deploymentID
+}
+
+// wait registers a waiter for the device; the returned channel receives
+// a value when the device is woken. The cancel function must be called
+// once the waiter is not needed anymore.
+func (w *deviceWaiters) wait(tenant, device string) (<-chan struct{}, func()) {
+	key := deviceWaiterKey(tenant, device)
+	ch := make(chan struct{}, 1)
+
+	w.lock.Lock()
+	if w.waiters[key] == nil {
+		w.waiters[key] = map[chan struct{}]struct{}{}
+	}
+	w.waiters[key][ch] = struct{}{}
+	w.lock.Unlock()
+
+	return ch, func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		delete(w.waiters[key], ch)
+		if len(w.waiters[key]) == 0 {
+			delete(w.waiters, key)
+		}
+	}
+}
+
+func (w *deviceWaiters) wake(tenant string, devices []string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, device := range devices {
+		for ch := range w.waiters[deviceWaiterKey(tenant, device)] {
+			// a pending wake up is as good as a new one
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// localNotifier wakes the devices waiting on this instance of the service.
+type localNotifier struct {
+	waiters *deviceWaiters
+}
+
+func (n *localNotifier) NotifyDevices(ctx context.Context, devices []string) error {
+	n.waiters.wake(tenantFromContext(ctx), devices)
+	return nil
+}
+
+func tenantFromContext(ctx context.Context) string {
+	if id := identity.FromContext(ctx); id != nil {
+		return id.Tenant
+	}
+	return ""
+}
+
+// WithDeploymentNotifier replaces the default notifier, which only wakes
+// devices waiting on this instance of the service.
+func (d *Deployments) WithDeploymentNotifier(notifier DeploymentNotifier) *Deployments {
+	d.notifier = notifier
+	return d
+}
+
+// WithMaxDeviceWait sets the longest time a device may wait for
+// a deployment; 0 disables waiting.
+func (d *Deployments) WithMaxDeviceWait(max time.Duration) *Deployments {
+	d.maxDeviceWait = max
+	return d
+}
+
+// WakeDevices wakes the devices of the tenant waiting on this instance of
+// the service for a deployment.
+func (d *Deployments) WakeDevices(tenant string, devices []string) {
+	d.waiters.wake(tenant, devices)
+}
+
+func (d *Deployments) notifyDevices(ctx context.Context, devices []string) {
+	if err := d.notifier.NotifyDevices(ctx, devices); err != nil {
+		// the devices will get the deployment with the next request
+		log.FromContext(ctx).Warnf("failed to notify devices: %v", err)
+	}
+}
+
+// deviceWait tells what a device with a pending deployment it may not start
+// yet waits for.
+type deviceWait struct {
+	// deployment the device waits for a slot in, if it limits concurrent
+	// devices
+	deploymentID string
+
+	// next opening of the maintenance windows, if closed
+	windowOpens *time.Time
+}
+
+func (d *Deployments) getDeviceWait(ctx context.Context,
+	deviceID string, now time.Time) (*deviceWait, error) {
+
+	wait := &deviceWait{}
+
+	deviceDeployment, err := d.db.FindOldestDeploymentForDeviceIDWithStatuses(
+		ctx, deviceID, model.ActiveDeploymentStatuses()...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Searching for oldest active deployment for the device")
+	}
+	if deviceDeployment == nil || deviceDeployment.Status == nil ||
+		*deviceDeployment.Status != model.DeviceDeploymentStatusPending {
+		return wait, nil
+	}
+
+	deployment, err := d.db.FindDeploymentByID(ctx, *deviceDeployment.DeploymentId)
+	if err != nil {
+		return nil, errors.Wrap(err, "Searching for the deployment")
+	}
+	if deployment == nil {
+		return wait, nil
+	}
+
+	if deployment.MaxConcurrent > 0 && !deviceDeployment.Admitted {
+		wait.deploymentID = *deployment.Id
+	}
+
+	sets, err := d.deviceMaintenanceWindows(ctx, deployment, deviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Checking maintenance windows")
+	}
+	if next, found := model.NextMaintenanceWindow(now, sets...); found &&
+		next.After(now) {
+		wait.windowOpens = &next
+	}
+
+	return wait, nil
+}
+
+// WaitForDeploymentForDevice returns the deployment for the device, like
+// GetDeploymentForDeviceWithCurrent, but if there is none it waits for
+// one up to the given timeout (capped at the configured maximum).
+func (d *Deployments) WaitForDeploymentForDevice(ctx context.Context, deviceID string,
+	installed model.InstalledDeviceDeployment,
+	timeout time.Duration) (*model.DeploymentInstructions, error) {
+
+	if timeout > d.maxDeviceWait {
+		timeout = d.maxDeviceWait
+	}
+	if timeout <= 0 {
+		return d.GetDeploymentForDeviceWithCurrent(ctx, deviceID, installed)
+	}
+
+	tenant := tenantFromContext(ctx)
+
+	// subscribe before checking, not to miss a deployment created meanwhile
+	woken, cancel := d.waiters.wait(tenant, deviceID)
+	defer cancel()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	// the slots of the deployment the device waits for are freed by
+	// devices finishing it
+	var (
+		waitingFor string
+		slotFreed  <-chan struct{}
+		cancelSlot = func() {}
+	)
+	defer func() {
+		cancelSlot()
+	}()
+
+	for {
+		deployment, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			deviceID, installed)
+		if err != nil || deployment != nil {
+			return deployment, err
+		}
+
+		wait, err := d.getDeviceWait(ctx, deviceID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if wait.deploymentID != waitingFor {
+			cancelSlot()
+			slotFreed, cancelSlot = nil, func() {}
+			if wait.deploymentID != "" {
+				slotFreed, cancelSlot = d.waiters.wait(tenant,
+					deploymentWaiterKey(wait.deploymentID))
+			}
+			waitingFor = wait.deploymentID
+			// check again, not to miss a slot freed meanwhile
+			continue
+		}
+
+		// the device may start the deployment once its windows open
+		var windowOpens <-chan time.Time
+		var windowTimer *time.Timer
+		if wait.windowOpens != nil {
+			windowTimer = time.NewTimer(time.Until(*wait.windowOpens))
+			windowOpens = windowTimer.C
+		}
+
+		select {
+		case <-woken:
+		case <-slotFreed:
+		case <-windowOpens:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, nil
+		}
+
+		if windowTimer != nil {
+			windowTimer.Stop()
+		}
+	}
+}
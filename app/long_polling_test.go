@@ -0,0 +1,275 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+type notifierFunc func(ctx context.Context, devices []string) error
+
+func (f notifierFunc) NotifyDevices(ctx context.Context, devices []string) error {
+	return f(ctx, devices)
+}
+
+func newLongPollingDeployments(t *testing.T) (*Deployments, *inmem.DataStoreInMem) {
+	db := inmem.NewDataStoreInMem()
+	fs := &fs_mocks.FileStorage{}
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+
+	return NewDeployments(db, fs, ArtifactContentType).
+		WithMaxDeviceWait(time.Minute), db
+}
+
+func createDeploymentForDevice(t *testing.T, ctx context.Context,
+	d *Deployments, device string) string {
+
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{device},
+	})
+	assert.NoError(t, err)
+	return id
+}
+
+func TestWaitForDeploymentForDevice(t *testing.T) {
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Tenant: "acme"})
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	t.Run("ok, woken by a new deployment", func(t *testing.T) {
+		d, db := newLongPollingDeployments(t)
+		insertImage(t, ctx, db, "bar")
+		insertImage(t, context.Background(), db, "bar")
+
+		type result struct {
+			instructions *model.DeploymentInstructions
+			err          error
+		}
+		done := make(chan result)
+		go func() {
+			instructions, err := d.WaitForDeploymentForDevice(ctx,
+				"device", installed, time.Minute)
+			done <- result{instructions, err}
+		}()
+
+		// a deployment of another device, or of the same device of
+		// another tenant, does not end the wait
+		createDeploymentForDevice(t, ctx, d, "other")
+		createDeploymentForDevice(t, context.Background(), d, "device")
+		select {
+		case <-done:
+			t.Fatal("wait finished without a deployment")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		id := createDeploymentForDevice(t, ctx, d, "device")
+		select {
+		case r := <-done:
+			assert.NoError(t, r.err)
+			if assert.NotNil(t, r.instructions) {
+				assert.Equal(t, id, r.instructions.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("device was not woken")
+		}
+		assert.Empty(t, d.waiters.waiters)
+	})
+
+	t.Run("ok, woken by a freed slot", func(t *testing.T) {
+		d, db := newLongPollingDeployments(t)
+		insertImage(t, ctx, db, "bar")
+
+		name, artifact := "foo", "bar"
+		id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+			Name:          &name,
+			ArtifactName:  &artifact,
+			Devices:       []string{"a", "b"},
+			MaxConcurrent: 1,
+		})
+		assert.NoError(t, err)
+
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			"a", installed)
+		assert.NoError(t, err)
+		assert.NotNil(t, instructions)
+
+		type result struct {
+			instructions *model.DeploymentInstructions
+			err          error
+		}
+		done := make(chan result)
+		go func() {
+			instructions, err := d.WaitForDeploymentForDevice(ctx,
+				"b", installed, time.Minute)
+			done <- result{instructions, err}
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("wait finished without a free slot")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		for _, status := range []string{
+			model.DeviceDeploymentStatusDownloading,
+			model.DeviceDeploymentStatusFailure,
+		} {
+			assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, "a",
+				model.DeviceDeploymentStatus{Status: status}))
+		}
+		select {
+		case r := <-done:
+			assert.NoError(t, r.err)
+			if assert.NotNil(t, r.instructions) {
+				assert.Equal(t, id, r.instructions.ID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("device was not woken")
+		}
+		assert.Empty(t, d.waiters.waiters)
+	})
+
+	t.Run("ok, timeout", func(t *testing.T) {
+		d, _ := newLongPollingDeployments(t)
+
+		start := time.Now()
+		instructions, err := d.WaitForDeploymentForDevice(ctx,
+			"device", installed, 50*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Nil(t, instructions)
+		assert.True(t, time.Since(start) >= 50*time.Millisecond)
+		assert.Empty(t, d.waiters.waiters)
+	})
+
+	t.Run("ok, waiting disabled", func(t *testing.T) {
+		d, _ := newLongPollingDeployments(t)
+		d = d.WithMaxDeviceWait(0)
+
+		start := time.Now()
+		instructions, err := d.WaitForDeploymentForDevice(ctx,
+			"device", installed, time.Minute)
+		assert.NoError(t, err)
+		assert.Nil(t, instructions)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("ok, canceled", func(t *testing.T) {
+		d, _ := newLongPollingDeployments(t)
+
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		instructions, err := d.WaitForDeploymentForDevice(cctx,
+			"device", installed, time.Minute)
+		assert.NoError(t, err)
+		assert.Nil(t, instructions)
+	})
+
+	t.Run("ok, notifier", func(t *testing.T) {
+		d, db := newLongPollingDeployments(t)
+		insertImage(t, ctx, db, "bar")
+
+		// the notifier delivers the notifications, possibly from other
+		// replicas, with WakeDevices
+		notified := make(chan []string, 1)
+		d = d.WithDeploymentNotifier(notifierFunc(
+			func(ctx context.Context, devices []string) error {
+				notified <- devices
+				return nil
+			}))
+
+		createDeploymentForDevice(t, ctx, d, "device")
+		assert.Equal(t, []string{"device"}, <-notified)
+
+		// the device is woken only through WakeDevices
+		woken, cancel := d.waiters.wait("acme", "device")
+		defer cancel()
+		d.WakeDevices("acme", []string{"device"})
+		select {
+		case <-woken:
+		default:
+			t.Fatal("device was not woken")
+		}
+	})
+}
+
+func TestGetDeviceWait(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	d, db := newLongPollingDeployments(t)
+	insertImage(t, ctx, db, "bar")
+	now := time.Now().UTC()
+
+	wait, err := d.getDeviceWait(ctx, "a", now)
+	assert.NoError(t, err)
+	assert.Equal(t, &deviceWait{}, wait)
+
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:          &name,
+		ArtifactName:  &artifact,
+		Devices:       []string{"a", "b"},
+		MaxConcurrent: 1,
+	})
+	assert.NoError(t, err)
+
+	instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx, "a", installed)
+	assert.NoError(t, err)
+	assert.NotNil(t, instructions)
+
+	// admitted devices do not wait for a slot
+	wait, err = d.getDeviceWait(ctx, "a", now)
+	assert.NoError(t, err)
+	assert.Equal(t, &deviceWait{}, wait)
+
+	wait, err = d.getDeviceWait(ctx, "b", now)
+	assert.NoError(t, err)
+	assert.Equal(t, &deviceWait{deploymentID: id}, wait)
+
+	// the window of the device opens in two hours
+	opens := now.Add(2 * time.Hour).Truncate(time.Minute)
+	assert.NoError(t, d.SetDeviceMaintenanceWindows(ctx, "b",
+		model.MaintenanceWindows{Windows: []model.MaintenanceWindow{{
+			Start: opens.Format("15:04"),
+			End:   opens.Add(time.Hour).Format("15:04"),
+		}}}))
+	wait, err = d.getDeviceWait(ctx, "b", now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, wait.windowOpens) {
+		assert.True(t, opens.Equal(*wait.windowOpens))
+	}
+	assert.Equal(t, id, wait.deploymentID)
+}
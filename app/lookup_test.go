@@ -0,0 +1,63 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestLookupDeploymentDeviceCount(t *testing.T) {
+	ctx := context.Background()
+
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b", "c"},
+	})
+	assert.NoError(t, err)
+
+	deployment, err := d.GetDeployment(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deployment.DeviceCount)
+
+	deployments, total, err := d.LookupDeployment(ctx, model.Query{
+		DeviceID: "b",
+		Limit:    1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	if assert.Len(t, deployments, 1) {
+		assert.Equal(t, 3, deployments[0].DeviceCount)
+	}
+
+	deployments, total, err = d.LookupDeployment(ctx, model.Query{
+		DeviceID: "d",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.Equal(t, []*model.Deployment{}, deployments)
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+const (
+	// ID of the windows applying to all the devices of the tenant
+	tenantMaintenanceWindowsID = "tenant"
+)
+
+func deviceMaintenanceWindowsID(deviceID string) string {
+	return "device:" + deviceID
+}
+
+// SetTenantMaintenanceWindows replaces the maintenance windows applying to
+// all the devices of the tenant.
+func (d *Deployments) SetTenantMaintenanceWindows(ctx context.Context,
+	windows model.MaintenanceWindows) error {
+
+	if err := d.db.SetMaintenanceWindows(ctx, tenantMaintenanceWindowsID,
+		windows); err != nil {
+		return errors.Wrap(err, "failed to save maintenance windows")
+	}
+	return nil
+}
+
+// GetTenantMaintenanceWindows returns the maintenance windows applying to
+// all the devices of the tenant, nil if they were never set.
+func (d *Deployments) GetTenantMaintenanceWindows(
+	ctx context.Context) (*model.MaintenanceWindows, error) {
+
+	return d.getMaintenanceWindows(ctx, tenantMaintenanceWindowsID)
+}
+
+// SetDeviceMaintenanceWindows replaces the maintenance windows of the device
+// of ID `deviceID`.
+func (d *Deployments) SetDeviceMaintenanceWindows(ctx context.Context,
+	deviceID string, windows model.MaintenanceWindows) error {
+
+	if err := d.db.SetMaintenanceWindows(ctx,
+		deviceMaintenanceWindowsID(deviceID), windows); err != nil {
+		return errors.Wrap(err, "failed to save maintenance windows")
+	}
+	return nil
+}
+
+// GetDeviceMaintenanceWindows returns the maintenance windows of the device
+// of ID `deviceID`, nil if they were never set.
+func (d *Deployments) GetDeviceMaintenanceWindows(ctx context.Context,
+	deviceID string) (*model.MaintenanceWindows, error) {
+
+	return d.getMaintenanceWindows(ctx, deviceMaintenanceWindowsID(deviceID))
+}
+
+func (d *Deployments) getMaintenanceWindows(ctx context.Context,
+	id string) (*model.MaintenanceWindows, error) {
+
+	windows, err := d.db.GetMaintenanceWindows(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get maintenance windows")
+	}
+	return windows, nil
+}
+
+// deploymentMaintenanceWindows returns the windows of the tenant and of the
+// deployment; the devices may start installing the deployment only within
+// both of them.
+func (d *Deployments) deploymentMaintenanceWindows(ctx context.Context,
+	deployment *model.Deployment) ([]model.MaintenanceWindows, error) {
+
+	var sets []model.MaintenanceWindows
+
+	tenant, err := d.GetTenantMaintenanceWindows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tenant != nil && len(tenant.Windows) > 0 {
+		sets = append(sets, *tenant)
+	}
+
+	if deployment.DeploymentConstructor != nil &&
+		len(deployment.MaintenanceWindows) > 0 {
+		sets = append(sets, model.MaintenanceWindows{
+			Windows: deployment.MaintenanceWindows,
+		})
+	}
+
+	return sets, nil
+}
+
+// deviceMaintenanceWindows returns the windows of the tenant, of the
+// deployment and of the device; the device may start installing the
+// deployment only within all of them.
+func (d *Deployments) deviceMaintenanceWindows(ctx context.Context,
+	deployment *model.Deployment, deviceID string) ([]model.MaintenanceWindows, error) {
+
+	sets, err := d.deploymentMaintenanceWindows(ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := d.GetDeviceMaintenanceWindows(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device != nil {
+		sets = append(sets, *device)
+	}
+
+	return sets, nil
+}
+
+// inMaintenanceWindow checks if the device may start installing the
+// deployment at the given time: within the windows of the tenant, of the
+// deployment and of the device.
+func (d *Deployments) inMaintenanceWindow(ctx context.Context,
+	deployment *model.Deployment, deviceID string, t time.Time) (bool, error) {
+
+	sets, err := d.deviceMaintenanceWindows(ctx, deployment, deviceID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, set := range sets {
+		if !set.Contains(t) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
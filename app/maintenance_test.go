@@ -0,0 +1,157 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	// windows relative to the time of the test, in UTC
+	window := func(from, to time.Duration) model.MaintenanceWindow {
+		now := time.Now().UTC()
+		return model.MaintenanceWindow{
+			Start: now.Add(from).Format("15:04"),
+			End:   now.Add(to).Format("15:04"),
+		}
+	}
+	open := []model.MaintenanceWindow{window(-time.Hour, time.Hour)}
+	closed := []model.MaintenanceWindow{window(2*time.Hour, 3*time.Hour)}
+
+	testCases := map[string]struct {
+		deployment []model.MaintenanceWindow
+		tenant     []model.MaintenanceWindow
+		device     []model.MaintenanceWindow
+		status     string
+
+		instructions bool
+		maintenance  *model.MaintenanceStatus
+		// the next window starts in two hours
+		nextWindow bool
+	}{
+		"ok, no windows": {
+			instructions: true,
+		},
+		"ok, open windows": {
+			deployment:   open,
+			tenant:       open,
+			device:       open,
+			instructions: true,
+			maintenance:  &model.MaintenanceStatus{Open: true},
+		},
+		"ok, deployment window closed": {
+			deployment:  closed,
+			maintenance: &model.MaintenanceStatus{},
+			nextWindow:  true,
+		},
+		"ok, windows never overlapping": {
+			deployment:  closed,
+			tenant:      open,
+			maintenance: &model.MaintenanceStatus{},
+		},
+		"ok, tenant window closed": {
+			tenant:      closed,
+			maintenance: &model.MaintenanceStatus{},
+			nextWindow:  true,
+		},
+		"ok, device window closed": {
+			deployment:  open,
+			device:      closed,
+			maintenance: &model.MaintenanceStatus{Open: true},
+		},
+		"ok, installation already started": {
+			deployment:   closed,
+			status:       model.DeviceDeploymentStatusDownloading,
+			instructions: true,
+			maintenance:  &model.MaintenanceStatus{},
+			nextWindow:   true,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			db := inmem.NewDataStoreInMem()
+			fs := &fs_mocks.FileStorage{}
+			fs.On("GetRequest", mock.Anything, mock.Anything,
+				DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+				Return(&model.Link{Uri: "http://foo"}, nil)
+			d := NewDeployments(db, fs, ArtifactContentType)
+
+			image := insertImage(t, ctx, db, "bar")
+			name, artifact := "foo", "bar"
+			id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+				Name:               &name,
+				ArtifactName:       &artifact,
+				Devices:            []string{"device"},
+				MaintenanceWindows: tc.deployment,
+			})
+			assert.NoError(t, err)
+			if tc.tenant != nil {
+				assert.NoError(t, d.SetTenantMaintenanceWindows(ctx,
+					model.MaintenanceWindows{Windows: tc.tenant}))
+			}
+			if tc.device != nil {
+				assert.NoError(t, d.SetDeviceMaintenanceWindows(ctx, "device",
+					model.MaintenanceWindows{Windows: tc.device}))
+			}
+			if tc.status != "" {
+				// the device got the deployment before the window closed
+				assert.NoError(t, db.AssignArtifact(ctx, "device", id, image,
+					"foo"))
+				assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id,
+					"device", model.DeviceDeploymentStatus{Status: tc.status}))
+			}
+
+			instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+				"device", installed)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.instructions, instructions != nil)
+
+			deployment, err := d.GetDeployment(ctx, id)
+			assert.NoError(t, err)
+			if tc.maintenance == nil {
+				assert.Nil(t, deployment.Maintenance)
+			} else if assert.NotNil(t, deployment.Maintenance) {
+				assert.Equal(t, tc.maintenance.Open,
+					deployment.Maintenance.Open)
+				if tc.nextWindow {
+					if assert.NotNil(t, deployment.Maintenance.NextWindowIn) {
+						assert.InDelta(t, 2*60*60,
+							*deployment.Maintenance.NextWindowIn, 60)
+					}
+				} else {
+					assert.Nil(t, deployment.Maintenance.NextWindowIn)
+				}
+			}
+		})
+	}
+}
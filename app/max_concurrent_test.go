@@ -0,0 +1,245 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func newMaxConcurrentDeployment(t *testing.T, max int,
+	devices []string) (*Deployments, string) {
+
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs := &fs_mocks.FileStorage{}
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:          &name,
+		ArtifactName:  &artifact,
+		Devices:       devices,
+		MaxConcurrent: max,
+	})
+	assert.NoError(t, err)
+
+	return d, id
+}
+
+func TestMaxConcurrentDevices(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	d, id := newMaxConcurrentDeployment(t, 2, []string{"a", "b", "c", "d"})
+
+	next := func(device string) bool {
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			device, installed)
+		assert.NoError(t, err)
+		return instructions != nil
+	}
+	report := func(device, status string) {
+		assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, device,
+			model.DeviceDeploymentStatus{Status: status}))
+	}
+
+	assert.True(t, next("a"))
+	assert.True(t, next("b"))
+	assert.False(t, next("c"))
+
+	// admitted devices keep getting the instructions
+	report("a", model.DeviceDeploymentStatusDownloading)
+	assert.True(t, next("a"))
+	assert.True(t, next("b"))
+	assert.False(t, next("c"))
+
+	// the next device is admitted when another one finishes
+	report("a", model.DeviceDeploymentStatusSuccess)
+	assert.True(t, next("c"))
+	assert.False(t, next("d"))
+
+	report("b", model.DeviceDeploymentStatusFailure)
+	assert.True(t, next("d"))
+}
+
+func TestMaxConcurrentDevicesPollingAtOnce(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	devices := make([]string, 20)
+	for i := range devices {
+		devices[i] = fmt.Sprintf("device-%d", i)
+	}
+	d, _ := newMaxConcurrentDeployment(t, 3, devices)
+
+	var lock sync.Mutex
+	var admitted int
+	var wg sync.WaitGroup
+	for _, device := range devices {
+		wg.Add(1)
+		go func(device string) {
+			defer wg.Done()
+			instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+				device, installed)
+			assert.NoError(t, err)
+			if instructions != nil {
+				lock.Lock()
+				admitted++
+				lock.Unlock()
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, admitted)
+}
+
+func TestMaxConcurrentDevicesReleased(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	d, id := newMaxConcurrentDeployment(t, 2, []string{"a", "b", "c", "d"})
+
+	next := func(device string) bool {
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			device, installed)
+		assert.NoError(t, err)
+		return instructions != nil
+	}
+	admittedDevices := func() int {
+		deployment, err := d.db.FindDeploymentByID(ctx, id)
+		assert.NoError(t, err)
+		return deployment.AdmittedDevices
+	}
+
+	assert.True(t, next("a"))
+	assert.True(t, next("b"))
+	assert.False(t, next("c"))
+
+	// decommissioned devices give their slot back
+	assert.NoError(t, d.DecommissionDevice(ctx, "a"))
+	assert.True(t, next("c"))
+	assert.False(t, next("d"))
+	assert.Equal(t, 2, admittedDevices())
+
+	// aborting frees all the slots
+	assert.NoError(t, d.AbortDeployment(ctx, id))
+	assert.Equal(t, 0, admittedDevices())
+}
+
+func TestMaxConcurrentDevicesExpired(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	d, id := newMaxConcurrentDeployment(t, 1, []string{"a", "b", "c"})
+
+	next := func(device string) bool {
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			device, installed)
+		assert.NoError(t, err)
+		return instructions != nil
+	}
+
+	assert.True(t, next("a"))
+	assert.False(t, next("b"))
+
+	// the slot is given to another device once the admitted one is gone
+	// for longer than the timeout
+	d.WithAdmissionTimeout(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, next("b"))
+
+	d.WithAdmissionTimeout(time.Hour)
+	assert.False(t, next("c"))
+
+	// the device coming back late does not free the slot of another one
+	assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, "a",
+		model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusFailure,
+		}))
+	assert.False(t, next("c"))
+
+	deployment, err := d.db.FindDeploymentByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deployment.AdmittedDevices)
+
+	// no expiry
+	d.WithAdmissionTimeout(0)
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, next("c"))
+}
+
+// releaseFailingDataStore fails to free the slots of the devices.
+type releaseFailingDataStore struct {
+	*inmem.DataStoreInMem
+}
+
+func (releaseFailingDataStore) ReleaseDeviceDeployment(ctx context.Context,
+	deviceID, deploymentID string) (bool, error) {
+	return false, errors.New("connection failed")
+}
+
+func TestMaxConcurrentDevicesReleaseError(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	d, id := newMaxConcurrentDeployment(t, 1, []string{"a", "b"})
+	instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx, "a", installed)
+	assert.NoError(t, err)
+	assert.NotNil(t, instructions)
+
+	// the stats are updated even if the slot is not freed
+	d.db = releaseFailingDataStore{d.db.(*inmem.DataStoreInMem)}
+	assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, "a",
+		model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusSuccess,
+		}))
+
+	deployment, err := d.db.FindDeploymentByID(ctx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deployment.Stats[model.DeviceDeploymentStatusSuccess])
+	assert.Equal(t, 1, deployment.AdmittedDevices)
+}
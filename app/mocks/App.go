@@ -37,6 +37,66 @@ func (_m *App) AbortDeployment(ctx context.Context, deploymentID string) error {
 	return r0
 }
 
+// AppendDeviceDeploymentLog provides a mock function with given fields: ctx, deviceID, deploymentID, chunk
+func (_m *App) AppendDeviceDeploymentLog(ctx context.Context, deviceID string, deploymentID string, chunk model.LogChunk) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, chunk)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.LogChunk) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, chunk)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ArchiveDeployments provides a mock function with given fields: ctx, defaultDays
+func (_m *App) ArchiveDeployments(ctx context.Context, defaultDays int) ([]model.ArchivedDeployment, error) {
+	ret := _m.Called(ctx, defaultDays)
+
+	var r0 []model.ArchivedDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, int) []model.ArchivedDeployment); ok {
+		r0 = rf(ctx, defaultDays)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ArchivedDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, defaultDays)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ArchiveDeploymentsAllTenants provides a mock function with given fields: ctx, defaultDays
+func (_m *App) ArchiveDeploymentsAllTenants(ctx context.Context, defaultDays int) ([]model.ArchivedDeployment, error) {
+	ret := _m.Called(ctx, defaultDays)
+
+	var r0 []model.ArchivedDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, int) []model.ArchivedDeployment); ok {
+		r0 = rf(ctx, defaultDays)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ArchivedDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, defaultDays)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateDeployment provides a mock function with given fields: ctx, constructor
 func (_m *App) CreateDeployment(ctx context.Context, constructor *model.DeploymentConstructor) (string, error) {
 	ret := _m.Called(ctx, constructor)
@@ -107,6 +167,41 @@ func (_m *App) DeleteImage(ctx context.Context, imageID string) error {
 	return r0
 }
 
+// DeprovisionTenant provides a mock function with given fields: ctx, tenantID
+func (_m *App) DeprovisionTenant(ctx context.Context, tenantID string) error {
+	ret := _m.Called(ctx, tenantID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeprovisionTenants provides a mock function with given fields: ctx
+func (_m *App) DeprovisionTenants(ctx context.Context) (int, error) {
+	ret := _m.Called(ctx)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context) int); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DownloadLink provides a mock function with given fields: ctx, imageID, expire
 func (_m *App) DownloadLink(ctx context.Context, imageID string, expire time.Duration) (*model.Link, error) {
 	ret := _m.Called(ctx, imageID, expire)
@@ -174,6 +269,29 @@ func (_m *App) GetDeployment(ctx context.Context, deploymentID string) (*model.D
 	return r0, r1
 }
 
+// GetDeploymentFailureSummary provides a mock function with given fields: ctx, deploymentID
+func (_m *App) GetDeploymentFailureSummary(ctx context.Context, deploymentID string) (*model.FailureSummary, error) {
+	ret := _m.Called(ctx, deploymentID)
+
+	var r0 *model.FailureSummary
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.FailureSummary); ok {
+		r0 = rf(ctx, deploymentID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.FailureSummary)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, deploymentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDeploymentForDeviceWithCurrent provides a mock function with given fields: ctx, deviceID, current
 func (_m *App) GetDeploymentForDeviceWithCurrent(ctx context.Context, deviceID string, current model.InstalledDeviceDeployment) (*model.DeploymentInstructions, error) {
 	ret := _m.Called(ctx, deviceID, current)
@@ -197,6 +315,29 @@ func (_m *App) GetDeploymentForDeviceWithCurrent(ctx context.Context, deviceID s
 	return r0, r1
 }
 
+// GetDeploymentProgress provides a mock function with given fields: ctx, deploymentID
+func (_m *App) GetDeploymentProgress(ctx context.Context, deploymentID string) (*model.DeploymentProgress, error) {
+	ret := _m.Called(ctx, deploymentID)
+
+	var r0 *model.DeploymentProgress
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeploymentProgress); ok {
+		r0 = rf(ctx, deploymentID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeploymentProgress)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, deploymentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDeploymentStats provides a mock function with given fields: ctx, deploymentID
 func (_m *App) GetDeploymentStats(ctx context.Context, deploymentID string) (model.Stats, error) {
 	ret := _m.Called(ctx, deploymentID)
@@ -220,6 +361,52 @@ func (_m *App) GetDeploymentStats(ctx context.Context, deploymentID string) (mod
 	return r0, r1
 }
 
+// GetDeploymentStatsTimeline provides a mock function with given fields: ctx, deploymentID, interval
+func (_m *App) GetDeploymentStatsTimeline(ctx context.Context, deploymentID string, interval time.Duration) ([]model.StatsTimelineBucket, error) {
+	ret := _m.Called(ctx, deploymentID, interval)
+
+	var r0 []model.StatsTimelineBucket
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) []model.StatsTimelineBucket); ok {
+		r0 = rf(ctx, deploymentID, interval)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.StatsTimelineBucket)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, deploymentID, interval)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceDeploymentHistory provides a mock function with given fields: ctx, query
+func (_m *App) GetDeviceDeploymentHistory(ctx context.Context, query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeploymentHistoryEntry, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 []model.DeviceDeploymentHistoryEntry
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentHistoryQuery) []model.DeviceDeploymentHistoryEntry); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceDeploymentHistoryEntry)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceDeploymentHistoryQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDeviceDeploymentLog provides a mock function with given fields: ctx, deviceID, deploymentID
 func (_m *App) GetDeviceDeploymentLog(ctx context.Context, deviceID string, deploymentID string) (*model.DeploymentLog, error) {
 	ret := _m.Called(ctx, deviceID, deploymentID)
@@ -243,22 +430,98 @@ func (_m *App) GetDeviceDeploymentLog(ctx context.Context, deviceID string, depl
 	return r0, r1
 }
 
-// GetDeviceStatusesForDeployment provides a mock function with given fields: ctx, deploymentID
-func (_m *App) GetDeviceStatusesForDeployment(ctx context.Context, deploymentID string) ([]model.DeviceDeployment, error) {
-	ret := _m.Called(ctx, deploymentID)
+// GetDeviceDeploymentTransitions provides a mock function with given fields: ctx, deploymentID, deviceID
+func (_m *App) GetDeviceDeploymentTransitions(ctx context.Context, deploymentID string, deviceID string) ([]model.DeviceDeploymentTransition, error) {
+	ret := _m.Called(ctx, deploymentID, deviceID)
+
+	var r0 []model.DeviceDeploymentTransition
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) []model.DeviceDeploymentTransition); ok {
+		r0 = rf(ctx, deploymentID, deviceID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceDeploymentTransition)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, deploymentID, deviceID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceMaintenanceWindows provides a mock function with given fields: ctx, deviceID
+func (_m *App) GetDeviceMaintenanceWindows(ctx context.Context, deviceID string) (*model.MaintenanceWindows, error) {
+	ret := _m.Called(ctx, deviceID)
+
+	var r0 *model.MaintenanceWindows
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.MaintenanceWindows); ok {
+		r0 = rf(ctx, deviceID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MaintenanceWindows)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, deviceID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceStatusesForDeployment provides a mock function with given fields: ctx, query
+func (_m *App) GetDeviceStatusesForDeployment(ctx context.Context, query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error) {
+	ret := _m.Called(ctx, query)
 
 	var r0 []model.DeviceDeployment
-	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeviceDeployment); ok {
-		r0 = rf(ctx, deploymentID)
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentsQuery) []model.DeviceDeployment); ok {
+		r0 = rf(ctx, query)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.DeviceDeployment)
 		}
 	}
 
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceDeploymentsQuery) int); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.DeviceDeploymentsQuery) error); ok {
+		r2 = rf(ctx, query)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetGatewayDevices provides a mock function with given fields: ctx, gatewayID
+func (_m *App) GetGatewayDevices(ctx context.Context, gatewayID string) (*model.GatewayDevices, error) {
+	ret := _m.Called(ctx, gatewayID)
+
+	var r0 *model.GatewayDevices
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.GatewayDevices); ok {
+		r0 = rf(ctx, gatewayID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.GatewayDevices)
+		}
+	}
+
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, deploymentID)
+		r1 = rf(ctx, gatewayID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -312,6 +575,52 @@ func (_m *App) GetLimit(ctx context.Context, name string) (*model.Limit, error)
 	return r0, r1
 }
 
+// GetTenantDeprovisioning provides a mock function with given fields: ctx, tenantID
+func (_m *App) GetTenantDeprovisioning(ctx context.Context, tenantID string) (*model.TenantDeprovisioning, error) {
+	ret := _m.Called(ctx, tenantID)
+
+	var r0 *model.TenantDeprovisioning
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TenantDeprovisioning); ok {
+		r0 = rf(ctx, tenantID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TenantDeprovisioning)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, tenantID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantMaintenanceWindows provides a mock function with given fields: ctx
+func (_m *App) GetTenantMaintenanceWindows(ctx context.Context) (*model.MaintenanceWindows, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.MaintenanceWindows
+	if rf, ok := ret.Get(0).(func(context.Context) *model.MaintenanceWindows); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MaintenanceWindows)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // HasDeploymentForDevice provides a mock function with given fields: ctx, deploymentID, deviceID
 func (_m *App) HasDeploymentForDevice(ctx context.Context, deploymentID string, deviceID string) (bool, error) {
 	ret := _m.Called(ctx, deploymentID, deviceID)
@@ -333,6 +642,22 @@ func (_m *App) HasDeploymentForDevice(ctx context.Context, deploymentID string,
 	return r0, r1
 }
 
+// HealthCheck provides a mock function with given fields: ctx
+func (_m *App) HealthCheck(ctx context.Context) *model.HealthReport {
+	ret := _m.Called(ctx)
+
+	var r0 *model.HealthReport
+	if rf, ok := ret.Get(0).(func(context.Context) *model.HealthReport); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.HealthReport)
+		}
+	}
+
+	return r0
+}
+
 // IsDeploymentFinished provides a mock function with given fields: ctx, deploymentID
 func (_m *App) IsDeploymentFinished(ctx context.Context, deploymentID string) (bool, error) {
 	ret := _m.Called(ctx, deploymentID)
@@ -354,6 +679,43 @@ func (_m *App) IsDeploymentFinished(ctx context.Context, deploymentID string) (b
 	return r0, r1
 }
 
+// IterateDeviceStatusesForDeployment provides a mock function with given fields: ctx, query, fn
+func (_m *App) IterateDeviceStatusesForDeployment(ctx context.Context, query model.DeviceDeploymentsQuery, fn func(*model.DeviceDeployment) error) error {
+	ret := _m.Called(ctx, query, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentsQuery, func(*model.DeviceDeployment) error) error); ok {
+		r0 = rf(ctx, query, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListArchivedDeployments provides a mock function with given fields: ctx, skip, limit
+func (_m *App) ListArchivedDeployments(ctx context.Context, skip int, limit int) ([]model.ArchivedDeployment, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.ArchivedDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) []model.ArchivedDeployment); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ArchivedDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ListImages provides a mock function with given fields: ctx, filters
 func (_m *App) ListImages(ctx context.Context, filters map[string]string) ([]*model.SoftwareImage, error) {
 	ret := _m.Called(ctx, filters)
@@ -378,7 +740,7 @@ func (_m *App) ListImages(ctx context.Context, filters map[string]string) ([]*mo
 }
 
 // LookupDeployment provides a mock function with given fields: ctx, query
-func (_m *App) LookupDeployment(ctx context.Context, query model.Query) ([]*model.Deployment, error) {
+func (_m *App) LookupDeployment(ctx context.Context, query model.Query) ([]*model.Deployment, int, error) {
 	ret := _m.Called(ctx, query)
 
 	var r0 []*model.Deployment
@@ -390,14 +752,21 @@ func (_m *App) LookupDeployment(ctx context.Context, query model.Query) ([]*mode
 		}
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, model.Query) error); ok {
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.Query) int); ok {
 		r1 = rf(ctx, query)
 	} else {
-		r1 = ret.Error(1)
+		r1 = ret.Get(1).(int)
 	}
 
-	return r0, r1
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.Query) error); ok {
+		r2 = rf(ctx, query)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
 // ProvisionTenant provides a mock function with given fields: ctx, tenant_id
@@ -414,6 +783,66 @@ func (_m *App) ProvisionTenant(ctx context.Context, tenant_id string) error {
 	return r0
 }
 
+// RecomputeStats provides a mock function with given fields: ctx, deploymentID
+func (_m *App) RecomputeStats(ctx context.Context, deploymentID string) ([]model.StatsCorrection, error) {
+	ret := _m.Called(ctx, deploymentID)
+
+	var r0 []model.StatsCorrection
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.StatsCorrection); ok {
+		r0 = rf(ctx, deploymentID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.StatsCorrection)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, deploymentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecomputeStatsAllTenants provides a mock function with given fields: ctx
+func (_m *App) RecomputeStatsAllTenants(ctx context.Context) ([]model.StatsCorrection, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.StatsCorrection
+	if rf, ok := ret.Get(0).(func(context.Context) []model.StatsCorrection); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.StatsCorrection)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreArchivedDeployment provides a mock function with given fields: ctx, id
+func (_m *App) RestoreArchivedDeployment(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SaveDeviceDeploymentLog provides a mock function with given fields: ctx, deviceID, deploymentID, logs
 func (_m *App) SaveDeviceDeploymentLog(ctx context.Context, deviceID string, deploymentID string, logs []model.LogMessage) error {
 	ret := _m.Called(ctx, deviceID, deploymentID, logs)
@@ -428,6 +857,85 @@ func (_m *App) SaveDeviceDeploymentLog(ctx context.Context, deviceID string, dep
 	return r0
 }
 
+// SetDeviceMaintenanceWindows provides a mock function with given fields: ctx, deviceID, windows
+func (_m *App) SetDeviceMaintenanceWindows(ctx context.Context, deviceID string, windows model.MaintenanceWindows) error {
+	ret := _m.Called(ctx, deviceID, windows)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.MaintenanceWindows) error); ok {
+		r0 = rf(ctx, deviceID, windows)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetGatewayDevices provides a mock function with given fields: ctx, gatewayID, devices
+func (_m *App) SetGatewayDevices(ctx context.Context, gatewayID string, devices model.GatewayDevices) error {
+	ret := _m.Called(ctx, gatewayID, devices)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.GatewayDevices) error); ok {
+		r0 = rf(ctx, gatewayID, devices)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetLimit provides a mock function with given fields: ctx, limit
+func (_m *App) SetLimit(ctx context.Context, limit model.Limit) error {
+	ret := _m.Called(ctx, limit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Limit) error); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantMaintenanceWindows provides a mock function with given fields: ctx, windows
+func (_m *App) SetTenantMaintenanceWindows(ctx context.Context, windows model.MaintenanceWindows) error {
+	ret := _m.Called(ctx, windows)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.MaintenanceWindows) error); ok {
+		r0 = rf(ctx, windows)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SubmitGatewayReports provides a mock function with given fields: ctx, gatewayID, reports
+func (_m *App) SubmitGatewayReports(ctx context.Context, gatewayID string, reports []model.GatewayReport) ([]error, error) {
+	ret := _m.Called(ctx, gatewayID, reports)
+
+	var r0 []error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []model.GatewayReport) []error); ok {
+		r0 = rf(ctx, gatewayID, reports)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []model.GatewayReport) error); ok {
+		r1 = rf(ctx, gatewayID, reports)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateDeviceDeploymentStatus provides a mock function with given fields: ctx, deploymentID, deviceID, status
 func (_m *App) UpdateDeviceDeploymentStatus(ctx context.Context, deploymentID string, deviceID string, status model.DeviceDeploymentStatus) error {
 	ret := _m.Called(ctx, deploymentID, deviceID, status)
@@ -441,3 +949,26 @@ func (_m *App) UpdateDeviceDeploymentStatus(ctx context.Context, deploymentID st
 
 	return r0
 }
+
+// WaitForDeploymentForDevice provides a mock function with given fields: ctx, deviceID, current, timeout
+func (_m *App) WaitForDeploymentForDevice(ctx context.Context, deviceID string, current model.InstalledDeviceDeployment, timeout time.Duration) (*model.DeploymentInstructions, error) {
+	ret := _m.Called(ctx, deviceID, current, timeout)
+
+	var r0 *model.DeploymentInstructions
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.InstalledDeviceDeployment, time.Duration) *model.DeploymentInstructions); ok {
+		r0 = rf(ctx, deviceID, current, timeout)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeploymentInstructions)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.InstalledDeviceDeployment, time.Duration) error); ok {
+		r1 = rf(ctx, deviceID, current, timeout)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
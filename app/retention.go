@@ -0,0 +1,538 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+const (
+	GzipContentType = "application/gzip"
+
+	// Number of deployments fetched at once for archival
+	archiveBatchSize = 100
+
+	// How long a deployment stays claimed for archival by an instance of
+	// the service, other instances skip it in the meantime
+	archiveClaimTimeout = time.Hour
+)
+
+// Errors expected from retention
+var (
+	ErrModelArchivedDeploymentNotFound = errors.New("Archived deployment not found")
+	ErrModelDeploymentExists           = errors.New("Deployment already exists")
+)
+
+// deploymentArchive is the content of the archive object. The documents are
+// stored as they are kept in the database (in BSON extended JSON), so that
+// restoring them does not lose fields hidden from the API.
+type deploymentArchive struct {
+	Deployment        bson.M   `json:"deployment"`
+	DeviceDeployments []bson.M `json:"device_deployments"`
+	Logs              []bson.M `json:"logs"`
+}
+
+func archiveObjectID(deploymentID string) string {
+	return "archive/deployments/" + deploymentID + ".json.gz"
+}
+
+// toDocument converts the object to its database representation
+func toDocument(in interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// fromDocument converts the database representation back to the object
+func fromDocument(doc bson.M, out interface{}) error {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(raw, out)
+}
+
+// retentionDays returns the retention period of the tenant from the
+// context, falling back to defaultDays if the tenant has no override.
+func (d *Deployments) retentionDays(ctx context.Context, defaultDays int) (int, error) {
+	limit, err := d.db.GetLimit(ctx, model.LimitRetentionDays)
+	if err == mongo.ErrLimitNotFound {
+		return defaultDays, nil
+	} else if err != nil {
+		return 0, errors.Wrap(err, "failed to get retention limit")
+	}
+	return int(limit.Value), nil
+}
+
+// ArchiveDeployments moves deployments of the tenant from the context
+// finished longer than the retention period ago (defaultDays, unless
+// overridden by the tenant's limit) to the file storage. Returns the archived
+// deployments.
+func (d *Deployments) ArchiveDeployments(ctx context.Context,
+	defaultDays int) ([]model.ArchivedDeployment, error) {
+
+	archived := []model.ArchivedDeployment{}
+
+	days, err := d.retentionDays(ctx, defaultDays)
+	if err != nil || days <= 0 {
+		return archived, err
+	}
+	before := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+
+	for {
+		deployments, err := d.db.FindFinishedBefore(ctx, before, archiveBatchSize)
+		if err != nil {
+			return archived, errors.Wrap(err, "failed to search for finished deployments")
+		}
+
+		for _, deployment := range deployments {
+			// instances of the service archive deployments concurrently
+			claimed, err := d.db.ClaimDeploymentArchival(ctx,
+				*deployment.Id, time.Now().Add(archiveClaimTimeout))
+			if err != nil {
+				return archived, errors.Wrapf(err,
+					"failed to claim deployment %s", *deployment.Id)
+			}
+			if !claimed {
+				continue
+			}
+
+			a, err := d.archiveDeployment(ctx, deployment)
+			if err != nil {
+				return archived, errors.Wrapf(err,
+					"failed to archive deployment %s", *deployment.Id)
+			}
+			archived = append(archived, *a)
+		}
+
+		if len(deployments) < archiveBatchSize {
+			return archived, nil
+		}
+	}
+}
+
+// ArchiveDeploymentsAllTenants runs ArchiveDeployments for all tenants,
+// including the default database.
+func (d *Deployments) ArchiveDeploymentsAllTenants(ctx context.Context,
+	defaultDays int) ([]model.ArchivedDeployment, error) {
+
+	tenants, err := d.db.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := []model.ArchivedDeployment{}
+	for _, tenant := range append([]string{""}, tenants...) {
+		tctx := ctx
+		if tenant != "" {
+			tctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+		}
+
+		a, err := d.ArchiveDeployments(tctx, defaultDays)
+		archived = append(archived, a...)
+		if err != nil {
+			return archived, errors.Wrapf(err,
+				"failed to archive deployments of tenant %q", tenant)
+		}
+	}
+
+	return archived, nil
+}
+
+// writeArchiveDocument writes the separator followed by the object in its
+// database representation.
+func writeArchiveDocument(w io.Writer, separator string, v interface{}) error {
+	doc, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+	raw, err := bson.MarshalJSON(doc)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, separator); err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+// writtenArchive describes the archive written by writeDeploymentArchive.
+type writtenArchive struct {
+	deviceDeployments int
+	logs              int
+
+	// IDs, and prefixes of IDs, of the file storage objects holding the
+	// logs, which are included in the archive
+	logObjects  []string
+	logPrefixes []string
+}
+
+// writeDeploymentArchive writes the archive of the deployment with its device
+// deployments and logs, one document at a time, so that they need not be held
+// in memory all at once.
+func (d *Deployments) writeDeploymentArchive(ctx context.Context, w io.Writer,
+	deployment *model.Deployment) (*writtenArchive, error) {
+
+	id := *deployment.Id
+
+	// the layout of deploymentArchive
+	if err := writeArchiveDocument(w, `{"deployment":`, deployment); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+	if _, err := io.WriteString(w, `,"device_deployments":[`); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+
+	written := &writtenArchive{}
+	var withLogs []string
+	err := d.db.IterateDeviceDeployments(ctx, id,
+		func(dd *model.DeviceDeployment) error {
+			separator := ","
+			if written.deviceDeployments == 0 {
+				separator = ""
+			}
+			written.deviceDeployments++
+			if dd.IsLogAvailable {
+				withLogs = append(withLogs, *dd.DeviceId)
+			}
+			return writeArchiveDocument(w, separator, dd)
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to archive device deployments")
+	}
+
+	if _, err := io.WriteString(w, `],"logs":[`); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+	separator := ""
+	for _, deviceID := range withLogs {
+		deploymentLog, err := d.GetDeviceDeploymentLog(ctx, deviceID, id)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get device deployment log")
+		}
+		if deploymentLog == nil {
+			continue
+		}
+		// the archive keeps the messages, not references
+		if deploymentLog.ObjectID != "" {
+			written.logObjects = append(written.logObjects,
+				deploymentLog.ObjectID)
+			deploymentLog.ObjectID = ""
+		}
+		if deploymentLog.ChunksPrefix != "" {
+			written.logPrefixes = append(written.logPrefixes,
+				deploymentLog.ChunksPrefix)
+			deploymentLog.ChunksPrefix = ""
+		}
+		if err := writeArchiveDocument(w, separator, deploymentLog); err != nil {
+			return nil, errors.Wrap(err, "failed to write archive")
+		}
+		separator = ","
+		written.logs++
+	}
+
+	if _, err := io.WriteString(w, `]}`); err != nil {
+		return nil, errors.Wrap(err, "failed to write archive")
+	}
+	return written, nil
+}
+
+// newDeploymentArchiveFile writes the archive of the deployment to a
+// temporary file, gzip-compressed if requested, since its size must be known
+// before storing it. Returns the file, rewound, with its size; the caller
+// removes it with removeTempFile.
+func (d *Deployments) newDeploymentArchiveFile(ctx context.Context,
+	deployment *model.Deployment, compress bool) (*os.File, int64, *writtenArchive, error) {
+
+	f, err := ioutil.TempFile("", "deployment-archive-")
+	if err != nil {
+		return nil, 0, nil, errors.Wrap(err, "failed to create archive")
+	}
+
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	written, err := d.writeDeploymentArchive(ctx, w, deployment)
+	if err == nil && zw != nil {
+		err = errors.Wrap(zw.Close(), "failed to compress archive")
+	}
+	var size int64
+	if err == nil {
+		size, err = f.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeTempFile(f)
+		return nil, 0, nil, err
+	}
+
+	return f, size, written, nil
+}
+
+func removeTempFile(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+func (d *Deployments) archiveDeployment(ctx context.Context,
+	deployment *model.Deployment) (*model.ArchivedDeployment, error) {
+
+	id := *deployment.Id
+
+	// An archive left by an instance which stopped before removing the
+	// deployment is overwritten. The deployment is removed first and
+	// restored last, so while it exists its device deployments and logs
+	// are complete, and so is the new archive.
+	objectID := archiveObjectID(id)
+
+	f, size, written, err := d.newDeploymentArchiveFile(ctx, deployment, true)
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempFile(f)
+
+	if err := d.fileStorage.UploadArtifact(ctx, objectID, size,
+		f, GzipContentType); err != nil {
+		return nil, errors.Wrap(err, "failed to upload archive")
+	}
+
+	archived := &model.ArchivedDeployment{
+		Id:          id,
+		Created:     deployment.Created,
+		Finished:    deployment.Finished,
+		DeviceCount: written.deviceDeployments,
+		Archived:    time.Now(),
+		ObjectID:    objectID,
+	}
+	if deployment.DeploymentConstructor != nil {
+		if deployment.Name != nil {
+			archived.Name = *deployment.Name
+		}
+		if deployment.ArtifactName != nil {
+			archived.ArtifactName = *deployment.ArtifactName
+		}
+	}
+	if err := d.db.SaveArchivedDeployment(ctx, archived); err != nil {
+		return nil, errors.Wrap(err, "failed to save archived deployment")
+	}
+
+	// remove the deployment first, if any of the following steps fails the
+	// leftovers are no longer picked up for archival (which would overwrite
+	// the complete archive)
+	if err := d.db.DeleteDeployment(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to remove deployment")
+	}
+	if err := d.db.DeleteDeviceDeployments(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to remove device deployments")
+	}
+	if err := d.db.DeleteDeviceDeploymentLogs(ctx, id); err != nil {
+		return nil, errors.Wrap(err, "failed to remove device deployment logs")
+	}
+	for _, objectID := range written.logObjects {
+		if err := d.fileStorage.Delete(ctx, objectID); err != nil {
+			log.FromContext(ctx).Warnf("failed to remove log object %s: %v",
+				objectID, err)
+		}
+	}
+	for _, prefix := range written.logPrefixes {
+		if err := d.deleteObjects(ctx, prefix); err != nil {
+			log.FromContext(ctx).Warnf("failed to remove log chunks %s: %v",
+				prefix, err)
+		}
+	}
+
+	log.FromContext(ctx).Infof("archived deployment %s (%d devices)",
+		id, archived.DeviceCount)
+
+	return archived, nil
+}
+
+// ListArchivedDeployments lists archived deployments of the tenant from the
+// context, most recently finished first.
+func (d *Deployments) ListArchivedDeployments(ctx context.Context,
+	skip, limit int) ([]model.ArchivedDeployment, error) {
+
+	archived, err := d.db.FindArchivedDeployments(ctx, skip, limit)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to search for archived deployments")
+	}
+	return archived, nil
+}
+
+// RestoreArchivedDeployment moves the archived deployment, with its device
+// deployments and logs, back to the database.
+func (d *Deployments) RestoreArchivedDeployment(ctx context.Context, id string) error {
+	archived, err := d.db.FindArchivedDeploymentByID(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to search for archived deployment")
+	}
+	if archived == nil {
+		return ErrModelArchivedDeploymentNotFound
+	}
+
+	existing, err := d.db.FindDeploymentByID(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "failed to search for deployment")
+	}
+	if existing != nil {
+		return ErrModelDeploymentExists
+	}
+
+	archive, err := d.readArchive(ctx, archived.ObjectID)
+	if err != nil {
+		return err
+	}
+
+	if err := d.restoreDeploymentArchive(ctx, archive); err != nil {
+		return err
+	}
+
+	if err := d.db.DeleteArchivedDeployment(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to remove archived deployment")
+	}
+	if err := d.fileStorage.Delete(ctx, archived.ObjectID); err != nil {
+		log.FromContext(ctx).Warnf("failed to remove archive of deployment %s: %v",
+			id, err)
+	}
+
+	return nil
+}
+
+// restoreDeploymentArchive inserts the deployment, with its device
+// deployments and logs, from the archive to the database.
+func (d *Deployments) restoreDeploymentArchive(ctx context.Context,
+	archive *deploymentArchive) error {
+
+	var deployment model.Deployment
+	if err := fromDocument(archive.Deployment, &deployment); err != nil {
+		return errors.Wrap(err, "failed to decode deployment")
+	}
+	if deployment.Id == nil {
+		return errors.New("failed to decode deployment: missing id")
+	}
+	id := *deployment.Id
+
+	deviceDeployments := make([]*model.DeviceDeployment, len(archive.DeviceDeployments))
+	for i, doc := range archive.DeviceDeployments {
+		deviceDeployments[i] = &model.DeviceDeployment{}
+		if err := fromDocument(doc, deviceDeployments[i]); err != nil {
+			return errors.Wrap(err, "failed to decode device deployment")
+		}
+	}
+
+	// the list of devices is not stored, but required for validation
+	if deployment.DeploymentConstructor == nil {
+		deployment.DeploymentConstructor = &model.DeploymentConstructor{}
+	}
+	deployment.Devices = make([]string, 0, len(deviceDeployments))
+	for _, dd := range deviceDeployments {
+		deployment.Devices = append(deployment.Devices, *dd.DeviceId)
+	}
+	// missing from the deployments archived before it was stored
+	deployment.DeviceCount = len(deviceDeployments)
+	deployment.ArchivingUntil = nil
+	// not archived again until the retention period passes anew
+	now := time.Now()
+	deployment.RestoredAt = &now
+
+	logs := make([]model.DeploymentLog, len(archive.Logs))
+	for i, doc := range archive.Logs {
+		if err := fromDocument(doc, &logs[i]); err != nil {
+			return errors.Wrap(err, "failed to decode device deployment log")
+		}
+	}
+
+	// leftovers of an interrupted restore
+	if err := d.db.DeleteDeviceDeployments(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to remove device deployments")
+	}
+	if err := d.db.DeleteDeviceDeploymentLogs(ctx, id); err != nil {
+		return errors.Wrap(err, "failed to remove device deployment logs")
+	}
+
+	for _, l := range logs {
+		var err error
+		// large logs would not fit in the database
+		if d.logsInFileStorage {
+			err = d.uploadDeviceDeploymentLog(ctx, l)
+		} else {
+			err = d.db.SaveDeviceDeploymentLog(ctx, l)
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to restore device deployment log")
+		}
+	}
+	if err := d.db.InsertMany(ctx, deviceDeployments...); err != nil {
+		return errors.Wrap(err, "failed to restore device deployments")
+	}
+	// the deployment goes last, so it only shows up once complete
+	if err := d.db.InsertDeployment(ctx, &deployment); err != nil {
+		return errors.Wrap(err, "failed to restore deployment")
+	}
+
+	return nil
+}
+
+func (d *Deployments) readArchive(ctx context.Context,
+	objectID string) (*deploymentArchive, error) {
+
+	r, err := d.fileStorage.GetObject(ctx, objectID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to download archive")
+	}
+	defer r.Close()
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress archive")
+	}
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress archive")
+	}
+
+	var archive deploymentArchive
+	if err := bson.UnmarshalJSON(raw, &archive); err != nil {
+		return nil, errors.Wrap(err, "failed to decode archive")
+	}
+
+	return &archive, nil
+}
@@ -0,0 +1,494 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/s3"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+// objectStore backs the file storage mock with a map
+type objectStore struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func newFileStorage(t *testing.T) (*fs_mocks.FileStorage, *objectStore) {
+	store := &objectStore{objects: map[string][]byte{}}
+	key := func(ctx context.Context, objectID string) string {
+		if id := identity.FromContext(ctx); id != nil {
+			return id.Tenant + "/" + objectID
+		}
+		return objectID
+	}
+
+	fs := &fs_mocks.FileStorage{}
+	for _, contentType := range []string{GzipContentType, ArtifactContentType} {
+		fs.On("UploadArtifact", mock.Anything, mock.AnythingOfType("string"),
+			mock.AnythingOfType("int64"), mock.Anything, contentType).
+			Run(func(args mock.Arguments) {
+				data, err := ioutil.ReadAll(args.Get(3).(io.Reader))
+				assert.NoError(t, err)
+				assert.Equal(t, args.Get(2).(int64), int64(len(data)))
+
+				store.lock.Lock()
+				defer store.lock.Unlock()
+				store.objects[key(args.Get(0).(context.Context), args.String(1))] = data
+			}).
+			Return(nil)
+	}
+	fs.On("GetObject", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(ctx context.Context, objectID string) io.ReadCloser {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			return ioutil.NopCloser(bytes.NewReader(store.objects[key(ctx, objectID)]))
+		}, nil)
+	fs.On("Size", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(ctx context.Context, objectID string) int64 {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			return int64(len(store.objects[key(ctx, objectID)]))
+		}, func(ctx context.Context, objectID string) error {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			if _, ok := store.objects[key(ctx, objectID)]; !ok {
+				return s3.ErrFileStorageFileNotFound
+			}
+			return nil
+		})
+	fs.On("ListObjects", mock.Anything, mock.AnythingOfType("string"),
+		mock.AnythingOfType("string"), mock.AnythingOfType("int")).
+		Return(func(ctx context.Context, prefix, after string, limit int) []string {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+
+			tenantPrefix := key(ctx, "")
+			objectIDs := []string{}
+			for k := range store.objects {
+				if !strings.HasPrefix(k, tenantPrefix+prefix) {
+					continue
+				}
+				if objectID := strings.TrimPrefix(k, tenantPrefix); objectID > after {
+					objectIDs = append(objectIDs, objectID)
+				}
+			}
+			sort.Strings(objectIDs)
+			if len(objectIDs) > limit {
+				objectIDs = objectIDs[:limit]
+			}
+			return objectIDs
+		}, nil)
+	fs.On("Exists", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(ctx context.Context, objectID string) bool {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			_, ok := store.objects[key(ctx, objectID)]
+			return ok
+		}, nil)
+	fs.On("Delete", mock.Anything, mock.AnythingOfType("string")).
+		Run(func(args mock.Arguments) {
+			store.lock.Lock()
+			defer store.lock.Unlock()
+			delete(store.objects, key(args.Get(0).(context.Context), args.String(1)))
+		}).
+		Return(nil)
+
+	return fs, store
+}
+
+// insertFinishedDeployment stores a deployment finished the given number of
+// days ago, with a successful device deployment with a log and a failed one.
+func insertFinishedDeployment(t *testing.T, ctx context.Context,
+	db *inmem.DataStoreInMem, daysAgo int) *model.Deployment {
+
+	var deployment *model.Deployment
+	if daysAgo < 0 {
+		deployment = insertDeployment(t, ctx, db,
+			model.Stats{model.DeviceDeploymentStatusPending: 2}, nil,
+			model.DeviceDeploymentStatusPending, model.DeviceDeploymentStatusPending)
+		return deployment
+	}
+
+	finished := time.Now().Add(-time.Duration(daysAgo) * 24 * time.Hour).
+		Truncate(time.Millisecond)
+	deployment = insertDeployment(t, ctx, db,
+		model.Stats{
+			model.DeviceDeploymentStatusSuccess: 1,
+			model.DeviceDeploymentStatusFailure: 1,
+		}, &finished)
+
+	for i, status := range []string{
+		model.DeviceDeploymentStatusSuccess,
+		model.DeviceDeploymentStatusFailure,
+	} {
+		deviceID := []string{"device-1", "device-2"}[i]
+		dd, err := model.NewDeviceDeployment(deviceID, *deployment.Id)
+		assert.NoError(t, err)
+		dd.Status = &status
+		dd.Image = &model.SoftwareImage{Id: "image"}
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, db.SaveDeviceDeploymentLog(ctx, model.DeploymentLog{
+		DeviceID:     "device-2",
+		DeploymentID: *deployment.Id,
+		Messages: []model.LogMessage{
+			{Timestamp: &now, Level: "error", Message: "failed"},
+		},
+	}))
+	assert.NoError(t, db.UpdateDeviceDeploymentLogAvailability(ctx,
+		"device-2", *deployment.Id, true))
+
+	return deployment
+}
+
+func TestArchiveDeployments(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	old := insertFinishedDeployment(t, ctx, db, 40)
+	recent := insertFinishedDeployment(t, ctx, db, 10)
+	unfinished := insertFinishedDeployment(t, ctx, db, -1)
+
+	// disabled
+	archived, err := d.ArchiveDeployments(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, archived)
+
+	archived, err = d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 1) {
+		assert.Equal(t, *old.Id, archived[0].Id)
+		assert.Equal(t, "foo", archived[0].Name)
+		assert.Equal(t, "bar", archived[0].ArtifactName)
+		assert.Equal(t, 2, archived[0].DeviceCount)
+	}
+	assert.Len(t, objects.objects, 1)
+
+	dep, err := db.FindDeploymentByID(ctx, *old.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, dep)
+	dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *old.Id})
+	assert.NoError(t, err)
+	assert.Empty(t, dds)
+	deploymentLog, err := db.GetDeviceDeploymentLog(ctx, "device-2", *old.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, deploymentLog)
+
+	for _, id := range []string{*recent.Id, *unfinished.Id} {
+		dep, err := db.FindDeploymentByID(ctx, id)
+		assert.NoError(t, err)
+		assert.NotNil(t, dep)
+	}
+
+	list, err := d.ListArchivedDeployments(ctx, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, *old.Id, list[0].Id)
+		assert.Equal(t, archived[0].ObjectID, list[0].ObjectID)
+	}
+
+	// nothing left to archive
+	archived, err = d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	assert.Empty(t, archived)
+
+	// the tenant's limit overrides the default
+	assert.NoError(t, db.UpsertLimit(ctx,
+		model.Limit{Name: model.LimitRetentionDays, Value: 5}))
+	archived, err = d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 1) {
+		assert.Equal(t, *recent.Id, archived[0].Id)
+	}
+
+	list, err = d.ListArchivedDeployments(ctx, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, *recent.Id, list[0].Id)
+		assert.Equal(t, *old.Id, list[1].Id)
+	}
+}
+
+func TestArchiveDeploymentsClaimed(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	claimed := insertFinishedDeployment(t, ctx, db, 40)
+	expired := insertFinishedDeployment(t, ctx, db, 40)
+
+	// being archived by another instance
+	ok, err := db.ClaimDeploymentArchival(ctx, *claimed.Id,
+		time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	// claimed by an instance which died
+	ok, err = db.ClaimDeploymentArchival(ctx, *expired.Id,
+		time.Now().Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	archived, err := d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 1) {
+		assert.Equal(t, *expired.Id, archived[0].Id)
+	}
+	dep, err := db.FindDeploymentByID(ctx, *claimed.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, dep)
+	assert.Len(t, objects.objects, 1)
+}
+
+func TestArchiveDeploymentsInterrupted(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	deployment := insertFinishedDeployment(t, ctx, db, 40)
+
+	// uploaded, partially, by an instance which stopped before saving the
+	// archived deployment
+	objects.objects[archiveObjectID(*deployment.Id)] = []byte("archi")
+
+	archived, err := d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 1) {
+		assert.Equal(t, *deployment.Id, archived[0].Id)
+	}
+	dep, err := db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, dep)
+
+	// the archive was overwritten with a complete one
+	assert.NoError(t, d.RestoreArchivedDeployment(ctx, *deployment.Id))
+	dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+	assert.NoError(t, err)
+	assert.Len(t, dds, 2)
+}
+
+func TestArchiveDeploymentsConcurrent(t *testing.T) {
+	const instances = 4
+
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	for i := 0; i < 10; i++ {
+		insertFinishedDeployment(t, ctx, db, 40)
+	}
+
+	var wg sync.WaitGroup
+	archived := make([][]model.ArchivedDeployment, instances)
+	for i := range archived {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			archived[i], err = d.ArchiveDeployments(ctx, 30)
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// every deployment is archived exactly once
+	ids := map[string]int{}
+	for _, a := range archived {
+		for _, deployment := range a {
+			ids[deployment.Id]++
+		}
+	}
+	assert.Len(t, ids, 10)
+	for id, count := range ids {
+		assert.Equal(t, 1, count, id)
+	}
+	assert.Len(t, objects.objects, 10)
+}
+
+func TestArchiveDeploymentsAllTenants(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, _ := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	assert.NoError(t, db.ProvisionTenant(ctx, "foo"))
+	assert.NoError(t, db.ProvisionTenant(ctx, "bar"))
+	fooCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "foo"})
+	barCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "bar"})
+
+	def := insertFinishedDeployment(t, ctx, db, 40)
+	foo := insertFinishedDeployment(t, fooCtx, db, 40)
+	insertFinishedDeployment(t, barCtx, db, 40)
+
+	// archival disabled for tenant "bar"
+	assert.NoError(t, db.UpsertLimit(barCtx,
+		model.Limit{Name: model.LimitRetentionDays, Value: 0}))
+
+	archived, err := d.ArchiveDeploymentsAllTenants(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 2) {
+		assert.Equal(t, *def.Id, archived[0].Id)
+		assert.Equal(t, *foo.Id, archived[1].Id)
+	}
+
+	list, err := d.ListArchivedDeployments(fooCtx, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	list, err = d.ListArchivedDeployments(barCtx, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestRestoreArchivedDeployment(t *testing.T) {
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Tenant: "foo"})
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	deployment := insertFinishedDeployment(t, ctx, db, 40)
+	dep, err := db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+	assert.NoError(t, err)
+	deploymentLog, err := db.GetDeviceDeploymentLog(ctx, "device-2", *deployment.Id)
+	assert.NoError(t, err)
+
+	err = d.RestoreArchivedDeployment(ctx, *deployment.Id)
+	assert.Equal(t, ErrModelArchivedDeploymentNotFound, err)
+
+	_, err = d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+
+	assert.NoError(t, d.RestoreArchivedDeployment(ctx, *deployment.Id))
+
+	restored, err := db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, restored) {
+		assert.Equal(t, *dep.Id, *restored.Id)
+		assert.Equal(t, *dep.Name, *restored.Name)
+		assert.True(t, dep.Created.Equal(*restored.Created))
+		assert.True(t, dep.Finished.Equal(*restored.Finished))
+		assert.True(t, model.Stats(dep.Stats).Equal(restored.Stats))
+		assert.Nil(t, restored.ArchivingUntil)
+		assert.NotNil(t, restored.RestoredAt)
+	}
+	restoredDds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, dds, restoredDds)
+	restoredLog, err := db.GetDeviceDeploymentLog(ctx, "device-2", *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, deploymentLog, restoredLog)
+
+	list, err := d.ListArchivedDeployments(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Empty(t, objects.objects)
+
+	// not archived again until the retention period passed since the
+	// restore
+	archived, err := d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	assert.Empty(t, archived)
+	restored, err = db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, restored)
+
+	// restoring over an existing deployment
+	_, err = d.archiveDeployment(ctx, restored)
+	assert.NoError(t, err)
+	dep.Devices = []string{"device-1", "device-2"}
+	assert.NoError(t, db.InsertDeployment(ctx, dep))
+	err = d.RestoreArchivedDeployment(ctx, *deployment.Id)
+	assert.Equal(t, ErrModelDeploymentExists, err)
+}
+
+func TestArchiveDeploymentsLogsInFileStorage(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, objects := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType).WithLogsInFileStorage(true)
+
+	deployment := insertFinishedDeployment(t, ctx, db, 40)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	messages := []model.LogMessage{
+		{Timestamp: &now, Level: "error", Message: "failed"},
+	}
+	assert.NoError(t, d.SaveDeviceDeploymentLog(ctx, "device-2", *deployment.Id,
+		messages))
+	logObjectID := deviceDeploymentLogObjectID(*deployment.Id, "device-2")
+	assert.Contains(t, objects.objects, logObjectID)
+	late := now.Add(time.Second)
+	messages = append(messages, model.LogMessage{
+		Timestamp: &late, Level: "info", Message: "late",
+	})
+	assert.NoError(t, d.AppendDeviceDeploymentLog(ctx, "device-2",
+		*deployment.Id, model.LogChunk{
+			Sequence: 1,
+			Messages: messages[1:],
+		}))
+	assert.Len(t, objects.objects, 2)
+
+	archived, err := d.ArchiveDeployments(ctx, 30)
+	assert.NoError(t, err)
+	if assert.Len(t, archived, 1) {
+		// the archive holds the messages, the log objects are removed
+		assert.Len(t, objects.objects, 1)
+		assert.Contains(t, objects.objects, archived[0].ObjectID)
+	}
+
+	// the restored log is stored in the file storage again
+	assert.NoError(t, d.RestoreArchivedDeployment(ctx, *deployment.Id))
+	restoredLog, err := db.GetDeviceDeploymentLog(ctx, "device-2", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, restoredLog) {
+		assert.Equal(t, logObjectID, restoredLog.ObjectID)
+		assert.Empty(t, restoredLog.Messages)
+		assert.Empty(t, restoredLog.ChunksPrefix)
+	}
+	assert.Contains(t, objects.objects, logObjectID)
+
+	restoredLog, err = d.GetDeviceDeploymentLog(ctx, "device-2", *deployment.Id)
+	assert.NoError(t, err)
+	if assert.NotNil(t, restoredLog) {
+		assert.Equal(t, messages, restoredLog.Messages)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+// Number of attempts to correct stats of a deployment which is concurrently
+// being updated
+const recomputeStatsMaxAttempts = 3
+
+// RecomputeStats recomputes cached stats of the deployment (or all
+// deployments of the tenant from the context, if deploymentID is empty) from
+// its device deployments, and fixes the finish time accordingly. Returns the
+// corrections made.
+func (d *Deployments) RecomputeStats(ctx context.Context,
+	deploymentID string) ([]model.StatsCorrection, error) {
+
+	ids := []string{deploymentID}
+	if deploymentID == "" {
+		deployments, _, err := d.db.Find(ctx, model.Query{})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list deployments")
+		}
+
+		ids = make([]string, 0, len(deployments))
+		for _, deployment := range deployments {
+			ids = append(ids, *deployment.Id)
+		}
+	}
+
+	corrections := []model.StatsCorrection{}
+	for _, id := range ids {
+		correction, err := d.recomputeDeploymentStats(ctx, id)
+		if err == ErrModelDeploymentNotFound && deploymentID == "" {
+			// removed since listed, e.g. by the retention policy
+			log.FromContext(ctx).Warnf(
+				"deployment %s not found, skipping", id)
+			continue
+		} else if err == ErrModelDeploymentNotFound {
+			return corrections, err
+		} else if err != nil {
+			return corrections, errors.Wrapf(err,
+				"failed to recompute stats of deployment %s", id)
+		}
+
+		if correction != nil {
+			corrections = append(corrections, *correction)
+		}
+	}
+
+	return corrections, nil
+}
+
+// RecomputeStatsAllTenants runs RecomputeStats for all deployments of all
+// tenants, including the default database.
+func (d *Deployments) RecomputeStatsAllTenants(
+	ctx context.Context) ([]model.StatsCorrection, error) {
+
+	tenants, err := d.db.ListTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	corrections := []model.StatsCorrection{}
+	for _, tenant := range append([]string{""}, tenants...) {
+		tctx := ctx
+		if tenant != "" {
+			tctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+		}
+
+		c, err := d.RecomputeStats(tctx, "")
+		corrections = append(corrections, c...)
+		if err != nil {
+			return corrections, errors.Wrapf(err,
+				"failed to recompute stats of tenant %q", tenant)
+		}
+	}
+
+	return corrections, nil
+}
+
+func (d *Deployments) recomputeDeploymentStats(ctx context.Context,
+	id string) (*model.StatsCorrection, error) {
+
+	l := log.FromContext(ctx)
+
+	for i := 0; i < recomputeStatsMaxAttempts; i++ {
+		deployment, err := d.db.FindDeploymentByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if deployment == nil {
+			return nil, ErrModelDeploymentNotFound
+		}
+
+		stats, err := d.db.AggregateDeviceDeploymentByStatus(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		finished := deployment.Finished
+		if (&model.Deployment{Stats: stats}).IsFinished() {
+			if finished == nil {
+				finished, err = d.lastDeviceFinishTime(ctx, id)
+				if err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			finished = nil
+		}
+
+		if stats.Equal(deployment.Stats) &&
+			(finished == nil) == (deployment.Finished == nil) {
+			return nil, nil
+		}
+
+		err = d.db.ReplaceStats(ctx, id, deployment.Stats, stats, finished)
+		if err == mongo.ErrStorageConflict {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		correction := &model.StatsCorrection{
+			DeploymentID: id,
+			OldStats:     deployment.Stats,
+			NewStats:     stats,
+			OldFinished:  deployment.Finished,
+			NewFinished:  finished,
+		}
+		if ident := identity.FromContext(ctx); ident != nil {
+			correction.Tenant = ident.Tenant
+		}
+
+		l.Infof("corrected stats of deployment %s: %v -> %v, finished: %v -> %v",
+			id, correction.OldStats, correction.NewStats,
+			correction.OldFinished, correction.NewFinished)
+
+		return correction, nil
+	}
+
+	return nil, mongo.ErrStorageConflict
+}
+
+// lastDeviceFinishTime returns the time the last device finished the
+// deployment, now if none recorded it.
+func (d *Deployments) lastDeviceFinishTime(ctx context.Context,
+	id string) (*time.Time, error) {
+
+	last, _, err := d.db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{
+			DeploymentID:   id,
+			SortBy:         model.DeviceDeploymentsSortFinished,
+			SortDescending: true,
+			Limit:          1,
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(last) > 0 && last[0].Finished != nil {
+		return last[0].Finished, nil
+	}
+	now := time.Now()
+	return &now, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+	mstore "github.com/mendersoftware/deployments/store/mocks"
+	"github.com/mendersoftware/deployments/utils/pointers"
+)
+
+// insertDeployment stores a deployment with the given cached stats and
+// device deployments in the given statuses.
+func insertDeployment(t *testing.T, ctx context.Context, db *inmem.DataStoreInMem,
+	stats model.Stats, finished *time.Time, statuses ...string) *model.Deployment {
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"device"},
+		})
+	assert.NoError(t, err)
+	for k, v := range stats {
+		deployment.Stats[k] = v
+	}
+	deployment.Finished = finished
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+
+	for i := range statuses {
+		dd, err := model.NewDeviceDeployment("device", *deployment.Id)
+		assert.NoError(t, err)
+		dd.Status = &statuses[i]
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+
+	return deployment
+}
+
+func TestRecomputeStats(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	finished := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+
+	// consistent, finished
+	ok := insertDeployment(t, ctx, db,
+		model.Stats{model.DeviceDeploymentStatusSuccess: 1}, &finished,
+		model.DeviceDeploymentStatusSuccess)
+	// drifted counters, should be finished when the last device did
+	drifted := insertDeployment(t, ctx, db,
+		model.Stats{
+			model.DeviceDeploymentStatusSuccess:     1,
+			model.DeviceDeploymentStatusDownloading: 1,
+		}, nil)
+	lastFinished := finished.Add(-time.Minute)
+	for i, status := range []string{
+		model.DeviceDeploymentStatusSuccess,
+		model.DeviceDeploymentStatusFailure,
+	} {
+		dd, err := model.NewDeviceDeployment("device", *drifted.Id)
+		assert.NoError(t, err)
+		dd.Status = &status
+		deviceFinished := lastFinished.Add(-time.Duration(1-i) * time.Minute)
+		dd.Finished = &deviceFinished
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+	// consistent counters, but finished while a device is still active
+	active := insertDeployment(t, ctx, db,
+		model.Stats{
+			model.DeviceDeploymentStatusSuccess:    1,
+			model.DeviceDeploymentStatusInstalling: 1,
+		}, &finished,
+		model.DeviceDeploymentStatusSuccess, model.DeviceDeploymentStatusInstalling)
+
+	// single deployment
+	corrections, err := d.RecomputeStats(ctx, *ok.Id)
+	assert.NoError(t, err)
+	assert.Empty(t, corrections)
+
+	_, err = d.RecomputeStats(ctx, "9b4e6f8d-2d55-4d1c-a9a0-4a3c8c1b5f6e")
+	assert.Equal(t, ErrModelDeploymentNotFound, err)
+
+	// whole tenant
+	corrections, err = d.RecomputeStats(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, corrections, 2) {
+		byID := map[string]model.StatsCorrection{}
+		for _, c := range corrections {
+			byID[c.DeploymentID] = c
+		}
+
+		c := byID[*drifted.Id]
+		assert.Equal(t, 1, c.OldStats[model.DeviceDeploymentStatusDownloading])
+		assert.Equal(t, 0, c.NewStats[model.DeviceDeploymentStatusDownloading])
+		assert.Equal(t, 1, c.NewStats[model.DeviceDeploymentStatusFailure])
+		assert.Nil(t, c.OldFinished)
+		if assert.NotNil(t, c.NewFinished) {
+			assert.True(t, lastFinished.Equal(*c.NewFinished))
+		}
+
+		c = byID[*active.Id]
+		assert.True(t, c.OldStats.Equal(c.NewStats))
+		assert.NotNil(t, c.OldFinished)
+		assert.Nil(t, c.NewFinished)
+	}
+
+	dep, err := db.FindDeploymentByID(ctx, *drifted.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dep.Stats[model.DeviceDeploymentStatusFailure])
+	assert.NotNil(t, dep.Finished)
+
+	dep, err = db.FindDeploymentByID(ctx, *active.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, dep.Finished)
+
+	// nothing left to correct
+	corrections, err = d.RecomputeStats(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, corrections)
+}
+
+func TestRecomputeStatsAllTenants(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	assert.NoError(t, db.ProvisionTenant(ctx, "foo"))
+	assert.NoError(t, db.ProvisionTenant(ctx, "bar"))
+
+	insertDeployment(t, ctx, db,
+		model.Stats{model.DeviceDeploymentStatusPending: 1}, nil,
+		model.DeviceDeploymentStatusSuccess)
+
+	fooCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "foo"})
+	foo := insertDeployment(t, fooCtx, db,
+		model.Stats{model.DeviceDeploymentStatusPending: 2}, nil,
+		model.DeviceDeploymentStatusPending)
+
+	barCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "bar"})
+	insertDeployment(t, barCtx, db,
+		model.Stats{model.DeviceDeploymentStatusPending: 1}, nil,
+		model.DeviceDeploymentStatusPending)
+
+	corrections, err := d.RecomputeStatsAllTenants(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, corrections, 2) {
+		assert.Equal(t, "", corrections[0].Tenant)
+		assert.Equal(t, "foo", corrections[1].Tenant)
+		assert.Equal(t, *foo.Id, corrections[1].DeploymentID)
+		assert.Equal(t, 1, corrections[1].NewStats[model.DeviceDeploymentStatusPending])
+	}
+}
+
+func TestRecomputeStatsDeploymentRemoved(t *testing.T) {
+	ctx := context.Background()
+
+	removed := &model.Deployment{
+		Id: pointers.StringToPointer("9b4e6f8d-2d55-4d1c-a9a0-4a3c8c1b5f6e"),
+	}
+	drifted := &model.Deployment{
+		Id:    pointers.StringToPointer("30b3e62c-9ec2-4312-a7fa-cff24cc7397a"),
+		Stats: model.NewDeviceDeploymentStats(),
+	}
+	drifted.Stats[model.DeviceDeploymentStatusPending] = 1
+	stats := model.NewDeviceDeploymentStats()
+	stats[model.DeviceDeploymentStatusPending] = 2
+
+	db := &mstore.DataStore{}
+	db.On("Find", ctx, model.Query{}).
+		Return([]*model.Deployment{removed, drifted}, 2, nil)
+	// removed by the retention policy since listed
+	db.On("FindDeploymentByID", ctx, *removed.Id).
+		Return(nil, nil)
+	db.On("FindDeploymentByID", ctx, *drifted.Id).
+		Return(drifted, nil)
+	db.On("AggregateDeviceDeploymentByStatus", ctx, *drifted.Id).
+		Return(stats, nil)
+	db.On("ReplaceStats", ctx, *drifted.Id, model.Stats(drifted.Stats),
+		stats, (*time.Time)(nil)).Return(nil)
+	d := NewDeployments(db, &fs_mocks.FileStorage{}, ArtifactContentType)
+
+	corrections, err := d.RecomputeStats(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, corrections, 1) {
+		assert.Equal(t, *drifted.Id, corrections[0].DeploymentID)
+	}
+	db.AssertExpectations(t)
+
+	_, err = d.RecomputeStats(ctx, *removed.Id)
+	assert.Equal(t, ErrModelDeploymentNotFound, err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestDeviceDeploymentStatusTransitions(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	for _, lenient := range []bool{false, true} {
+		db := inmem.NewDataStoreInMem()
+		fs := &fs_mocks.FileStorage{}
+		fs.On("GetRequest", mock.Anything, mock.Anything,
+			DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+			Return(&model.Link{Uri: "http://foo"}, nil)
+		d := NewDeployments(db, fs, ArtifactContentType).
+			WithLenientStatusTransitions(lenient)
+
+		insertImage(t, ctx, db, "bar")
+		name, artifact := "foo", "bar"
+		id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"a", "b"},
+		})
+		assert.NoError(t, err)
+
+		report := func(device, status string) error {
+			return d.UpdateDeviceDeploymentStatus(ctx, id, device,
+				model.DeviceDeploymentStatus{Status: status})
+		}
+		checkStatus := func(device, status string) {
+			current, err := db.GetDeviceDeploymentStatus(ctx, id, device)
+			assert.NoError(t, err)
+			assert.Equal(t, status, current)
+		}
+
+		// "a" did not get the artifact yet
+		err = report("a", model.DeviceDeploymentStatusInstalling)
+		if lenient {
+			assert.NoError(t, err)
+			checkStatus("a", model.DeviceDeploymentStatusInstalling)
+		} else {
+			assert.EqualError(t, err, "pending to installing without "+
+				"artifact: invalid status transition")
+			checkStatus("a", model.DeviceDeploymentStatusPending)
+		}
+
+		// "b" may skip reporting downloading, but not go back to it
+		instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx,
+			"b", installed)
+		assert.NoError(t, err)
+		assert.NotNil(t, instructions)
+		assert.NoError(t, report("b", model.DeviceDeploymentStatusInstalling))
+		assert.NoError(t, report("b", model.DeviceDeploymentStatusSuccess))
+
+		err = report("b", model.DeviceDeploymentStatusDownloading)
+		if lenient {
+			assert.NoError(t, err)
+			checkStatus("b", model.DeviceDeploymentStatusDownloading)
+		} else {
+			assert.Equal(t, model.ErrInvalidStatusTransition, errors.Cause(err))
+			checkStatus("b", model.DeviceDeploymentStatusSuccess)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/deployments/s3"
+	"github.com/mendersoftware/deployments/store"
+)
+
+// Errors expected from StorageMigrator
+var (
+	ErrStorageMigrationSizeMismatch     = errors.New("Size mismatch after copy")
+	ErrStorageMigrationChecksumMismatch = errors.New("Checksum mismatch after copy")
+)
+
+// StorageMigrationReport summarizes migration of a single tenant's artifacts.
+type StorageMigrationReport struct {
+	Tenant string
+	// Objects copied to the destination storage (or to be copied in dry-run mode)
+	Copied int
+	// Objects already present in the destination storage
+	Skipped int
+	// Objects referenced by image metadata but absent in the source storage
+	Missing []string
+	// Number of bytes copied
+	Bytes int64
+}
+
+// StorageMigrationJournal keeps track of objects already migrated, so that an
+// interrupted migration can be resumed without verifying them again.
+type StorageMigrationJournal struct {
+	done map[string]string
+	w    io.Writer
+}
+
+// NewStorageMigrationJournal loads previously recorded entries from r (if
+// not nil) and appends new ones to w.
+func NewStorageMigrationJournal(r io.Reader, w io.Writer) (*StorageMigrationJournal, error) {
+	j := &StorageMigrationJournal{
+		done: map[string]string{},
+		w:    w,
+	}
+
+	if r == nil {
+		return j, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		j.done[fields[0]] = fields[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read storage migration journal")
+	}
+
+	return j, nil
+}
+
+func journalKey(tenant, objectID string) string {
+	if tenant == "" {
+		return objectID
+	}
+	return tenant + "/" + objectID
+}
+
+func (j *StorageMigrationJournal) isDone(tenant, objectID string) bool {
+	if j == nil {
+		return false
+	}
+	_, ok := j.done[journalKey(tenant, objectID)]
+	return ok
+}
+
+func (j *StorageMigrationJournal) record(tenant, objectID, checksum string) error {
+	if j == nil {
+		return nil
+	}
+
+	key := journalKey(tenant, objectID)
+	j.done[key] = checksum
+
+	if j.w == nil {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(j.w, "%s %s\n", key, checksum)
+	return err
+}
+
+// StorageMigrator copies artifact files from one file storage to another.
+type StorageMigrator struct {
+	db      store.DataStore
+	src     s3.FileStorage
+	dst     s3.FileStorage
+	dryRun  bool
+	journal *StorageMigrationJournal
+}
+
+func NewStorageMigrator(db store.DataStore, src, dst s3.FileStorage) *StorageMigrator {
+	return &StorageMigrator{
+		db:  db,
+		src: src,
+		dst: dst,
+	}
+}
+
+// WithDryRun makes the migrator only report the objects it would copy.
+func (m *StorageMigrator) WithDryRun(dryRun bool) *StorageMigrator {
+	m.dryRun = dryRun
+	return m
+}
+
+// WithJournal makes the migrator skip objects recorded in the journal, and
+// record every object it verified.
+func (m *StorageMigrator) WithJournal(j *StorageMigrationJournal) *StorageMigrator {
+	m.journal = j
+	return m
+}
+
+// MigrateTenant copies all artifacts of the tenant to the destination
+// storage. Objects which are already present in the destination with
+// matching size and checksum are skipped, therefore the migration can be
+// safely restarted. Every copied object is verified by reading it back.
+func (m *StorageMigrator) MigrateTenant(ctx context.Context,
+	tenant string) (*StorageMigrationReport, error) {
+
+	if tenant != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	}
+
+	l := log.FromContext(ctx)
+
+	images, err := m.db.FindAll(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Searching for image metadata")
+	}
+
+	report := &StorageMigrationReport{
+		Tenant: tenant,
+	}
+
+	for _, image := range images {
+		if m.journal.isDone(tenant, image.Id) {
+			report.Skipped++
+			continue
+		}
+
+		size, err := m.src.Size(ctx, image.Id)
+		if err == s3.ErrFileStorageFileNotFound {
+			l.Warnf("artifact file %s not found in source storage", image.Id)
+			report.Missing = append(report.Missing, image.Id)
+			continue
+		} else if err != nil {
+			return report, errors.Wrapf(err, "failed to check artifact file %s", image.Id)
+		}
+
+		migrated, checksum, err := m.isMigrated(ctx, image.Id, size)
+		if err != nil {
+			return report, err
+		}
+
+		if migrated {
+			report.Skipped++
+			if err := m.journal.record(tenant, image.Id, checksum); err != nil {
+				return report, errors.Wrap(err, "failed to update journal")
+			}
+			continue
+		}
+
+		if m.dryRun {
+			l.Infof("would copy artifact file %s (%d bytes)", image.Id, size)
+			report.Copied++
+			report.Bytes += size
+			continue
+		}
+
+		l.Infof("copying artifact file %s (%d bytes)", image.Id, size)
+		checksum, err = m.copyObject(ctx, image.Id, size)
+		if err != nil {
+			return report, errors.Wrapf(err, "failed to copy artifact file %s", image.Id)
+		}
+
+		report.Copied++
+		report.Bytes += size
+
+		if err := m.journal.record(tenant, image.Id, checksum); err != nil {
+			return report, errors.Wrap(err, "failed to update journal")
+		}
+	}
+
+	return report, nil
+}
+
+// isMigrated checks if the object is present in the destination storage with
+// the same size and checksum as in the source storage.
+func (m *StorageMigrator) isMigrated(ctx context.Context,
+	objectID string, size int64) (bool, string, error) {
+
+	dstSize, err := m.dst.Size(ctx, objectID)
+	if err == s3.ErrFileStorageFileNotFound {
+		return false, "", nil
+	} else if err != nil {
+		return false, "", errors.Wrapf(err,
+			"failed to check destination artifact file %s", objectID)
+	}
+
+	if dstSize != size {
+		return false, "", nil
+	}
+
+	srcSum, _, err := checksumObject(ctx, m.src, objectID)
+	if err != nil {
+		return false, "", err
+	}
+
+	dstSum, _, err := checksumObject(ctx, m.dst, objectID)
+	if err != nil {
+		return false, "", err
+	}
+
+	return srcSum == dstSum, srcSum, nil
+}
+
+// copyObject streams the object from the source to the destination storage
+// and verifies the copy. Returns checksum of the object.
+func (m *StorageMigrator) copyObject(ctx context.Context,
+	objectID string, size int64) (string, error) {
+
+	r, err := m.src.GetObject(ctx, objectID)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if err := m.dst.UploadArtifact(ctx, objectID, size,
+		io.TeeReader(r, h), ArtifactContentType); err != nil {
+		return "", err
+	}
+	srcSum := hex.EncodeToString(h.Sum(nil))
+
+	dstSum, dstSize, err := checksumObject(ctx, m.dst, objectID)
+	if err != nil {
+		return "", err
+	}
+
+	if dstSize != size {
+		return "", ErrStorageMigrationSizeMismatch
+	}
+
+	if dstSum != srcSum {
+		return "", ErrStorageMigrationChecksumMismatch
+	}
+
+	return srcSum, nil
+}
+
+// checksumObject reads the object and computes its SHA256 checksum.
+func checksumObject(ctx context.Context, fs s3.FileStorage,
+	objectID string) (string, int64, error) {
+
+	r, err := fs.GetObject(ctx, objectID)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "failed to read artifact file %s", objectID)
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "failed to read artifact file %s", objectID)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
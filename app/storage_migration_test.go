@@ -0,0 +1,181 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/s3"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	mstore "github.com/mendersoftware/deployments/store/mocks"
+)
+
+func tenantCtxMatcher(tenant string) interface{} {
+	return mock.MatchedBy(func(ctx context.Context) bool {
+		id := identity.FromContext(ctx)
+		if tenant == "" {
+			return id == nil
+		}
+		return id != nil && id.Tenant == tenant
+	})
+}
+
+func objectReader(content string) func(context.Context, string) io.ReadCloser {
+	return func(context.Context, string) io.ReadCloser {
+		return ioutil.NopCloser(strings.NewReader(content))
+	}
+}
+
+func TestStorageMigratorMigrateTenant(t *testing.T) {
+	images := []*model.SoftwareImage{
+		{Id: "copy"},
+		{Id: "present"},
+		{Id: "missing"},
+	}
+
+	testCases := map[string]struct {
+		tenant  string
+		dryRun  bool
+		journal string
+
+		// content of the 'copy' object read back from destination
+		copied string
+
+		report  StorageMigrationReport
+		err     string
+		entries string
+	}{
+		"ok": {
+			tenant: "foo",
+			copied: "artifact",
+			report: StorageMigrationReport{
+				Tenant:  "foo",
+				Copied:  1,
+				Skipped: 1,
+				Missing: []string{"missing"},
+				Bytes:   8,
+			},
+			entries: "foo/present 4d4c7eee2e28d03cb2dbf3df639c3290ade66e18755e83caade2d8f37bd8c044\n",
+		},
+		"ok, default tenant": {
+			copied: "artifact",
+			report: StorageMigrationReport{
+				Copied:  1,
+				Skipped: 1,
+				Missing: []string{"missing"},
+				Bytes:   8,
+			},
+		},
+		"ok, dry run": {
+			tenant: "foo",
+			dryRun: true,
+			report: StorageMigrationReport{
+				Tenant:  "foo",
+				Copied:  1,
+				Skipped: 1,
+				Missing: []string{"missing"},
+				Bytes:   8,
+			},
+		},
+		"ok, resumed from journal": {
+			tenant:  "foo",
+			journal: "foo/copy abc\nfoo/present def\nfoo/missing ghi\n",
+			report: StorageMigrationReport{
+				Tenant:  "foo",
+				Skipped: 3,
+			},
+		},
+		"error, checksum mismatch": {
+			tenant: "foo",
+			copied: "artifacT",
+			report: StorageMigrationReport{
+				Tenant: "foo",
+			},
+			err: "failed to copy artifact file copy: " +
+				ErrStorageMigrationChecksumMismatch.Error(),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("FindAll", tenantCtxMatcher(tc.tenant)).Return(images, nil)
+
+			src := &fs_mocks.FileStorage{}
+			src.On("Size", tenantCtxMatcher(tc.tenant), "copy").Return(int64(8), nil)
+			src.On("Size", tenantCtxMatcher(tc.tenant), "present").Return(int64(7), nil)
+			src.On("Size", tenantCtxMatcher(tc.tenant), "missing").
+				Return(int64(0), s3.ErrFileStorageFileNotFound)
+			src.On("GetObject", tenantCtxMatcher(tc.tenant), "copy").
+				Return(objectReader("artifact"), nil)
+			src.On("GetObject", tenantCtxMatcher(tc.tenant), "present").
+				Return(objectReader("present"), nil)
+
+			dst := &fs_mocks.FileStorage{}
+			dst.On("Size", tenantCtxMatcher(tc.tenant), "copy").
+				Return(int64(0), s3.ErrFileStorageFileNotFound)
+			dst.On("Size", tenantCtxMatcher(tc.tenant), "present").Return(int64(7), nil)
+			dst.On("GetObject", tenantCtxMatcher(tc.tenant), "present").
+				Return(objectReader("present"), nil)
+			dst.On("GetObject", tenantCtxMatcher(tc.tenant), "copy").
+				Return(objectReader(tc.copied), nil)
+			dst.On("UploadArtifact", tenantCtxMatcher(tc.tenant), "copy", int64(8),
+				mock.MatchedBy(func(r io.Reader) bool {
+					b, _ := ioutil.ReadAll(r)
+					return string(b) == "artifact"
+				}),
+				ArtifactContentType).Return(nil)
+
+			var journalOut bytes.Buffer
+			journal, err := NewStorageMigrationJournal(
+				strings.NewReader(tc.journal), &journalOut)
+			assert.NoError(t, err)
+
+			m := NewStorageMigrator(db, src, dst).
+				WithDryRun(tc.dryRun).
+				WithJournal(journal)
+
+			report, err := m.MigrateTenant(context.Background(), tc.tenant)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.report, *report)
+
+			if tc.dryRun {
+				dst.AssertNotCalled(t, "UploadArtifact",
+					mock.Anything, mock.Anything, mock.Anything,
+					mock.Anything, mock.Anything)
+			}
+			if tc.entries != "" {
+				assert.Contains(t, journalOut.String(), tc.entries)
+			}
+		})
+	}
+}
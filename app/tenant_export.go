@@ -0,0 +1,480 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/s3"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+// Version of the tenant export format
+const tenantExportVersion = 1
+
+// Entries of the tenant export. The documents are stored as they are kept in
+// the database (in BSON extended JSON), the same way as in the deployment
+// archives of the retention policy.
+const (
+	tenantExportManifest = "manifest.json"
+	tenantExportLimits   = "limits.json"
+
+	tenantExportImages              = "images/"
+	tenantExportArtifacts           = "artifacts/"
+	tenantExportDeployments         = "deployments/"
+	tenantExportArchivedDeployments = "archived_deployments/"
+
+	tenantExportDocumentExt = ".json"
+	tenantExportArchiveExt  = ".json.gz"
+)
+
+// Number of archived deployments fetched at once for export
+const exportBatchSize = 100
+
+// Errors expected from tenant export and import
+var (
+	ErrTenantExportInvalid = errors.New("Invalid tenant export")
+	ErrTenantNotEmpty      = errors.New("Tenant already has images or deployments")
+)
+
+type tenantExportManifestData struct {
+	Version   int       `json:"version"`
+	TenantID  string    `json:"tenant_id"`
+	Exported  time.Time `json:"exported"`
+	Artifacts bool      `json:"artifacts"`
+}
+
+// TenantTransferReport summarizes an export or import of a tenant's data.
+type TenantTransferReport struct {
+	Limits              int
+	Images              int
+	Artifacts           int
+	Deployments         int
+	DeviceDeployments   int
+	Logs                int
+	ArchivedDeployments int
+	// Artifact files referenced by image metadata but absent in the storage
+	MissingArtifacts []string
+}
+
+type tenantExportWriter struct {
+	tw      *tar.Writer
+	modTime time.Time
+}
+
+func (w *tenantExportWriter) writeEntry(name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: w.modTime,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	if _, err := io.Copy(w.tw, r); err != nil {
+		return errors.Wrapf(err, "failed to write %s", name)
+	}
+	return nil
+}
+
+func (w *tenantExportWriter) writeDocument(name string, doc interface{}) error {
+	raw, err := bson.MarshalJSON(doc)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode %s", name)
+	}
+	return w.writeEntry(name, int64(len(raw)), bytes.NewReader(raw))
+}
+
+// ExportTenant writes all data of the tenant from the context to w as a
+// gzip-compressed tar archive: limits, images (optionally with the artifact
+// files), deployments with their device deployments and logs, and archived
+// deployments.
+func (d *Deployments) ExportTenant(ctx context.Context, w io.Writer,
+	withArtifacts bool) (*TenantTransferReport, error) {
+
+	report := &TenantTransferReport{}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	ew := &tenantExportWriter{tw: tw, modTime: time.Now()}
+
+	manifest := tenantExportManifestData{
+		Version:   tenantExportVersion,
+		Exported:  ew.modTime,
+		Artifacts: withArtifacts,
+	}
+	if id := identity.FromContext(ctx); id != nil {
+		manifest.TenantID = id.Tenant
+	}
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to encode manifest")
+	}
+	if err := ew.writeEntry(tenantExportManifest, int64(len(raw)),
+		bytes.NewReader(raw)); err != nil {
+		return report, err
+	}
+
+	if err := d.exportLimits(ctx, ew, report); err != nil {
+		return report, err
+	}
+	if err := d.exportImages(ctx, ew, withArtifacts, report); err != nil {
+		return report, err
+	}
+	if err := d.exportDeployments(ctx, ew, report); err != nil {
+		return report, err
+	}
+	if err := d.exportArchivedDeployments(ctx, ew, report); err != nil {
+		return report, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return report, errors.Wrap(err, "failed to write export")
+	}
+	if err := zw.Close(); err != nil {
+		return report, errors.Wrap(err, "failed to write export")
+	}
+
+	return report, nil
+}
+
+func (d *Deployments) exportLimits(ctx context.Context,
+	ew *tenantExportWriter, report *TenantTransferReport) error {
+
+	limits := []bson.M{}
+	for _, name := range model.ValidLimits {
+		limit, err := d.db.GetLimit(ctx, name)
+		if err == mongo.ErrLimitNotFound {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get limit %s", name)
+		}
+
+		doc, err := toDocument(limit)
+		if err != nil {
+			return err
+		}
+		limits = append(limits, doc)
+	}
+
+	if err := ew.writeDocument(tenantExportLimits, limits); err != nil {
+		return err
+	}
+	report.Limits = len(limits)
+
+	return nil
+}
+
+func (d *Deployments) exportImages(ctx context.Context, ew *tenantExportWriter,
+	withArtifacts bool, report *TenantTransferReport) error {
+
+	images, err := d.db.FindAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list images")
+	}
+
+	for _, image := range images {
+		doc, err := toDocument(image)
+		if err != nil {
+			return err
+		}
+		if err := ew.writeDocument(
+			tenantExportImages+image.Id+tenantExportDocumentExt, doc); err != nil {
+			return err
+		}
+		report.Images++
+
+		if !withArtifacts {
+			continue
+		}
+
+		size, err := d.fileStorage.Size(ctx, image.Id)
+		if err == s3.ErrFileStorageFileNotFound {
+			report.MissingArtifacts = append(report.MissingArtifacts, image.Id)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to get size of artifact %s", image.Id)
+		}
+
+		r, err := d.fileStorage.GetObject(ctx, image.Id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to download artifact %s", image.Id)
+		}
+		err = ew.writeEntry(tenantExportArtifacts+image.Id, size, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		report.Artifacts++
+	}
+
+	return nil
+}
+
+func (d *Deployments) exportDeployments(ctx context.Context,
+	ew *tenantExportWriter, report *TenantTransferReport) error {
+
+	deployments, _, err := d.db.Find(ctx, model.Query{})
+	if err != nil {
+		return errors.Wrap(err, "failed to list deployments")
+	}
+
+	for _, deployment := range deployments {
+		f, size, written, err := d.newDeploymentArchiveFile(ctx,
+			deployment, false)
+		if err != nil {
+			return errors.Wrapf(err, "failed to export deployment %s", *deployment.Id)
+		}
+		err = ew.writeEntry(
+			tenantExportDeployments+*deployment.Id+tenantExportDocumentExt,
+			size, f)
+		removeTempFile(f)
+		if err != nil {
+			return err
+		}
+		report.Deployments++
+		report.DeviceDeployments += written.deviceDeployments
+		report.Logs += written.logs
+	}
+
+	return nil
+}
+
+func (d *Deployments) exportArchivedDeployments(ctx context.Context,
+	ew *tenantExportWriter, report *TenantTransferReport) error {
+
+	for skip := 0; ; skip += exportBatchSize {
+		archived, err := d.db.FindArchivedDeployments(ctx, skip, exportBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "failed to list archived deployments")
+		}
+
+		for i := range archived {
+			a := &archived[i]
+
+			doc, err := toDocument(a)
+			if err != nil {
+				return err
+			}
+			if err := ew.writeDocument(
+				tenantExportArchivedDeployments+a.Id+tenantExportDocumentExt,
+				doc); err != nil {
+				return err
+			}
+
+			size, err := d.fileStorage.Size(ctx, a.ObjectID)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get size of archive %s", a.Id)
+			}
+			r, err := d.fileStorage.GetObject(ctx, a.ObjectID)
+			if err != nil {
+				return errors.Wrapf(err, "failed to download archive %s", a.Id)
+			}
+			err = ew.writeEntry(
+				tenantExportArchivedDeployments+a.Id+tenantExportArchiveExt, size, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+			report.ArchivedDeployments++
+		}
+
+		if len(archived) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// ImportTenant restores data exported with ExportTenant into the tenant from
+// the context, which may differ from the exported one. The tenant must not
+// have any images or deployments yet.
+func (d *Deployments) ImportTenant(ctx context.Context,
+	r io.Reader) (*TenantTransferReport, error) {
+
+	report := &TenantTransferReport{}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return report, errors.Wrap(ErrTenantExportInvalid, err.Error())
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != tenantExportManifest {
+		return report, errors.Wrap(ErrTenantExportInvalid, "missing manifest")
+	}
+	var manifest tenantExportManifestData
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return report, errors.Wrap(ErrTenantExportInvalid, err.Error())
+	}
+	if manifest.Version != tenantExportVersion {
+		return report, errors.Wrapf(ErrTenantExportInvalid,
+			"unsupported version %d", manifest.Version)
+	}
+
+	if id := identity.FromContext(ctx); id != nil && id.Tenant != "" {
+		if err := d.db.ProvisionTenant(ctx, id.Tenant); err != nil {
+			return report, errors.Wrap(err, "failed to provision tenant")
+		}
+	}
+	if err := d.checkTenantEmpty(ctx); err != nil {
+		return report, err
+	}
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return report, nil
+		} else if err != nil {
+			return report, errors.Wrap(ErrTenantExportInvalid, err.Error())
+		}
+
+		if err := d.importEntry(ctx, hdr, tr, report); err != nil {
+			return report, errors.Wrapf(err, "failed to import %s", hdr.Name)
+		}
+	}
+}
+
+func (d *Deployments) checkTenantEmpty(ctx context.Context) error {
+	images, err := d.db.FindAll(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list images")
+	}
+	deployments, _, err := d.db.Find(ctx, model.Query{Limit: 1})
+	if err != nil {
+		return errors.Wrap(err, "failed to list deployments")
+	}
+	if len(images) > 0 || len(deployments) > 0 {
+		return ErrTenantNotEmpty
+	}
+	return nil
+}
+
+func readDocument(r io.Reader, out interface{}) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := bson.UnmarshalJSON(raw, out); err != nil {
+		return errors.Wrap(ErrTenantExportInvalid, err.Error())
+	}
+	return nil
+}
+
+func (d *Deployments) importEntry(ctx context.Context, hdr *tar.Header,
+	r io.Reader, report *TenantTransferReport) error {
+
+	name := hdr.Name
+	switch {
+	case name == tenantExportLimits:
+		var docs []bson.M
+		if err := readDocument(r, &docs); err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			var limit model.Limit
+			if err := fromDocument(doc, &limit); err != nil {
+				return errors.Wrap(err, "failed to decode limit")
+			}
+			if err := d.db.UpsertLimit(ctx, limit); err != nil {
+				return err
+			}
+			report.Limits++
+		}
+
+	case strings.HasPrefix(name, tenantExportImages) &&
+		strings.HasSuffix(name, tenantExportDocumentExt):
+		var doc bson.M
+		if err := readDocument(r, &doc); err != nil {
+			return err
+		}
+		var image model.SoftwareImage
+		if err := fromDocument(doc, &image); err != nil {
+			return errors.Wrap(err, "failed to decode image")
+		}
+		if err := d.db.InsertImage(ctx, &image); err != nil {
+			return err
+		}
+		report.Images++
+
+	case strings.HasPrefix(name, tenantExportArtifacts):
+		imageID := strings.TrimPrefix(name, tenantExportArtifacts)
+		if err := d.fileStorage.UploadArtifact(ctx, imageID, hdr.Size,
+			r, d.imageContentType); err != nil {
+			return err
+		}
+		report.Artifacts++
+
+	case strings.HasPrefix(name, tenantExportDeployments) &&
+		strings.HasSuffix(name, tenantExportDocumentExt):
+		var archive deploymentArchive
+		if err := readDocument(r, &archive); err != nil {
+			return err
+		}
+		if err := d.restoreDeploymentArchive(ctx, &archive); err != nil {
+			return err
+		}
+		report.Deployments++
+		report.DeviceDeployments += len(archive.DeviceDeployments)
+		report.Logs += len(archive.Logs)
+
+	case strings.HasPrefix(name, tenantExportArchivedDeployments) &&
+		strings.HasSuffix(name, tenantExportArchiveExt):
+		id := strings.TrimSuffix(
+			strings.TrimPrefix(name, tenantExportArchivedDeployments),
+			tenantExportArchiveExt)
+		if err := d.fileStorage.UploadArtifact(ctx, archiveObjectID(id),
+			hdr.Size, r, GzipContentType); err != nil {
+			return err
+		}
+
+	case strings.HasPrefix(name, tenantExportArchivedDeployments) &&
+		strings.HasSuffix(name, tenantExportDocumentExt):
+		var doc bson.M
+		if err := readDocument(r, &doc); err != nil {
+			return err
+		}
+		var archived model.ArchivedDeployment
+		if err := fromDocument(doc, &archived); err != nil {
+			return errors.Wrap(err, "failed to decode archived deployment")
+		}
+		archived.ObjectID = archiveObjectID(archived.Id)
+		if err := d.db.SaveArchivedDeployment(ctx, &archived); err != nil {
+			return err
+		}
+		report.ArchivedDeployments++
+
+	default:
+		return errors.Wrap(ErrTenantExportInvalid, "unexpected entry")
+	}
+
+	return nil
+}
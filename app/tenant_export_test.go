@@ -0,0 +1,164 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func insertImage(t *testing.T, ctx context.Context, db *inmem.DataStoreInMem,
+	name string) *model.SoftwareImage {
+
+	uid, err := uuid.NewV4()
+	assert.NoError(t, err)
+
+	image := model.NewSoftwareImage(
+		uid.String(),
+		&model.SoftwareImageMetaConstructor{},
+		&model.SoftwareImageMetaArtifactConstructor{
+			Name:                  name,
+			DeviceTypesCompatible: []string{"foo"},
+			Info: &model.ArtifactInfo{
+				Format:  "mender",
+				Version: 2,
+			},
+		},
+		4)
+	assert.NoError(t, db.InsertImage(ctx, image))
+
+	return image
+}
+
+func TestExportImportTenant(t *testing.T) {
+	srcCtx := identity.WithContext(context.Background(),
+		&identity.Identity{Tenant: "foo"})
+	srcDb := inmem.NewDataStoreInMem()
+	srcFs, srcObjects := newFileStorage(t)
+	src := NewDeployments(srcDb, srcFs, ArtifactContentType)
+
+	assert.NoError(t, srcDb.ProvisionTenant(srcCtx, "foo"))
+	assert.NoError(t, srcDb.UpsertLimit(srcCtx,
+		model.Limit{Name: model.LimitStorage, Value: 1000}))
+	image := insertImage(t, srcCtx, srcDb, "bar")
+	missing := insertImage(t, srcCtx, srcDb, "baz")
+	srcObjects.objects["foo/"+image.Id] = []byte("data")
+
+	archived := insertFinishedDeployment(t, srcCtx, srcDb, 40)
+	_, err := src.ArchiveDeployments(srcCtx, 30)
+	assert.NoError(t, err)
+	deployment := insertFinishedDeployment(t, srcCtx, srcDb, 10)
+
+	for _, withArtifacts := range []bool{false, true} {
+		var buf bytes.Buffer
+		report, err := src.ExportTenant(srcCtx, &buf, withArtifacts)
+		assert.NoError(t, err)
+		expected := &TenantTransferReport{
+			Limits:              1,
+			Images:              2,
+			Deployments:         1,
+			DeviceDeployments:   2,
+			Logs:                1,
+			ArchivedDeployments: 1,
+		}
+		if withArtifacts {
+			expected.Artifacts = 1
+			expected.MissingArtifacts = []string{missing.Id}
+		}
+		assert.Equal(t, expected, report)
+
+		// import into another installation and tenant
+		dstCtx := identity.WithContext(context.Background(),
+			&identity.Identity{Tenant: "bar"})
+		dstDb := inmem.NewDataStoreInMem()
+		dstFs, dstObjects := newFileStorage(t)
+		dst := NewDeployments(dstDb, dstFs, ArtifactContentType)
+
+		exported := buf.Bytes()
+		report, err = dst.ImportTenant(dstCtx, bytes.NewReader(exported))
+		assert.NoError(t, err)
+		expected.MissingArtifacts = nil
+		assert.Equal(t, expected, report)
+
+		tenants, err := dstDb.ListTenants(dstCtx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bar"}, tenants)
+
+		limit, err := dstDb.GetLimit(dstCtx, model.LimitStorage)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1000), limit.Value)
+
+		images, err := dstDb.FindAll(dstCtx)
+		assert.NoError(t, err)
+		assert.Len(t, images, 2)
+		if withArtifacts {
+			assert.Equal(t, []byte("data"), dstObjects.objects["bar/"+image.Id])
+		} else {
+			assert.NotContains(t, dstObjects.objects, "bar/"+image.Id)
+		}
+
+		dep, err := dstDb.FindDeploymentByID(dstCtx, *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, dep) {
+			assert.Equal(t, *deployment.Name, *dep.Name)
+		}
+		dds, _, err := dstDb.GetDeviceStatusesForDeployment(dstCtx,
+			model.DeviceDeploymentsQuery{DeploymentID: *deployment.Id})
+		assert.NoError(t, err)
+		assert.Len(t, dds, 2)
+		dlog, err := dst.GetDeviceDeploymentLog(dstCtx, "device-2", *deployment.Id)
+		assert.NoError(t, err)
+		if assert.NotNil(t, dlog) && assert.Len(t, dlog.Messages, 1) {
+			assert.Equal(t, "failed", dlog.Messages[0].Message)
+		}
+
+		// the archive is usable in the new location
+		assert.NoError(t, dst.RestoreArchivedDeployment(dstCtx, *archived.Id))
+		dep, err = dstDb.FindDeploymentByID(dstCtx, *archived.Id)
+		assert.NoError(t, err)
+		assert.NotNil(t, dep)
+
+		// importing into a tenant with data
+		_, err = dst.ImportTenant(dstCtx, bytes.NewReader(exported))
+		assert.Equal(t, ErrTenantNotEmpty, err)
+	}
+}
+
+func TestImportTenantInvalid(t *testing.T) {
+	ctx := context.Background()
+	db := inmem.NewDataStoreInMem()
+	fs, _ := newFileStorage(t)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	_, err := d.ImportTenant(ctx, bytes.NewReader([]byte("foo")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ErrTenantExportInvalid.Error())
+
+	var buf bytes.Buffer
+	_, err = d.ExportTenant(ctx, &buf, false)
+	assert.NoError(t, err)
+	// drop the end of the archive
+	truncated := buf.Bytes()[:buf.Len()/2]
+	_, err = d.ImportTenant(ctx, bytes.NewReader(truncated))
+	assert.Error(t, err)
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/deployments/model"
+	fs_mocks "github.com/mendersoftware/deployments/s3/mocks"
+	"github.com/mendersoftware/deployments/store/inmem"
+)
+
+func TestGetDeviceDeploymentTransitions(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	db := inmem.NewDataStoreInMem()
+	fs := &fs_mocks.FileStorage{}
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+
+	transitions, err := d.GetDeviceDeploymentTransitions(ctx, id, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []model.DeviceDeploymentTransition{}, transitions)
+
+	_, err = d.GetDeviceDeploymentTransitions(ctx, id, "c")
+	assert.Equal(t, ErrModelDeploymentNotFound, err)
+
+	instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx, "a", installed)
+	assert.NoError(t, err)
+	assert.NotNil(t, instructions)
+
+	substate := "reboot loop"
+	percent := 50
+	for _, status := range []model.DeviceDeploymentStatus{
+		{Status: model.DeviceDeploymentStatusDownloading},
+		// progress reports are not transitions
+		{
+			Status: model.DeviceDeploymentStatusDownloading,
+			Progress: &model.DeviceDeploymentProgress{
+				Percent: &percent,
+			},
+		},
+		{Status: model.DeviceDeploymentStatusInstalling},
+		{Status: model.DeviceDeploymentStatusRebooting},
+		{Status: model.DeviceDeploymentStatusRebooting, SubState: &substate},
+		{Status: model.DeviceDeploymentStatusFailure},
+		// neither are retries of the final status
+		{Status: model.DeviceDeploymentStatusFailure},
+	} {
+		assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, "a", status))
+	}
+
+	assert.NoError(t, d.AbortDeployment(ctx, id))
+
+	expected := []struct {
+		from, to string
+		substate *string
+	}{
+		{model.DeviceDeploymentStatusPending, model.DeviceDeploymentStatusDownloading, nil},
+		{model.DeviceDeploymentStatusDownloading, model.DeviceDeploymentStatusInstalling, nil},
+		{model.DeviceDeploymentStatusInstalling, model.DeviceDeploymentStatusRebooting, nil},
+		{model.DeviceDeploymentStatusRebooting, model.DeviceDeploymentStatusRebooting, &substate},
+		{model.DeviceDeploymentStatusRebooting, model.DeviceDeploymentStatusFailure, nil},
+	}
+	transitions, err = d.GetDeviceDeploymentTransitions(ctx, id, "a")
+	assert.NoError(t, err)
+	if assert.Len(t, transitions, len(expected)) {
+		for i, e := range expected {
+			assert.Equal(t, e.from, transitions[i].From)
+			assert.Equal(t, e.to, transitions[i].To)
+			assert.Equal(t, e.substate, transitions[i].SubState)
+			assert.False(t, transitions[i].Timestamp.IsZero())
+			if i > 0 {
+				assert.False(t, transitions[i].Timestamp.Before(
+					transitions[i-1].Timestamp))
+			}
+		}
+	}
+
+	// abort is recorded for the devices still active
+	transitions, err = d.GetDeviceDeploymentTransitions(ctx, id, "b")
+	assert.NoError(t, err)
+	if assert.Len(t, transitions, 1) {
+		assert.Equal(t, model.DeviceDeploymentStatusPending, transitions[0].From)
+		assert.Equal(t, model.DeviceDeploymentStatusAborted, transitions[0].To)
+	}
+}
+
+func TestGetDeploymentStatsTimeline(t *testing.T) {
+	ctx := context.Background()
+	installed := model.InstalledDeviceDeployment{
+		Artifact:   "baz",
+		DeviceType: "foo",
+	}
+
+	db := inmem.NewDataStoreInMem()
+	fs := &fs_mocks.FileStorage{}
+	fs.On("GetRequest", mock.Anything, mock.Anything,
+		DefaultUpdateDownloadLinkExpire, ArtifactContentType).
+		Return(&model.Link{Uri: "http://foo"}, nil)
+	d := NewDeployments(db, fs, ArtifactContentType)
+
+	timeline, err := d.GetDeploymentStatsTimeline(ctx,
+		"4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1", time.Minute)
+	assert.NoError(t, err)
+	assert.Nil(t, timeline)
+
+	insertImage(t, ctx, db, "bar")
+	name, artifact := "foo", "bar"
+	id, err := d.CreateDeployment(ctx, &model.DeploymentConstructor{
+		Name:         &name,
+		ArtifactName: &artifact,
+		Devices:      []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+
+	instructions, err := d.GetDeploymentForDeviceWithCurrent(ctx, "a", installed)
+	assert.NoError(t, err)
+	assert.NotNil(t, instructions)
+	assert.NoError(t, d.UpdateDeviceDeploymentStatus(ctx, id, "a",
+		model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusSuccess,
+		}))
+
+	timeline, err = d.GetDeploymentStatsTimeline(ctx, id, time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, timeline, 1) {
+		assert.Equal(t, 1, timeline[0].Stats[model.DeviceDeploymentStatusSuccess])
+		assert.Equal(t, 1, timeline[0].Stats[model.DeviceDeploymentStatusPending])
+		assert.Equal(t, 1,
+			timeline[0].Transitions[model.DeviceDeploymentStatusSuccess])
+	}
+
+	_, err = d.GetDeploymentStatsTimeline(ctx, id, 0)
+	assert.Equal(t, model.ErrInvalidStatsTimelineInterval, err)
+}
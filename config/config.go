@@ -62,6 +62,37 @@ const (
 
 	SettingMiddleware        = "middleware"
 	SettingMiddlewareDefault = EnvProd
+
+	SettingRetention                = "retention"
+	SettingRetentionDays            = SettingRetention + ".days"
+	SettingRetentionDaysDefault     = 0
+	SettingRetentionInterval        = SettingRetention + ".interval"
+	SettingRetentionIntervalDefault = "1h"
+
+	SettingDeprovisioning                = "deprovisioning"
+	SettingDeprovisioningInterval        = SettingDeprovisioning + ".interval"
+	SettingDeprovisioningIntervalDefault = "1m"
+
+	SettingDeviceLogs                   = "device_logs"
+	SettingDeviceLogsFileStorage        = SettingDeviceLogs + ".file_storage"
+	SettingDeviceLogsFileStorageDefault = false
+
+	SettingDeviceWait                = "device_wait"
+	SettingDeviceWaitMax             = SettingDeviceWait + ".max"
+	SettingDeviceWaitMaxDefault      = "60s"
+	SettingDeviceWaitNotifier        = SettingDeviceWait + ".notifier"
+	SettingDeviceWaitNotifierDefault = DeviceWaitNotifierLocal
+
+	DeviceWaitNotifierLocal = "local"
+	DeviceWaitNotifierMongo = "mongo"
+
+	SettingStatusTransitions               = "status_transitions"
+	SettingStatusTransitionsLenient        = SettingStatusTransitions + ".lenient"
+	SettingStatusTransitionsLenientDefault = false
+
+	SettingMaxConcurrent                        = "max_concurrent"
+	SettingMaxConcurrentAdmissionTimeout        = SettingMaxConcurrent + ".admission_timeout"
+	SettingMaxConcurrentAdmissionTimeoutDefault = "24h"
 )
 
 // ValidateAwsAuth validates configuration of SettingsAwsAuth section if provided.
@@ -123,5 +154,13 @@ var (
 		{Key: SettingDbSSLSkipVerify, Value: SettingDbSSLSkipVerifyDefault},
 		{Key: SettingGateway, Value: SettingGatewayDefault},
 		{Key: SettingsAwsTagArtifact, Value: SettingsAwsTagArtifactDefault},
+		{Key: SettingRetentionDays, Value: SettingRetentionDaysDefault},
+		{Key: SettingRetentionInterval, Value: SettingRetentionIntervalDefault},
+		{Key: SettingDeprovisioningInterval, Value: SettingDeprovisioningIntervalDefault},
+		{Key: SettingDeviceLogsFileStorage, Value: SettingDeviceLogsFileStorageDefault},
+		{Key: SettingDeviceWaitMax, Value: SettingDeviceWaitMaxDefault},
+		{Key: SettingDeviceWaitNotifier, Value: SettingDeviceWaitNotifierDefault},
+		{Key: SettingMaxConcurrentAdmissionTimeout, Value: SettingMaxConcurrentAdmissionTimeoutDefault},
+		{Key: SettingStatusTransitionsLenient, Value: SettingStatusTransitionsLenientDefault},
 	}
 )
@@ -17,15 +17,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
 	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/spf13/viper"
 	"github.com/urfave/cli"
 
+	api_http "github.com/mendersoftware/deployments/api/http"
+	dapp "github.com/mendersoftware/deployments/app"
 	dconfig "github.com/mendersoftware/deployments/config"
+	"github.com/mendersoftware/deployments/model"
 	"github.com/mendersoftware/deployments/store/mongo"
 )
 
@@ -74,6 +82,87 @@ func doMain(args []string) {
 
 			Action: cmdMigrate,
 		},
+		{
+			Name:  "migrate-storage",
+			Usage: "Copy artifact files to another file storage and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name: "destination-config",
+					Usage: "Configuration `FILE` with the 'aws' section " +
+						"describing the destination storage.",
+				},
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional); all tenants if not set.",
+				},
+				cli.StringFlag{
+					Name: "journal",
+					Usage: "Journal `FILE` (optional) recording migrated files; " +
+						"allows resuming an interrupted migration.",
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Only report files which would be copied.",
+				},
+			},
+
+			Action: cmdMigrateStorage,
+		},
+		{
+			Name: "recompute-stats",
+			Usage: "Recompute cached deployment stats from device deployments, " +
+				"fix finish times and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional); all tenants if neither tenant nor deployment is set.",
+				},
+				cli.StringFlag{
+					Name:  "deployment",
+					Usage: "Deployment ID (optional); all deployments of the tenant if not set.",
+				},
+			},
+
+			Action: cmdRecomputeStats,
+		},
+		{
+			Name:  "export-tenant",
+			Usage: "Export data of a tenant to a file and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant",
+					Usage: "Tenant ID (optional); the default database if not set.",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "Output `FILE` (gzip-compressed tar archive).",
+				},
+				cli.BoolFlag{
+					Name:  "with-artifacts",
+					Usage: "Include artifact files.",
+				},
+			},
+
+			Action: cmdExportTenant,
+		},
+		{
+			Name: "import-tenant",
+			Usage: "Import data of a tenant exported with export-tenant " +
+				"and exit",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name: "tenant",
+					Usage: "Tenant ID (optional) to import the data to; " +
+						"the default database if not set.",
+				},
+				cli.StringFlag{
+					Name:  "input",
+					Usage: "Input `FILE` created by export-tenant.",
+				},
+			},
+
+			Action: cmdImportTenant,
+		},
 	}
 
 	app.Action = cmdServer
@@ -127,6 +216,13 @@ func cmdServer(args *cli.Context) error {
 	}
 	dbSession.Close()
 
+	if err := startArchival(config.Config); err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+	if err := startDeprovisioning(config.Config); err != nil {
+		return cli.NewExitError(err.Error(), 3)
+	}
+
 	err = RunServer(config.Config)
 	if err != nil {
 		return cli.NewExitError(err.Error(), 4)
@@ -135,6 +231,83 @@ func cmdServer(args *cli.Context) error {
 	return nil
 }
 
+// startArchival starts the background job moving deployments past the
+// retention period to the file storage.
+func startArchival(c config.Reader) error {
+	interval := c.GetDuration(dconfig.SettingRetentionInterval)
+	if interval <= 0 {
+		return nil
+	}
+	days := c.GetInt(dconfig.SettingRetentionDays)
+
+	d, err := newBackgroundDeployments(c)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		l := log.New(log.Ctx{})
+		for {
+			archived, err := d.ArchiveDeploymentsAllTenants(context.Background(), days)
+			if len(archived) > 0 {
+				l.Infof("archived %d deployments", len(archived))
+			}
+			if err != nil {
+				l.Errorf("failed to archive deployments: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+
+	return nil
+}
+
+// startDeprovisioning starts the background job removing the data of the
+// deprovisioned tenants.
+func startDeprovisioning(c config.Reader) error {
+	interval := c.GetDuration(dconfig.SettingDeprovisioningInterval)
+	if interval <= 0 {
+		return nil
+	}
+
+	d, err := newBackgroundDeployments(c)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		l := log.New(log.Ctx{})
+		for {
+			deprovisioned, err := d.DeprovisionTenants(context.Background())
+			if deprovisioned > 0 {
+				l.Infof("deprovisioned %d tenants", deprovisioned)
+			}
+			if err != nil {
+				l.Errorf("failed to deprovision tenants: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+
+	return nil
+}
+
+func newBackgroundDeployments(c config.Reader) (*dapp.Deployments, error) {
+	dbSession, err := mongo.NewMongoSession(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to db: %v", err)
+	}
+
+	fileStorage, err := api_http.SetupS3(c)
+	if err != nil {
+		dbSession.Close()
+		return nil, fmt.Errorf("failed to set up file storage: %v", err)
+	}
+
+	return dapp.NewDeployments(mongo.NewDataStoreMongoWithSession(dbSession),
+		fileStorage, dapp.ArtifactContentType), nil
+}
+
 func cmdMigrate(args *cli.Context) error {
 	tenant := args.String("tenant")
 	db := mstore.DbNameForTenant(tenant, mongo.DbName)
@@ -157,3 +330,256 @@ func cmdMigrate(args *cli.Context) error {
 
 	return nil
 }
+
+func cmdMigrateStorage(args *cli.Context) error {
+	l := log.New(log.Ctx{})
+
+	destConfigPath := args.String("destination-config")
+	if destConfigPath == "" {
+		return cli.NewExitError("destination storage configuration is required", 1)
+	}
+
+	destConfig := viper.New()
+	config.SetDefaults(destConfig, dconfig.Defaults)
+	destConfig.SetConfigFile(destConfigPath)
+	if err := destConfig.ReadInConfig(); err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("error loading destination configuration: %s", err),
+			1)
+	}
+	if err := config.ValidateConfig(destConfig, dconfig.ValidateAwsAuth); err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("error loading destination configuration: %s", err),
+			1)
+	}
+
+	src, err := api_http.SetupS3(config.Config)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to set up source storage: %v", err),
+			3)
+	}
+
+	dst, err := api_http.SetupS3(destConfig)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to set up destination storage: %v", err),
+			3)
+	}
+
+	dbSession, err := mongo.NewMongoSession(config.Config)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to connect to db: %v", err),
+			3)
+	}
+	defer dbSession.Close()
+
+	tenants := []string{args.String("tenant")}
+	if !args.IsSet("tenant") {
+		dbs, err := migrate.GetTenantDbs(dbSession, mstore.IsTenantDb(mongo.DbName))
+		if err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("failed go retrieve tenant DBs: %v", err),
+				3)
+		}
+		for _, db := range dbs {
+			tenants = append(tenants, mstore.TenantFromDbName(db, mongo.DbName))
+		}
+	}
+
+	migrator := dapp.NewStorageMigrator(
+		mongo.NewDataStoreMongoWithSession(dbSession), src, dst).
+		WithDryRun(args.Bool("dry-run"))
+
+	if journalPath := args.String("journal"); journalPath != "" {
+		f, err := os.OpenFile(journalPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("failed to open journal: %v", err),
+				1)
+		}
+		defer f.Close()
+
+		var w io.Writer = f
+		if args.Bool("dry-run") {
+			w = nil
+		}
+
+		journal, err := dapp.NewStorageMigrationJournal(f, w)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		migrator = migrator.WithJournal(journal)
+	}
+
+	for _, tenant := range tenants {
+		report, err := migrator.MigrateTenant(context.Background(), tenant)
+		if report != nil {
+			l.Infof("tenant %q: copied %d files (%d bytes), skipped %d, missing %d",
+				tenant, report.Copied, report.Bytes,
+				report.Skipped, len(report.Missing))
+		}
+		if err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("failed to migrate storage of tenant %q: %v", tenant, err),
+				3)
+		}
+	}
+
+	return nil
+}
+
+func cmdRecomputeStats(args *cli.Context) error {
+	l := log.New(log.Ctx{})
+
+	dbSession, err := mongo.NewMongoSession(config.Config)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to connect to db: %v", err),
+			3)
+	}
+	defer dbSession.Close()
+
+	d := dapp.NewDeployments(mongo.NewDataStoreMongoWithSession(dbSession),
+		nil, dapp.ArtifactContentType)
+
+	ctx := context.Background()
+	if tenant := args.String("tenant"); tenant != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	}
+
+	var corrections []model.StatsCorrection
+	if !args.IsSet("tenant") && !args.IsSet("deployment") {
+		corrections, err = d.RecomputeStatsAllTenants(ctx)
+	} else {
+		corrections, err = d.RecomputeStats(ctx, args.String("deployment"))
+	}
+
+	l.Infof("corrected stats of %d deployments", len(corrections))
+
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to recompute stats: %v", err),
+			3)
+	}
+
+	return nil
+}
+
+// newTenantTransfer sets up the application and the context of the tenant
+// for cmdExportTenant and cmdImportTenant.
+func newTenantTransfer(args *cli.Context) (*dapp.Deployments, context.Context, func(), error) {
+	fileStorage, err := api_http.SetupS3(config.Config)
+	if err != nil {
+		return nil, nil, nil, cli.NewExitError(
+			fmt.Sprintf("failed to set up file storage: %v", err),
+			3)
+	}
+
+	dbSession, err := mongo.NewMongoSession(config.Config)
+	if err != nil {
+		return nil, nil, nil, cli.NewExitError(
+			fmt.Sprintf("failed to connect to db: %v", err),
+			3)
+	}
+
+	d := dapp.NewDeployments(mongo.NewDataStoreMongoWithSession(dbSession),
+		fileStorage, dapp.ArtifactContentType).
+		WithLogsInFileStorage(config.Config.GetBool(dconfig.SettingDeviceLogsFileStorage))
+
+	ctx := context.Background()
+	if tenant := args.String("tenant"); tenant != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant})
+	}
+
+	return d, ctx, dbSession.Close, nil
+}
+
+func logTenantTransferReport(l *log.Logger, action string,
+	report *dapp.TenantTransferReport) {
+
+	if report == nil {
+		return
+	}
+	l.Infof("%s %d limits, %d images, %d artifact files, %d deployments "+
+		"(%d device deployments, %d logs), %d archived deployments",
+		action, report.Limits, report.Images, report.Artifacts,
+		report.Deployments, report.DeviceDeployments, report.Logs,
+		report.ArchivedDeployments)
+	for _, id := range report.MissingArtifacts {
+		l.Warnf("artifact file of image %s not found", id)
+	}
+}
+
+func cmdExportTenant(args *cli.Context) error {
+	l := log.New(log.Ctx{})
+
+	output := args.String("output")
+	if output == "" {
+		return cli.NewExitError("output file is required", 1)
+	}
+
+	d, ctx, closeDb, err := newTenantTransfer(args)
+	if err != nil {
+		return err
+	}
+	defer closeDb()
+
+	f, err := os.Create(output)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to create output file: %v", err),
+			1)
+	}
+	defer f.Close()
+
+	report, err := d.ExportTenant(ctx, f, args.Bool("with-artifacts"))
+	logTenantTransferReport(l, "exported", report)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to export tenant: %v", err),
+			3)
+	}
+
+	if err := f.Close(); err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to write output file: %v", err),
+			3)
+	}
+
+	return nil
+}
+
+func cmdImportTenant(args *cli.Context) error {
+	l := log.New(log.Ctx{})
+
+	input := args.String("input")
+	if input == "" {
+		return cli.NewExitError("input file is required", 1)
+	}
+
+	d, ctx, closeDb, err := newTenantTransfer(args)
+	if err != nil {
+		return err
+	}
+	defer closeDb()
+
+	f, err := os.Open(input)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to open input file: %v", err),
+			1)
+	}
+	defer f.Close()
+
+	report, err := d.ImportTenant(ctx, f)
+	logTenantTransferReport(l, "imported", report)
+	if err != nil {
+		return cli.NewExitError(
+			fmt.Sprintf("failed to import tenant: %v", err),
+			3)
+	}
+
+	return nil
+}
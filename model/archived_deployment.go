@@ -0,0 +1,36 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// ArchivedDeployment describes a finished deployment which was moved, along
+// with its device deployments and logs, from the database to the file storage
+// by the retention policy.
+type ArchivedDeployment struct {
+	Id           string     `json:"id" bson:"_id"`
+	Name         string     `json:"name" bson:"name"`
+	ArtifactName string     `json:"artifact_name" bson:"artifact_name"`
+	Created      *time.Time `json:"created" bson:"created"`
+	Finished     *time.Time `json:"finished,omitempty" bson:"finished"`
+	DeviceCount  int        `json:"device_count" bson:"device_count"`
+
+	// Archival time
+	Archived time.Time `json:"archived" bson:"archived"`
+	// ID of the file storage object holding the archive
+	ObjectID string `json:"-" bson:"object_id"`
+}
@@ -25,7 +25,8 @@ import (
 
 // Errors
 var (
-	ErrInvalidDeviceID = errors.New("Invalid device ID")
+	ErrInvalidDeviceID      = errors.New("Invalid device ID")
+	ErrInvalidMaxConcurrent = errors.New("Invalid maximum of concurrent devices")
 )
 
 // DeploymentConstructor represent input data needed for creating new Deployment (they differ in fields)
@@ -38,6 +39,13 @@ type DeploymentConstructor struct {
 
 	// List of device id's targeted for deployments, required
 	Devices []string `json:"devices,omitempty" valid:"required" bson:"-"`
+
+	// Windows when the devices may start installing the deployment, optional
+	MaintenanceWindows []MaintenanceWindow `json:"maintenance_windows,omitempty" valid:"-" bson:"maintenance_windows,omitempty"`
+
+	// Maximum number of devices downloading, installing or rebooting at
+	// the same time, optional; 0 means no limit
+	MaxConcurrent int `json:"max_concurrent,omitempty" valid:"-" bson:"max_concurrent,omitempty"`
 }
 
 // Validate checkes structure according to valid tags
@@ -53,7 +61,11 @@ func (c *DeploymentConstructor) Validate() error {
 		}
 	}
 
-	return nil
+	if c.MaxConcurrent < 0 {
+		return ErrInvalidMaxConcurrent
+	}
+
+	return MaintenanceWindows{Windows: c.MaintenanceWindows}.Validate()
 }
 
 type Deployment struct {
@@ -77,8 +89,24 @@ type Deployment struct {
 	// Individual counter incremented/decremented according to device status updates.
 	Stats map[string]int `json:"-"`
 
-	// Total number of devices targeted
-	DeviceCount int `json:"device_count" bson:"-"`
+	// Total number of devices targeted, set on create
+	DeviceCount int `json:"device_count" bson:"device_count"`
+
+	// Number of devices admitted to install the deployment and not finished
+	// yet, when limited by MaxConcurrent
+	AdmittedDevices int `json:"-" bson:"admitted_devices"`
+
+	// When the devices may start installing the deployment, if restricted
+	// by maintenance windows
+	Maintenance *MaintenanceStatus `json:"maintenance,omitempty" bson:"-"`
+
+	// Until when the deployment is claimed for archival by an instance of
+	// the service
+	ArchivingUntil *time.Time `json:"-" bson:"archiving_until,omitempty"`
+
+	// When the deployment was last restored from its archive; the retention
+	// period counts from then, not from when it finished
+	RestoredAt *time.Time `json:"-" bson:"restored_at,omitempty"`
 }
 
 // NewDeployment creates new deployment object, sets create data by default.
@@ -224,6 +252,11 @@ type Query struct {
 	// match deployments by text by looking at deployment name and artifact name
 	SearchText string
 
+	// exact artifact name, optional
+	ArtifactName string
+	// only return deployments targeting the device, optional
+	DeviceID string
+
 	// deployment status
 	Status StatusQuery
 	Limit  int
@@ -231,4 +264,18 @@ type Query struct {
 	// only return deployments between timestamp range
 	CreatedAfter  *time.Time
 	CreatedBefore *time.Time
+	// only return deployments finished in the timestamp range
+	FinishedAfter  *time.Time
+	FinishedBefore *time.Time
+
+	// field to sort by, DeploymentsSortCreated or DeploymentsSortFinished;
+	// newest first if empty
+	SortBy         string
+	SortDescending bool
 }
+
+// Fields the deployments may be sorted by
+const (
+	DeploymentsSortCreated  = "created"
+	DeploymentsSortFinished = "finished"
+)
@@ -29,10 +29,11 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 	t.Parallel()
 
 	testCases := []struct {
-		InputName         *string
-		InputArtifactName *string
-		InputDevices      []string
-		IsValid           bool
+		InputName          *string
+		InputArtifactName  *string
+		InputDevices       []string
+		InputMaxConcurrent int
+		IsValid            bool
 	}{
 		{
 			InputName:         nil,
@@ -82,6 +83,20 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 			InputDevices:      []string{"f826484e-1157-4109-af21-304e6d711560"},
 			IsValid:           true,
 		},
+		{
+			InputName:          StringToPointer("f826484e-1157-4109-af21-304e6d711560"),
+			InputArtifactName:  StringToPointer("f826484e-1157-4109-af21-304e6d711560"),
+			InputDevices:       []string{"lala"},
+			InputMaxConcurrent: 10,
+			IsValid:            true,
+		},
+		{
+			InputName:          StringToPointer("f826484e-1157-4109-af21-304e6d711560"),
+			InputArtifactName:  StringToPointer("f826484e-1157-4109-af21-304e6d711560"),
+			InputDevices:       []string{"lala"},
+			InputMaxConcurrent: -1,
+			IsValid:            false,
+		},
 	}
 
 	for _, test := range testCases {
@@ -90,6 +105,7 @@ func TestDeploymentConstructorValidate(t *testing.T) {
 		dep.Name = test.InputName
 		dep.ArtifactName = test.InputArtifactName
 		dep.Devices = test.InputDevices
+		dep.MaxConcurrent = test.InputMaxConcurrent
 
 		err := dep.Validate()
 
@@ -45,6 +45,53 @@ type DeviceDeploymentStatus struct {
 	SubState *string
 	// finish time
 	FinishTime *time.Time
+	// download or installation progress reported by device
+	Progress *DeviceDeploymentProgress
+	// status the device deployment is changed from; the change fails if
+	// the status changed in the meantime, unless empty
+	PreviousStatus string
+	// time of the report; unless zero, the change from the previous status
+	// is recorded in the transitions in the same write
+	Timestamp time.Time
+}
+
+// DeviceDeploymentProgress holds the latest progress of the download or
+// installation reported by the device; all values are optional.
+type DeviceDeploymentProgress struct {
+	BytesDownloaded *int64 `json:"bytes_downloaded,omitempty" bson:"bytes_downloaded,omitempty"`
+	BytesTotal      *int64 `json:"bytes_total,omitempty" bson:"bytes_total,omitempty"`
+	// Percent of the current step, 0-100
+	Percent *int `json:"percent,omitempty" bson:"percent,omitempty"`
+}
+
+func (p DeviceDeploymentProgress) Validate() error {
+	if p.BytesDownloaded != nil && *p.BytesDownloaded < 0 {
+		return errors.Wrap(ErrBadProgress, "negative bytes_downloaded")
+	}
+	if p.BytesTotal != nil && *p.BytesTotal < 0 {
+		return errors.Wrap(ErrBadProgress, "negative bytes_total")
+	}
+	if p.BytesDownloaded != nil && p.BytesTotal != nil &&
+		*p.BytesDownloaded > *p.BytesTotal {
+		return errors.Wrap(ErrBadProgress,
+			"bytes_downloaded greater than bytes_total")
+	}
+	if p.Percent != nil && (*p.Percent < 0 || *p.Percent > 100) {
+		return errors.Wrap(ErrBadProgress, "progress out of range 0-100")
+	}
+	return nil
+}
+
+// DeploymentProgress aggregates the progress reported by the devices which
+// are downloading or installing the deployment's artifact.
+type DeploymentProgress struct {
+	// Number of devices that reported progress
+	Devices int `json:"devices" bson:"devices"`
+	// Sums of bytes reported by the devices
+	BytesDownloaded int64 `json:"bytes_downloaded" bson:"bytes_downloaded"`
+	BytesTotal      int64 `json:"bytes_total" bson:"bytes_total"`
+	// Average of the percentages reported by the devices, if any did
+	Percent *float64 `json:"percent,omitempty" bson:"percent"`
 }
 
 type DeviceDeployment struct {
@@ -77,6 +124,34 @@ type DeviceDeployment struct {
 
 	// Device reported substate
 	SubState *string `json:"substate,omitempty" valid:"-" bson:"substate"`
+
+	// Device reported progress of the download or installation
+	Progress *DeviceDeploymentProgress `json:"progress,omitempty" valid:"-" bson:"progress,omitempty"`
+
+	// The device holds one of the slots of a deployment limiting the
+	// number of concurrent devices
+	Admitted bool `json:"-" valid:"-" bson:"admitted,omitempty"`
+
+	// Time the device was admitted; the slots of devices admitted long
+	// ago, e.g. gone offline, are given to other devices
+	AdmittedAt *time.Time `json:"-" valid:"-" bson:"admitted_at,omitempty"`
+
+	// Status changes, oldest first
+	Transitions []DeviceDeploymentTransition `json:"-" valid:"-" bson:"transitions,omitempty"`
+}
+
+// MaxDeviceDeploymentTransitions is the number of the latest transitions
+// kept for each device deployment.
+const MaxDeviceDeploymentTransitions = 1000
+
+// DeviceDeploymentTransition is a status reported for a device deployment;
+// repeated reports of the same status, e.g. on every reboot of the device,
+// are recorded too.
+type DeviceDeploymentTransition struct {
+	From      string    `json:"from" bson:"from"`
+	To        string    `json:"to" bson:"to"`
+	SubState  *string   `json:"substate,omitempty" bson:"substate,omitempty"`
+	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 }
 
 func NewDeviceDeployment(deviceId, deploymentId string) (*DeviceDeployment, error) {
@@ -110,8 +185,9 @@ func (d *DeviceDeployment) Validate() error {
 // aggregated by state.
 type Stats map[string]int
 
-func NewDeviceDeploymentStats() Stats {
-	statuses := []string{
+// AllDeviceDeploymentStatuses lists all statuses of device deployments.
+func AllDeviceDeploymentStatuses() []string {
+	return []string{
 		DeviceDeploymentStatusNoArtifact,
 		DeviceDeploymentStatusFailure,
 		DeviceDeploymentStatusSuccess,
@@ -123,17 +199,35 @@ func NewDeviceDeploymentStats() Stats {
 		DeviceDeploymentStatusAborted,
 		DeviceDeploymentStatusDecommissioned,
 	}
+}
 
+func NewDeviceDeploymentStats() Stats {
 	s := make(Stats)
 
 	// populate statuses with 0s
-	for _, v := range statuses {
+	for _, v := range AllDeviceDeploymentStatuses() {
 		s[v] = 0
 	}
 
 	return s
 }
 
+// Equal checks if the stats hold the same counters; missing counters are
+// treated as 0.
+func (s Stats) Equal(other Stats) bool {
+	for k, v := range s {
+		if other[k] != v {
+			return false
+		}
+	}
+	for k, v := range other {
+		if s[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 func IsDeviceDeploymentStatusFinished(status string) bool {
 	if status == DeviceDeploymentStatusFailure || status == DeviceDeploymentStatusSuccess ||
 		status == DeviceDeploymentStatusNoArtifact || status == DeviceDeploymentStatusAlreadyInst ||
@@ -143,6 +237,19 @@ func IsDeviceDeploymentStatusFinished(status string) bool {
 	return false
 }
 
+// ProgressDeploymentStatuses lists statuses in which devices may report the
+// progress of the download or installation.
+func ProgressDeploymentStatuses() []string {
+	return []string{
+		DeviceDeploymentStatusDownloading,
+		DeviceDeploymentStatusInstalling,
+	}
+}
+
+func IsDeviceDeploymentStatusWithProgress(status string) bool {
+	return containsString(status, ProgressDeploymentStatuses())
+}
+
 // ActiveDeploymentStatuses lists statuses that represent deployment in active state (not finished).
 func ActiveDeploymentStatuses() []string {
 	return []string{
@@ -153,11 +260,37 @@ func ActiveDeploymentStatuses() []string {
 	}
 }
 
+// Keys of the provides of devices and artifacts
+const (
+	ProvidesKeyArtifactName  = "artifact_name"
+	ProvidesKeyDeviceType    = "device_type"
+	ProvidesKeyArtifactGroup = "artifact_group"
+)
+
 // InstalledDeviceDeployment describes a deployment currently installed on the
 // device, usually reported by a device
 type InstalledDeviceDeployment struct {
 	Artifact   string `valid:"required"`
 	DeviceType string `valid:"required"`
+
+	// All the provides of the device, if reported; artifacts are then
+	// selected by their depends and provides instead of the name
+	Provides map[string]string `valid:"-"`
+}
+
+// DeviceProvides is the request body of devices reporting their provides
+type DeviceProvides struct {
+	Provides map[string]string `json:"device_provides"`
+}
+
+// InstalledDeviceDeployment returns the installed deployment described by
+// the provides.
+func (p DeviceProvides) InstalledDeviceDeployment() InstalledDeviceDeployment {
+	return InstalledDeviceDeployment{
+		Artifact:   p.Provides[ProvidesKeyArtifactName],
+		DeviceType: p.Provides[ProvidesKeyDeviceType],
+		Provides:   p.Provides,
+	}
 }
 
 func (i *InstalledDeviceDeployment) Validate() error {
@@ -170,3 +170,20 @@ func TestDeviceDeploymentIsFinished(t *testing.T) {
 		}
 	}
 }
+
+func TestDeviceDeploymentStatsEqual(t *testing.T) {
+
+	t.Parallel()
+
+	stats := NewDeviceDeploymentStats()
+	stats[DeviceDeploymentStatusSuccess] = 2
+
+	assert.True(t, stats.Equal(Stats{DeviceDeploymentStatusSuccess: 2}))
+	assert.True(t, Stats{DeviceDeploymentStatusSuccess: 2}.Equal(stats))
+	assert.False(t, stats.Equal(Stats{DeviceDeploymentStatusSuccess: 1}))
+	assert.False(t, stats.Equal(Stats{
+		DeviceDeploymentStatusSuccess: 2,
+		DeviceDeploymentStatusFailure: 1,
+	}))
+	assert.True(t, Stats(nil).Equal(NewDeviceDeploymentStats()))
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// DeviceDeploymentHistoryQuery selects device deployments of a single device.
+type DeviceDeploymentHistoryQuery struct {
+	DeviceID string
+
+	// device deployment status, optional
+	Status string
+	// only return device deployments created in the timestamp range
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+
+	Skip  int
+	Limit int
+}
+
+// DeviceDeploymentHistoryEntry describes participation of a device in a
+// single deployment.
+type DeviceDeploymentHistoryEntry struct {
+	DeploymentID   string `json:"deployment_id"`
+	DeploymentName string `json:"deployment_name,omitempty"`
+	ArtifactName   string `json:"artifact_name,omitempty"`
+	// ID of the artifact assigned to the device, if any
+	ArtifactID string `json:"artifact_id,omitempty"`
+
+	Status   string     `json:"status"`
+	SubState *string    `json:"substate,omitempty"`
+	Created  *time.Time `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	IsLogAvailable bool `json:"log"`
+}
@@ -17,6 +17,7 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/asaskevich/govalidator"
@@ -35,11 +36,30 @@ type DeploymentLog struct {
 	DeploymentID string `json:"-" valid:"uuidv4,required"`
 
 	Messages []LogMessage `json:"messages" valid:"required"`
+
+	// ID of the file storage object holding the messages, if not stored
+	// in the database
+	ObjectID string `json:"-" bson:"object_id,omitempty" valid:"-"`
+
+	// chunks appended by the device after the last complete upload
+	Chunks []LogChunk `json:"-" bson:"chunks,omitempty" valid:"-"`
+
+	// prefix of the file storage objects holding the appended chunks, one
+	// object each, if not stored in the database
+	ChunksPrefix string `json:"-" bson:"chunks_prefix,omitempty" valid:"-"`
+}
+
+// LogChunk is a part of the deployment log uploaded incrementally by the
+// device. The sequence number identifies re-sent chunks.
+type LogChunk struct {
+	Sequence uint64       `json:"sequence" bson:"sequence"`
+	Messages []LogMessage `json:"messages" bson:"messages"`
 }
 
 var (
 	ErrInvalidDeploymentLog = errors.New("invalid deployment log")
 	ErrInvalidLogMessage    = errors.New("invalid log message")
+	ErrInvalidLogChunk      = errors.New("invalid log chunk")
 )
 
 func (l *LogMessage) UnmarshalJSON(raw []byte) error {
@@ -91,3 +111,64 @@ func (d DeploymentLog) Validate() error {
 	_, err := govalidator.ValidateStruct(d)
 	return err
 }
+
+func (c *LogChunk) UnmarshalJSON(raw []byte) error {
+	var aux struct {
+		Sequence *uint64      `json:"sequence"`
+		Messages []LogMessage `json:"messages"`
+	}
+
+	if err := json.Unmarshal(raw, &aux); err != nil {
+		return err
+	}
+
+	if aux.Sequence == nil {
+		return errors.Wrapf(ErrInvalidLogChunk, "no sequence number")
+	}
+	if len(aux.Messages) == 0 {
+		return errors.Wrapf(ErrInvalidLogChunk, "no messages")
+	}
+
+	c.Sequence = *aux.Sequence
+	c.Messages = aux.Messages
+	return nil
+}
+
+func (c LogChunk) Validate() error {
+	if len(c.Messages) == 0 {
+		return errors.Wrapf(ErrInvalidLogChunk, "no messages")
+	}
+	for _, m := range c.Messages {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeChunks merges the appended chunks into the log messages, in
+// timestamp order. Messages with equal timestamps keep the order in which
+// they were uploaded.
+func (d *DeploymentLog) MergeChunks() {
+	if len(d.Chunks) == 0 {
+		return
+	}
+
+	chunks := make([]LogChunk, len(d.Chunks))
+	copy(chunks, d.Chunks)
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Sequence < chunks[j].Sequence
+	})
+
+	messages := make([]LogMessage, 0, len(d.Messages))
+	messages = append(messages, d.Messages...)
+	for _, c := range chunks {
+		messages = append(messages, c.Messages...)
+	}
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(*messages[j].Timestamp)
+	})
+
+	d.Messages = messages
+	d.Chunks = nil
+}
@@ -196,3 +196,104 @@ func TestUnmarshalLogMessage(t *testing.T) {
 	}
 
 }
+
+func TestUnmarshalLogChunk(t *testing.T) {
+
+	t.Parallel()
+
+	tref, err := time.Parse(time.RFC3339, "2006-01-02T15:04:05-07:00")
+	assert.NoError(t, err)
+
+	tcs := []struct {
+		input    string
+		err      error
+		expected *LogChunk
+	}{
+		{
+			input: `{"sequence": 1, "messages": []}`,
+			err:   errors.Wrapf(ErrInvalidLogChunk, "no messages"),
+		},
+		{
+			input: `{"messages": [{
+"timestamp": "2006-01-02T15:04:05-07:00", "level": "notice", "message": "foo"
+}]}`,
+			err: errors.Wrapf(ErrInvalidLogChunk, "no sequence number"),
+		},
+		{
+			input: `{"sequence": 0, "messages": [{
+"timestamp": "2006-01-02T15:04:05-07:00", "level": "notice", "message": "foo"
+}]}`,
+			expected: &LogChunk{
+				Sequence: 0,
+				Messages: []LogMessage{
+					{
+						Level:     "notice",
+						Message:   "foo",
+						Timestamp: &tref,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Logf("testing: %v %v", tc.input, tc.err)
+		var c LogChunk
+		err := json.Unmarshal([]byte(tc.input), &c)
+
+		if tc.err != nil {
+			assert.EqualError(t, err, tc.err.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, &c)
+		}
+	}
+}
+
+func TestDeploymentLogMergeChunks(t *testing.T) {
+
+	t.Parallel()
+
+	at := func(sec int64) *time.Time {
+		tm := time.Unix(sec, 0)
+		return &tm
+	}
+
+	dlog := DeploymentLog{
+		Messages: []LogMessage{
+			{Timestamp: at(10), Level: "info", Message: "uploaded"},
+		},
+		Chunks: []LogChunk{
+			{
+				Sequence: 2,
+				Messages: []LogMessage{
+					{Timestamp: at(30), Level: "info", Message: "c"},
+					{Timestamp: at(30), Level: "info", Message: "d"},
+				},
+			},
+			{
+				Sequence: 1,
+				Messages: []LogMessage{
+					{Timestamp: at(20), Level: "info", Message: "a"},
+					{Timestamp: at(30), Level: "info", Message: "b"},
+				},
+			},
+			{
+				// delivered late after a reboot
+				Sequence: 0,
+				Messages: []LogMessage{
+					{Timestamp: at(5), Level: "info", Message: "started"},
+				},
+			},
+		},
+	}
+
+	dlog.MergeChunks()
+
+	var merged []string
+	for _, m := range dlog.Messages {
+		merged = append(merged, m.Message)
+	}
+	assert.Equal(t, []string{"started", "uploaded", "a", "b", "c", "d"}, merged)
+	assert.Nil(t, dlog.Chunks)
+}
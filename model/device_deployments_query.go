@@ -0,0 +1,43 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+// Fields the device deployments of a deployment may be sorted by
+const (
+	DeviceDeploymentsSortCreated  = "created"
+	DeviceDeploymentsSortFinished = "finished"
+)
+
+// DeviceDeploymentsQuery selects a page of the device deployments of a
+// single deployment.
+type DeviceDeploymentsQuery struct {
+	DeploymentID string
+
+	// device deployment status, optional
+	Status string
+	// device type, optional
+	DeviceType string
+	// only return device deployments with or without a log, if set
+	IsLogAvailable *bool
+
+	// field to sort by, DeviceDeploymentsSortCreated if empty; ties are
+	// sorted by the device ID
+	SortBy         string
+	SortDescending bool
+
+	Skip int
+	// no limit if 0
+	Limit int
+}
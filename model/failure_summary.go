@@ -0,0 +1,177 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// FailureGroupSampleSize limits the number of device IDs listed in
+	// each group of the failure summary.
+	FailureGroupSampleSize = 5
+
+	// FailureSignatureLines is the number of trailing error-level log
+	// lines making the signature of a failure.
+	FailureSignatureLines = 3
+)
+
+var (
+	failureSignatureUUID   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	failureSignatureHex    = regexp.MustCompile(`(?i)\b(0x[0-9a-f]+|[0-9a-f]{6,})\b`)
+	failureSignatureNumber = regexp.MustCompile(`[0-9]+`)
+	failureSignatureSpace  = regexp.MustCompile(`\s+`)
+)
+
+// FailureGroup counts the failed devices sharing a key, with a sample of
+// their IDs.
+type FailureGroup struct {
+	Key           string   `json:"key"`
+	Count         int      `json:"count"`
+	SampleDevices []string `json:"sample_devices"`
+}
+
+// FailureSummary groups the failed devices of a deployment by substate, by
+// device type and by the signature of their logs, largest groups first.
+// Devices without substate, device type or error-level log lines are
+// grouped under an empty key.
+type FailureSummary struct {
+	Failed       int            `json:"failed"`
+	BySubState   []FailureGroup `json:"by_substate"`
+	ByDeviceType []FailureGroup `json:"by_device_type"`
+	BySignature  []FailureGroup `json:"by_signature"`
+}
+
+// IsErrorLevel tells whether the log message level is error or worse.
+func (l LogMessage) IsErrorLevel() bool {
+	switch strings.ToLower(l.Level) {
+	case "error", "fatal", "panic", "critical":
+		return true
+	}
+	return false
+}
+
+// NormalizeFailureMessage replaces the UUIDs, hexadecimal values and numbers
+// of the log message, which vary between devices failing for the same
+// reason, with placeholders.
+func NormalizeFailureMessage(message string) string {
+	message = failureSignatureUUID.ReplaceAllString(message, "<uuid>")
+	message = failureSignatureHex.ReplaceAllStringFunc(message, func(hex string) string {
+		// plain numbers and words are not hexadecimal values
+		if strings.HasPrefix(strings.ToLower(hex), "0x") ||
+			(strings.ContainsAny(hex, "0123456789") &&
+				strings.ContainsAny(strings.ToLower(hex), "abcdef")) {
+			return "<hex>"
+		}
+		return hex
+	})
+	message = failureSignatureNumber.ReplaceAllString(message, "<n>")
+	message = failureSignatureSpace.ReplaceAllString(message, " ")
+	return strings.TrimSpace(message)
+}
+
+// FailureSignatureMessages returns the last error-level messages of the log,
+// those making its failure signature, in the order of the log.
+func FailureSignatureMessages(messages []LogMessage) []LogMessage {
+	start := len(messages)
+	count := 0
+	for start > 0 && count < FailureSignatureLines {
+		start--
+		if messages[start].IsErrorLevel() {
+			count++
+		}
+	}
+
+	tail := make([]LogMessage, 0, count)
+	for _, message := range messages[start:] {
+		if message.IsErrorLevel() {
+			tail = append(tail, message)
+		}
+	}
+	return tail
+}
+
+// FailureSignature returns the normalized last error-level lines of the log,
+// one per line; empty if the log holds none.
+func FailureSignature(messages []LogMessage) string {
+	var lines []string
+	for _, message := range FailureSignatureMessages(messages) {
+		lines = append(lines, NormalizeFailureMessage(message.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+type failureGroups map[string]*FailureGroup
+
+func (g failureGroups) add(key, deviceID string) {
+	group, ok := g[key]
+	if !ok {
+		group = &FailureGroup{Key: key, SampleDevices: []string{}}
+		g[key] = group
+	}
+	group.Count++
+	if len(group.SampleDevices) < FailureGroupSampleSize {
+		group.SampleDevices = append(group.SampleDevices, deviceID)
+	}
+}
+
+func (g failureGroups) sorted() []FailureGroup {
+	groups := make([]FailureGroup, 0, len(g))
+	for _, group := range g {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+// NewFailureSummary groups the failed device deployments; signatures holds
+// the failure signatures of the devices by device ID, for those which
+// uploaded a log.
+func NewFailureSummary(failures []DeviceDeployment,
+	signatures map[string]string) *FailureSummary {
+
+	bySubState := failureGroups{}
+	byDeviceType := failureGroups{}
+	bySignature := failureGroups{}
+	for _, dd := range failures {
+		var deviceID, subState, deviceType string
+		if dd.DeviceId != nil {
+			deviceID = *dd.DeviceId
+		}
+		if dd.SubState != nil {
+			subState = *dd.SubState
+		}
+		if dd.DeviceType != nil {
+			deviceType = *dd.DeviceType
+		}
+		bySubState.add(subState, deviceID)
+		byDeviceType.add(deviceType, deviceID)
+		bySignature.add(signatures[deviceID], deviceID)
+	}
+
+	return &FailureSummary{
+		Failed:       len(failures),
+		BySubState:   bySubState.sorted(),
+		ByDeviceType: byDeviceType.sorted(),
+		BySignature:  bySignature.sorted(),
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeFailureMessage(t *testing.T) {
+	testCases := map[string]struct {
+		message  string
+		expected string
+	}{
+		"numbers": {
+			message:  "download timed out after 30s at 45%",
+			expected: "download timed out after <n>s at <n>%",
+		},
+		"uuid": {
+			message:  "artifact 30b3e62c-9ec2-4312-a7fa-cff24cc7397a not found",
+			expected: "artifact <uuid> not found",
+		},
+		"hex": {
+			message:  "checksum 9f86d081884c7d65 != 0xdeadbeef",
+			expected: "checksum <hex> != <hex>",
+		},
+		"words kept": {
+			message:  "failed to decode payload: bad header",
+			expected: "failed to decode payload: bad header",
+		},
+		"whitespace": {
+			message:  "  connection   refused\n",
+			expected: "connection refused",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, NormalizeFailureMessage(tc.message))
+		})
+	}
+}
+
+func TestFailureSignature(t *testing.T) {
+	now := time.Now()
+	message := func(level, text string) LogMessage {
+		return LogMessage{Timestamp: &now, Level: level, Message: text}
+	}
+
+	testCases := map[string]struct {
+		messages []LogMessage
+		expected string
+		errors   []LogMessage
+	}{
+		"no log": {},
+		"no errors": {
+			messages: []LogMessage{
+				message("info", "installing"),
+				message("warning", "retrying"),
+			},
+		},
+		"last error lines": {
+			messages: []LogMessage{
+				message("error", "first error 1"),
+				message("info", "installing"),
+				message("ERROR", "second error 2"),
+				message("error", "third error 3"),
+				message("fatal", "fourth error 4"),
+				message("info", "rolling back"),
+			},
+			expected: "second error <n>\nthird error <n>\nfourth error <n>",
+			errors: []LogMessage{
+				message("ERROR", "second error 2"),
+				message("error", "third error 3"),
+				message("fatal", "fourth error 4"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FailureSignature(tc.messages))
+			if tc.errors == nil {
+				tc.errors = []LogMessage{}
+			}
+			assert.Equal(t, tc.errors, FailureSignatureMessages(tc.messages))
+		})
+	}
+}
+
+func TestNewFailureSummary(t *testing.T) {
+	now := time.Now()
+	strPtr := func(s string) *string { return &s }
+
+	var failures []DeviceDeployment
+	signatures := map[string]string{}
+	for i := 0; i < 8; i++ {
+		device := fmt.Sprintf("device-%d", i)
+		dd := DeviceDeployment{
+			DeviceId:   strPtr(device),
+			DeviceType: strPtr("rpi3"),
+			SubState:   strPtr("ArtifactInstall"),
+		}
+		switch {
+		case i < 6:
+			signatures[device] = FailureSignature([]LogMessage{{
+				Timestamp: &now, Level: "error",
+				Message: fmt.Sprintf("no space left on /dev/mmcblk0p%d", i)}})
+		case i == 6:
+			dd.DeviceType = strPtr("beaglebone")
+			dd.SubState = nil
+			signatures[device] = FailureSignature([]LogMessage{{
+				Timestamp: &now, Level: "error",
+				Message: "connection refused"}})
+		default:
+			dd.DeviceType = nil
+		}
+		failures = append(failures, dd)
+	}
+
+	summary := NewFailureSummary(failures, signatures)
+	assert.Equal(t, &FailureSummary{
+		Failed: 8,
+		BySubState: []FailureGroup{{
+			Key:   "ArtifactInstall",
+			Count: 7,
+			SampleDevices: []string{
+				"device-0", "device-1", "device-2", "device-3", "device-4",
+			},
+		}, {
+			Key:           "",
+			Count:         1,
+			SampleDevices: []string{"device-6"},
+		}},
+		ByDeviceType: []FailureGroup{{
+			Key:   "rpi3",
+			Count: 6,
+			SampleDevices: []string{
+				"device-0", "device-1", "device-2", "device-3", "device-4",
+			},
+		}, {
+			Key:           "",
+			Count:         1,
+			SampleDevices: []string{"device-7"},
+		}, {
+			Key:           "beaglebone",
+			Count:         1,
+			SampleDevices: []string{"device-6"},
+		}},
+		BySignature: []FailureGroup{{
+			Key:   "no space left on /dev/mmcblk<n>p<n>",
+			Count: 6,
+			SampleDevices: []string{
+				"device-0", "device-1", "device-2", "device-3", "device-4",
+			},
+		}, {
+			Key:           "",
+			Count:         1,
+			SampleDevices: []string{"device-7"},
+		}, {
+			Key:           "connection refused",
+			Count:         1,
+			SampleDevices: []string{"device-6"},
+		}},
+	}, summary)
+
+	summary = NewFailureSummary(nil, nil)
+	assert.Equal(t, &FailureSummary{
+		BySubState:   []FailureGroup{},
+		ByDeviceType: []FailureGroup{},
+		BySignature:  []FailureGroup{},
+	}, summary)
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"github.com/asaskevich/govalidator"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidGatewayReport = errors.New("invalid gateway report")
+)
+
+// GatewayDevices lists the devices a gateway is allowed to report for.
+type GatewayDevices struct {
+	Devices []string `json:"devices" bson:"devices"`
+}
+
+func (g GatewayDevices) Validate() error {
+	for _, device := range g.Devices {
+		if govalidator.IsNull(device) {
+			return errors.New("empty device ID")
+		}
+	}
+	return nil
+}
+
+// GatewayReport is the status report and/or the deployment log submitted
+// by a gateway on behalf of one of its devices.
+type GatewayReport struct {
+	DeploymentID string         `json:"deployment_id"`
+	DeviceID     string         `json:"device_id"`
+	Status       *StatusReport  `json:"status,omitempty"`
+	Log          *DeploymentLog `json:"log,omitempty"`
+}
+
+func (r GatewayReport) Validate() error {
+	if !govalidator.IsUUIDv4(r.DeploymentID) {
+		return errors.Wrap(ErrInvalidGatewayReport,
+			"deployment_id: must be a UUIDv4")
+	}
+	if govalidator.IsNull(r.DeviceID) {
+		return errors.Wrap(ErrInvalidGatewayReport, "device_id: required")
+	}
+	if r.Status == nil && r.Log == nil {
+		return errors.Wrap(ErrInvalidGatewayReport,
+			"either status or log is required")
+	}
+	if r.Log != nil {
+		if len(r.Log.Messages) == 0 {
+			return errors.Wrap(ErrInvalidGatewayReport, "log: no messages")
+		}
+		for _, m := range r.Log.Messages {
+			if err := m.Validate(); err != nil {
+				return errors.Wrap(ErrInvalidGatewayReport,
+					"log: "+err.Error())
+			}
+		}
+	}
+	return nil
+}
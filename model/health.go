@@ -0,0 +1,79 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// Health statuses
+const (
+	HealthStatusOK    = "ok"
+	HealthStatusError = "error"
+)
+
+// Names of the checked dependencies
+const (
+	HealthDependencyDatabase    = "mongo"
+	HealthDependencyFileStorage = "storage"
+)
+
+// DependencyHealth describes result of checking a single dependency.
+type DependencyHealth struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+func NewDependencyHealth(name string, latency time.Duration, err error) DependencyHealth {
+	h := DependencyHealth{
+		Name:    name,
+		Status:  HealthStatusOK,
+		Latency: latency.String(),
+	}
+
+	if err != nil {
+		h.Status = HealthStatusError
+		h.Error = err.Error()
+	}
+
+	return h
+}
+
+// HealthReport aggregates the health of all service dependencies.
+type HealthReport struct {
+	Status       string             `json:"status"`
+	Dependencies []DependencyHealth `json:"dependencies"`
+}
+
+func NewHealthReport(deps ...DependencyHealth) *HealthReport {
+	r := &HealthReport{
+		Status:       HealthStatusOK,
+		Dependencies: deps,
+	}
+
+	for _, d := range deps {
+		if d.Status != HealthStatusOK {
+			r.Status = HealthStatusError
+		}
+	}
+
+	return r
+}
+
+func (r *HealthReport) IsHealthy() bool {
+	return r.Status == HealthStatusOK
+}
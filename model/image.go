@@ -65,6 +65,14 @@ type SoftwareImageMetaArtifactConstructor struct {
 
 	// List of updates
 	Updates []Update `json:"updates" valid:"-"`
+
+	// Provides of the artifact, as they are on a device once the artifact
+	// is installed
+	Provides map[string]string `json:"artifact_provides,omitempty" bson:"provides,omitempty" valid:"-"`
+
+	// Depends of the artifact; for each key the device has to provide one
+	// of the listed values
+	Depends map[string][]string `json:"artifact_depends,omitempty" bson:"depends,omitempty" valid:"-"`
 }
 
 func NewSoftwareImageMetaArtifactConstructor() *SoftwareImageMetaArtifactConstructor {
@@ -124,6 +132,51 @@ func (s *SoftwareImage) Validate() error {
 	return err
 }
 
+// ArtifactProvides returns the provides of the artifact. Artifacts stored
+// before the provides were recorded only provide their name.
+func (s *SoftwareImage) ArtifactProvides() map[string]string {
+	if len(s.Provides) > 0 {
+		return s.Provides
+	}
+	return map[string]string{
+		ProvidesKeyArtifactName: s.Name,
+	}
+}
+
+// ArtifactDepends returns the depends of the artifact. Artifacts stored
+// before the depends were recorded only depend on the device type.
+func (s *SoftwareImage) ArtifactDepends() map[string][]string {
+	if len(s.Depends) > 0 {
+		return s.Depends
+	}
+	return map[string][]string{
+		ProvidesKeyDeviceType: s.DeviceTypesCompatible,
+	}
+}
+
+// DependsSatisfied checks if the artifact can be installed on a device with
+// the given provides.
+func (s *SoftwareImage) DependsSatisfied(provides map[string]string) bool {
+	for key, accepted := range s.ArtifactDepends() {
+		value, ok := provides[key]
+		if !ok || !containsString(value, accepted) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsInstalled checks if the artifact is already installed on a device with
+// the given provides.
+func (s *SoftwareImage) IsInstalled(provides map[string]string) bool {
+	for key, value := range s.ArtifactProvides() {
+		if provides[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
 // MultipartUploadMsg is a structure with fields extracted from the mulitpart/form-data form
 // send in the artifact upload request
 type MultipartUploadMsg struct {
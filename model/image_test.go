@@ -76,3 +76,103 @@ func TestValidateCorrectImage(t *testing.T) {
 		t.Errorf("%v", err)
 	}
 }
+
+func TestSoftwareImageProvides(t *testing.T) {
+	legacy := &SoftwareImage{
+		SoftwareImageMetaArtifactConstructor: SoftwareImageMetaArtifactConstructor{
+			Name:                  "foo",
+			DeviceTypesCompatible: []string{"bar", "baz"},
+		},
+	}
+	delta := &SoftwareImage{
+		SoftwareImageMetaArtifactConstructor: SoftwareImageMetaArtifactConstructor{
+			Name:                  "foo",
+			DeviceTypesCompatible: []string{"bar"},
+			Provides: map[string]string{
+				"artifact_name":         "foo",
+				"rootfs-image.checksum": "new",
+			},
+			Depends: map[string][]string{
+				"device_type":           {"bar"},
+				"rootfs-image.checksum": {"old", "older"},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		image    *SoftwareImage
+		provides map[string]string
+
+		satisfied bool
+		installed bool
+	}{
+		"legacy, compatible": {
+			image: legacy,
+			provides: map[string]string{
+				"artifact_name": "other",
+				"device_type":   "baz",
+			},
+			satisfied: true,
+		},
+		"legacy, incompatible": {
+			image: legacy,
+			provides: map[string]string{
+				"artifact_name": "other",
+				"device_type":   "qux",
+			},
+		},
+		"legacy, installed": {
+			image: legacy,
+			provides: map[string]string{
+				"artifact_name": "foo",
+				"device_type":   "bar",
+			},
+			satisfied: true,
+			installed: true,
+		},
+		"delta, compatible": {
+			image: delta,
+			provides: map[string]string{
+				"artifact_name":         "other",
+				"device_type":           "bar",
+				"rootfs-image.checksum": "older",
+			},
+			satisfied: true,
+		},
+		"delta, missing provide": {
+			image: delta,
+			provides: map[string]string{
+				"artifact_name": "other",
+				"device_type":   "bar",
+			},
+		},
+		"delta, installed": {
+			image: delta,
+			provides: map[string]string{
+				"artifact_name":         "foo",
+				"device_type":           "bar",
+				"rootfs-image.checksum": "new",
+			},
+			installed: true,
+		},
+		"delta, same name, other checksum": {
+			image: delta,
+			provides: map[string]string{
+				"artifact_name":         "foo",
+				"device_type":           "bar",
+				"rootfs-image.checksum": "other",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if satisfied := tc.image.DependsSatisfied(tc.provides); satisfied != tc.satisfied {
+				t.Errorf("depends satisfied: %v, expected %v", satisfied, tc.satisfied)
+			}
+			if installed := tc.image.IsInstalled(tc.provides); installed != tc.installed {
+				t.Errorf("installed: %v, expected %v", installed, tc.installed)
+			}
+		})
+	}
+}
@@ -16,10 +16,13 @@ package model
 
 const (
 	LimitStorage = "storage"
+	// Retention period of finished deployments in days, overrides the
+	// global setting; 0 disables archival
+	LimitRetentionDays = "retention_days"
 )
 
 var (
-	ValidLimits = []string{LimitStorage}
+	ValidLimits = []string{LimitStorage, LimitRetentionDays}
 )
 
 type Limit struct {
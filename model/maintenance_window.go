@@ -0,0 +1,212 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	maintenanceWindowTimeLayout = "15:04"
+
+	// Windows are looked up this far ahead; weekly windows always
+	// occur within this period.
+	maintenanceWindowLookahead = 8 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// MaintenanceWindow is a recurring period of the day when devices may start
+// installing deployments, e.g. 02:00-04:00 in Europe/Oslo on weekdays.
+// Windows ending before they start end on the next day.
+type MaintenanceWindow struct {
+	// Start and end of the window, as HH:MM; the same start and end
+	// make the window last the whole day
+	Start string `json:"start" bson:"start"`
+	End   string `json:"end" bson:"end"`
+
+	// IANA time zone of the start and end; defaults to UTC
+	TimeZone string `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+
+	// Days of the week the window starts on, e.g. "monday"; defaults to
+	// every day
+	Weekdays []string `json:"weekdays,omitempty" bson:"weekdays,omitempty"`
+}
+
+func (w MaintenanceWindow) Validate() error {
+	if _, err := time.Parse(maintenanceWindowTimeLayout, w.Start); err != nil {
+		return errors.Wrapf(ErrInvalidMaintenanceWindow, "start %q", w.Start)
+	}
+	if _, err := time.Parse(maintenanceWindowTimeLayout, w.End); err != nil {
+		return errors.Wrapf(ErrInvalidMaintenanceWindow, "end %q", w.End)
+	}
+	if _, err := time.LoadLocation(w.TimeZone); err != nil {
+		return errors.Wrapf(ErrInvalidMaintenanceWindow, "time zone %q", w.TimeZone)
+	}
+	for _, day := range w.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return errors.Wrapf(ErrInvalidMaintenanceWindow, "weekday %q", day)
+		}
+	}
+	return nil
+}
+
+func (w MaintenanceWindow) startsOn(day time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, name := range w.Weekdays {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrences returns the periods of the window overlapping [from, to).
+// The window has to be valid.
+func (w MaintenanceWindow) occurrences(from, to time.Time) [][2]time.Time {
+	loc, _ := time.LoadLocation(w.TimeZone)
+	start, _ := time.Parse(maintenanceWindowTimeLayout, w.Start)
+	end, _ := time.Parse(maintenanceWindowTimeLayout, w.End)
+
+	var periods [][2]time.Time
+	// start a day early for the windows spanning midnight
+	day := from.In(loc).AddDate(0, 0, -1)
+	for ; !day.After(to.In(loc)); day = day.AddDate(0, 0, 1) {
+		if !w.startsOn(day.Weekday()) {
+			continue
+		}
+		periodStart := time.Date(day.Year(), day.Month(), day.Day(),
+			start.Hour(), start.Minute(), 0, 0, loc)
+		periodEnd := time.Date(day.Year(), day.Month(), day.Day(),
+			end.Hour(), end.Minute(), 0, 0, loc)
+		if !periodEnd.After(periodStart) {
+			periodEnd = periodEnd.AddDate(0, 0, 1)
+		}
+		if periodEnd.After(from) && periodStart.Before(to) {
+			periods = append(periods, [2]time.Time{periodStart, periodEnd})
+		}
+	}
+	return periods
+}
+
+// MaintenanceWindows are the windows of a tenant, a device or a deployment.
+// Without any window devices may install deployments at any time.
+type MaintenanceWindows struct {
+	Windows []MaintenanceWindow `json:"windows" bson:"windows"`
+}
+
+func (ws MaintenanceWindows) Validate() error {
+	for _, w := range ws.Windows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Contains checks if the time is within any of the windows.
+func (ws MaintenanceWindows) Contains(t time.Time) bool {
+	if len(ws.Windows) == 0 {
+		return true
+	}
+	for _, w := range ws.Windows {
+		if len(w.occurrences(t, t.Add(time.Nanosecond))) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// NextMaintenanceWindow returns the earliest time, not before t, within the
+// windows of all the sets; t itself if it is within all of them. Returns
+// false if the windows do not overlap in the coming week.
+func NextMaintenanceWindow(t time.Time, sets ...MaintenanceWindows) (time.Time, bool) {
+	// the windows overlap first at the start of one of them, unless they
+	// overlap already
+	candidates := []time.Time{t}
+	for _, set := range sets {
+		for _, w := range set.Windows {
+			for _, period := range w.occurrences(t, t.Add(maintenanceWindowLookahead)) {
+				if period[0].After(t) {
+					candidates = append(candidates, period[0])
+				}
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+
+	for _, candidate := range candidates {
+		open := true
+		for _, set := range sets {
+			if !set.Contains(candidate) {
+				open = false
+				break
+			}
+		}
+		if open {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// MaintenanceStatus tells if and when the devices of a deployment may start
+// installing it.
+type MaintenanceStatus struct {
+	Open bool `json:"open"`
+
+	// Start of the next window, if not open
+	NextWindow *time.Time `json:"next_window,omitempty"`
+
+	// Seconds until the next window
+	NextWindowIn *int64 `json:"next_window_in,omitempty"`
+}
+
+// NewMaintenanceStatus returns the status of the windows of all the sets at
+// the given time.
+func NewMaintenanceStatus(t time.Time, sets ...MaintenanceWindows) *MaintenanceStatus {
+	next, found := NextMaintenanceWindow(t, sets...)
+	if !found {
+		return &MaintenanceStatus{}
+	}
+	if !next.After(t) {
+		return &MaintenanceStatus{Open: true}
+	}
+	in := int64(next.Sub(t).Seconds())
+	return &MaintenanceStatus{
+		NextWindow:   &next,
+		NextWindowIn: &in,
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	testCases := map[string]struct {
+		window MaintenanceWindow
+		err    string
+	}{
+		"ok": {
+			window: MaintenanceWindow{
+				Start:    "02:00",
+				End:      "04:00",
+				TimeZone: "Europe/Oslo",
+				Weekdays: []string{"Monday", "friday"},
+			},
+		},
+		"ok, UTC": {
+			window: MaintenanceWindow{Start: "22:00", End: "02:00"},
+		},
+		"error, start": {
+			window: MaintenanceWindow{Start: "25:00", End: "02:00"},
+			err:    `start "25:00": invalid maintenance window`,
+		},
+		"error, end": {
+			window: MaintenanceWindow{Start: "01:00", End: "2"},
+			err:    `end "2": invalid maintenance window`,
+		},
+		"error, time zone": {
+			window: MaintenanceWindow{
+				Start:    "01:00",
+				End:      "02:00",
+				TimeZone: "Europe/Atlantis",
+			},
+			err: `time zone "Europe/Atlantis": invalid maintenance window`,
+		},
+		"error, weekday": {
+			window: MaintenanceWindow{
+				Start:    "01:00",
+				End:      "02:00",
+				Weekdays: []string{"someday"},
+			},
+			err: `weekday "someday": invalid maintenance window`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := MaintenanceWindows{
+				Windows: []MaintenanceWindow{tc.window},
+			}.Validate()
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				assert.Equal(t, ErrInvalidMaintenanceWindow, errors.Cause(err))
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNextMaintenanceWindow(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	assert.NoError(t, err)
+
+	weekdaysNight := MaintenanceWindows{
+		Windows: []MaintenanceWindow{{
+			Start:    "02:00",
+			End:      "04:00",
+			TimeZone: "Europe/Oslo",
+			Weekdays: []string{
+				"monday", "tuesday", "wednesday", "thursday", "friday",
+			},
+		}},
+	}
+	aroundMidnight := MaintenanceWindows{
+		Windows: []MaintenanceWindow{{
+			Start: "23:00",
+			End:   "02:30",
+		}},
+	}
+
+	testCases := map[string]struct {
+		time time.Time
+		sets []MaintenanceWindows
+
+		open  bool
+		next  time.Time
+		found bool
+	}{
+		"no windows": {
+			time:  time.Date(2019, 5, 6, 12, 0, 0, 0, oslo),
+			open:  true,
+			next:  time.Date(2019, 5, 6, 12, 0, 0, 0, oslo),
+			found: true,
+		},
+		"empty windows": {
+			time:  time.Date(2019, 5, 6, 12, 0, 0, 0, oslo),
+			sets:  []MaintenanceWindows{{}},
+			open:  true,
+			next:  time.Date(2019, 5, 6, 12, 0, 0, 0, oslo),
+			found: true,
+		},
+		"within the window": {
+			// Monday
+			time:  time.Date(2019, 5, 6, 3, 0, 0, 0, oslo),
+			sets:  []MaintenanceWindows{weekdaysNight},
+			open:  true,
+			next:  time.Date(2019, 5, 6, 3, 0, 0, 0, oslo),
+			found: true,
+		},
+		"end of the window": {
+			time:  time.Date(2019, 5, 6, 4, 0, 0, 0, oslo),
+			sets:  []MaintenanceWindows{weekdaysNight},
+			next:  time.Date(2019, 5, 7, 2, 0, 0, 0, oslo),
+			found: true,
+		},
+		"weekend": {
+			// Saturday
+			time:  time.Date(2019, 5, 4, 3, 0, 0, 0, oslo),
+			sets:  []MaintenanceWindows{weekdaysNight},
+			next:  time.Date(2019, 5, 6, 2, 0, 0, 0, oslo),
+			found: true,
+		},
+		"window from the previous day": {
+			time:  time.Date(2019, 5, 6, 1, 0, 0, 0, time.UTC),
+			sets:  []MaintenanceWindows{aroundMidnight},
+			open:  true,
+			next:  time.Date(2019, 5, 6, 1, 0, 0, 0, time.UTC),
+			found: true,
+		},
+		"overlapping windows": {
+			// Monday 01:00 UTC, 03:00 in Oslo
+			time:  time.Date(2019, 5, 6, 1, 0, 0, 0, time.UTC),
+			sets:  []MaintenanceWindows{weekdaysNight, aroundMidnight},
+			open:  true,
+			next:  time.Date(2019, 5, 6, 1, 0, 0, 0, time.UTC),
+			found: true,
+		},
+		"overlapping windows, next day": {
+			// Monday 12:00 UTC; both windows contain 00:00-02:00 UTC
+			time:  time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC),
+			sets:  []MaintenanceWindows{weekdaysNight, aroundMidnight},
+			next:  time.Date(2019, 5, 7, 0, 0, 0, 0, time.UTC),
+			found: true,
+		},
+		"windows never overlapping": {
+			time: time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC),
+			sets: []MaintenanceWindows{
+				weekdaysNight,
+				{Windows: []MaintenanceWindow{{Start: "12:00", End: "13:00"}}},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			open := true
+			for _, set := range tc.sets {
+				open = open && set.Contains(tc.time)
+			}
+			assert.Equal(t, tc.open, open)
+
+			next, found := NextMaintenanceWindow(tc.time, tc.sets...)
+			assert.Equal(t, tc.found, found)
+			if tc.found {
+				assert.True(t, tc.next.Equal(next),
+					"expected %s, got %s", tc.next, next)
+			}
+		})
+	}
+}
+
+func TestNewMaintenanceStatus(t *testing.T) {
+	now := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	in := int64(90 * 60)
+	next := now.Add(90 * time.Minute)
+
+	assert.Equal(t, &MaintenanceStatus{Open: true}, NewMaintenanceStatus(now))
+	assert.Equal(t, &MaintenanceStatus{
+		NextWindow:   &next,
+		NextWindowIn: &in,
+	}, NewMaintenanceStatus(now, MaintenanceWindows{
+		Windows: []MaintenanceWindow{{Start: "13:30", End: "14:00"}},
+	}))
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+// StatsCorrection describes a deployment whose cached stats (or finish time)
+// did not match its device deployments and were corrected.
+type StatsCorrection struct {
+	Tenant       string `json:"tenant_id,omitempty"`
+	DeploymentID string `json:"deployment_id"`
+
+	OldStats Stats `json:"old_stats"`
+	NewStats Stats `json:"new_stats"`
+
+	OldFinished *time.Time `json:"old_finished,omitempty"`
+	NewFinished *time.Time `json:"new_finished,omitempty"`
+}
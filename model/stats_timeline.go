@@ -0,0 +1,189 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxStatsTimelineBuckets limits the number of intervals of the
+	// statistics timeline.
+	MaxStatsTimelineBuckets = 1000
+)
+
+var (
+	ErrInvalidStatsTimelineInterval = errors.New("invalid interval")
+)
+
+// StatsTimelineBucket holds the statistics of a deployment at the end of an
+// interval. The counts of finished statuses only grow, making cumulative
+// success and failure curves.
+type StatsTimelineBucket struct {
+	// End of the interval
+	Time time.Time `json:"time"`
+
+	// Number of device deployments in each status at the end of the
+	// interval
+	Stats Stats `json:"stats"`
+
+	// Number of device deployments changing to each status within the
+	// interval
+	Transitions Stats `json:"transitions"`
+}
+
+type statusEvent struct {
+	status string
+	time   time.Time
+}
+
+// StatsTimeline accumulates the statistics timeline of a deployment one
+// device deployment at a time, so that they need not be read all at once.
+type StatsTimeline struct {
+	ends []time.Time
+
+	// changes of the number of device deployments in each status, and
+	// transitions, within each interval
+	changes     []Stats
+	transitions []Stats
+}
+
+// NewStatsTimeline builds the statistics of the device deployments over the
+// [from, to] period, bucketed by the interval, from their status transitions.
+func NewStatsTimeline(deviceDeployments []DeviceDeployment,
+	from, to time.Time, interval time.Duration) ([]StatsTimelineBucket, error) {
+
+	timeline, err := NewEmptyStatsTimeline(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deviceDeployments {
+		timeline.Add(&deviceDeployments[i])
+	}
+	return timeline.Buckets(), nil
+}
+
+// NewEmptyStatsTimeline returns the timeline of the [from, to] period,
+// bucketed by the interval, without any device deployments.
+func NewEmptyStatsTimeline(from, to time.Time,
+	interval time.Duration) (*StatsTimeline, error) {
+
+	if interval <= 0 {
+		return nil, ErrInvalidStatsTimelineInterval
+	}
+	count := int(to.Sub(from) / interval)
+	if to.Sub(from)%interval != 0 || count == 0 {
+		count++
+	}
+	if count > MaxStatsTimelineBuckets {
+		return nil, errors.Wrapf(ErrInvalidStatsTimelineInterval,
+			"more than %d intervals", MaxStatsTimelineBuckets)
+	}
+
+	timeline := &StatsTimeline{
+		ends:        make([]time.Time, count),
+		changes:     make([]Stats, count),
+		transitions: make([]Stats, count),
+	}
+	for i := range timeline.ends {
+		end := from.Add(time.Duration(i+1) * interval)
+		if end.After(to) {
+			end = to
+		}
+		timeline.ends[i] = end
+		timeline.changes[i] = NewDeviceDeploymentStats()
+		timeline.transitions[i] = NewDeviceDeploymentStats()
+	}
+	return timeline, nil
+}
+
+// Add accounts the device deployment in the timeline from its status
+// transitions. Device deployments without transitions recorded are pending
+// until they finish, if they did.
+func (t *StatsTimeline) Add(dd *DeviceDeployment) {
+	var events []statusEvent
+	if dd.Created != nil {
+		events = append(events, statusEvent{
+			status: DeviceDeploymentStatusPending,
+			time:   *dd.Created,
+		})
+	}
+	for _, transition := range dd.Transitions {
+		events = append(events, statusEvent{
+			status: transition.To,
+			time:   transition.Timestamp,
+		})
+	}
+	if len(dd.Transitions) == 0 && dd.Finished != nil && dd.Status != nil {
+		events = append(events, statusEvent{
+			status: *dd.Status,
+			time:   *dd.Finished,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	current := ""
+	for _, event := range events {
+		// events are counted in the first interval ending after them
+		i := sort.Search(len(t.ends), func(i int) bool {
+			return !t.ends[i].Before(event.time)
+		})
+		if i == len(t.ends) {
+			break
+		}
+		if current == event.status {
+			continue
+		}
+		// creating the device deployment is not a transition
+		if current != "" {
+			t.changes[i][current]--
+			t.transitions[i][event.status]++
+		}
+		t.changes[i][event.status]++
+		current = event.status
+	}
+}
+
+// Buckets returns the statistics at the end of each interval.
+func (t *StatsTimeline) Buckets() []StatsTimelineBucket {
+	buckets := make([]StatsTimelineBucket, len(t.ends))
+	stats := NewDeviceDeploymentStats()
+	for i := range buckets {
+		bucketStats := NewDeviceDeploymentStats()
+		for status, n := range stats {
+			bucketStats[status] = n
+		}
+		for status, n := range t.changes[i] {
+			bucketStats[status] += n
+		}
+		stats = bucketStats
+
+		transitions := NewDeviceDeploymentStats()
+		for status, n := range t.transitions[i] {
+			transitions[status] = n
+		}
+		buckets[i] = StatsTimelineBucket{
+			Time:        t.ends[i],
+			Stats:       bucketStats,
+			Transitions: transitions,
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStatsTimeline(t *testing.T) {
+	start := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	strPtr := func(s string) *string { return &s }
+	timePtr := func(t time.Time) *time.Time { return &t }
+	transition := func(from, to string, minutes int) DeviceDeploymentTransition {
+		return DeviceDeploymentTransition{From: from, To: to, Timestamp: at(minutes)}
+	}
+
+	deviceDeployments := []DeviceDeployment{
+		{
+			Created: timePtr(at(0)),
+			Status:  strPtr(DeviceDeploymentStatusSuccess),
+			Transitions: []DeviceDeploymentTransition{
+				transition(DeviceDeploymentStatusPending,
+					DeviceDeploymentStatusDownloading, 5),
+				transition(DeviceDeploymentStatusDownloading,
+					DeviceDeploymentStatusInstalling, 15),
+				transition(DeviceDeploymentStatusInstalling,
+					DeviceDeploymentStatusRebooting, 16),
+				// repeated reports do not count
+				transition(DeviceDeploymentStatusRebooting,
+					DeviceDeploymentStatusRebooting, 17),
+				transition(DeviceDeploymentStatusRebooting,
+					DeviceDeploymentStatusSuccess, 20),
+			},
+		},
+		{
+			Created: timePtr(at(0)),
+			Status:  strPtr(DeviceDeploymentStatusFailure),
+			Transitions: []DeviceDeploymentTransition{
+				transition(DeviceDeploymentStatusPending,
+					DeviceDeploymentStatusDownloading, 12),
+				transition(DeviceDeploymentStatusDownloading,
+					DeviceDeploymentStatusFailure, 25),
+			},
+		},
+		// finished before transitions were recorded
+		{
+			Created:  timePtr(at(0)),
+			Finished: timePtr(at(8)),
+			Status:   strPtr(DeviceDeploymentStatusAlreadyInst),
+		},
+		// added to the deployment later
+		{
+			Created: timePtr(at(22)),
+			Status:  strPtr(DeviceDeploymentStatusPending),
+		},
+	}
+
+	stats := func(counts map[string]int) Stats {
+		s := NewDeviceDeploymentStats()
+		for status, n := range counts {
+			s[status] = n
+		}
+		return s
+	}
+
+	buckets, err := NewStatsTimeline(deviceDeployments, at(0), at(25),
+		10*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, []StatsTimelineBucket{
+		{
+			Time: at(10),
+			Stats: stats(map[string]int{
+				DeviceDeploymentStatusDownloading: 1,
+				DeviceDeploymentStatusPending:     1,
+				DeviceDeploymentStatusAlreadyInst: 1,
+			}),
+			Transitions: stats(map[string]int{
+				DeviceDeploymentStatusDownloading: 1,
+				DeviceDeploymentStatusAlreadyInst: 1,
+			}),
+		},
+		{
+			Time: at(20),
+			Stats: stats(map[string]int{
+				DeviceDeploymentStatusSuccess:     1,
+				DeviceDeploymentStatusDownloading: 1,
+				DeviceDeploymentStatusAlreadyInst: 1,
+			}),
+			Transitions: stats(map[string]int{
+				DeviceDeploymentStatusDownloading: 1,
+				DeviceDeploymentStatusInstalling:  1,
+				DeviceDeploymentStatusRebooting:   1,
+				DeviceDeploymentStatusSuccess:     1,
+			}),
+		},
+		{
+			Time: at(25),
+			Stats: stats(map[string]int{
+				DeviceDeploymentStatusSuccess:     1,
+				DeviceDeploymentStatusFailure:     1,
+				DeviceDeploymentStatusAlreadyInst: 1,
+				DeviceDeploymentStatusPending:     1,
+			}),
+			Transitions: stats(map[string]int{
+				DeviceDeploymentStatusFailure: 1,
+			}),
+		},
+	}, buckets)
+
+	// a deployment created just now still has an interval
+	buckets, err = NewStatsTimeline(nil, at(0), at(0), time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, buckets, 1)
+
+	_, err = NewStatsTimeline(nil, at(0), at(0), 0)
+	assert.Equal(t, ErrInvalidStatsTimelineInterval, err)
+
+	_, err = NewStatsTimeline(nil, at(0), at(MaxStatsTimelineBuckets+1),
+		time.Minute)
+	assert.Equal(t, ErrInvalidStatsTimelineInterval, errors.Cause(err))
+}
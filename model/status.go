@@ -22,12 +22,31 @@ import (
 )
 
 var (
-	ErrBadStatus = errors.New("unknown status value")
+	ErrBadStatus   = errors.New("unknown status value")
+	ErrBadProgress = errors.New("invalid progress")
 )
 
 type StatusReport struct {
 	Status   string
 	SubState *string `json:"substate" valid:"length(0|200)"`
+
+	// Optional progress of the download or installation
+	BytesDownloaded *int64 `json:"bytes_downloaded" valid:"-"`
+	BytesTotal      *int64 `json:"bytes_total" valid:"-"`
+	Progress        *int   `json:"progress" valid:"-"`
+}
+
+// DeviceDeploymentProgress returns the progress carried by the report, or nil
+// if the device did not report any.
+func (s *StatusReport) DeviceDeploymentProgress() *DeviceDeploymentProgress {
+	if s.BytesDownloaded == nil && s.BytesTotal == nil && s.Progress == nil {
+		return nil
+	}
+	return &DeviceDeploymentProgress{
+		BytesDownloaded: s.BytesDownloaded,
+		BytesTotal:      s.BytesTotal,
+		Percent:         s.Progress,
+	}
 }
 
 func containsString(what string, in []string) bool {
@@ -67,9 +86,19 @@ func (s *StatusReport) UnmarshalJSON(raw []byte) error {
 		return err
 	}
 
+	report := StatusReport(temp)
+	if progress := report.DeviceDeploymentProgress(); progress != nil {
+		if !IsDeviceDeploymentStatusWithProgress(temp.Status) {
+			return errors.Wrapf(ErrBadProgress,
+				"progress reported in status %s", temp.Status)
+		}
+		if err := progress.Validate(); err != nil {
+			return err
+		}
+	}
+
 	// all good
-	s.Status = temp.Status
-	s.SubState = temp.SubState
+	*s = report
 
 	return nil
 }
@@ -37,6 +37,74 @@ func TestStatusUnmarshal(t *testing.T) {
 		report)
 }
 
+func TestStatusUnmarshalProgress(t *testing.T) {
+	bytesDownloaded, bytesTotal, progress := int64(10), int64(100), 20
+
+	testCases := map[string]struct {
+		input string
+
+		report   StatusReport
+		progress *DeviceDeploymentProgress
+		err      string
+	}{
+		"ok, no progress": {
+			input:  `{"status": "downloading"}`,
+			report: StatusReport{Status: DeviceDeploymentStatusDownloading},
+		},
+		"ok, downloading": {
+			input: `{"status": "downloading", "bytes_downloaded": 10, "bytes_total": 100}`,
+			report: StatusReport{
+				Status:          DeviceDeploymentStatusDownloading,
+				BytesDownloaded: &bytesDownloaded,
+				BytesTotal:      &bytesTotal,
+			},
+			progress: &DeviceDeploymentProgress{
+				BytesDownloaded: &bytesDownloaded,
+				BytesTotal:      &bytesTotal,
+			},
+		},
+		"ok, installing": {
+			input: `{"status": "installing", "progress": 20}`,
+			report: StatusReport{
+				Status:   DeviceDeploymentStatusInstalling,
+				Progress: &progress,
+			},
+			progress: &DeviceDeploymentProgress{Percent: &progress},
+		},
+		"error, progress in final status": {
+			input: `{"status": "success", "progress": 100}`,
+			err:   "progress reported in status success: invalid progress",
+		},
+		"error, progress out of range": {
+			input: `{"status": "installing", "progress": 101}`,
+			err:   "progress out of range 0-100: invalid progress",
+		},
+		"error, negative bytes": {
+			input: `{"status": "downloading", "bytes_downloaded": -1}`,
+			err:   "negative bytes_downloaded: invalid progress",
+		},
+		"error, more bytes than total": {
+			input: `{"status": "downloading", "bytes_downloaded": 101, "bytes_total": 100}`,
+			err:   "bytes_downloaded greater than bytes_total: invalid progress",
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			var report StatusReport
+			err := json.Unmarshal([]byte(tc.input), &report)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.report, report)
+			assert.Equal(t, tc.progress, report.DeviceDeploymentProgress())
+		})
+	}
+}
+
 func TestContainsString(t *testing.T) {
 	assert.True(t, containsString("foo", []string{"bar", "foo", "baz"}))
 	assert.False(t, containsString("foo", []string{"bar", "baz"}))
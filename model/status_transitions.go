@@ -0,0 +1,92 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+)
+
+// deviceDeploymentStatusTransitions lists the statuses each status of device
+// deployments may change to. Devices go through downloading, installing and
+// rebooting in order, but may skip reporting any of them; the server may find
+// the artifact already installed or missing whenever the device asks for its
+// deployment. Finished statuses never change.
+var deviceDeploymentStatusTransitions = map[string][]string{
+	DeviceDeploymentStatusPending: {
+		DeviceDeploymentStatusDownloading,
+		DeviceDeploymentStatusInstalling,
+		DeviceDeploymentStatusRebooting,
+		DeviceDeploymentStatusSuccess,
+		DeviceDeploymentStatusFailure,
+		DeviceDeploymentStatusNoArtifact,
+		DeviceDeploymentStatusAlreadyInst,
+		DeviceDeploymentStatusAborted,
+		DeviceDeploymentStatusDecommissioned,
+	},
+	DeviceDeploymentStatusDownloading: {
+		DeviceDeploymentStatusDownloading,
+		DeviceDeploymentStatusInstalling,
+		DeviceDeploymentStatusRebooting,
+		DeviceDeploymentStatusSuccess,
+		DeviceDeploymentStatusFailure,
+		DeviceDeploymentStatusNoArtifact,
+		DeviceDeploymentStatusAlreadyInst,
+		DeviceDeploymentStatusAborted,
+		DeviceDeploymentStatusDecommissioned,
+	},
+	DeviceDeploymentStatusInstalling: {
+		DeviceDeploymentStatusInstalling,
+		DeviceDeploymentStatusRebooting,
+		DeviceDeploymentStatusSuccess,
+		DeviceDeploymentStatusFailure,
+		DeviceDeploymentStatusNoArtifact,
+		DeviceDeploymentStatusAlreadyInst,
+		DeviceDeploymentStatusAborted,
+		DeviceDeploymentStatusDecommissioned,
+	},
+	DeviceDeploymentStatusRebooting: {
+		DeviceDeploymentStatusRebooting,
+		DeviceDeploymentStatusSuccess,
+		DeviceDeploymentStatusFailure,
+		DeviceDeploymentStatusNoArtifact,
+		DeviceDeploymentStatusAlreadyInst,
+		DeviceDeploymentStatusAborted,
+		DeviceDeploymentStatusDecommissioned,
+	},
+}
+
+// CheckDeviceDeploymentStatusTransition returns ErrInvalidStatusTransition
+// if a device deployment must not change from one status to the other.
+func CheckDeviceDeploymentStatusTransition(from, to string) error {
+	if !containsString(to, deviceDeploymentStatusTransitions[from]) {
+		return errors.Wrapf(ErrInvalidStatusTransition, "%s to %s", from, to)
+	}
+	return nil
+}
+
+// IsDeviceDeploymentStatusWithArtifact checks if devices report the status
+// only after getting the artifact of the deployment.
+func IsDeviceDeploymentStatusWithArtifact(status string) bool {
+	return containsString(status, []string{
+		DeviceDeploymentStatusDownloading,
+		DeviceDeploymentStatusInstalling,
+		DeviceDeploymentStatusRebooting,
+		DeviceDeploymentStatusSuccess,
+	})
+}
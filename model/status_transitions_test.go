@@ -0,0 +1,64 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDeviceDeploymentStatusTransition(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		valid    bool
+	}{
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusDownloading, true},
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusAlreadyInst, true},
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusNoArtifact, true},
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusFailure, true},
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusInstalling, true},
+		{DeviceDeploymentStatusPending, DeviceDeploymentStatusSuccess, true},
+		{DeviceDeploymentStatusDownloading, DeviceDeploymentStatusDownloading, true},
+		{DeviceDeploymentStatusDownloading, DeviceDeploymentStatusInstalling, true},
+		{DeviceDeploymentStatusDownloading, DeviceDeploymentStatusRebooting, true},
+		{DeviceDeploymentStatusDownloading, DeviceDeploymentStatusSuccess, true},
+		{DeviceDeploymentStatusDownloading, DeviceDeploymentStatusPending, false},
+		{DeviceDeploymentStatusInstalling, DeviceDeploymentStatusRebooting, true},
+		{DeviceDeploymentStatusInstalling, DeviceDeploymentStatusSuccess, true},
+		{DeviceDeploymentStatusInstalling, DeviceDeploymentStatusDownloading, false},
+		{DeviceDeploymentStatusRebooting, DeviceDeploymentStatusSuccess, true},
+		{DeviceDeploymentStatusRebooting, DeviceDeploymentStatusFailure, true},
+		{DeviceDeploymentStatusRebooting, DeviceDeploymentStatusInstalling, false},
+		{DeviceDeploymentStatusSuccess, DeviceDeploymentStatusDownloading, false},
+		{DeviceDeploymentStatusSuccess, DeviceDeploymentStatusFailure, false},
+		{DeviceDeploymentStatusFailure, DeviceDeploymentStatusSuccess, false},
+		{DeviceDeploymentStatusAborted, DeviceDeploymentStatusInstalling, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.from+" to "+tc.to, func(t *testing.T) {
+			err := CheckDeviceDeploymentStatusTransition(tc.from, tc.to)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err,
+					tc.from+" to "+tc.to+": invalid status transition")
+				assert.Equal(t, ErrInvalidStatusTransition, errors.Cause(err))
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+const (
+	TenantDeprovisioningPending    = "pending"
+	TenantDeprovisioningInProgress = "in_progress"
+	TenantDeprovisioningFinished   = "finished"
+)
+
+// TenantDeprovisioning describes the progress of the removal of the tenant's
+// data. Kept after the tenant database is dropped.
+type TenantDeprovisioning struct {
+	TenantID string `json:"tenant_id" bson:"_id"`
+	Status   string `json:"status" bson:"status"`
+
+	// Number of file storage objects removed so far
+	ObjectsDeleted int `json:"objects_deleted" bson:"objects_deleted"`
+
+	Started  time.Time  `json:"started" bson:"started"`
+	Updated  time.Time  `json:"updated" bson:"updated"`
+	Finished *time.Time `json:"finished,omitempty" bson:"finished,omitempty"`
+}
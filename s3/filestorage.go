@@ -50,7 +50,11 @@ var (
 type FileStorage interface {
 	Delete(ctx context.Context, objectId string) error
 	Exists(ctx context.Context, objectId string) (bool, error)
+	ListObjects(ctx context.Context, prefix, after string, limit int) ([]string, error)
 	LastModified(ctx context.Context, objectId string) (time.Time, error)
+	Size(ctx context.Context, objectId string) (int64, error)
+	GetObject(ctx context.Context, objectId string) (io.ReadCloser, error)
+	HealthCheck(ctx context.Context) error
 	PutRequest(ctx context.Context, objectId string,
 		duration time.Duration) (*model.Link, error)
 	GetRequest(ctx context.Context, objectId string,
@@ -196,6 +200,38 @@ func (s *SimpleStorageService) Exists(ctx context.Context, objectID string) (boo
 	return false, nil
 }
 
+// ListObjects returns up to limit IDs of the objects starting with prefix,
+// in lexicographical order, following the object ID after (if set).
+func (s *SimpleStorageService) ListObjects(ctx context.Context,
+	prefix, after string, limit int) ([]string, error) {
+
+	tenantPrefix := getArtifactByTenant(ctx, "")
+
+	params := &s3.ListObjectsInput{
+		// Required
+		Bucket: aws.String(s.bucket),
+
+		// Optional
+		MaxKeys: aws.Int64(int64(limit)),
+		Prefix:  aws.String(tenantPrefix + prefix),
+	}
+	if after != "" {
+		params.Marker = aws.String(tenantPrefix + after)
+	}
+
+	resp, err := s.client.ListObjects(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "Listing files")
+	}
+
+	objectIDs := make([]string, 0, len(resp.Contents))
+	for _, o := range resp.Contents {
+		objectIDs = append(objectIDs, strings.TrimPrefix(*o.Key, tenantPrefix))
+	}
+
+	return objectIDs, nil
+}
+
 // UploadArtifact uploads given artifact into the file server (AWS S3 or minio)
 // using objectID as a key
 func (s *SimpleStorageService) UploadArtifact(ctx context.Context,
@@ -356,3 +392,74 @@ func (s *SimpleStorageService) LastModified(ctx context.Context, objectID string
 
 	return *resp.Contents[0].LastModified, nil
 }
+
+// Size returns file size in bytes.
+// If object not found return ErrFileStorageFileNotFound
+func (s *SimpleStorageService) Size(ctx context.Context, objectID string) (int64, error) {
+
+	objectID = getArtifactByTenant(ctx, objectID)
+
+	params := &s3.ListObjectsInput{
+		// Required
+		Bucket: aws.String(s.bucket),
+
+		// Optional
+		MaxKeys: aws.Int64(1),
+		Prefix:  aws.String(objectID),
+	}
+
+	resp, err := s.client.ListObjects(params)
+	if err != nil {
+		return 0, errors.Wrap(err, "Searching for file")
+	}
+
+	if len(resp.Contents) == 0 {
+		return 0, ErrFileStorageFileNotFound
+	}
+
+	// Note: Response should contain max 1 object (MaxKetys=1)
+	// Double check if it's exact match as object search matches prefix.
+	if *resp.Contents[0].Key != objectID {
+		return 0, ErrFileStorageFileNotFound
+	}
+
+	return *resp.Contents[0].Size, nil
+}
+
+// GetObject opens the file for reading; the caller is responsible for
+// closing the returned reader.
+// If object not found return ErrFileStorageFileNotFound
+func (s *SimpleStorageService) GetObject(ctx context.Context,
+	objectID string) (io.ReadCloser, error) {
+
+	objectID = getArtifactByTenant(ctx, objectID)
+
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectID),
+	}
+
+	resp, err := s.client.GetObject(params)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok &&
+			awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrFileStorageFileNotFound
+		}
+		return nil, errors.Wrap(err, "Downloading file")
+	}
+
+	return resp.Body, nil
+}
+
+// HealthCheck verifies that the bucket exists and is accessible.
+func (s *SimpleStorageService) HealthCheck(ctx context.Context) error {
+	params := &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	}
+
+	if _, err := s.client.HeadBucket(params); err != nil {
+		return errors.Wrap(err, "Checking bucket")
+	}
+
+	return nil
+}
@@ -60,6 +60,29 @@ func (_m *FileStorage) Exists(ctx context.Context, objectId string) (bool, error
 	return r0, r1
 }
 
+// GetObject provides a mock function with given fields: ctx, objectId
+func (_m *FileStorage) GetObject(ctx context.Context, objectId string) (io.ReadCloser, error) {
+	ret := _m.Called(ctx, objectId)
+
+	var r0 io.ReadCloser
+	if rf, ok := ret.Get(0).(func(context.Context, string) io.ReadCloser); ok {
+		r0 = rf(ctx, objectId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, objectId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetRequest provides a mock function with given fields: ctx, objectId, duration, responseContentType
 func (_m *FileStorage) GetRequest(ctx context.Context, objectId string, duration time.Duration, responseContentType string) (*model.Link, error) {
 	ret := _m.Called(ctx, objectId, duration, responseContentType)
@@ -83,6 +106,20 @@ func (_m *FileStorage) GetRequest(ctx context.Context, objectId string, duration
 	return r0, r1
 }
 
+// HealthCheck provides a mock function with given fields: ctx
+func (_m *FileStorage) HealthCheck(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // LastModified provides a mock function with given fields: ctx, objectId
 func (_m *FileStorage) LastModified(ctx context.Context, objectId string) (time.Time, error) {
 	ret := _m.Called(ctx, objectId)
@@ -104,6 +141,29 @@ func (_m *FileStorage) LastModified(ctx context.Context, objectId string) (time.
 	return r0, r1
 }
 
+// ListObjects provides a mock function with given fields: ctx, prefix, after, limit
+func (_m *FileStorage) ListObjects(ctx context.Context, prefix string, after string, limit int) ([]string, error) {
+	ret := _m.Called(ctx, prefix, after, limit)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) []string); ok {
+		r0 = rf(ctx, prefix, after, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, prefix, after, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // PutRequest provides a mock function with given fields: ctx, objectId, duration
 func (_m *FileStorage) PutRequest(ctx context.Context, objectId string, duration time.Duration) (*model.Link, error) {
 	ret := _m.Called(ctx, objectId, duration)
@@ -127,6 +187,27 @@ func (_m *FileStorage) PutRequest(ctx context.Context, objectId string, duration
 	return r0, r1
 }
 
+// Size provides a mock function with given fields: ctx, objectId
+func (_m *FileStorage) Size(ctx context.Context, objectId string) (int64, error) {
+	ret := _m.Called(ctx, objectId)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, string) int64); ok {
+		r0 = rf(ctx, objectId)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, objectId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UploadArtifact provides a mock function with given fields: ctx, objectId, artifactSize, artifact, contentType
 func (_m *FileStorage) UploadArtifact(ctx context.Context, objectId string, artifactSize int64, artifact io.Reader, contentType string) error {
 	ret := _m.Called(ctx, objectId, artifactSize, artifact, contentType)
@@ -21,14 +21,26 @@ import (
 )
 
 type DataStore interface {
+	//health
+	Ping(ctx context.Context) error
+
 	//releases
 	GetReleases(ctx context.Context, filt *model.ReleaseFilter) ([]model.Release, error)
 
 	//limits
 	GetLimit(ctx context.Context, name string) (*model.Limit, error)
+	UpsertLimit(ctx context.Context, limit model.Limit) error
 
 	//tenants
 	ProvisionTenant(ctx context.Context, tenantId string) error
+	ListTenants(ctx context.Context) ([]string, error)
+	DeprovisionTenant(ctx context.Context, tenantId string) error
+	SaveTenantDeprovisioning(ctx context.Context,
+		deprovisioning model.TenantDeprovisioning) error
+	GetTenantDeprovisioning(ctx context.Context,
+		tenantId string) (*model.TenantDeprovisioning, error)
+	FindUnfinishedTenantDeprovisionings(ctx context.Context) (
+		[]model.TenantDeprovisioning, error)
 
 	//images
 	Exists(ctx context.Context, id string) (bool, error)
@@ -50,8 +62,15 @@ type DataStore interface {
 
 	//device deployment log
 	SaveDeviceDeploymentLog(ctx context.Context, log model.DeploymentLog) error
+	SaveDeviceDeploymentLogObject(ctx context.Context,
+		deviceID, deploymentID, objectID string) error
+	AppendDeviceDeploymentLog(ctx context.Context,
+		deviceID, deploymentID string, chunk model.LogChunk) error
+	SaveDeviceDeploymentLogChunksPrefix(ctx context.Context,
+		deviceID, deploymentID, prefix string) error
 	GetDeviceDeploymentLog(ctx context.Context,
 		deviceID, deploymentID string) (*model.DeploymentLog, error)
+	DeleteDeviceDeploymentLogs(ctx context.Context, deploymentID string) error
 
 	// device deployemnts
 	InsertMany(ctx context.Context,
@@ -62,36 +81,88 @@ type DataStore interface {
 		deviceID string, statuses ...string) (*model.DeviceDeployment, error)
 	FindAllDeploymentsForDeviceIDWithStatuses(ctx context.Context,
 		deviceID string, statuses ...string) ([]model.DeviceDeployment, error)
+	FindDeviceDeploymentHistory(ctx context.Context,
+		query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeployment, error)
 	UpdateDeviceDeploymentStatus(ctx context.Context, deviceID string,
 		deploymentID string, status model.DeviceDeploymentStatus) (string, error)
+	AdmitDeviceDeployment(ctx context.Context, deviceID string,
+		deploymentID string, max int) (bool, error)
+	ReleaseDeviceDeployment(ctx context.Context, deviceID string,
+		deploymentID string) (bool, error)
+	ReleaseDeviceDeploymentsAdmittedBefore(ctx context.Context,
+		deploymentID string, before time.Time) (int, error)
 	UpdateDeviceDeploymentLogAvailability(ctx context.Context,
 		deviceID string, deploymentID string, log bool) error
 	AssignArtifact(ctx context.Context, deviceID string,
-		deploymentID string, artifact *model.SoftwareImage) error
+		deploymentID string, artifact *model.SoftwareImage,
+		deviceType string) error
 	AggregateDeviceDeploymentByStatus(ctx context.Context,
 		id string) (model.Stats, error)
+	AggregateDeviceDeploymentProgress(ctx context.Context,
+		id string) (*model.DeploymentProgress, error)
 	GetDeviceStatusesForDeployment(ctx context.Context,
-		deploymentID string) ([]model.DeviceDeployment, error)
+		query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error)
+	IterateDeviceStatusesForDeployment(ctx context.Context,
+		query model.DeviceDeploymentsQuery,
+		fn func(*model.DeviceDeployment) error) error
+	IterateDeviceDeploymentTransitions(ctx context.Context,
+		deploymentID string, fn func(*model.DeviceDeployment) error) error
+	IterateDeviceDeployments(ctx context.Context,
+		deploymentID string, fn func(*model.DeviceDeployment) error) error
 	HasDeploymentForDevice(ctx context.Context,
 		deploymentID string, deviceID string) (bool, error)
 	GetDeviceDeploymentStatus(ctx context.Context,
 		deploymentID string, deviceID string) (string, error)
+	GetDeviceDeployment(ctx context.Context,
+		deploymentID string, deviceID string) (*model.DeviceDeployment, error)
+	AddDeviceDeploymentTransition(ctx context.Context, deviceID string,
+		deploymentID string, transition model.DeviceDeploymentTransition) error
 	AbortDeviceDeployments(ctx context.Context, deploymentID string) error
 	DecommissionDeviceDeployments(ctx context.Context, deviceId string) error
+	DeleteDeviceDeployments(ctx context.Context, deploymentID string) error
 
 	// deployments
 	InsertDeployment(ctx context.Context, deployment *model.Deployment) error
 	DeleteDeployment(ctx context.Context, id string) error
 	FindDeploymentByID(ctx context.Context, id string) (*model.Deployment, error)
+	FindDeploymentsByIDs(ctx context.Context,
+		ids []string) ([]*model.Deployment, error)
 	FindUnfinishedByID(ctx context.Context,
 		id string) (*model.Deployment, error)
 	UpdateStats(ctx context.Context, id string, state_from, state_to string) error
 	UpdateStatsAndFinishDeployment(ctx context.Context,
 		id string, stats model.Stats) error
+	ReplaceStats(ctx context.Context, id string,
+		old, stats model.Stats, finished *time.Time) error
 	Find(ctx context.Context,
-		query model.Query) ([]*model.Deployment, error)
+		query model.Query) ([]*model.Deployment, int, error)
+	FindFinishedBefore(ctx context.Context,
+		before time.Time, limit int) ([]*model.Deployment, error)
+	ClaimDeploymentArchival(ctx context.Context,
+		id string, until time.Time) (bool, error)
 	Finish(ctx context.Context, id string, when time.Time) error
 	ExistUnfinishedByArtifactId(ctx context.Context, id string) (bool, error)
 	ExistByArtifactId(ctx context.Context, id string) (bool, error)
 	DeviceCountByDeployment(ctx context.Context, id string) (int, error)
+
+	// archived deployments
+	SaveArchivedDeployment(ctx context.Context,
+		archived *model.ArchivedDeployment) error
+	FindArchivedDeployments(ctx context.Context,
+		skip, limit int) ([]model.ArchivedDeployment, error)
+	FindArchivedDeploymentByID(ctx context.Context,
+		id string) (*model.ArchivedDeployment, error)
+	DeleteArchivedDeployment(ctx context.Context, id string) error
+
+	// gateways
+	SetGatewayDevices(ctx context.Context, gatewayID string,
+		devices model.GatewayDevices) error
+	GetGatewayDevices(ctx context.Context,
+		gatewayID string) (*model.GatewayDevices, error)
+
+	// maintenance windows
+	SetMaintenanceWindows(ctx context.Context, id string,
+		windows model.MaintenanceWindows) error
+	GetMaintenanceWindows(ctx context.Context,
+		id string) (*model.MaintenanceWindows, error)
 }
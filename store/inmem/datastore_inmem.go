@@ -0,0 +1,2017 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package inmem provides a thread-safe, in-memory implementation of
+// store.DataStore. It follows the semantics of the MongoDB implementation
+// (including the returned errors), and is meant for tests and development
+// setups without external dependencies.
+package inmem
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/globalsign/mgo/bson"
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+// Errors
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+// database holds the collections of a single tenant
+type database struct {
+	limits      map[string]model.Limit
+	images      []*model.SoftwareImage
+	deployments []*model.Deployment
+	devices     []*model.DeviceDeployment
+	logs        []*model.DeploymentLog
+	archived    []*model.ArchivedDeployment
+
+	gateways map[string]model.GatewayDevices
+
+	maintenanceWindows map[string]model.MaintenanceWindows
+
+	deprovisioning map[string]model.TenantDeprovisioning
+}
+
+func newDatabase() *database {
+	return &database{
+		limits:             map[string]model.Limit{},
+		gateways:           map[string]model.GatewayDevices{},
+		maintenanceWindows: map[string]model.MaintenanceWindows{},
+		deprovisioning:     map[string]model.TenantDeprovisioning{},
+	}
+}
+
+type DataStoreInMem struct {
+	lock sync.RWMutex
+	dbs  map[string]*database
+
+	// guards dbs, which are created on first use also by readers
+	dbsLock sync.Mutex
+}
+
+func NewDataStoreInMem() *DataStoreInMem {
+	return &DataStoreInMem{
+		dbs: map[string]*database{},
+	}
+}
+
+// clone deep copies in into out; stored objects are never shared with the
+// callers, which also makes the fields skipped by bson behave as in MongoDB.
+func clone(in, out interface{}) {
+	raw, err := bson.Marshal(in)
+	if err != nil {
+		panic(errors.Wrap(err, "failed to copy object"))
+	}
+	if err := bson.Unmarshal(raw, out); err != nil {
+		panic(errors.Wrap(err, "failed to copy object"))
+	}
+}
+
+func cloneImage(image *model.SoftwareImage) *model.SoftwareImage {
+	var c model.SoftwareImage
+	clone(image, &c)
+	return &c
+}
+
+func cloneDeployment(deployment *model.Deployment) *model.Deployment {
+	var c model.Deployment
+	clone(deployment, &c)
+	return &c
+}
+
+func cloneDeviceDeployment(dd *model.DeviceDeployment) *model.DeviceDeployment {
+	var c model.DeviceDeployment
+	clone(dd, &c)
+	return &c
+}
+
+// db returns database for the tenant from the context; must be called with
+// the lock held.
+func (db *DataStoreInMem) db(ctx context.Context) *database {
+	return db.dbByName(mstore.DbFromContext(ctx, mongo.DatabaseName))
+}
+
+func (db *DataStoreInMem) dbByName(name string) *database {
+	db.dbsLock.Lock()
+	defer db.dbsLock.Unlock()
+
+	d, ok := db.dbs[name]
+	if !ok {
+		d = newDatabase()
+		db.dbs[name] = d
+	}
+	return d
+}
+
+// health
+
+func (db *DataStoreInMem) Ping(ctx context.Context) error {
+	return nil
+}
+
+// releases
+
+func (db *DataStoreInMem) GetReleases(ctx context.Context,
+	filt *model.ReleaseFilter) ([]model.Release, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	releases := map[string]*model.Release{}
+	for _, image := range db.db(ctx).images {
+		if filt != nil && image.Name != filt.Name {
+			continue
+		}
+
+		r, ok := releases[image.Name]
+		if !ok {
+			r = &model.Release{
+				Name: image.Name,
+			}
+			releases[image.Name] = r
+		}
+		r.Artifacts = append(r.Artifacts, *cloneImage(image))
+	}
+
+	results := []model.Release{}
+	for _, r := range releases {
+		results = append(results, *r)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name > results[j].Name
+	})
+
+	return results, nil
+}
+
+// limits
+
+func (db *DataStoreInMem) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	limit, ok := db.db(ctx).limits[name]
+	if !ok {
+		return nil, mongo.ErrLimitNotFound
+	}
+
+	return &limit, nil
+}
+
+func (db *DataStoreInMem) UpsertLimit(ctx context.Context, limit model.Limit) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.db(ctx).limits[limit.Name] = limit
+
+	return nil
+}
+
+// tenants
+
+func (db *DataStoreInMem) ProvisionTenant(ctx context.Context, tenantId string) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.dbByName(mstore.DbNameForTenant(tenantId, mongo.DbName))
+
+	return nil
+}
+
+func (db *DataStoreInMem) ListTenants(ctx context.Context) ([]string, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	db.dbsLock.Lock()
+	defer db.dbsLock.Unlock()
+
+	tenants := []string{}
+	for name := range db.dbs {
+		if mstore.IsTenantDb(mongo.DbName)(name) {
+			tenants = append(tenants, mstore.TenantFromDbName(name, mongo.DbName))
+		}
+	}
+	sort.Strings(tenants)
+
+	return tenants, nil
+}
+
+func (db *DataStoreInMem) DeprovisionTenant(ctx context.Context, tenantId string) error {
+	if govalidator.IsNull(tenantId) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	delete(db.dbs, mstore.DbNameForTenant(tenantId, mongo.DbName))
+
+	return nil
+}
+
+func (db *DataStoreInMem) SaveTenantDeprovisioning(ctx context.Context,
+	deprovisioning model.TenantDeprovisioning) error {
+
+	if govalidator.IsNull(deprovisioning.TenantID) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.dbByName(mongo.DatabaseName).
+		deprovisioning[deprovisioning.TenantID] = deprovisioning
+
+	return nil
+}
+
+func (db *DataStoreInMem) GetTenantDeprovisioning(ctx context.Context,
+	tenantId string) (*model.TenantDeprovisioning, error) {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	deprovisioning, ok := db.dbByName(mongo.DatabaseName).deprovisioning[tenantId]
+	if !ok {
+		return nil, nil
+	}
+
+	return &deprovisioning, nil
+}
+
+func (db *DataStoreInMem) FindUnfinishedTenantDeprovisionings(
+	ctx context.Context) ([]model.TenantDeprovisioning, error) {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	deprovisionings := []model.TenantDeprovisioning{}
+	for _, deprovisioning := range db.dbByName(mongo.DatabaseName).deprovisioning {
+		if deprovisioning.Status != model.TenantDeprovisioningFinished {
+			deprovisionings = append(deprovisionings, deprovisioning)
+		}
+	}
+	sort.Slice(deprovisionings, func(i, j int) bool {
+		return deprovisionings[i].Started.Before(deprovisionings[j].Started)
+	})
+
+	return deprovisionings, nil
+}
+
+//images
+
+func (d *database) findImage(id string) (int, *model.SoftwareImage) {
+	for i, image := range d.images {
+		if image.Id == id {
+			return i, image
+		}
+	}
+	return -1, nil
+}
+
+func (db *DataStoreInMem) Exists(ctx context.Context, id string) (bool, error) {
+	if govalidator.IsNull(id) {
+		return false, mongo.ErrSoftwareImagesStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, image := db.db(ctx).findImage(id)
+
+	return image != nil, nil
+}
+
+func (db *DataStoreInMem) Update(ctx context.Context,
+	image *model.SoftwareImage) (bool, error) {
+
+	if err := image.Validate(); err != nil {
+		return false, err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	image.SetModified(time.Now())
+
+	d := db.db(ctx)
+	i, found := d.findImage(image.Id)
+	if found == nil {
+		return false, nil
+	}
+	d.images[i] = cloneImage(image)
+
+	return true, nil
+}
+
+func (db *DataStoreInMem) InsertImage(ctx context.Context, image *model.SoftwareImage) error {
+	if image == nil {
+		return mongo.ErrSoftwareImagesStorageInvalidImage
+	}
+
+	if err := image.Validate(); err != nil {
+		return err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if _, found := d.findImage(image.Id); found != nil {
+		return ErrDuplicateKey
+	}
+	// same as the unique index on artifact name and device type
+	if !d.isArtifactUnique(image.Name, image.DeviceTypesCompatible) {
+		return ErrDuplicateKey
+	}
+
+	d.images = append(d.images, cloneImage(image))
+
+	return nil
+}
+
+func (db *DataStoreInMem) FindImageByID(ctx context.Context,
+	id string) (*model.SoftwareImage, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, image := db.db(ctx).findImage(id)
+	if image == nil {
+		return nil, nil
+	}
+
+	return cloneImage(image), nil
+}
+
+func (d *database) isArtifactUnique(artifactName string,
+	deviceTypesCompatible []string) bool {
+
+	for _, image := range d.images {
+		if image.Name != artifactName {
+			continue
+		}
+		for _, dt := range deviceTypesCompatible {
+			if containsString(image.DeviceTypesCompatible, dt) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (db *DataStoreInMem) IsArtifactUnique(ctx context.Context,
+	artifactName string, deviceTypesCompatible []string) (bool, error) {
+
+	if govalidator.IsNull(artifactName) {
+		return false, mongo.ErrSoftwareImagesStorageInvalidArtifactName
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db(ctx).isArtifactUnique(artifactName, deviceTypesCompatible), nil
+}
+
+func (db *DataStoreInMem) DeleteImage(ctx context.Context, id string) error {
+	if govalidator.IsNull(id) {
+		return mongo.ErrSoftwareImagesStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if i, found := d.findImage(id); found != nil {
+		d.images = append(d.images[:i], d.images[i+1:]...)
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) FindAll(ctx context.Context) ([]*model.SoftwareImage, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var images []*model.SoftwareImage
+	for _, image := range db.db(ctx).images {
+		images = append(images, cloneImage(image))
+	}
+
+	return images, nil
+}
+
+func (db *DataStoreInMem) ImagesByName(ctx context.Context,
+	name string) ([]*model.SoftwareImage, error) {
+
+	if govalidator.IsNull(name) {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidName
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var images []*model.SoftwareImage
+	for _, image := range db.db(ctx).images {
+		if image.Name == name {
+			images = append(images, cloneImage(image))
+		}
+	}
+
+	return images, nil
+}
+
+func (db *DataStoreInMem) ImageByIdsAndDeviceType(ctx context.Context,
+	ids []string, deviceType string) (*model.SoftwareImage, error) {
+
+	if govalidator.IsNull(deviceType) {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidDeviceType
+	}
+
+	if len(ids) == 0 {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for _, image := range db.db(ctx).images {
+		if containsString(ids, image.Id) &&
+			containsString(image.DeviceTypesCompatible, deviceType) {
+			return cloneImage(image), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (db *DataStoreInMem) ImageByNameAndDeviceType(ctx context.Context,
+	name, deviceType string) (*model.SoftwareImage, error) {
+
+	if govalidator.IsNull(name) {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidName
+	}
+
+	if govalidator.IsNull(deviceType) {
+		return nil, mongo.ErrSoftwareImagesStorageInvalidDeviceType
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for _, image := range db.db(ctx).images {
+		if image.Name == name &&
+			containsString(image.DeviceTypesCompatible, deviceType) {
+			return cloneImage(image), nil
+		}
+	}
+
+	return nil, nil
+}
+
+//device deployment log
+
+func (d *database) findLog(deviceID, deploymentID string) *model.DeploymentLog {
+	for _, l := range d.logs {
+		if l.DeviceID == deviceID && l.DeploymentID == deploymentID {
+			return l
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreInMem) SaveDeviceDeploymentLog(ctx context.Context,
+	log model.DeploymentLog) error {
+
+	if err := log.Validate(); err != nil {
+		return err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	messages := make([]model.LogMessage, len(log.Messages))
+	copy(messages, log.Messages)
+
+	d := db.db(ctx)
+	if l := d.findLog(log.DeviceID, log.DeploymentID); l != nil {
+		l.Messages = messages
+		l.ObjectID = ""
+		l.Chunks = nil
+		l.ChunksPrefix = ""
+		return nil
+	}
+
+	d.logs = append(d.logs, &model.DeploymentLog{
+		DeviceID:     log.DeviceID,
+		DeploymentID: log.DeploymentID,
+		Messages:     messages,
+	})
+
+	return nil
+}
+
+func (db *DataStoreInMem) SaveDeviceDeploymentLogObject(ctx context.Context,
+	deviceID, deploymentID, objectID string) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) ||
+		govalidator.IsNull(objectID) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if l := d.findLog(deviceID, deploymentID); l != nil {
+		l.Messages = nil
+		l.ObjectID = objectID
+		l.Chunks = nil
+		l.ChunksPrefix = ""
+		return nil
+	}
+
+	d.logs = append(d.logs, &model.DeploymentLog{
+		DeviceID:     deviceID,
+		DeploymentID: deploymentID,
+		ObjectID:     objectID,
+	})
+
+	return nil
+}
+
+func (db *DataStoreInMem) SaveDeviceDeploymentLogChunksPrefix(ctx context.Context,
+	deviceID, deploymentID, prefix string) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) ||
+		govalidator.IsNull(prefix) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if l := d.findLog(deviceID, deploymentID); l != nil {
+		l.ChunksPrefix = prefix
+		return nil
+	}
+
+	d.logs = append(d.logs, &model.DeploymentLog{
+		DeviceID:     deviceID,
+		DeploymentID: deploymentID,
+		ChunksPrefix: prefix,
+	})
+
+	return nil
+}
+
+func (db *DataStoreInMem) AppendDeviceDeploymentLog(ctx context.Context,
+	deviceID, deploymentID string, chunk model.LogChunk) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidInput
+	}
+	if err := chunk.Validate(); err != nil {
+		return err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	l := d.findLog(deviceID, deploymentID)
+	if l == nil {
+		l = &model.DeploymentLog{
+			DeviceID:     deviceID,
+			DeploymentID: deploymentID,
+		}
+		d.logs = append(d.logs, l)
+	}
+
+	for _, c := range l.Chunks {
+		if c.Sequence == chunk.Sequence {
+			return nil
+		}
+	}
+
+	messages := make([]model.LogMessage, len(chunk.Messages))
+	copy(messages, chunk.Messages)
+	l.Chunks = append(l.Chunks, model.LogChunk{
+		Sequence: chunk.Sequence,
+		Messages: messages,
+	})
+
+	return nil
+}
+
+func (db *DataStoreInMem) GetDeviceDeploymentLog(ctx context.Context,
+	deviceID, deploymentID string) (*model.DeploymentLog, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	l := db.db(ctx).findLog(deviceID, deploymentID)
+	if l == nil {
+		return nil, nil
+	}
+
+	var messages []model.LogMessage
+	if l.Messages != nil {
+		messages = make([]model.LogMessage, len(l.Messages))
+		copy(messages, l.Messages)
+	}
+
+	return &model.DeploymentLog{
+		DeviceID:     l.DeviceID,
+		DeploymentID: l.DeploymentID,
+		Messages:     messages,
+		ObjectID:     l.ObjectID,
+		Chunks:       append([]model.LogChunk(nil), l.Chunks...),
+		ChunksPrefix: l.ChunksPrefix,
+	}, nil
+}
+
+func (db *DataStoreInMem) DeleteDeviceDeploymentLogs(ctx context.Context,
+	deploymentID string) error {
+
+	if govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	logs := d.logs[:0]
+	for _, l := range d.logs {
+		if l.DeploymentID != deploymentID {
+			logs = append(logs, l)
+		}
+	}
+	d.logs = logs
+
+	return nil
+}
+
+// device deployments
+
+func (d *database) findDeviceDeployment(deviceID,
+	deploymentID string) *model.DeviceDeployment {
+
+	for _, dd := range d.devices {
+		if *dd.DeviceId == deviceID && *dd.DeploymentId == deploymentID {
+			return dd
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreInMem) InsertMany(ctx context.Context,
+	deployments ...*model.DeviceDeployment) error {
+
+	if len(deployments) == 0 {
+		return nil
+	}
+
+	for _, deployment := range deployments {
+		if deployment == nil {
+			return mongo.ErrStorageInvalidDeviceDeployment
+		}
+
+		if err := deployment.Validate(); err != nil {
+			return errors.Wrap(err, "Validating device deployment")
+		}
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	for _, deployment := range deployments {
+		for _, dd := range d.devices {
+			if *dd.Id == *deployment.Id {
+				return ErrDuplicateKey
+			}
+		}
+		d.devices = append(d.devices, cloneDeviceDeployment(deployment))
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) ExistAssignedImageWithIDAndStatuses(ctx context.Context,
+	imageID string, statuses ...string) (bool, error) {
+
+	if govalidator.IsNull(imageID) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for _, dd := range db.db(ctx).devices {
+		if dd.Image == nil || dd.Image.Id != imageID {
+			continue
+		}
+		if len(statuses) == 0 || containsString(statuses, *dd.Status) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (db *DataStoreInMem) FindOldestDeploymentForDeviceIDWithStatuses(ctx context.Context,
+	deviceID string, statuses ...string) (*model.DeviceDeployment, error) {
+
+	if govalidator.IsNull(deviceID) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var oldest *model.DeviceDeployment
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeviceId != deviceID || !containsString(statuses, *dd.Status) {
+			continue
+		}
+		if oldest == nil || dd.Created.Before(*oldest.Created) {
+			oldest = dd
+		}
+	}
+
+	if oldest == nil {
+		return nil, nil
+	}
+
+	return cloneDeviceDeployment(oldest), nil
+}
+
+func (db *DataStoreInMem) FindAllDeploymentsForDeviceIDWithStatuses(ctx context.Context,
+	deviceID string, statuses ...string) ([]model.DeviceDeployment, error) {
+
+	if govalidator.IsNull(deviceID) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var deployments []model.DeviceDeployment
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeviceId == deviceID && containsString(statuses, *dd.Status) {
+			deployments = append(deployments, *cloneDeviceDeployment(dd))
+		}
+	}
+
+	return deployments, nil
+}
+
+func (db *DataStoreInMem) FindDeviceDeploymentHistory(ctx context.Context,
+	query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeployment, error) {
+
+	if govalidator.IsNull(query.DeviceID) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	deviceDeployments := []model.DeviceDeployment{}
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeviceId != query.DeviceID ||
+			query.Status != "" && *dd.Status != query.Status ||
+			!inTimeRange(dd.Created, query.CreatedAfter, query.CreatedBefore) {
+			continue
+		}
+		deviceDeployments = append(deviceDeployments, *cloneDeviceDeployment(dd))
+	}
+
+	sort.SliceStable(deviceDeployments, func(i, j int) bool {
+		return deviceDeployments[i].Created.After(*deviceDeployments[j].Created)
+	})
+
+	if query.Skip >= len(deviceDeployments) {
+		return []model.DeviceDeployment{}, nil
+	}
+	deviceDeployments = deviceDeployments[query.Skip:]
+	if query.Limit > 0 && query.Limit < len(deviceDeployments) {
+		deviceDeployments = deviceDeployments[:query.Limit]
+	}
+
+	return deviceDeployments, nil
+}
+
+func (db *DataStoreInMem) UpdateDeviceDeploymentStatus(ctx context.Context,
+	deviceID string, deploymentID string,
+	ddStatus model.DeviceDeploymentStatus) (string, error) {
+
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return "", mongo.ErrStorageInvalidID
+	}
+
+	if ok, _ := govalidator.ValidateStruct(ddStatus); !ok {
+		return "", mongo.ErrStorageInvalidInput
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil ||
+		*dd.Status == model.DeviceDeploymentStatusAborted ||
+		*dd.Status == model.DeviceDeploymentStatusDecommissioned {
+		return "", mongo.ErrStorageNotFound
+	}
+	if ddStatus.PreviousStatus != "" && ddStatus.PreviousStatus != *dd.Status {
+		return "", mongo.ErrStorageNotFound
+	}
+	if !ddStatus.Timestamp.IsZero() && ddStatus.PreviousStatus == "" {
+		return "", mongo.ErrStorageInvalidInput
+	}
+
+	old := *dd.Status
+
+	status := ddStatus.Status
+	dd.Status = &status
+	if ddStatus.FinishTime != nil {
+		finished := *ddStatus.FinishTime
+		dd.Finished = &finished
+	}
+	if ddStatus.SubState != nil {
+		subState := *ddStatus.SubState
+		dd.SubState = &subState
+	}
+	dd.Progress = nil
+	if ddStatus.Progress != nil {
+		var progress model.DeviceDeploymentProgress
+		clone(ddStatus.Progress, &progress)
+		dd.Progress = &progress
+	}
+	if !ddStatus.Timestamp.IsZero() {
+		addTransition(dd, model.DeviceDeploymentTransition{
+			From:      old,
+			To:        status,
+			SubState:  ddStatus.SubState,
+			Timestamp: ddStatus.Timestamp,
+		})
+	}
+
+	return old, nil
+}
+
+func (db *DataStoreInMem) AdmitDeviceDeployment(ctx context.Context,
+	deviceID string, deploymentID string, max int) (bool, error) {
+
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	dd := d.findDeviceDeployment(deviceID, deploymentID)
+	_, deployment := d.findDeployment(deploymentID)
+	if dd == nil || dd.Admitted || deployment == nil ||
+		deployment.AdmittedDevices >= max {
+		return false, nil
+	}
+
+	now := time.Now()
+	dd.Admitted = true
+	dd.AdmittedAt = &now
+	deployment.AdmittedDevices++
+
+	return true, nil
+}
+
+func (db *DataStoreInMem) ReleaseDeviceDeployment(ctx context.Context,
+	deviceID string, deploymentID string) (bool, error) {
+
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	dd := d.findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil || !dd.Admitted {
+		return false, nil
+	}
+
+	dd.Admitted = false
+	dd.AdmittedAt = nil
+	if _, deployment := d.findDeployment(deploymentID); deployment != nil {
+		deployment.AdmittedDevices--
+	}
+
+	return true, nil
+}
+
+func (db *DataStoreInMem) ReleaseDeviceDeploymentsAdmittedBefore(
+	ctx context.Context, deploymentID string, before time.Time) (int, error) {
+
+	if govalidator.IsNull(deploymentID) {
+		return 0, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	_, deployment := d.findDeployment(deploymentID)
+
+	released := 0
+	for _, dd := range d.devices {
+		if *dd.DeploymentId != deploymentID || !dd.Admitted ||
+			(dd.AdmittedAt != nil && !dd.AdmittedAt.Before(before)) {
+			continue
+		}
+		dd.Admitted = false
+		dd.AdmittedAt = nil
+		if deployment != nil {
+			deployment.AdmittedDevices--
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+func (db *DataStoreInMem) UpdateDeviceDeploymentLogAvailability(ctx context.Context,
+	deviceID string, deploymentID string, log bool) error {
+
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil {
+		return mongo.ErrStorageNotFound
+	}
+
+	dd.IsLogAvailable = log
+
+	return nil
+}
+
+func (db *DataStoreInMem) AssignArtifact(ctx context.Context,
+	deviceID string, deploymentID string, artifact *model.SoftwareImage,
+	deviceType string) error {
+
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil {
+		return mongo.ErrStorageNotFound
+	}
+
+	dd.Image = nil
+	if artifact != nil {
+		dd.Image = cloneImage(artifact)
+	}
+	dd.DeviceType = &deviceType
+
+	return nil
+}
+
+func (d *database) aggregateDeviceDeploymentByStatus(id string) model.Stats {
+	stats := model.NewDeviceDeploymentStats()
+	for _, dd := range d.devices {
+		if *dd.DeploymentId == id {
+			stats[*dd.Status]++
+		}
+	}
+	return stats
+}
+
+func (db *DataStoreInMem) AggregateDeviceDeploymentByStatus(ctx context.Context,
+	id string) (model.Stats, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db(ctx).aggregateDeviceDeploymentByStatus(id), nil
+}
+
+func (db *DataStoreInMem) AggregateDeviceDeploymentProgress(ctx context.Context,
+	id string) (*model.DeploymentProgress, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var progress model.DeploymentProgress
+	percents, percentSum := 0, 0
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeploymentId != id || dd.Progress == nil ||
+			!model.IsDeviceDeploymentStatusWithProgress(*dd.Status) {
+			continue
+		}
+		progress.Devices++
+		if dd.Progress.BytesDownloaded != nil {
+			progress.BytesDownloaded += *dd.Progress.BytesDownloaded
+		}
+		if dd.Progress.BytesTotal != nil {
+			progress.BytesTotal += *dd.Progress.BytesTotal
+		}
+		if dd.Progress.Percent != nil {
+			percents++
+			percentSum += *dd.Progress.Percent
+		}
+	}
+	if progress.Devices == 0 {
+		return nil, nil
+	}
+	if percents > 0 {
+		percent := float64(percentSum) / float64(percents)
+		progress.Percent = &percent
+	}
+
+	return &progress, nil
+}
+
+func (db *DataStoreInMem) GetDeviceStatusesForDeployment(ctx context.Context,
+	query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var statuses []model.DeviceDeployment
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeploymentId != query.DeploymentID {
+			continue
+		}
+		if query.Status != "" && *dd.Status != query.Status {
+			continue
+		}
+		if query.DeviceType != "" &&
+			(dd.DeviceType == nil || *dd.DeviceType != query.DeviceType) {
+			continue
+		}
+		if query.IsLogAvailable != nil &&
+			dd.IsLogAvailable != *query.IsLogAvailable {
+			continue
+		}
+		statuses = append(statuses, *cloneDeviceDeployment(dd))
+	}
+
+	// missing times sort first, as in mongo
+	timeOf := func(dd *model.DeviceDeployment) time.Time {
+		t := dd.Created
+		if query.SortBy == model.DeviceDeploymentsSortFinished {
+			t = dd.Finished
+		}
+		if t == nil {
+			return time.Time{}
+		}
+		return *t
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		a, b := &statuses[i], &statuses[j]
+		if query.SortDescending {
+			a, b = b, a
+		}
+		ta, tb := timeOf(a), timeOf(b)
+		if !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		return *a.DeviceId < *b.DeviceId
+	})
+
+	total := len(statuses)
+	if query.Skip >= total {
+		return []model.DeviceDeployment{}, total, nil
+	}
+	statuses = statuses[query.Skip:]
+	if query.Limit > 0 && query.Limit < len(statuses) {
+		statuses = statuses[:query.Limit]
+	}
+
+	return statuses, total, nil
+}
+
+func (db *DataStoreInMem) IterateDeviceStatusesForDeployment(ctx context.Context,
+	query model.DeviceDeploymentsQuery,
+	fn func(*model.DeviceDeployment) error) error {
+
+	query.Skip, query.Limit = 0, 0
+	statuses, _, err := db.GetDeviceStatusesForDeployment(ctx, query)
+	if err != nil {
+		return err
+	}
+	for i := range statuses {
+		statuses[i].Transitions = nil
+		if err := fn(&statuses[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreInMem) IterateDeviceDeployments(ctx context.Context,
+	deploymentID string, fn func(*model.DeviceDeployment) error) error {
+
+	return db.IterateDeviceDeploymentTransitions(ctx, deploymentID, fn)
+}
+
+func (db *DataStoreInMem) IterateDeviceDeploymentTransitions(ctx context.Context,
+	deploymentID string, fn func(*model.DeviceDeployment) error) error {
+
+	statuses, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: deploymentID})
+	if err != nil {
+		return err
+	}
+	for i := range statuses {
+		if err := fn(&statuses[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreInMem) HasDeploymentForDevice(ctx context.Context,
+	deploymentID string, deviceID string) (bool, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.db(ctx).findDeviceDeployment(deviceID, deploymentID) != nil, nil
+}
+
+func (db *DataStoreInMem) GetDeviceDeploymentStatus(ctx context.Context,
+	deploymentID string, deviceID string) (string, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil {
+		return "", nil
+	}
+
+	return *dd.Status, nil
+}
+
+func (db *DataStoreInMem) GetDeviceDeployment(ctx context.Context,
+	deploymentID string, deviceID string) (*model.DeviceDeployment, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil {
+		return nil, nil
+	}
+
+	return cloneDeviceDeployment(dd), nil
+}
+
+func (db *DataStoreInMem) AddDeviceDeploymentTransition(ctx context.Context,
+	deviceID string, deploymentID string,
+	transition model.DeviceDeploymentTransition) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	dd := db.db(ctx).findDeviceDeployment(deviceID, deploymentID)
+	if dd == nil {
+		return mongo.ErrStorageNotFound
+	}
+	addTransition(dd, transition)
+
+	return nil
+}
+
+func addTransition(dd *model.DeviceDeployment,
+	transition model.DeviceDeploymentTransition) {
+
+	dd.Transitions = append(dd.Transitions, transition)
+	if over := len(dd.Transitions) - model.MaxDeviceDeploymentTransitions; over > 0 {
+		dd.Transitions = dd.Transitions[over:]
+	}
+}
+
+func (db *DataStoreInMem) AbortDeviceDeployments(ctx context.Context,
+	deploymentId string) error {
+
+	if govalidator.IsNull(deploymentId) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeploymentId == deploymentId &&
+			containsString(model.ActiveDeploymentStatuses(), *dd.Status) {
+			status := model.DeviceDeploymentStatusAborted
+			addTransition(dd, model.DeviceDeploymentTransition{
+				From:      *dd.Status,
+				To:        status,
+				Timestamp: time.Now(),
+			})
+			dd.Status = &status
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) DecommissionDeviceDeployments(ctx context.Context,
+	deviceId string) error {
+
+	if govalidator.IsNull(deviceId) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeviceId == deviceId &&
+			containsString(model.ActiveDeploymentStatuses(), *dd.Status) {
+			status := model.DeviceDeploymentStatusDecommissioned
+			addTransition(dd, model.DeviceDeploymentTransition{
+				From:      *dd.Status,
+				To:        status,
+				Timestamp: time.Now(),
+			})
+			dd.Status = &status
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) DeleteDeviceDeployments(ctx context.Context,
+	deploymentID string) error {
+
+	if govalidator.IsNull(deploymentID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	devices := d.devices[:0]
+	for _, dd := range d.devices {
+		if *dd.DeploymentId != deploymentID {
+			devices = append(devices, dd)
+		}
+	}
+	d.devices = devices
+
+	return nil
+}
+
+// deployments
+
+func (d *database) findDeployment(id string) (int, *model.Deployment) {
+	for i, deployment := range d.deployments {
+		if *deployment.Id == id {
+			return i, deployment
+		}
+	}
+	return -1, nil
+}
+
+func (db *DataStoreInMem) InsertDeployment(ctx context.Context,
+	deployment *model.Deployment) error {
+
+	if deployment == nil {
+		return mongo.ErrDeploymentStorageInvalidDeployment
+	}
+
+	if err := deployment.Validate(); err != nil {
+		return err
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if _, found := d.findDeployment(*deployment.Id); found != nil {
+		return ErrDuplicateKey
+	}
+
+	d.deployments = append(d.deployments, cloneDeployment(deployment))
+
+	return nil
+}
+
+func (db *DataStoreInMem) DeleteDeployment(ctx context.Context, id string) error {
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if i, found := d.findDeployment(id); found != nil {
+		d.deployments = append(d.deployments[:i], d.deployments[i+1:]...)
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) FindDeploymentByID(ctx context.Context,
+	id string) (*model.Deployment, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil {
+		return nil, nil
+	}
+
+	return cloneDeployment(deployment), nil
+}
+
+func (db *DataStoreInMem) FindDeploymentsByIDs(ctx context.Context,
+	ids []string) ([]*model.Deployment, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	deployments := []*model.Deployment{}
+	for _, deployment := range db.db(ctx).deployments {
+		if containsString(ids, *deployment.Id) {
+			deployments = append(deployments, cloneDeployment(deployment))
+		}
+	}
+
+	return deployments, nil
+}
+
+func (db *DataStoreInMem) FindUnfinishedByID(ctx context.Context,
+	id string) (*model.Deployment, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil || deployment.Finished != nil {
+		return nil, nil
+	}
+
+	return cloneDeployment(deployment), nil
+}
+
+func (db *DataStoreInMem) DeviceCountByDeployment(ctx context.Context,
+	id string) (int, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	count := 0
+	for _, dd := range db.db(ctx).devices {
+		if *dd.DeploymentId == id {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (db *DataStoreInMem) UpdateStatsAndFinishDeployment(ctx context.Context,
+	id string, stats model.Stats) error {
+
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil {
+		return mongo.ErrStorageInvalidID
+	}
+
+	deployment.Stats = model.Stats{}
+	for k, v := range stats {
+		deployment.Stats[k] = v
+	}
+
+	if deployment.IsFinished() {
+		now := time.Now()
+		deployment.Finished = &now
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) ReplaceStats(ctx context.Context, id string,
+	old, stats model.Stats, finished *time.Time) error {
+
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil {
+		return mongo.ErrStorageInvalidID
+	}
+
+	if !model.Stats(deployment.Stats).Equal(old) {
+		return mongo.ErrStorageConflict
+	}
+
+	deployment.Stats = model.Stats{}
+	for k, v := range stats {
+		deployment.Stats[k] = v
+	}
+
+	deployment.Finished = nil
+	if finished != nil {
+		f := *finished
+		deployment.Finished = &f
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) UpdateStats(ctx context.Context, id string,
+	state_from, state_to string) error {
+
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	if govalidator.IsNull(state_from) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	if govalidator.IsNull(state_to) {
+		return mongo.ErrStorageInvalidInput
+	}
+
+	if state_from == state_to {
+		return nil
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil {
+		return mongo.ErrStorageInvalidID
+	}
+
+	if deployment.Stats == nil {
+		deployment.Stats = model.Stats{}
+	}
+	deployment.Stats[state_from]--
+	deployment.Stats[state_to]++
+
+	if containsString(model.ActiveDeploymentStatuses(), state_from) &&
+		!containsString(model.ActiveDeploymentStatuses(), state_to) &&
+		deployment.IsFinished() {
+		now := time.Now()
+		deployment.Finished = &now
+	}
+
+	return nil
+}
+
+// matchesText mimics MongoDB text search on deployment name and artifact
+// name: the deployment matches if any of the search terms is equal (case
+// insensitive) to any of the words in these fields.
+func matchesText(deployment *model.Deployment, text string) bool {
+	if deployment.DeploymentConstructor == nil {
+		return false
+	}
+
+	words := map[string]bool{}
+	for _, field := range []*string{deployment.Name, deployment.ArtifactName} {
+		if field == nil {
+			continue
+		}
+		for _, w := range strings.Fields(strings.ToLower(*field)) {
+			words[w] = true
+		}
+	}
+
+	for _, term := range strings.Fields(strings.ToLower(text)) {
+		if words[strings.Trim(term, `"`)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesStatus mirrors the status queries of the MongoDB implementation.
+func matchesStatus(deployment *model.Deployment, status model.StatusQuery) bool {
+	stats := deployment.Stats
+
+	switch status {
+	case model.StatusQueryInProgress:
+		return stats[model.DeviceDeploymentStatusDownloading] > 0 ||
+			stats[model.DeviceDeploymentStatusInstalling] > 0 ||
+			stats[model.DeviceDeploymentStatusRebooting] > 0 ||
+			(stats[model.DeviceDeploymentStatusPending] > 0 &&
+				(stats[model.DeviceDeploymentStatusAlreadyInst] > 0 ||
+					stats[model.DeviceDeploymentStatusSuccess] > 0 ||
+					stats[model.DeviceDeploymentStatusFailure] > 0 ||
+					stats[model.DeviceDeploymentStatusNoArtifact] > 0))
+
+	case model.StatusQueryPending:
+		for _, s := range []string{
+			model.DeviceDeploymentStatusDownloading,
+			model.DeviceDeploymentStatusInstalling,
+			model.DeviceDeploymentStatusRebooting,
+			model.DeviceDeploymentStatusSuccess,
+			model.DeviceDeploymentStatusAlreadyInst,
+			model.DeviceDeploymentStatusAborted,
+			model.DeviceDeploymentStatusDecommissioned,
+			model.DeviceDeploymentStatusFailure,
+			model.DeviceDeploymentStatusNoArtifact,
+		} {
+			if stats[s] != 0 {
+				return false
+			}
+		}
+		return stats[model.DeviceDeploymentStatusPending] > 0
+
+	case model.StatusQueryFinished:
+		return deployment.Finished != nil
+
+	case model.StatusQueryAborted:
+		return stats[model.DeviceDeploymentStatusAborted] > 0
+	}
+
+	return true
+}
+
+// inTimeRange checks if the time is within the range; missing times are
+// never within a limited range.
+func inTimeRange(t, after, before *time.Time) bool {
+	if after == nil && before == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	return (after == nil || !t.Before(*after)) &&
+		(before == nil || !t.After(*before))
+}
+
+func (db *DataStoreInMem) Find(ctx context.Context,
+	match model.Query) ([]*model.Deployment, int, error) {
+
+	// timestamps are stored with millisecond precision
+	truncate := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		truncated := t.Truncate(time.Millisecond)
+		return &truncated
+	}
+	match.CreatedAfter = truncate(match.CreatedAfter)
+	match.CreatedBefore = truncate(match.CreatedBefore)
+	match.FinishedAfter = truncate(match.FinishedAfter)
+	match.FinishedBefore = truncate(match.FinishedBefore)
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var found []*model.Deployment
+	for _, deployment := range db.db(ctx).deployments {
+		if match.SearchText != "" && !matchesText(deployment, match.SearchText) {
+			continue
+		}
+		if !matchesStatus(deployment, match.Status) {
+			continue
+		}
+		if match.ArtifactName != "" &&
+			(deployment.ArtifactName == nil ||
+				*deployment.ArtifactName != match.ArtifactName) {
+			continue
+		}
+		if match.DeviceID != "" &&
+			db.db(ctx).findDeviceDeployment(match.DeviceID, *deployment.Id) == nil {
+			continue
+		}
+		if !inTimeRange(deployment.Created, match.CreatedAfter, match.CreatedBefore) {
+			continue
+		}
+		if !inTimeRange(deployment.Finished, match.FinishedAfter, match.FinishedBefore) {
+			continue
+		}
+		found = append(found, deployment)
+	}
+
+	// missing times sort first, as in mongo
+	timeOf := func(deployment *model.Deployment) time.Time {
+		t := deployment.Created
+		if match.SortBy == model.DeploymentsSortFinished {
+			t = deployment.Finished
+		}
+		if t == nil {
+			return time.Time{}
+		}
+		return *t
+	}
+	descending := match.SortBy == "" || match.SortDescending
+	sort.SliceStable(found, func(i, j int) bool {
+		if descending {
+			return timeOf(found[i]).After(timeOf(found[j]))
+		}
+		return timeOf(found[i]).Before(timeOf(found[j]))
+	})
+
+	total := len(found)
+	if match.Skip > 0 {
+		if match.Skip >= len(found) {
+			found = nil
+		} else {
+			found = found[match.Skip:]
+		}
+	}
+	if match.Limit > 0 && match.Limit < len(found) {
+		found = found[:match.Limit]
+	}
+
+	deployments := make([]*model.Deployment, 0, len(found))
+	for _, deployment := range found {
+		deployments = append(deployments, cloneDeployment(deployment))
+	}
+
+	return deployments, total, nil
+}
+
+func isClaimedForArchival(deployment *model.Deployment, now time.Time) bool {
+	return deployment.ArchivingUntil != nil &&
+		!deployment.ArchivingUntil.Before(now)
+}
+
+func (db *DataStoreInMem) ClaimDeploymentArchival(ctx context.Context,
+	id string, until time.Time) (bool, error) {
+
+	if govalidator.IsNull(id) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil || isClaimedForArchival(deployment, time.Now()) {
+		return false, nil
+	}
+	deployment.ArchivingUntil = &until
+
+	return true, nil
+}
+
+func (db *DataStoreInMem) FindFinishedBefore(ctx context.Context,
+	before time.Time, limit int) ([]*model.Deployment, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	now := time.Now()
+	var found []*model.Deployment
+	for _, deployment := range db.db(ctx).deployments {
+		if deployment.Finished != nil && deployment.Finished.Before(before) &&
+			(deployment.RestoredAt == nil || deployment.RestoredAt.Before(before)) &&
+			!isClaimedForArchival(deployment, now) {
+			found = append(found, deployment)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Finished.Before(*found[j].Finished)
+	})
+
+	if limit > 0 && limit < len(found) {
+		found = found[:limit]
+	}
+
+	deployments := make([]*model.Deployment, 0, len(found))
+	for _, deployment := range found {
+		deployments = append(deployments, cloneDeployment(deployment))
+	}
+
+	return deployments, nil
+}
+
+func (db *DataStoreInMem) Finish(ctx context.Context, id string, when time.Time) error {
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	_, deployment := db.db(ctx).findDeployment(id)
+	if deployment == nil {
+		return mongo.ErrStorageInvalidID
+	}
+
+	deployment.Finished = &when
+
+	return nil
+}
+
+func (db *DataStoreInMem) ExistUnfinishedByArtifactId(ctx context.Context,
+	id string) (bool, error) {
+
+	if govalidator.IsNull(id) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for _, deployment := range db.db(ctx).deployments {
+		if deployment.Finished == nil && containsString(deployment.Artifacts, id) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (db *DataStoreInMem) ExistByArtifactId(ctx context.Context,
+	id string) (bool, error) {
+
+	if govalidator.IsNull(id) {
+		return false, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	for _, deployment := range db.db(ctx).deployments {
+		if containsString(deployment.Artifacts, id) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// archived deployments
+
+func (d *database) findArchivedDeployment(id string) (int, *model.ArchivedDeployment) {
+	for i, archived := range d.archived {
+		if archived.Id == id {
+			return i, archived
+		}
+	}
+	return -1, nil
+}
+
+func (db *DataStoreInMem) SaveArchivedDeployment(ctx context.Context,
+	archived *model.ArchivedDeployment) error {
+
+	if archived == nil || govalidator.IsNull(archived.Id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var c model.ArchivedDeployment
+	clone(archived, &c)
+
+	d := db.db(ctx)
+	if i, found := d.findArchivedDeployment(archived.Id); found != nil {
+		d.archived[i] = &c
+	} else {
+		d.archived = append(d.archived, &c)
+	}
+
+	return nil
+}
+
+func (db *DataStoreInMem) FindArchivedDeployments(ctx context.Context,
+	skip, limit int) ([]model.ArchivedDeployment, error) {
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	found := append([]*model.ArchivedDeployment{}, db.db(ctx).archived...)
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Finished == nil || found[j].Finished == nil {
+			return found[i].Finished != nil
+		}
+		return found[i].Finished.After(*found[j].Finished)
+	})
+
+	if skip >= len(found) {
+		found = nil
+	} else {
+		found = found[skip:]
+	}
+	if limit > 0 && limit < len(found) {
+		found = found[:limit]
+	}
+
+	archived := make([]model.ArchivedDeployment, len(found))
+	for i := range found {
+		clone(found[i], &archived[i])
+	}
+
+	return archived, nil
+}
+
+func (db *DataStoreInMem) FindArchivedDeploymentByID(ctx context.Context,
+	id string) (*model.ArchivedDeployment, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	_, found := db.db(ctx).findArchivedDeployment(id)
+	if found == nil {
+		return nil, nil
+	}
+
+	var c model.ArchivedDeployment
+	clone(found, &c)
+
+	return &c, nil
+}
+
+func (db *DataStoreInMem) DeleteArchivedDeployment(ctx context.Context, id string) error {
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	d := db.db(ctx)
+	if i, found := d.findArchivedDeployment(id); found != nil {
+		d.archived = append(d.archived[:i], d.archived[i+1:]...)
+	}
+
+	return nil
+}
+
+func containsString(in []string, what string) bool {
+	for _, v := range in {
+		if v == what {
+			return true
+		}
+	}
+	return false
+}
+
+// gateways
+
+func (db *DataStoreInMem) SetGatewayDevices(ctx context.Context,
+	gatewayID string, devices model.GatewayDevices) error {
+
+	if govalidator.IsNull(gatewayID) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var c model.GatewayDevices
+	clone(devices, &c)
+	db.db(ctx).gateways[gatewayID] = c
+
+	return nil
+}
+
+func (db *DataStoreInMem) GetGatewayDevices(ctx context.Context,
+	gatewayID string) (*model.GatewayDevices, error) {
+
+	if govalidator.IsNull(gatewayID) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	devices, ok := db.db(ctx).gateways[gatewayID]
+	if !ok {
+		return nil, nil
+	}
+	var c model.GatewayDevices
+	clone(devices, &c)
+
+	return &c, nil
+}
+
+// maintenance windows
+
+func (db *DataStoreInMem) SetMaintenanceWindows(ctx context.Context,
+	id string, windows model.MaintenanceWindows) error {
+
+	if govalidator.IsNull(id) {
+		return mongo.ErrStorageInvalidID
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	var c model.MaintenanceWindows
+	clone(windows, &c)
+	db.db(ctx).maintenanceWindows[id] = c
+
+	return nil
+}
+
+func (db *DataStoreInMem) GetMaintenanceWindows(ctx context.Context,
+	id string) (*model.MaintenanceWindows, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, mongo.ErrStorageInvalidID
+	}
+
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	windows, ok := db.db(ctx).maintenanceWindows[id]
+	if !ok {
+		return nil, nil
+	}
+	var c model.MaintenanceWindows
+	clone(windows, &c)
+
+	return &c, nil
+}
@@ -0,0 +1,470 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/store"
+	"github.com/mendersoftware/deployments/store/mongo"
+)
+
+var _ store.DataStore = &DataStoreInMem{}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func newImage(t *testing.T, name string, deviceTypes ...string) *model.SoftwareImage {
+	uid, err := uuid.NewV4()
+	assert.NoError(t, err)
+
+	return model.NewSoftwareImage(
+		uid.String(),
+		&model.SoftwareImageMetaConstructor{},
+		&model.SoftwareImageMetaArtifactConstructor{
+			Name:                  name,
+			DeviceTypesCompatible: deviceTypes,
+			Info: &model.ArtifactInfo{
+				Format:  "mender",
+				Version: 2,
+			},
+		},
+		10)
+}
+
+func newDeployment(t *testing.T, name, artifact string, devices ...string) *model.Deployment {
+	d, err := model.NewDeploymentFromConstructor(&model.DeploymentConstructor{
+		Name:         stringPtr(name),
+		ArtifactName: stringPtr(artifact),
+		Devices:      devices,
+	})
+	assert.NoError(t, err)
+	return d
+}
+
+func TestImages(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	foo := newImage(t, "foo", "bar", "baz")
+	assert.NoError(t, db.InsertImage(ctx, foo))
+	assert.Equal(t, ErrDuplicateKey, db.InsertImage(ctx, newImage(t, "foo", "baz")))
+	assert.NoError(t, db.InsertImage(ctx, newImage(t, "foo", "qux")))
+	assert.NoError(t, db.InsertImage(ctx, newImage(t, "zed", "bar")))
+
+	ok, err := db.Exists(ctx, foo.Id)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = db.Exists(ctx, "")
+	assert.Equal(t, mongo.ErrSoftwareImagesStorageInvalidID, err)
+
+	ok, err = db.IsArtifactUnique(ctx, "foo", []string{"qux"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	image, err := db.ImageByNameAndDeviceType(ctx, "foo", "baz")
+	assert.NoError(t, err)
+	assert.Equal(t, foo.Id, image.Id)
+
+	image, err = db.ImageByIdsAndDeviceType(ctx, []string{"x", foo.Id}, "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, foo.Id, image.Id)
+
+	// returned objects are copies
+	image.Name = "modified"
+	image, err = db.FindImageByID(ctx, foo.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", image.Name)
+
+	images, err := db.ImagesByName(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Len(t, images, 2)
+
+	releases, err := db.GetReleases(ctx, nil)
+	assert.NoError(t, err)
+	assert.Len(t, releases, 2)
+	assert.Equal(t, "zed", releases[0].Name)
+	assert.Len(t, releases[1].Artifacts, 2)
+
+	assert.NoError(t, db.DeleteImage(ctx, foo.Id))
+	image, err = db.FindImageByID(ctx, foo.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, image)
+
+	// images of another tenant are not visible
+	tctx := identity.WithContext(ctx, &identity.Identity{Tenant: "tenant"})
+	images, err = db.FindAll(tctx)
+	assert.NoError(t, err)
+	assert.Len(t, images, 0)
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	_, err := db.GetLimit(ctx, model.LimitStorage)
+	assert.Equal(t, mongo.ErrLimitNotFound, err)
+
+	assert.NoError(t, db.UpsertLimit(ctx, model.Limit{Name: model.LimitStorage, Value: 100}))
+	limit, err := db.GetLimit(ctx, model.LimitStorage)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), limit.Value)
+}
+
+func TestConcurrentTenants(t *testing.T) {
+	db := NewDataStoreInMem()
+
+	// readers of tenants not seen before create their databases
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: fmt.Sprintf("tenant-%d", i)})
+			_, err := db.GetLimit(ctx, model.LimitStorage)
+			assert.Equal(t, mongo.ErrLimitNotFound, err)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDeviceDeployments(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	dep := newDeployment(t, "foo", "bar", "d1", "d2")
+	dep.Stats[model.DeviceDeploymentStatusPending] = 2
+	assert.NoError(t, db.InsertDeployment(ctx, dep))
+
+	d1, _ := model.NewDeviceDeployment("d1", *dep.Id)
+	d2, _ := model.NewDeviceDeployment("d2", *dep.Id)
+	assert.NoError(t, db.InsertMany(ctx, d1, d2))
+
+	old, err := db.UpdateDeviceDeploymentStatus(ctx, "d1", *dep.Id,
+		model.DeviceDeploymentStatus{Status: model.DeviceDeploymentStatusSuccess})
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceDeploymentStatusPending, old)
+	assert.NoError(t, db.UpdateStats(ctx, *dep.Id, old, model.DeviceDeploymentStatusSuccess))
+
+	_, err = db.UpdateDeviceDeploymentStatus(ctx, "d3", *dep.Id,
+		model.DeviceDeploymentStatus{Status: model.DeviceDeploymentStatusSuccess})
+	assert.Equal(t, mongo.ErrStorageNotFound, err)
+
+	status, err := db.GetDeviceDeploymentStatus(ctx, *dep.Id, "d1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceDeploymentStatusSuccess, status)
+
+	stats, err := db.AggregateDeviceDeploymentByStatus(ctx, *dep.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats[model.DeviceDeploymentStatusPending])
+	assert.Equal(t, 1, stats[model.DeviceDeploymentStatusSuccess])
+
+	assert.NoError(t, db.AbortDeviceDeployments(ctx, *dep.Id))
+	statuses, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: *dep.Id})
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, model.DeviceDeploymentStatusSuccess, *statuses[0].Status)
+	assert.Equal(t, model.DeviceDeploymentStatusAborted, *statuses[1].Status)
+
+	stats, err = db.AggregateDeviceDeploymentByStatus(ctx, *dep.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, db.UpdateStatsAndFinishDeployment(ctx, *dep.Id, stats))
+
+	found, err := db.FindUnfinishedByID(ctx, *dep.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	found, err = db.FindDeploymentByID(ctx, *dep.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, found.Finished)
+	assert.Equal(t, stats, model.Stats(found.Stats))
+}
+
+func TestGetDeviceStatusesForDeployment(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	created := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	for i, device := range []string{"d1", "d2", "d3", "d4"} {
+		dd, err := model.NewDeviceDeployment(device, deploymentID)
+		assert.NoError(t, err)
+		// d1 and d2 are created at the same time
+		deviceCreated := created.Add(time.Duration(i/2) * time.Minute)
+		dd.Created = &deviceCreated
+		dd.DeviceType = stringPtr("foo")
+		if i%2 == 1 {
+			finished := created.Add(time.Duration(10-i) * time.Minute)
+			dd.Finished = &finished
+			dd.Status = stringPtr(model.DeviceDeploymentStatusFailure)
+			dd.IsLogAvailable = true
+		}
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+	other, err := model.NewDeviceDeployment("d1",
+		"1d1ce8bc-6c53-4c42-8a76-5c6b3a4f6d2e")
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertMany(ctx, other))
+
+	withLog := true
+	testCases := map[string]struct {
+		query model.DeviceDeploymentsQuery
+
+		devices []string
+		total   int
+	}{
+		"all, by creation": {
+			query:   model.DeviceDeploymentsQuery{},
+			devices: []string{"d1", "d2", "d3", "d4"},
+			total:   4,
+		},
+		"page": {
+			query:   model.DeviceDeploymentsQuery{Skip: 1, Limit: 2},
+			devices: []string{"d2", "d3"},
+			total:   4,
+		},
+		"past the last page": {
+			query:   model.DeviceDeploymentsQuery{Skip: 4, Limit: 2},
+			devices: []string{},
+			total:   4,
+		},
+		"by creation, descending": {
+			query:   model.DeviceDeploymentsQuery{SortDescending: true},
+			devices: []string{"d4", "d3", "d2", "d1"},
+			total:   4,
+		},
+		"by finish, unfinished first": {
+			query: model.DeviceDeploymentsQuery{
+				SortBy: model.DeviceDeploymentsSortFinished,
+			},
+			devices: []string{"d1", "d3", "d4", "d2"},
+			total:   4,
+		},
+		"status": {
+			query: model.DeviceDeploymentsQuery{
+				Status: model.DeviceDeploymentStatusPending,
+			},
+			devices: []string{"d1", "d3"},
+			total:   2,
+		},
+		"log and device type": {
+			query: model.DeviceDeploymentsQuery{
+				IsLogAvailable: &withLog,
+				DeviceType:     "foo",
+				Limit:          1,
+			},
+			devices: []string{"d2"},
+			total:   2,
+		},
+		"other device type": {
+			query: model.DeviceDeploymentsQuery{
+				DeviceType: "bar",
+			},
+			devices: []string{},
+			total:   0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tc.query.DeploymentID = deploymentID
+			statuses, total, err := db.GetDeviceStatusesForDeployment(ctx,
+				tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.total, total)
+
+			devices := []string{}
+			for _, dd := range statuses {
+				devices = append(devices, *dd.DeviceId)
+			}
+			assert.Equal(t, tc.devices, devices)
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	now := time.Now()
+	pending := newDeployment(t, "pending one", "app", "d1")
+	pending.Stats[model.DeviceDeploymentStatusPending] = 1
+	pending.Created = &now
+
+	earlier := now.Add(-time.Hour)
+	running := newDeployment(t, "running", "other", "d1", "d2")
+	running.Stats[model.DeviceDeploymentStatusPending] = 1
+	running.Stats[model.DeviceDeploymentStatusSuccess] = 1
+	running.Created = &earlier
+
+	evenEarlier := now.Add(-2 * time.Hour)
+	finished := newDeployment(t, "finished", "app", "d1")
+	finished.Stats[model.DeviceDeploymentStatusAborted] = 1
+	finished.Created = &evenEarlier
+	finished.Finished = &now
+
+	for _, d := range []*model.Deployment{finished, pending, running} {
+		assert.NoError(t, db.InsertDeployment(ctx, d))
+	}
+	dd, err := model.NewDeviceDeployment("d2", *running.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertMany(ctx, dd))
+
+	testCases := map[string]struct {
+		query model.Query
+		ids   []string
+		total int
+	}{
+		"all, newest first": {
+			ids:   []string{*pending.Id, *running.Id, *finished.Id},
+			total: 3,
+		},
+		"text": {
+			query: model.Query{SearchText: "APP"},
+			ids:   []string{*pending.Id, *finished.Id},
+			total: 2,
+		},
+		"artifact name": {
+			query: model.Query{ArtifactName: "other"},
+			ids:   []string{*running.Id},
+			total: 1,
+		},
+		"device": {
+			query: model.Query{DeviceID: "d2"},
+			ids:   []string{*running.Id},
+			total: 1,
+		},
+		"pending": {
+			query: model.Query{Status: model.StatusQueryPending},
+			ids:   []string{*pending.Id},
+			total: 1,
+		},
+		"in progress": {
+			query: model.Query{Status: model.StatusQueryInProgress},
+			ids:   []string{*running.Id},
+			total: 1,
+		},
+		"finished": {
+			query: model.Query{Status: model.StatusQueryFinished},
+			ids:   []string{*finished.Id},
+			total: 1,
+		},
+		"aborted": {
+			query: model.Query{Status: model.StatusQueryAborted},
+			ids:   []string{*finished.Id},
+			total: 1,
+		},
+		"created range": {
+			query: model.Query{CreatedAfter: &evenEarlier, CreatedBefore: &earlier},
+			ids:   []string{*running.Id, *finished.Id},
+			total: 2,
+		},
+		"finished range": {
+			query: model.Query{FinishedAfter: &earlier},
+			ids:   []string{*finished.Id},
+			total: 1,
+		},
+		"oldest first": {
+			query: model.Query{SortBy: model.DeploymentsSortCreated},
+			ids:   []string{*finished.Id, *running.Id, *pending.Id},
+			total: 3,
+		},
+		"last finished first": {
+			query: model.Query{
+				SortBy:         model.DeploymentsSortFinished,
+				SortDescending: true,
+				Limit:          1,
+			},
+			ids:   []string{*finished.Id},
+			total: 3,
+		},
+		"skip and limit": {
+			query: model.Query{Skip: 1, Limit: 1},
+			ids:   []string{*running.Id},
+			total: 3,
+		},
+		"skip all": {
+			query: model.Query{Skip: 3},
+			ids:   []string{},
+			total: 3,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			deployments, total, err := db.Find(ctx, tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.total, total)
+
+			ids := []string{}
+			for _, d := range deployments {
+				ids = append(ids, *d.Id)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestFindDeviceDeploymentHistory(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreInMem()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	var ids []string
+	for i, name := range []string{"foo", "bar", "baz"} {
+		dep := newDeployment(t, name, "app", "device")
+		assert.NoError(t, db.InsertDeployment(ctx, dep))
+		ids = append(ids, *dep.Id)
+
+		dd, err := model.NewDeviceDeployment("device", *dep.Id)
+		assert.NoError(t, err)
+		created := base.Add(time.Duration(i) * time.Hour)
+		dd.Created = &created
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+
+	found, err := db.FindDeviceDeploymentHistory(ctx,
+		model.DeviceDeploymentHistoryQuery{DeviceID: "device", Skip: 1, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, ids[1], *found[0].DeploymentId)
+	}
+
+	_, err = db.FindDeviceDeploymentHistory(ctx,
+		model.DeviceDeploymentHistoryQuery{})
+	assert.Equal(t, mongo.ErrStorageInvalidID, err)
+
+	deployments, err := db.FindDeploymentsByIDs(ctx,
+		[]string{ids[2], ids[0], "9b4e6f8d-2d55-4d1c-a9a0-4a3c8c1b5f6e"})
+	assert.NoError(t, err)
+	if assert.Len(t, deployments, 2) {
+		assert.Equal(t, ids[0], *deployments[0].Id)
+		assert.Equal(t, ids[2], *deployments[1].Id)
+	}
+}
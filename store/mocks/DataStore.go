@@ -38,6 +38,41 @@ func (_m *DataStore) AbortDeviceDeployments(ctx context.Context, deploymentID st
 	return r0
 }
 
+// AddDeviceDeploymentTransition provides a mock function with given fields: ctx, deviceID, deploymentID, transition
+func (_m *DataStore) AddDeviceDeploymentTransition(ctx context.Context, deviceID string, deploymentID string, transition model.DeviceDeploymentTransition) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, transition)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.DeviceDeploymentTransition) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, transition)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AdmitDeviceDeployment provides a mock function with given fields: ctx, deviceID, deploymentID, max
+func (_m *DataStore) AdmitDeviceDeployment(ctx context.Context, deviceID string, deploymentID string, max int) (bool, error) {
+	ret := _m.Called(ctx, deviceID, deploymentID, max)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int) bool); ok {
+		r0 = rf(ctx, deviceID, deploymentID, max)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int) error); ok {
+		r1 = rf(ctx, deviceID, deploymentID, max)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // AggregateDeviceDeploymentByStatus provides a mock function with given fields: ctx, id
 func (_m *DataStore) AggregateDeviceDeploymentByStatus(ctx context.Context, id string) (model.Stats, error) {
 	ret := _m.Called(ctx, id)
@@ -61,13 +96,50 @@ func (_m *DataStore) AggregateDeviceDeploymentByStatus(ctx context.Context, id s
 	return r0, r1
 }
 
-// AssignArtifact provides a mock function with given fields: ctx, deviceID, deploymentID, artifact
-func (_m *DataStore) AssignArtifact(ctx context.Context, deviceID string, deploymentID string, artifact *model.SoftwareImage) error {
-	ret := _m.Called(ctx, deviceID, deploymentID, artifact)
+// AggregateDeviceDeploymentProgress provides a mock function with given fields: ctx, id
+func (_m *DataStore) AggregateDeviceDeploymentProgress(ctx context.Context, id string) (*model.DeploymentProgress, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.DeploymentProgress
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeploymentProgress); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeploymentProgress)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AppendDeviceDeploymentLog provides a mock function with given fields: ctx, deviceID, deploymentID, chunk
+func (_m *DataStore) AppendDeviceDeploymentLog(ctx context.Context, deviceID string, deploymentID string, chunk model.LogChunk) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, chunk)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.LogChunk) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, chunk)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AssignArtifact provides a mock function with given fields: ctx, deviceID, deploymentID, artifact, deviceType
+func (_m *DataStore) AssignArtifact(ctx context.Context, deviceID string, deploymentID string, artifact *model.SoftwareImage, deviceType string) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, artifact, deviceType)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, *model.SoftwareImage) error); ok {
-		r0 = rf(ctx, deviceID, deploymentID, artifact)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *model.SoftwareImage, string) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, artifact, deviceType)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -75,6 +147,27 @@ func (_m *DataStore) AssignArtifact(ctx context.Context, deviceID string, deploy
 	return r0
 }
 
+// ClaimDeploymentArchival provides a mock function with given fields: ctx, id, until
+func (_m *DataStore) ClaimDeploymentArchival(ctx context.Context, id string, until time.Time) (bool, error) {
+	ret := _m.Called(ctx, id, until)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) bool); ok {
+		r0 = rf(ctx, id, until)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, id, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DecommissionDeviceDeployments provides a mock function with given fields: ctx, deviceId
 func (_m *DataStore) DecommissionDeviceDeployments(ctx context.Context, deviceId string) error {
 	ret := _m.Called(ctx, deviceId)
@@ -89,6 +182,20 @@ func (_m *DataStore) DecommissionDeviceDeployments(ctx context.Context, deviceId
 	return r0
 }
 
+// DeleteArchivedDeployment provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteArchivedDeployment(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteDeployment provides a mock function with given fields: ctx, id
 func (_m *DataStore) DeleteDeployment(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
@@ -103,6 +210,34 @@ func (_m *DataStore) DeleteDeployment(ctx context.Context, id string) error {
 	return r0
 }
 
+// DeleteDeviceDeploymentLogs provides a mock function with given fields: ctx, deploymentID
+func (_m *DataStore) DeleteDeviceDeploymentLogs(ctx context.Context, deploymentID string) error {
+	ret := _m.Called(ctx, deploymentID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, deploymentID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDeviceDeployments provides a mock function with given fields: ctx, deploymentID
+func (_m *DataStore) DeleteDeviceDeployments(ctx context.Context, deploymentID string) error {
+	ret := _m.Called(ctx, deploymentID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, deploymentID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeleteImage provides a mock function with given fields: ctx, id
 func (_m *DataStore) DeleteImage(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
@@ -117,6 +252,20 @@ func (_m *DataStore) DeleteImage(ctx context.Context, id string) error {
 	return r0
 }
 
+// DeprovisionTenant provides a mock function with given fields: ctx, tenantId
+func (_m *DataStore) DeprovisionTenant(ctx context.Context, tenantId string) error {
+	ret := _m.Called(ctx, tenantId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, tenantId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // DeviceCountByDeployment provides a mock function with given fields: ctx, id
 func (_m *DataStore) DeviceCountByDeployment(ctx context.Context, id string) (int, error) {
 	ret := _m.Called(ctx, id)
@@ -223,7 +372,7 @@ func (_m *DataStore) Exists(ctx context.Context, id string) (bool, error) {
 }
 
 // Find provides a mock function with given fields: ctx, query
-func (_m *DataStore) Find(ctx context.Context, query model.Query) ([]*model.Deployment, error) {
+func (_m *DataStore) Find(ctx context.Context, query model.Query) ([]*model.Deployment, int, error) {
 	ret := _m.Called(ctx, query)
 
 	var r0 []*model.Deployment
@@ -235,14 +384,21 @@ func (_m *DataStore) Find(ctx context.Context, query model.Query) ([]*model.Depl
 		}
 	}
 
-	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, model.Query) error); ok {
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.Query) int); ok {
 		r1 = rf(ctx, query)
 	} else {
-		r1 = ret.Error(1)
+		r1 = ret.Get(1).(int)
 	}
 
-	return r0, r1
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.Query) error); ok {
+		r2 = rf(ctx, query)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
 }
 
 // FindAll provides a mock function with given fields: ctx
@@ -291,6 +447,52 @@ func (_m *DataStore) FindAllDeploymentsForDeviceIDWithStatuses(ctx context.Conte
 	return r0, r1
 }
 
+// FindArchivedDeploymentByID provides a mock function with given fields: ctx, id
+func (_m *DataStore) FindArchivedDeploymentByID(ctx context.Context, id string) (*model.ArchivedDeployment, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.ArchivedDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.ArchivedDeployment); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ArchivedDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindArchivedDeployments provides a mock function with given fields: ctx, skip, limit
+func (_m *DataStore) FindArchivedDeployments(ctx context.Context, skip int, limit int) ([]model.ArchivedDeployment, error) {
+	ret := _m.Called(ctx, skip, limit)
+
+	var r0 []model.ArchivedDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, int, int) []model.ArchivedDeployment); ok {
+		r0 = rf(ctx, skip, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ArchivedDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int, int) error); ok {
+		r1 = rf(ctx, skip, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindDeploymentByID provides a mock function with given fields: ctx, id
 func (_m *DataStore) FindDeploymentByID(ctx context.Context, id string) (*model.Deployment, error) {
 	ret := _m.Called(ctx, id)
@@ -314,6 +516,75 @@ func (_m *DataStore) FindDeploymentByID(ctx context.Context, id string) (*model.
 	return r0, r1
 }
 
+// FindDeploymentsByIDs provides a mock function with given fields: ctx, ids
+func (_m *DataStore) FindDeploymentsByIDs(ctx context.Context, ids []string) ([]*model.Deployment, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []*model.Deployment
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []*model.Deployment); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Deployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindDeviceDeploymentHistory provides a mock function with given fields: ctx, query
+func (_m *DataStore) FindDeviceDeploymentHistory(ctx context.Context, query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeployment, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 []model.DeviceDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentHistoryQuery) []model.DeviceDeployment); ok {
+		r0 = rf(ctx, query)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.DeviceDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceDeploymentHistoryQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// FindFinishedBefore provides a mock function with given fields: ctx, before, limit
+func (_m *DataStore) FindFinishedBefore(ctx context.Context, before time.Time, limit int) ([]*model.Deployment, error) {
+	ret := _m.Called(ctx, before, limit)
+
+	var r0 []*model.Deployment
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, int) []*model.Deployment); ok {
+		r0 = rf(ctx, before, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.Deployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, int) error); ok {
+		r1 = rf(ctx, before, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // FindImageByID provides a mock function with given fields: ctx, id
 func (_m *DataStore) FindImageByID(ctx context.Context, id string) (*model.SoftwareImage, error) {
 	ret := _m.Called(ctx, id)
@@ -383,6 +654,29 @@ func (_m *DataStore) FindUnfinishedByID(ctx context.Context, id string) (*model.
 	return r0, r1
 }
 
+// FindUnfinishedTenantDeprovisionings provides a mock function with given fields: ctx
+func (_m *DataStore) FindUnfinishedTenantDeprovisionings(ctx context.Context) ([]model.TenantDeprovisioning, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.TenantDeprovisioning
+	if rf, ok := ret.Get(0).(func(context.Context) []model.TenantDeprovisioning); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TenantDeprovisioning)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Finish provides a mock function with given fields: ctx, id, when
 func (_m *DataStore) Finish(ctx context.Context, id string, when time.Time) error {
 	ret := _m.Called(ctx, id, when)
@@ -397,6 +691,29 @@ func (_m *DataStore) Finish(ctx context.Context, id string, when time.Time) erro
 	return r0
 }
 
+// GetDeviceDeployment provides a mock function with given fields: ctx, deploymentID, deviceID
+func (_m *DataStore) GetDeviceDeployment(ctx context.Context, deploymentID string, deviceID string) (*model.DeviceDeployment, error) {
+	ret := _m.Called(ctx, deploymentID, deviceID)
+
+	var r0 *model.DeviceDeployment
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.DeviceDeployment); ok {
+		r0 = rf(ctx, deploymentID, deviceID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceDeployment)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, deploymentID, deviceID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetDeviceDeploymentLog provides a mock function with given fields: ctx, deviceID, deploymentID
 func (_m *DataStore) GetDeviceDeploymentLog(ctx context.Context, deviceID string, deploymentID string) (*model.DeploymentLog, error) {
 	ret := _m.Called(ctx, deviceID, deploymentID)
@@ -441,22 +758,52 @@ func (_m *DataStore) GetDeviceDeploymentStatus(ctx context.Context, deploymentID
 	return r0, r1
 }
 
-// GetDeviceStatusesForDeployment provides a mock function with given fields: ctx, deploymentID
-func (_m *DataStore) GetDeviceStatusesForDeployment(ctx context.Context, deploymentID string) ([]model.DeviceDeployment, error) {
-	ret := _m.Called(ctx, deploymentID)
+// GetDeviceStatusesForDeployment provides a mock function with given fields: ctx, query
+func (_m *DataStore) GetDeviceStatusesForDeployment(ctx context.Context, query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error) {
+	ret := _m.Called(ctx, query)
 
 	var r0 []model.DeviceDeployment
-	if rf, ok := ret.Get(0).(func(context.Context, string) []model.DeviceDeployment); ok {
-		r0 = rf(ctx, deploymentID)
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentsQuery) []model.DeviceDeployment); ok {
+		r0 = rf(ctx, query)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.DeviceDeployment)
 		}
 	}
 
+	var r1 int
+	if rf, ok := ret.Get(1).(func(context.Context, model.DeviceDeploymentsQuery) int); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Get(1).(int)
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, model.DeviceDeploymentsQuery) error); ok {
+		r2 = rf(ctx, query)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// GetGatewayDevices provides a mock function with given fields: ctx, gatewayID
+func (_m *DataStore) GetGatewayDevices(ctx context.Context, gatewayID string) (*model.GatewayDevices, error) {
+	ret := _m.Called(ctx, gatewayID)
+
+	var r0 *model.GatewayDevices
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.GatewayDevices); ok {
+		r0 = rf(ctx, gatewayID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.GatewayDevices)
+		}
+	}
+
 	var r1 error
 	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, deploymentID)
+		r1 = rf(ctx, gatewayID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -487,6 +834,29 @@ func (_m *DataStore) GetLimit(ctx context.Context, name string) (*model.Limit, e
 	return r0, r1
 }
 
+// GetMaintenanceWindows provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetMaintenanceWindows(ctx context.Context, id string) (*model.MaintenanceWindows, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.MaintenanceWindows
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.MaintenanceWindows); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MaintenanceWindows)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetReleases provides a mock function with given fields: ctx, filt
 func (_m *DataStore) GetReleases(ctx context.Context, filt *model.ReleaseFilter) ([]model.Release, error) {
 	ret := _m.Called(ctx, filt)
@@ -510,6 +880,29 @@ func (_m *DataStore) GetReleases(ctx context.Context, filt *model.ReleaseFilter)
 	return r0, r1
 }
 
+// GetTenantDeprovisioning provides a mock function with given fields: ctx, tenantId
+func (_m *DataStore) GetTenantDeprovisioning(ctx context.Context, tenantId string) (*model.TenantDeprovisioning, error) {
+	ret := _m.Called(ctx, tenantId)
+
+	var r0 *model.TenantDeprovisioning
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TenantDeprovisioning); ok {
+		r0 = rf(ctx, tenantId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TenantDeprovisioning)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, tenantId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // HasDeploymentForDevice provides a mock function with given fields: ctx, deploymentID, deviceID
 func (_m *DataStore) HasDeploymentForDevice(ctx context.Context, deploymentID string, deviceID string) (bool, error) {
 	ret := _m.Called(ctx, deploymentID, deviceID)
@@ -663,6 +1056,85 @@ func (_m *DataStore) IsArtifactUnique(ctx context.Context, artifactName string,
 	return r0, r1
 }
 
+// IterateDeviceDeploymentTransitions provides a mock function with given fields: ctx, deploymentID, fn
+func (_m *DataStore) IterateDeviceDeploymentTransitions(ctx context.Context, deploymentID string, fn func(*model.DeviceDeployment) error) error {
+	ret := _m.Called(ctx, deploymentID, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.DeviceDeployment) error) error); ok {
+		r0 = rf(ctx, deploymentID, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IterateDeviceDeployments provides a mock function with given fields: ctx, deploymentID, fn
+func (_m *DataStore) IterateDeviceDeployments(ctx context.Context, deploymentID string, fn func(*model.DeviceDeployment) error) error {
+	ret := _m.Called(ctx, deploymentID, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.DeviceDeployment) error) error); ok {
+		r0 = rf(ctx, deploymentID, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IterateDeviceStatusesForDeployment provides a mock function with given fields: ctx, query, fn
+func (_m *DataStore) IterateDeviceStatusesForDeployment(ctx context.Context, query model.DeviceDeploymentsQuery, fn func(*model.DeviceDeployment) error) error {
+	ret := _m.Called(ctx, query, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceDeploymentsQuery, func(*model.DeviceDeployment) error) error); ok {
+		r0 = rf(ctx, query, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListTenants provides a mock function with given fields: ctx
+func (_m *DataStore) ListTenants(ctx context.Context) ([]string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context) []string); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *DataStore) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ProvisionTenant provides a mock function with given fields: ctx, tenantId
 func (_m *DataStore) ProvisionTenant(ctx context.Context, tenantId string) error {
 	ret := _m.Called(ctx, tenantId)
@@ -677,6 +1149,76 @@ func (_m *DataStore) ProvisionTenant(ctx context.Context, tenantId string) error
 	return r0
 }
 
+// ReleaseDeviceDeployment provides a mock function with given fields: ctx, deviceID, deploymentID
+func (_m *DataStore) ReleaseDeviceDeployment(ctx context.Context, deviceID string, deploymentID string) (bool, error) {
+	ret := _m.Called(ctx, deviceID, deploymentID)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, deviceID, deploymentID)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, deviceID, deploymentID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReleaseDeviceDeploymentsAdmittedBefore provides a mock function with given fields: ctx, deploymentID, before
+func (_m *DataStore) ReleaseDeviceDeploymentsAdmittedBefore(ctx context.Context, deploymentID string, before time.Time) (int, error) {
+	ret := _m.Called(ctx, deploymentID, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) int); ok {
+		r0 = rf(ctx, deploymentID, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, deploymentID, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplaceStats provides a mock function with given fields: ctx, id, old, stats, finished
+func (_m *DataStore) ReplaceStats(ctx context.Context, id string, old model.Stats, stats model.Stats, finished *time.Time) error {
+	ret := _m.Called(ctx, id, old, stats, finished)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.Stats, model.Stats, *time.Time) error); ok {
+		r0 = rf(ctx, id, old, stats, finished)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveArchivedDeployment provides a mock function with given fields: ctx, archived
+func (_m *DataStore) SaveArchivedDeployment(ctx context.Context, archived *model.ArchivedDeployment) error {
+	ret := _m.Called(ctx, archived)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ArchivedDeployment) error); ok {
+		r0 = rf(ctx, archived)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SaveDeviceDeploymentLog provides a mock function with given fields: ctx, log
 func (_m *DataStore) SaveDeviceDeploymentLog(ctx context.Context, log model.DeploymentLog) error {
 	ret := _m.Called(ctx, log)
@@ -691,6 +1233,76 @@ func (_m *DataStore) SaveDeviceDeploymentLog(ctx context.Context, log model.Depl
 	return r0
 }
 
+// SaveDeviceDeploymentLogChunksPrefix provides a mock function with given fields: ctx, deviceID, deploymentID, prefix
+func (_m *DataStore) SaveDeviceDeploymentLogChunksPrefix(ctx context.Context, deviceID string, deploymentID string, prefix string) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, prefix)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, prefix)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveDeviceDeploymentLogObject provides a mock function with given fields: ctx, deviceID, deploymentID, objectID
+func (_m *DataStore) SaveDeviceDeploymentLogObject(ctx context.Context, deviceID string, deploymentID string, objectID string) error {
+	ret := _m.Called(ctx, deviceID, deploymentID, objectID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, deviceID, deploymentID, objectID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveTenantDeprovisioning provides a mock function with given fields: ctx, deprovisioning
+func (_m *DataStore) SaveTenantDeprovisioning(ctx context.Context, deprovisioning model.TenantDeprovisioning) error {
+	ret := _m.Called(ctx, deprovisioning)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.TenantDeprovisioning) error); ok {
+		r0 = rf(ctx, deprovisioning)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetGatewayDevices provides a mock function with given fields: ctx, gatewayID, devices
+func (_m *DataStore) SetGatewayDevices(ctx context.Context, gatewayID string, devices model.GatewayDevices) error {
+	ret := _m.Called(ctx, gatewayID, devices)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.GatewayDevices) error); ok {
+		r0 = rf(ctx, gatewayID, devices)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetMaintenanceWindows provides a mock function with given fields: ctx, id, windows
+func (_m *DataStore) SetMaintenanceWindows(ctx context.Context, id string, windows model.MaintenanceWindows) error {
+	ret := _m.Called(ctx, id, windows)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.MaintenanceWindows) error); ok {
+		r0 = rf(ctx, id, windows)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Update provides a mock function with given fields: ctx, image
 func (_m *DataStore) Update(ctx context.Context, image *model.SoftwareImage) (bool, error) {
 	ret := _m.Called(ctx, image)
@@ -774,3 +1386,17 @@ func (_m *DataStore) UpdateStatsAndFinishDeployment(ctx context.Context, id stri
 
 	return r0
 }
+
+// UpsertLimit provides a mock function with given fields: ctx, limit
+func (_m *DataStore) UpsertLimit(ctx context.Context, limit model.Limit) error {
+	ret := _m.Called(ctx, limit)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Limit) error); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
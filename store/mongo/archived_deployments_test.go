@@ -0,0 +1,262 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestArchivedDeployments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestArchivedDeployments in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	before := now.Add(-time.Hour)
+
+	first := model.ArchivedDeployment{
+		Id:          "a9b8c7d6-0d1e-4f2a-8b3c-4d5e6f7a8b9c",
+		Name:        "first",
+		Created:     &before,
+		Finished:    &before,
+		DeviceCount: 1,
+		Archived:    now,
+		ObjectID:    "archive/deployments/first.json.gz",
+	}
+	second := first
+	second.Id = "0e1f2a3b-4c5d-4e6f-8a7b-8c9d0e1f2a3b"
+	second.Name = "second"
+	second.Finished = &now
+
+	assert.NoError(t, db.SaveArchivedDeployment(ctx, &first))
+	assert.NoError(t, db.SaveArchivedDeployment(ctx, &second))
+	// replaces the existing one
+	second.DeviceCount = 2
+	assert.NoError(t, db.SaveArchivedDeployment(ctx, &second))
+
+	assert.Equal(t, ErrStorageInvalidID,
+		db.SaveArchivedDeployment(ctx, &model.ArchivedDeployment{}))
+
+	archived, err := db.FindArchivedDeployments(ctx, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ArchivedDeployment{second, first}, archived)
+
+	archived, err = db.FindArchivedDeployments(ctx, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ArchivedDeployment{first}, archived)
+
+	// other tenant
+	archived, err = db.FindArchivedDeployments(context.Background(), 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, archived)
+
+	found, err := db.FindArchivedDeploymentByID(ctx, first.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, &first, found)
+
+	assert.NoError(t, db.DeleteArchivedDeployment(ctx, first.Id))
+	assert.NoError(t, db.DeleteArchivedDeployment(ctx, first.Id))
+
+	found, err = db.FindArchivedDeploymentByID(ctx, first.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestFindFinishedBeforeAndDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindFinishedBeforeAndDelete in short mode.")
+	}
+
+	ctx := context.Background()
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now()
+	finishedTimes := []time.Time{
+		now.Add(-2 * time.Hour),
+		now.Add(-3 * time.Hour),
+		now,
+	}
+	var ids []string
+	for i, finished := range []*time.Time{
+		&finishedTimes[0],
+		&finishedTimes[1],
+		&finishedTimes[2],
+		nil,
+	} {
+		name, artifact := "foo", "bar"
+		deployment, err := model.NewDeploymentFromConstructor(
+			&model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &artifact,
+				Devices:      []string{"device"},
+			})
+		assert.NoError(t, err)
+		deployment.Finished = finished
+		assert.NoError(t, db.InsertDeployment(ctx, deployment), "%d", i)
+		ids = append(ids, *deployment.Id)
+
+		dd, err := model.NewDeviceDeployment("device", *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+		assert.NoError(t, db.SaveDeviceDeploymentLog(ctx, model.DeploymentLog{
+			DeviceID:     "device",
+			DeploymentID: *deployment.Id,
+			Messages: []model.LogMessage{
+				{Timestamp: &now, Level: "info", Message: "foo"},
+			},
+		}))
+	}
+
+	deployments, err := db.FindFinishedBefore(ctx, now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, deployments, 2) {
+		assert.Equal(t, ids[1], *deployments[0].Id)
+		assert.Equal(t, ids[0], *deployments[1].Id)
+	}
+
+	deployments, err = db.FindFinishedBefore(ctx, now.Add(-time.Hour), 1)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 1)
+
+	assert.NoError(t, db.DeleteDeviceDeployments(ctx, ids[0]))
+	assert.NoError(t, db.DeleteDeviceDeploymentLogs(ctx, ids[0]))
+
+	dds, _, err := db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: ids[0]})
+	assert.NoError(t, err)
+	assert.Empty(t, dds)
+	l, err := db.GetDeviceDeploymentLog(ctx, "device", ids[0])
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	dds, _, err = db.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: ids[1]})
+	assert.NoError(t, err)
+	assert.Len(t, dds, 1)
+	l, err = db.GetDeviceDeploymentLog(ctx, "device", ids[1])
+	assert.NoError(t, err)
+	assert.NotNil(t, l)
+}
+
+func TestFindFinishedBeforeRestored(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindFinishedBeforeRestored in short mode.")
+	}
+
+	ctx := context.Background()
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now()
+	finished := now.Add(-3 * time.Hour)
+	var ids []string
+	for _, restored := range []time.Time{
+		now.Add(-2 * time.Hour),
+		now,
+	} {
+		name, artifact := "foo", "bar"
+		deployment, err := model.NewDeploymentFromConstructor(
+			&model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &artifact,
+				Devices:      []string{"device"},
+			})
+		assert.NoError(t, err)
+		deployment.Finished = &finished
+		deployment.RestoredAt = &restored
+		assert.NoError(t, db.InsertDeployment(ctx, deployment))
+		ids = append(ids, *deployment.Id)
+	}
+
+	// restored recently, the retention period starts over
+	deployments, err := db.FindFinishedBefore(ctx, now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, deployments, 1) {
+		assert.Equal(t, ids[0], *deployments[0].Id)
+	}
+}
+
+func TestClaimDeploymentArchival(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestClaimDeploymentArchival in short mode.")
+	}
+
+	ctx := context.Background()
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	now := time.Now()
+	finished := now.Add(-2 * time.Hour)
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:         &name,
+			ArtifactName: &artifact,
+			Devices:      []string{"device"},
+		})
+	assert.NoError(t, err)
+	deployment.Finished = &finished
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+
+	claimed, err := db.ClaimDeploymentArchival(ctx, *deployment.Id,
+		now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// claimed by another instance
+	claimed, err = db.ClaimDeploymentArchival(ctx, *deployment.Id,
+		now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	deployments, err := db.FindFinishedBefore(ctx, now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deployments)
+
+	// claim expired
+	assert.NoError(t, db.session.DB(DatabaseName).
+		C(CollectionDeployments).UpdateId(*deployment.Id, bson.M{
+		"$set": bson.M{StorageKeyDeploymentArchiving: now.Add(-time.Minute)},
+	}))
+
+	deployments, err = db.FindFinishedBefore(ctx, now.Add(-time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 1)
+
+	claimed, err = db.ClaimDeploymentArchival(ctx, *deployment.Id,
+		now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = db.ClaimDeploymentArchival(ctx, "missing",
+		now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
 	mstore "github.com/mendersoftware/go-lib-micro/store"
 	"github.com/pkg/errors"
 
@@ -37,14 +38,29 @@ const (
 	CollectionDeployments          = "deployments"
 	CollectionDeviceDeploymentLogs = "devices.logs"
 	CollectionDevices              = "devices"
+	CollectionArchivedDeployments  = "deployments.archived"
+	CollectionTenantDeprovisioning = "tenants.deprovisioning"
+	CollectionGateways             = "gateways"
+	CollectionDeviceNotifications  = "devices.notifications"
+	CollectionMaintenanceWindows   = "maintenance_windows"
 )
 
 // Indexes
 const (
 	IndexUniqeNameAndDeviceTypeStr = "uniqueNameAndDeviceTypeIndex"
 	IndexDeploymentArtifactNameStr = "deploymentArtifactNameIndex"
+
+	IndexDeviceDeploymentDeviceStatusCreatedStr = "deviceIdStatusCreatedIndex"
+	IndexDeviceDeploymentDeploymentDeviceStr    = "deploymentIdDeviceIdIndex"
+	IndexDeviceDeploymentDeploymentStatusStr    = "deploymentIdStatusIndex"
+	IndexDeviceDeploymentImageStatusStr         = "imageIdStatusIndex"
+	IndexDeviceDeploymentDeploymentCreatedStr   = "deploymentIdCreatedIndex"
+	IndexDeviceDeploymentDeploymentFinishedStr  = "deploymentIdFinishedIndex"
 )
 
+// Number of attempts of the conditional update of deployment stats
+const updateStatsMaxAttempts = 10
+
 var (
 	StorageIndexes = []string{
 		"$text:" + StorageKeyDeploymentName,
@@ -68,6 +84,7 @@ var (
 	ErrDeploymentStorageInvalidQuery      = errors.New("Invalid query")
 	ErrDeploymentStorageCannotExecQuery   = errors.New("Cannot execute query")
 	ErrStorageInvalidInput                = errors.New("invalid input")
+	ErrStorageConflict                    = errors.New("Concurrent modification, try again")
 
 	ErrLimitNotFound = errors.New("limit not found")
 )
@@ -80,22 +97,44 @@ const (
 	StorageKeySoftwareImageId          = "_id"
 
 	StorageKeyDeviceDeploymentLogMessages = "messages"
+	StorageKeyDeviceDeploymentLogObjectID = "object_id"
+	StorageKeyDeviceDeploymentLogChunks   = "chunks"
+	StorageKeyDeviceDeploymentLogPrefix   = "chunks_prefix"
+	StorageKeyDeviceDeploymentLogSequence = StorageKeyDeviceDeploymentLogChunks + ".sequence"
 
 	StorageKeyDeviceDeploymentAssignedImage   = "image"
 	StorageKeyDeviceDeploymentAssignedImageId = StorageKeyDeviceDeploymentAssignedImage + "." + StorageKeySoftwareImageId
 	StorageKeyDeviceDeploymentDeviceId        = "deviceid"
 	StorageKeyDeviceDeploymentStatus          = "status"
 	StorageKeyDeviceDeploymentSubState        = "substate"
+	StorageKeyDeviceDeploymentProgress        = "progress"
 	StorageKeyDeviceDeploymentDeploymentID    = "deploymentid"
 	StorageKeyDeviceDeploymentFinished        = "finished"
 	StorageKeyDeviceDeploymentIsLogAvailable  = "log"
 	StorageKeyDeviceDeploymentArtifact        = "image"
+	StorageKeyDeviceDeploymentCreated         = "created"
+	StorageKeyDeviceDeploymentAdmitted        = "admitted"
+	StorageKeyDeviceDeploymentAdmittedAt      = "admitted_at"
+	StorageKeyDeviceDeploymentTransitions     = "transitions"
+	StorageKeyDeviceDeploymentDeviceType      = "devicetype"
 
 	StorageKeyDeploymentName         = "deploymentconstructor.name"
 	StorageKeyDeploymentArtifactName = "deploymentconstructor.artifactname"
 	StorageKeyDeploymentStats        = "stats"
 	StorageKeyDeploymentFinished     = "finished"
 	StorageKeyDeploymentArtifacts    = "artifacts"
+	StorageKeyDeploymentAdmitted     = "admitted_devices"
+	StorageKeyDeploymentCreated      = "created"
+	StorageKeyDeploymentDeviceCount  = "device_count"
+	StorageKeyDeploymentArchiving    = "archiving_until"
+	StorageKeyDeploymentRestored     = "restored_at"
+
+	StorageKeyLimitValue = "value"
+
+	StorageKeyArchivedDeploymentFinished = "finished"
+
+	StorageKeyTenantDeprovisioningStatus  = "status"
+	StorageKeyTenantDeprovisioningStarted = "started"
 )
 
 type DataStoreMongo struct {
@@ -224,6 +263,14 @@ func (db *DataStoreMongo) matchFromFilt(f *model.ReleaseFilter) bson.M {
 	}
 }
 
+// Ping verifies the connection to the database.
+func (db *DataStoreMongo) Ping(ctx context.Context) error {
+	session := db.session.Copy()
+	defer session.Close()
+
+	return session.Ping()
+}
+
 // limits
 //
 func (db *DataStoreMongo) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
@@ -243,6 +290,23 @@ func (db *DataStoreMongo) GetLimit(ctx context.Context, name string) (*model.Lim
 	return &limit, nil
 }
 
+// UpsertLimit stores the value of the limit, creating it if necessary.
+func (db *DataStoreMongo) UpsertLimit(ctx context.Context, limit model.Limit) error {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	update := bson.M{
+		"$set": bson.M{
+			StorageKeyLimitValue: limit.Value,
+		},
+	}
+	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionLimits).UpsertId(limit.Name, update)
+
+	return err
+}
+
 func (db *DataStoreMongo) ProvisionTenant(ctx context.Context, tenantId string) error {
 	session := db.session.Copy()
 	defer session.Close()
@@ -252,6 +316,99 @@ func (db *DataStoreMongo) ProvisionTenant(ctx context.Context, tenantId string)
 	return MigrateSingle(ctx, dbname, DbVersion, session, true)
 }
 
+// ListTenants returns IDs of all tenants with a provisioned database.
+func (db *DataStoreMongo) ListTenants(ctx context.Context) ([]string, error) {
+	session := db.session.Copy()
+	defer session.Close()
+
+	dbs, err := migrate.GetTenantDbs(session, mstore.IsTenantDb(DbName))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed go retrieve tenant DBs")
+	}
+
+	tenants := make([]string, 0, len(dbs))
+	for _, d := range dbs {
+		tenants = append(tenants, mstore.TenantFromDbName(d, DbName))
+	}
+
+	return tenants, nil
+}
+
+// DeprovisionTenant drops the tenant's database. Noop if it does not exist.
+func (db *DataStoreMongo) DeprovisionTenant(ctx context.Context, tenantId string) error {
+	if govalidator.IsNull(tenantId) {
+		return ErrStorageInvalidInput
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	dbname := mstore.DbNameForTenant(tenantId, DbName)
+
+	return session.DB(dbname).DropDatabase()
+}
+
+// SaveTenantDeprovisioning stores the progress of the tenant's
+// deprovisioning. Kept in the default database, as the tenant's one is
+// dropped.
+func (db *DataStoreMongo) SaveTenantDeprovisioning(ctx context.Context,
+	deprovisioning model.TenantDeprovisioning) error {
+
+	if govalidator.IsNull(deprovisioning.TenantID) {
+		return ErrStorageInvalidInput
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	_, err := session.DB(DatabaseName).C(CollectionTenantDeprovisioning).
+		UpsertId(deprovisioning.TenantID, deprovisioning)
+
+	return err
+}
+
+// GetTenantDeprovisioning returns the progress of the tenant's
+// deprovisioning, nil if it was never started.
+func (db *DataStoreMongo) GetTenantDeprovisioning(ctx context.Context,
+	tenantId string) (*model.TenantDeprovisioning, error) {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	var deprovisioning model.TenantDeprovisioning
+	if err := session.DB(DatabaseName).C(CollectionTenantDeprovisioning).
+		FindId(tenantId).One(&deprovisioning); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &deprovisioning, nil
+}
+
+// FindUnfinishedTenantDeprovisionings returns the progress of the
+// deprovisionings which are pending or were interrupted, oldest first.
+func (db *DataStoreMongo) FindUnfinishedTenantDeprovisionings(
+	ctx context.Context) ([]model.TenantDeprovisioning, error) {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyTenantDeprovisioningStatus: bson.M{
+			"$ne": model.TenantDeprovisioningFinished,
+		},
+	}
+	deprovisionings := []model.TenantDeprovisioning{}
+	if err := session.DB(DatabaseName).C(CollectionTenantDeprovisioning).
+		Find(query).Sort(StorageKeyTenantDeprovisioningStarted).All(&deprovisionings); err != nil {
+		return nil, err
+	}
+
+	return deprovisionings, nil
+}
+
 //images
 
 // Ensure required indexes exists; create if not.
@@ -556,6 +713,79 @@ func (db *DataStoreMongo) SaveDeviceDeploymentLog(ctx context.Context,
 		"$set": bson.M{
 			StorageKeyDeviceDeploymentLogMessages: log.Messages,
 		},
+		"$unset": bson.M{
+			StorageKeyDeviceDeploymentLogObjectID: 1,
+			StorageKeyDeviceDeploymentLogChunks:   1,
+			StorageKeyDeviceDeploymentLogPrefix:   1,
+		},
+	}
+	if _, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeviceDeploymentLogs).Upsert(query, update); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveDeviceDeploymentLogObject stores a reference to the file storage
+// object holding the log messages, in place of the messages.
+func (db *DataStoreMongo) SaveDeviceDeploymentLogObject(ctx context.Context,
+	deviceID, deploymentID, objectID string) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) ||
+		govalidator.IsNull(objectID) {
+		return ErrStorageInvalidInput
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			StorageKeyDeviceDeploymentLogObjectID: objectID,
+		},
+		"$unset": bson.M{
+			StorageKeyDeviceDeploymentLogMessages: 1,
+			StorageKeyDeviceDeploymentLogChunks:   1,
+			StorageKeyDeviceDeploymentLogPrefix:   1,
+		},
+	}
+	if _, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeviceDeploymentLogs).Upsert(query, update); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SaveDeviceDeploymentLogChunksPrefix records that chunks of the log are
+// stored in the file storage objects with the prefix, creating the log if
+// necessary.
+func (db *DataStoreMongo) SaveDeviceDeploymentLogChunksPrefix(ctx context.Context,
+	deviceID, deploymentID, prefix string) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) ||
+		govalidator.IsNull(prefix) {
+		return ErrStorageInvalidInput
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			StorageKeyDeviceDeploymentLogPrefix: prefix,
+		},
 	}
 	if _, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
 		C(CollectionDeviceDeploymentLogs).Upsert(query, update); err != nil {
@@ -565,6 +795,53 @@ func (db *DataStoreMongo) SaveDeviceDeploymentLog(ctx context.Context,
 	return nil
 }
 
+// AppendDeviceDeploymentLog adds the chunk to the deployment log, unless a
+// chunk with the same sequence number was already added.
+func (db *DataStoreMongo) AppendDeviceDeploymentLog(ctx context.Context,
+	deviceID, deploymentID string, chunk model.LogChunk) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidInput
+	}
+	if err := chunk.Validate(); err != nil {
+		return err
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	collection := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeviceDeploymentLogs)
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+
+	// make sure the log exists, so that the conditional update below
+	// does not need to upsert
+	if _, err := collection.Upsert(query, bson.M{
+		"$setOnInsert": query,
+	}); err != nil {
+		return err
+	}
+
+	query[StorageKeyDeviceDeploymentLogSequence] = bson.M{
+		"$ne": chunk.Sequence,
+	}
+	update := bson.M{
+		"$push": bson.M{
+			StorageKeyDeviceDeploymentLogChunks: chunk,
+		},
+	}
+	if err := collection.Update(query, update); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	// not found means the chunk is a duplicate
+	return nil
+}
+
 func (db *DataStoreMongo) GetDeviceDeploymentLog(ctx context.Context,
 	deviceID, deploymentID string) (*model.DeploymentLog, error) {
 
@@ -588,6 +865,26 @@ func (db *DataStoreMongo) GetDeviceDeploymentLog(ctx context.Context,
 	return &depl, nil
 }
 
+// DeleteDeviceDeploymentLogs removes logs of all devices in the deployment.
+func (db *DataStoreMongo) DeleteDeviceDeploymentLogs(ctx context.Context,
+	deploymentID string) error {
+
+	if govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeviceDeploymentLogs).RemoveAll(query)
+
+	return err
+}
+
 // device deployments
 
 // InsertMany stores multiple device deployment objects.
@@ -721,6 +1018,49 @@ func (db *DataStoreMongo) FindAllDeploymentsForDeviceIDWithStatuses(ctx context.
 	return deployments, nil
 }
 
+// FindDeviceDeploymentHistory returns the page of the device deployments of
+// the device matching the query, newest first.
+func (db *DataStoreMongo) FindDeviceDeploymentHistory(ctx context.Context,
+	query model.DeviceDeploymentHistoryQuery) ([]model.DeviceDeployment, error) {
+
+	if govalidator.IsNull(query.DeviceID) {
+		return nil, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	filter := bson.M{
+		StorageKeyDeviceDeploymentDeviceId: query.DeviceID,
+	}
+	if query.Status != "" {
+		filter[StorageKeyDeviceDeploymentStatus] = query.Status
+	}
+	if created := buildTimeRangeQuery(query.CreatedAfter,
+		query.CreatedBefore); created != nil {
+		filter[StorageKeyDeviceDeploymentCreated] = created
+	}
+
+	q := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Find(filter).
+		Sort("-" + StorageKeyDeviceDeploymentCreated).
+		Skip(query.Skip)
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
+	}
+
+	deviceDeployments := []model.DeviceDeployment{}
+	if err := q.All(&deviceDeployments); err != nil {
+		return nil, err
+	}
+
+	return deviceDeployments, nil
+}
+
+// UpdateDeviceDeploymentStatus updates status of the device deployment and
+// returns the previous one. Status of aborted or decommissioned device
+// deployments, or not in the previous statuses if given, is never changed;
+// ErrStorageNotFound is returned instead.
 func (db *DataStoreMongo) UpdateDeviceDeploymentStatus(ctx context.Context,
 	deviceID string, deploymentID string, ddStatus model.DeviceDeploymentStatus) (string, error) {
 
@@ -741,6 +1081,17 @@ func (db *DataStoreMongo) UpdateDeviceDeploymentStatus(ctx context.Context,
 	query := bson.M{
 		StorageKeyDeviceDeploymentDeviceId:     deviceID,
 		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+		StorageKeyDeviceDeploymentStatus: bson.M{
+			"$nin": []string{
+				model.DeviceDeploymentStatusAborted,
+				model.DeviceDeploymentStatusDecommissioned,
+			},
+		},
+	}
+
+	if ddStatus.PreviousStatus != "" {
+		query[StorageKeyDeviceDeploymentStatus].(bson.M)["$eq"] =
+			ddStatus.PreviousStatus
 	}
 
 	// update status field
@@ -760,6 +1111,29 @@ func (db *DataStoreMongo) UpdateDeviceDeploymentStatus(ctx context.Context,
 		"$set": set,
 	}
 
+	// progress holds the latest report only
+	if ddStatus.Progress != nil {
+		set[StorageKeyDeviceDeploymentProgress] = ddStatus.Progress
+	} else {
+		update["$unset"] = bson.M{
+			StorageKeyDeviceDeploymentProgress: 1,
+		}
+	}
+
+	// the transition is recorded along with the status it leads to
+	if !ddStatus.Timestamp.IsZero() {
+		if ddStatus.PreviousStatus == "" {
+			return "", ErrStorageInvalidInput
+		}
+		update["$push"] = pushDeviceDeploymentTransition(
+			model.DeviceDeploymentTransition{
+				From:      ddStatus.PreviousStatus,
+				To:        ddStatus.Status,
+				SubState:  ddStatus.SubState,
+				Timestamp: ddStatus.Timestamp,
+			})
+	}
+
 	var old model.DeviceDeployment
 
 	// update and return the old status in one go
@@ -785,77 +1159,247 @@ func (db *DataStoreMongo) UpdateDeviceDeploymentStatus(ctx context.Context,
 	return *old.Status, nil
 }
 
-func (db *DataStoreMongo) UpdateDeviceDeploymentLogAvailability(ctx context.Context,
-	deviceID string, deploymentID string, log bool) error {
+// AdmitDeviceDeployment lets the device start installing the deployment if
+// fewer than `max` devices were admitted and have not finished yet. Returns
+// false if all the slots are taken, or if the device was admitted already.
+func (db *DataStoreMongo) AdmitDeviceDeployment(ctx context.Context,
+	deviceID string, deploymentID string, max int) (bool, error) {
 
-	// Verify ID formatting
 	if govalidator.IsNull(deviceID) ||
 		govalidator.IsNull(deploymentID) {
-		return ErrStorageInvalidID
+		return false, ErrStorageInvalidID
 	}
 
 	session := db.session.Copy()
 	defer session.Close()
 
-	selector := bson.M{
+	database := session.DB(mstore.DbFromContext(ctx, DatabaseName))
+
+	// claim the device first, not to take two slots for the device
+	// polling concurrently
+	device := bson.M{
 		StorageKeyDeviceDeploymentDeviceId:     deviceID,
 		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
 	}
-
-	update := bson.M{
+	claim := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+		StorageKeyDeviceDeploymentAdmitted:     bson.M{"$ne": true},
+	}
+	if err := database.C(CollectionDevices).Update(claim, bson.M{
 		"$set": bson.M{
-			StorageKeyDeviceDeploymentIsLogAvailable: log,
+			StorageKeyDeviceDeploymentAdmitted:   true,
+			StorageKeyDeviceDeploymentAdmittedAt: time.Now(),
 		},
-	}
-
-	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDevices).Update(selector, update); err != nil {
+	}); err != nil {
 		if err == mgo.ErrNotFound {
-			return ErrStorageNotFound
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 
-	return nil
+	err := database.C(CollectionDeployments).Update(bson.M{
+		"_id":                        deploymentID,
+		StorageKeyDeploymentAdmitted: bson.M{"$lt": max},
+	}, bson.M{
+		"$inc": bson.M{StorageKeyDeploymentAdmitted: 1},
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	// no slot left, give the claim back
+	if errUnclaim := database.C(CollectionDevices).Update(device, bson.M{
+		"$unset": bson.M{
+			StorageKeyDeviceDeploymentAdmitted:   1,
+			StorageKeyDeviceDeploymentAdmittedAt: 1,
+		},
+	}); errUnclaim != nil {
+		return false, errUnclaim
+	}
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return false, err
 }
 
-// AssignArtifact assignes artifact to the device deployment
-func (db *DataStoreMongo) AssignArtifact(ctx context.Context,
-	deviceID string, deploymentID string, artifact *model.SoftwareImage) error {
+// ReleaseDeviceDeployment frees the slot the device took when admitted to
+// the deployment, if any. Returns whether a slot was freed.
+func (db *DataStoreMongo) ReleaseDeviceDeployment(ctx context.Context,
+	deviceID string, deploymentID string) (bool, error) {
 
-	// Verify ID formatting
 	if govalidator.IsNull(deviceID) ||
 		govalidator.IsNull(deploymentID) {
-		return ErrStorageInvalidID
+		return false, ErrStorageInvalidID
 	}
 
 	session := db.session.Copy()
 	defer session.Close()
 
-	selector := bson.M{
+	database := session.DB(mstore.DbFromContext(ctx, DatabaseName))
+
+	if err := database.C(CollectionDevices).Update(bson.M{
 		StorageKeyDeviceDeploymentDeviceId:     deviceID,
 		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			StorageKeyDeviceDeploymentArtifact: artifact,
+		StorageKeyDeviceDeploymentAdmitted:     true,
+	}, bson.M{
+		"$unset": bson.M{
+			StorageKeyDeviceDeploymentAdmitted:   1,
+			StorageKeyDeviceDeploymentAdmittedAt: 1,
 		},
-	}
-
-	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDevices).Update(selector, update); err != nil {
+	}); err != nil {
 		if err == mgo.ErrNotFound {
-			return ErrStorageNotFound
+			return false, nil
 		}
-		return err
+		return false, err
 	}
 
-	return nil
+	if err := database.C(CollectionDeployments).UpdateId(deploymentID, bson.M{
+		"$inc": bson.M{StorageKeyDeploymentAdmitted: -1},
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-func (db *DataStoreMongo) AggregateDeviceDeploymentByStatus(ctx context.Context,
-	id string) (model.Stats, error) {
+// ReleaseDeviceDeploymentsAdmittedBefore frees the slots of the devices
+// admitted to the deployment before the given time. Returns the number of
+// slots freed.
+func (db *DataStoreMongo) ReleaseDeviceDeploymentsAdmittedBefore(
+	ctx context.Context, deploymentID string, before time.Time) (int, error) {
+
+	if govalidator.IsNull(deploymentID) {
+		return 0, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	database := session.DB(mstore.DbFromContext(ctx, DatabaseName))
+	devices := database.C(CollectionDevices)
+
+	admittedBefore := bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+		StorageKeyDeviceDeploymentAdmitted:     true,
+		// also matches the devices admitted before the time was stored
+		StorageKeyDeviceDeploymentAdmittedAt: bson.M{
+			"$not": bson.M{"$gte": before},
+		},
+	}
+
+	var ids []string
+	var dd struct {
+		ID string `bson:"_id"`
+	}
+	iter := devices.Find(admittedBefore).Select(bson.M{"_id": 1}).Iter()
+	for iter.Next(&dd) {
+		ids = append(ids, dd.ID)
+	}
+	if err := iter.Close(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range ids {
+		// released concurrently, if not found
+		admittedBefore["_id"] = id
+		if err := devices.Update(admittedBefore, bson.M{
+			"$unset": bson.M{
+				StorageKeyDeviceDeploymentAdmitted:   1,
+				StorageKeyDeviceDeploymentAdmittedAt: 1,
+			},
+		}); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return released, err
+		}
+
+		if err := database.C(CollectionDeployments).UpdateId(deploymentID, bson.M{
+			"$inc": bson.M{StorageKeyDeploymentAdmitted: -1},
+		}); err != nil {
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+func (db *DataStoreMongo) UpdateDeviceDeploymentLogAvailability(ctx context.Context,
+	deviceID string, deploymentID string, log bool) error {
+
+	// Verify ID formatting
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	selector := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			StorageKeyDeviceDeploymentIsLogAvailable: log,
+		},
+	}
+
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrStorageNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// AssignArtifact assignes artifact to the device deployment, along with the
+// device type reported by the device
+func (db *DataStoreMongo) AssignArtifact(ctx context.Context,
+	deviceID string, deploymentID string, artifact *model.SoftwareImage,
+	deviceType string) error {
+
+	// Verify ID formatting
+	if govalidator.IsNull(deviceID) ||
+		govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	selector := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			StorageKeyDeviceDeploymentArtifact:   artifact,
+			StorageKeyDeviceDeploymentDeviceType: deviceType,
+		},
+	}
+
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return ErrStorageNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) AggregateDeviceDeploymentByStatus(ctx context.Context,
+	id string) (model.Stats, error) {
 
 	if govalidator.IsNull(id) {
 		return nil, ErrStorageInvalidID
@@ -901,26 +1445,196 @@ func (db *DataStoreMongo) AggregateDeviceDeploymentByStatus(ctx context.Context,
 	return raw, nil
 }
 
+// AggregateDeviceDeploymentProgress sums up the progress reported by the
+// devices downloading or installing the deployment; returns nil if none did.
+func (db *DataStoreMongo) AggregateDeviceDeploymentProgress(ctx context.Context,
+	id string) (*model.DeploymentProgress, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	progress := "$" + StorageKeyDeviceDeploymentProgress + "."
+	pipe := []bson.M{
+		{
+			"$match": bson.M{
+				StorageKeyDeviceDeploymentDeploymentID: id,
+				StorageKeyDeviceDeploymentStatus: bson.M{
+					"$in": model.ProgressDeploymentStatuses(),
+				},
+				StorageKeyDeviceDeploymentProgress: bson.M{
+					"$exists": true,
+				},
+			},
+		},
+		{
+			"$group": bson.M{
+				"_id":              nil,
+				"devices":          bson.M{"$sum": 1},
+				"bytes_downloaded": bson.M{"$sum": progress + "bytes_downloaded"},
+				"bytes_total":      bson.M{"$sum": progress + "bytes_total"},
+				"percent":          bson.M{"$avg": progress + "percent"},
+			},
+		},
+	}
+
+	var results []model.DeploymentProgress
+	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Pipe(&pipe).All(&results)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	return &results[0], nil
+}
+
 //GetDeviceStatusesForDeployment retrieve device deployment statuses for a given deployment.
+// Returns the page of the device deployments selected by the query along with
+// the total number of the matching ones.
 func (db *DataStoreMongo) GetDeviceStatusesForDeployment(ctx context.Context,
-	deploymentID string) ([]model.DeviceDeployment, error) {
+	query model.DeviceDeploymentsQuery) ([]model.DeviceDeployment, int, error) {
 
 	session := db.session.Copy()
 	defer session.Close()
 
-	query := bson.M{
-		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	filter := deviceDeploymentsFilter(query)
+
+	c := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices)
+
+	total, err := c.Find(filter).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := c.Find(filter).
+		Select(bson.M{StorageKeyDeviceDeploymentTransitions: 0}).
+		Sort(deviceDeploymentsSort(query)...).
+		Skip(query.Skip)
+	if query.Limit > 0 {
+		q = q.Limit(query.Limit)
 	}
 
 	var statuses []model.DeviceDeployment
+	if err := q.All(&statuses); err != nil {
+		return nil, 0, err
+	}
 
-	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDevices).Find(query).All(&statuses)
-	if err != nil {
-		return nil, err
+	return statuses, total, nil
+}
+
+// deviceDeploymentsFilter returns the filter of the device deployments
+// selected by the query.
+func deviceDeploymentsFilter(query model.DeviceDeploymentsQuery) bson.M {
+	filter := bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: query.DeploymentID,
+	}
+	if query.Status != "" {
+		filter[StorageKeyDeviceDeploymentStatus] = query.Status
+	}
+	if query.DeviceType != "" {
+		filter[StorageKeyDeviceDeploymentDeviceType] = query.DeviceType
+	}
+	if query.IsLogAvailable != nil {
+		filter[StorageKeyDeviceDeploymentIsLogAvailable] = *query.IsLogAvailable
+	}
+	return filter
+}
+
+// deviceDeploymentsSort returns the sort order of the device deployments
+// requested by the query; devices at the same time are sorted by ID.
+func deviceDeploymentsSort(query model.DeviceDeploymentsQuery) []string {
+	sortBy := []string{StorageKeyDeviceDeploymentCreated,
+		StorageKeyDeviceDeploymentDeviceId}
+	if query.SortBy == model.DeviceDeploymentsSortFinished {
+		sortBy[0] = StorageKeyDeviceDeploymentFinished
+	}
+	if query.SortDescending {
+		for i := range sortBy {
+			sortBy[i] = "-" + sortBy[i]
+		}
+	}
+	return sortBy
+}
+
+// IterateDeviceStatusesForDeployment calls fn for each device deployment
+// selected by the query, in its order, read from a cursor; stops at the
+// first error returned by fn. The paging of the query does not apply, and
+// the transitions are not read.
+func (db *DataStoreMongo) IterateDeviceStatusesForDeployment(ctx context.Context,
+	query model.DeviceDeploymentsQuery,
+	fn func(*model.DeviceDeployment) error) error {
+
+	return db.iterateDeviceDeployments(ctx, deviceDeploymentsFilter(query),
+		deviceDeploymentsSort(query), bson.M{
+			StorageKeyDeviceDeploymentTransitions: 0,
+		}, fn)
+}
+
+// IterateDeviceDeploymentTransitions calls fn for each device deployment of
+// the deployment, read from a cursor; stops at the first error returned by fn.
+// Only the status, creation and finish time, and transitions are read.
+func (db *DataStoreMongo) IterateDeviceDeploymentTransitions(ctx context.Context,
+	deploymentID string, fn func(*model.DeviceDeployment) error) error {
+
+	return db.iterateDeviceDeployments(ctx, bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}, nil, bson.M{
+		StorageKeyDeviceDeploymentStatus:      1,
+		StorageKeyDeviceDeploymentCreated:     1,
+		StorageKeyDeviceDeploymentFinished:    1,
+		StorageKeyDeviceDeploymentTransitions: 1,
+	}, fn)
+}
+
+// IterateDeviceDeployments calls fn for each device deployment of the
+// deployment as stored, transitions included, read from a cursor; stops at
+// the first error returned by fn.
+func (db *DataStoreMongo) IterateDeviceDeployments(ctx context.Context,
+	deploymentID string, fn func(*model.DeviceDeployment) error) error {
+
+	return db.iterateDeviceDeployments(ctx, bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}, nil, nil, fn)
+}
+
+// iterateDeviceDeployments calls fn for each device deployment matching the
+// filter, in the sort order and with the projection unless nil.
+func (db *DataStoreMongo) iterateDeviceDeployments(ctx context.Context,
+	filter bson.M, sortBy []string, projection bson.M,
+	fn func(*model.DeviceDeployment) error) error {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	q := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Find(filter)
+	if sortBy != nil {
+		q = q.Sort(sortBy...)
+	}
+	if projection != nil {
+		q = q.Select(projection)
+	}
+	iter := q.Iter()
+	for {
+		// pointer fields are kept by unmarshalling into the same value
+		var dd model.DeviceDeployment
+		if !iter.Next(&dd) {
+			break
+		}
+		if err := fn(&dd); err != nil {
+			iter.Close()
+			return err
+		}
 	}
 
-	return statuses, nil
+	return iter.Close()
 }
 
 // Returns true if deployment of ID `deploymentID` is assigned to device with ID
@@ -976,36 +1690,40 @@ func (db *DataStoreMongo) GetDeviceDeploymentStatus(ctx context.Context,
 	return *dep.Status, nil
 }
 
-func (db *DataStoreMongo) AbortDeviceDeployments(ctx context.Context,
-	deploymentId string) error {
-
-	if govalidator.IsNull(deploymentId) {
-		return ErrStorageInvalidID
-	}
+// GetDeviceDeployment returns the device deployment, or nil if not found.
+func (db *DataStoreMongo) GetDeviceDeployment(ctx context.Context,
+	deploymentID string, deviceID string) (*model.DeviceDeployment, error) {
 
 	session := db.session.Copy()
 	defer session.Close()
-	selector := bson.M{
-		"$and": []bson.M{
-			{
-				StorageKeyDeviceDeploymentDeploymentID: deploymentId,
-			},
-			{
-				StorageKeyDeviceDeploymentStatus: bson.M{
-					"$in": model.ActiveDeploymentStatuses(),
-				},
-			},
-		},
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			StorageKeyDeviceDeploymentStatus: model.DeviceDeploymentStatusAborted,
-		},
+	var dep model.DeviceDeployment
+	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Find(query).One(&dep)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDevices).UpdateAll(selector, update)
+	return &dep, nil
+}
+
+func (db *DataStoreMongo) AbortDeviceDeployments(ctx context.Context,
+	deploymentId string) error {
+
+	if govalidator.IsNull(deploymentId) {
+		return ErrStorageInvalidID
+	}
+
+	err := db.finishActiveDeviceDeployments(ctx, bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentId,
+	}, model.DeviceDeploymentStatusAborted)
 
 	if err == mgo.ErrNotFound {
 		return ErrStorageInvalidID
@@ -1021,29 +1739,111 @@ func (db *DataStoreMongo) DecommissionDeviceDeployments(ctx context.Context,
 		return ErrStorageInvalidID
 	}
 
+	return db.finishActiveDeviceDeployments(ctx, bson.M{
+		StorageKeyDeviceDeploymentDeviceId: deviceId,
+	}, model.DeviceDeploymentStatusDecommissioned)
+}
+
+// finishActiveDeviceDeployments sets the status of the active device
+// deployments matching the query, recording the transitions. The active
+// statuses are updated in the order devices go through them, so that devices
+// reporting a new status in the meantime are not missed.
+func (db *DataStoreMongo) finishActiveDeviceDeployments(ctx context.Context,
+	query bson.M, status string) error {
+
 	session := db.session.Copy()
 	defer session.Close()
-	selector := bson.M{
-		"$and": []bson.M{
-			{
-				StorageKeyDeviceDeploymentDeviceId: deviceId,
-			},
-			{
-				StorageKeyDeviceDeploymentStatus: bson.M{
-					"$in": model.ActiveDeploymentStatuses(),
-				},
+
+	now := time.Now()
+	for _, from := range model.ActiveDeploymentStatuses() {
+		selector := bson.M{
+			StorageKeyDeviceDeploymentStatus: from,
+		}
+		for key, value := range query {
+			selector[key] = value
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				StorageKeyDeviceDeploymentStatus: status,
 			},
-		},
+			"$push": pushDeviceDeploymentTransition(
+				model.DeviceDeploymentTransition{
+					From:      from,
+					To:        status,
+					Timestamp: now,
+				}),
+		}
+
+		_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+			C(CollectionDevices).UpdateAll(selector, update)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AddDeviceDeploymentTransition records a status reported for the device
+// deployment.
+func (db *DataStoreMongo) AddDeviceDeploymentTransition(ctx context.Context,
+	deviceID string, deploymentID string,
+	transition model.DeviceDeploymentTransition) error {
+
+	if govalidator.IsNull(deviceID) || govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidID
 	}
 
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeviceId:     deviceID,
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
 	update := bson.M{
-		"$set": bson.M{
-			StorageKeyDeviceDeploymentStatus: model.DeviceDeploymentStatusDecommissioned,
+		"$push": pushDeviceDeploymentTransition(transition),
+	}
+
+	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDevices).Update(query, update)
+	if err == mgo.ErrNotFound {
+		return ErrStorageNotFound
+	}
+	return err
+}
+
+// pushDeviceDeploymentTransition returns the $push operation appending the
+// transition; only the latest ones are kept, so that a device stuck in a
+// reboot loop can not grow the document beyond the size limit.
+func pushDeviceDeploymentTransition(
+	transition model.DeviceDeploymentTransition) bson.M {
+
+	return bson.M{
+		StorageKeyDeviceDeploymentTransitions: bson.M{
+			"$each":  []model.DeviceDeploymentTransition{transition},
+			"$slice": -model.MaxDeviceDeploymentTransitions,
 		},
 	}
+}
+
+// DeleteDeviceDeployments removes all device deployments of the deployment.
+func (db *DataStoreMongo) DeleteDeviceDeployments(ctx context.Context,
+	deploymentID string) error {
+
+	if govalidator.IsNull(deploymentID) {
+		return ErrStorageInvalidID
+	}
 
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+	}
 	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDevices).UpdateAll(selector, update)
+		C(CollectionDevices).RemoveAll(query)
 
 	return err
 }
@@ -1158,7 +1958,26 @@ func (db *DataStoreMongo) FindDeploymentByID(ctx context.Context, id string) (*m
 		return nil, err
 	}
 
-	return deployment, nil
+	return deployment, nil
+}
+
+// FindDeploymentsByIDs returns the deployments with the given IDs, skipping
+// the missing ones.
+func (db *DataStoreMongo) FindDeploymentsByIDs(ctx context.Context,
+	ids []string) ([]*model.Deployment, error) {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	deployments := []*model.Deployment{}
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeployments).
+		Find(bson.M{"_id": bson.M{"$in": ids}}).
+		All(&deployments); err != nil {
+		return nil, err
+	}
+
+	return deployments, nil
 }
 
 func (db *DataStoreMongo) FindUnfinishedByID(ctx context.Context,
@@ -1250,6 +2069,70 @@ func (db *DataStoreMongo) UpdateStatsAndFinishDeployment(ctx context.Context,
 	return err
 }
 
+// ReplaceStats sets stats and finish time (unset if nil) of the deployment,
+// provided that its stats are still equal to old. Returns ErrStorageConflict
+// if they were modified in the meantime.
+func (db *DataStoreMongo) ReplaceStats(ctx context.Context, id string,
+	old, stats model.Stats, finished *time.Time) error {
+
+	if govalidator.IsNull(id) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	c := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeployments)
+
+	query := bson.M{
+		"_id": id,
+	}
+	for status, count := range old {
+		if count == 0 {
+			query[buildStatusKey(status)] = bson.M{
+				"$in": []interface{}{0, nil},
+			}
+		} else {
+			query[buildStatusKey(status)] = count
+		}
+	}
+
+	var update bson.M
+	if finished != nil {
+		update = bson.M{
+			"$set": bson.M{
+				StorageKeyDeploymentStats:    stats,
+				StorageKeyDeploymentFinished: finished,
+			},
+		}
+	} else {
+		update = bson.M{
+			"$set": bson.M{
+				StorageKeyDeploymentStats: stats,
+			},
+			"$unset": bson.M{
+				StorageKeyDeploymentFinished: "",
+			},
+		}
+	}
+
+	err := c.Update(query, update)
+	if err != mgo.ErrNotFound {
+		return err
+	}
+
+	count, err := c.FindId(id).Count()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrStorageInvalidID
+	}
+
+	return ErrStorageConflict
+}
+
 func (db *DataStoreMongo) UpdateStats(ctx context.Context, id string,
 	state_from, state_to string) error {
 
@@ -1274,22 +2157,83 @@ func (db *DataStoreMongo) UpdateStats(ctx context.Context, id string,
 	session := db.session.Copy()
 	defer session.Close()
 
+	c := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeployments)
+
 	// note dot notation on embedded document
-	update := bson.M{
-		"$inc": bson.M{
-			"stats." + state_from: -1,
-			"stats." + state_to:   1,
-		},
+	inc := bson.M{
+		"stats." + state_from: -1,
+		"stats." + state_to:   1,
 	}
 
-	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDeployments).UpdateId(id, update)
+	if !isActiveStatus(state_from) || isActiveStatus(state_to) {
+		err := c.UpdateId(id, bson.M{"$inc": inc})
+		if err == mgo.ErrNotFound {
+			return ErrStorageInvalidID
+		}
+		return err
+	}
 
-	if err == mgo.ErrNotFound {
-		return ErrStorageInvalidID
+	// The update may complete the deployment, i.e. the device was the last
+	// one in an active state. The finish time is then set in the same
+	// write, so that the stats and the finished field are always in sync and
+	// exactly one of concurrent updates finishes the deployment. Each attempt
+	// matches either completing or non-completing state of the counters; if
+	// none matches, the counters changed in the meantime and we retry.
+	completing := bson.M{
+		buildStatusKey(state_from): 1,
+	}
+	for _, status := range model.ActiveDeploymentStatuses() {
+		if status != state_from {
+			completing[buildStatusKey(status)] = bson.M{
+				"$in": []interface{}{0, nil},
+			}
+		}
 	}
 
-	return err
+	for i := 0; i < updateStatsMaxAttempts; i++ {
+		err := c.Update(bson.M{
+			"_id":  id,
+			"$and": []bson.M{completing},
+		}, bson.M{
+			"$inc": inc,
+			"$set": bson.M{
+				StorageKeyDeploymentFinished: time.Now(),
+			},
+		})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+
+		err = c.Update(bson.M{
+			"_id":  id,
+			"$nor": []bson.M{completing},
+		}, bson.M{
+			"$inc": inc,
+		})
+		if err != mgo.ErrNotFound {
+			return err
+		}
+
+		count, err := c.FindId(id).Count()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrStorageInvalidID
+		}
+	}
+
+	return ErrStorageConflict
+}
+
+func isActiveStatus(status string) bool {
+	for _, s := range model.ActiveDeploymentStatuses() {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
 
 func buildStatusKey(status string) string {
@@ -1390,24 +2334,51 @@ func buildStatusQuery(status model.StatusQuery) bson.M {
 		{
 			stq = bson.M{StorageKeyDeploymentFinished: notNull}
 		}
+	case model.StatusQueryAborted:
+		{
+			// any of the devices was aborted
+			stq = bson.M{
+				buildStatusKey(model.DeviceDeploymentStatusAborted): gt0,
+			}
+		}
 	}
 
 	return stq
 }
 
+// buildTimeRangeQuery returns the condition on a timestamp within the
+// range, nil if the range is not limited.
+func buildTimeRangeQuery(after, before *time.Time) bson.M {
+	if after == nil && before == nil {
+		return nil
+	}
+	q := bson.M{}
+	if after != nil {
+		q["$gte"] = after
+	}
+	if before != nil {
+		q["$lte"] = before
+	}
+	return q
+}
+
+// Find returns the page of the deployments matching the query along with the
+// total number of the matching ones.
 func (db *DataStoreMongo) Find(ctx context.Context,
-	match model.Query) ([]*model.Deployment, error) {
+	match model.Query) ([]*model.Deployment, int, error) {
 
 	session := db.session.Copy()
 	defer session.Close()
 
+	database := session.DB(mstore.DbFromContext(ctx, DatabaseName))
+
 	andq := []bson.M{}
 
 	// build deployment by name part of the query
 	if match.SearchText != "" {
 		// we must have indexing for text search
 		if !db.hasIndexing(ctx, session) {
-			return nil, ErrDeploymentStorageCannotExecQuery
+			return nil, 0, ErrDeploymentStorageCannotExecQuery
 		}
 
 		tq := bson.M{
@@ -1425,6 +2396,22 @@ func (db *DataStoreMongo) Find(ctx context.Context,
 		andq = append(andq, stq)
 	}
 
+	// the devices are not stored in the deployment; look up the
+	// deployments from the device deployments instead
+	if match.DeviceID != "" {
+		var ids []string
+		err := database.C(CollectionDevices).Find(bson.M{
+			StorageKeyDeviceDeploymentDeviceId: match.DeviceID,
+		}).Distinct(StorageKeyDeviceDeploymentDeploymentID, &ids)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(ids) == 0 {
+			return []*model.Deployment{}, 0, nil
+		}
+		andq = append(andq, bson.M{"_id": bson.M{"$in": ids}})
+	}
+
 	query := bson.M{}
 	if len(andq) != 0 {
 		// use search criteria if any
@@ -1433,33 +2420,112 @@ func (db *DataStoreMongo) Find(ctx context.Context,
 		}
 	}
 
-	if match.CreatedAfter != nil && match.CreatedBefore != nil {
-		query["created"] = bson.M{
-			"$gte": match.CreatedAfter,
-			"$lte": match.CreatedBefore,
-		}
-	} else if match.CreatedAfter != nil {
-		query["created"] = bson.M{
-			"$gte": match.CreatedAfter,
+	if match.ArtifactName != "" {
+		query[StorageKeyDeploymentArtifactName] = match.ArtifactName
+	}
+	if q := buildTimeRangeQuery(match.CreatedAfter, match.CreatedBefore); q != nil {
+		query[StorageKeyDeploymentCreated] = q
+	}
+	if q := buildTimeRangeQuery(match.FinishedAfter, match.FinishedBefore); q != nil {
+		query[StorageKeyDeploymentFinished] = q
+	}
+
+	sortBy := "-" + StorageKeyDeploymentCreated
+	if match.SortBy != "" {
+		sortBy = StorageKeyDeploymentCreated
+		if match.SortBy == model.DeploymentsSortFinished {
+			sortBy = StorageKeyDeploymentFinished
 		}
-	} else if match.CreatedBefore != nil {
-		query["created"] = bson.M{
-			"$lte": match.CreatedBefore,
+		if match.SortDescending {
+			sortBy = "-" + sortBy
 		}
 	}
 
+	c := database.C(CollectionDeployments)
+
+	total, err := c.Find(&query).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var deployment []*model.Deployment
-	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
-		C(CollectionDeployments).
-		Find(&query).Sort("-created").
+	err = c.Find(&query).Sort(sortBy).
 		Skip(match.Skip).Limit(match.Limit).
 		All(&deployment)
 
 	if err != nil {
+		return nil, 0, err
+	}
+
+	return deployment, total, nil
+}
+
+// FindFinishedBefore returns up to limit deployments finished, and restored
+// if ever, before the given time, oldest first, skipping those claimed for
+// archival.
+func (db *DataStoreMongo) FindFinishedBefore(ctx context.Context,
+	before time.Time, limit int) ([]*model.Deployment, error) {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	query := bson.M{
+		StorageKeyDeploymentFinished: bson.M{
+			"$lt": before,
+		},
+		// also matches deployments never claimed
+		StorageKeyDeploymentArchiving: bson.M{
+			"$not": bson.M{"$gte": time.Now()},
+		},
+		// also matches deployments never restored
+		StorageKeyDeploymentRestored: bson.M{
+			"$not": bson.M{"$gte": before},
+		},
+	}
+
+	var deployments []*model.Deployment
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeployments).
+		Find(query).Sort(StorageKeyDeploymentFinished).
+		Limit(limit).
+		All(&deployments); err != nil {
 		return nil, err
 	}
 
-	return deployment, nil
+	return deployments, nil
+}
+
+// ClaimDeploymentArchival claims the deployment for archival until the given
+// time, unless claimed by another instance of the service already. Returns
+// whether the deployment was claimed.
+func (db *DataStoreMongo) ClaimDeploymentArchival(ctx context.Context,
+	id string, until time.Time) (bool, error) {
+
+	if govalidator.IsNull(id) {
+		return false, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeployments).Update(bson.M{
+		"_id": id,
+		StorageKeyDeploymentArchiving: bson.M{
+			"$not": bson.M{"$gte": time.Now()},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			StorageKeyDeploymentArchiving: until,
+		},
+	})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 func (db *DataStoreMongo) Finish(ctx context.Context, id string, when time.Time) error {
@@ -1540,3 +2606,174 @@ func (db *DataStoreMongo) ExistByArtifactId(ctx context.Context,
 
 	return true, nil
 }
+
+// archived deployments
+
+// SaveArchivedDeployment stores the archived deployment, replacing the
+// previous version, if any.
+func (db *DataStoreMongo) SaveArchivedDeployment(ctx context.Context,
+	archived *model.ArchivedDeployment) error {
+
+	if archived == nil || govalidator.IsNull(archived.Id) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionArchivedDeployments).UpsertId(archived.Id, archived)
+
+	return err
+}
+
+// FindArchivedDeployments lists archived deployments, most recently finished
+// first.
+func (db *DataStoreMongo) FindArchivedDeployments(ctx context.Context,
+	skip, limit int) ([]model.ArchivedDeployment, error) {
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	archived := []model.ArchivedDeployment{}
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionArchivedDeployments).
+		Find(nil).Sort("-" + StorageKeyArchivedDeploymentFinished).
+		Skip(skip).Limit(limit).
+		All(&archived); err != nil {
+		return nil, err
+	}
+
+	return archived, nil
+}
+
+// FindArchivedDeploymentByID returns the archived deployment or nil if not
+// found.
+func (db *DataStoreMongo) FindArchivedDeploymentByID(ctx context.Context,
+	id string) (*model.ArchivedDeployment, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	var archived model.ArchivedDeployment
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionArchivedDeployments).FindId(id).One(&archived); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &archived, nil
+}
+
+// DeleteArchivedDeployment removes the archived deployment.
+// Noop on ID not found
+func (db *DataStoreMongo) DeleteArchivedDeployment(ctx context.Context, id string) error {
+
+	if govalidator.IsNull(id) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionArchivedDeployments).RemoveId(id); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// gateways
+
+// SetGatewayDevices replaces the list of devices the gateway is allowed to
+// report for.
+func (db *DataStoreMongo) SetGatewayDevices(ctx context.Context,
+	gatewayID string, devices model.GatewayDevices) error {
+
+	if govalidator.IsNull(gatewayID) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionGateways).UpsertId(gatewayID, devices)
+	return err
+}
+
+// GetGatewayDevices returns the devices the gateway is allowed to report
+// for, nil if none were ever set.
+func (db *DataStoreMongo) GetGatewayDevices(ctx context.Context,
+	gatewayID string) (*model.GatewayDevices, error) {
+
+	if govalidator.IsNull(gatewayID) {
+		return nil, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	var devices model.GatewayDevices
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionGateways).FindId(gatewayID).One(&devices); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &devices, nil
+}
+
+// maintenance windows
+
+// SetMaintenanceWindows replaces the maintenance windows of ID `id`.
+func (db *DataStoreMongo) SetMaintenanceWindows(ctx context.Context,
+	id string, windows model.MaintenanceWindows) error {
+
+	if govalidator.IsNull(id) {
+		return ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	_, err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionMaintenanceWindows).UpsertId(id, windows)
+	return err
+}
+
+// GetMaintenanceWindows returns the maintenance windows of ID `id`, nil if
+// none were ever set.
+func (db *DataStoreMongo) GetMaintenanceWindows(ctx context.Context,
+	id string) (*model.MaintenanceWindows, error) {
+
+	if govalidator.IsNull(id) {
+		return nil, ErrStorageInvalidID
+	}
+
+	session := db.session.Copy()
+	defer session.Close()
+
+	var windows model.MaintenanceWindows
+	if err := session.DB(mstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionMaintenanceWindows).FindId(id).One(&windows); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &windows, nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -862,6 +863,61 @@ func TestDeploymentStorageUpdateStats(t *testing.T) {
 	}
 }
 
+func TestDeploymentStorageUpdateStatsConcurrent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestDeploymentStorageUpdateStatsConcurrent in short mode.")
+	}
+
+	const devices = 50
+
+	db.Wipe()
+	session := db.Session()
+	defer session.Close()
+	store := NewDataStoreMongoWithSession(session)
+
+	ctx := context.Background()
+
+	deployment, err := model.NewDeploymentFromConstructor(&model.DeploymentConstructor{
+		Name:         StringToPointer("foo"),
+		ArtifactName: StringToPointer("bar"),
+		Devices:      []string{"baz"},
+	})
+	assert.NoError(t, err)
+	deployment.Stats[model.DeviceDeploymentStatusPending] = devices
+	assert.NoError(t, store.InsertDeployment(ctx, deployment))
+
+	// move all devices through active states concurrently; the deployment
+	// must be finished exactly once, by the last update
+	var wg sync.WaitGroup
+	for i := 0; i < devices; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			transitions := [][2]string{
+				{model.DeviceDeploymentStatusPending, model.DeviceDeploymentStatusDownloading},
+				{model.DeviceDeploymentStatusDownloading, model.DeviceDeploymentStatusInstalling},
+				{model.DeviceDeploymentStatusInstalling, model.DeviceDeploymentStatusSuccess},
+			}
+			if i%2 == 0 {
+				transitions[2][1] = model.DeviceDeploymentStatusFailure
+			}
+			for _, tr := range transitions {
+				assert.NoError(t, store.UpdateStats(ctx, *deployment.Id, tr[0], tr[1]))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	found, err := store.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, found.Finished)
+	assert.Equal(t, 0, found.Stats[model.DeviceDeploymentStatusPending])
+	assert.Equal(t, 0, found.Stats[model.DeviceDeploymentStatusDownloading])
+	assert.Equal(t, 0, found.Stats[model.DeviceDeploymentStatusInstalling])
+	assert.Equal(t, devices/2, found.Stats[model.DeviceDeploymentStatusSuccess])
+	assert.Equal(t, devices/2, found.Stats[model.DeviceDeploymentStatusFailure])
+}
+
 func TestDeploymentStorageUpdateStatsAndFinishDeployment(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping TestDeploymentStorageUpdateStatsAndFinishDeployment in short mode.")
@@ -1410,7 +1466,7 @@ func TestDeploymentStorageFindBy(t *testing.T) {
 				createdTime = createdTime.Add(time.Minute)
 			}
 
-			deps, err := store.Find(ctx,
+			deps, _, err := store.Find(ctx,
 				testCase.InputModelQuery)
 
 			if testCase.OutputError != nil {
@@ -1434,7 +1490,7 @@ func TestDeploymentStorageFindBy(t *testing.T) {
 				}
 
 				// output result should be stable
-				otherDeps, _ := store.Find(ctx,
+				otherDeps, _, _ := store.Find(ctx,
 					testCase.InputModelQuery)
 				assert.Equal(t, deps, otherDeps)
 
@@ -1459,7 +1515,7 @@ func TestDeploymentStorageFindBy(t *testing.T) {
 				// tenant is set, so only tenant's DB was set
 				// up, verify that we cannot find anything in
 				// default DB
-				deps, err := store.Find(context.Background(),
+				deps, _, err := store.Find(context.Background(),
 					testCase.InputModelQuery)
 				assert.Len(t, deps, 0)
 				assert.NoError(t, err)
@@ -1683,7 +1739,7 @@ func TestDeploymentFiltering(t *testing.T) {
 				assert.NoError(t, err)
 			}
 
-			deps, err := store.Find(ctx, *tc.InputQuery)
+			deps, _, err := store.Find(ctx, *tc.InputQuery)
 			assert.NoError(t, err)
 			assert.Len(t, deps, tc.returnsResult)
 		})
@@ -293,3 +293,184 @@ func TestGetDeviceDeploymentLog(t *testing.T) {
 
 	db.Wipe()
 }
+
+func TestSaveDeviceDeploymentLogObject(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestSaveDeviceDeploymentLogObject in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	// Make sure we start test with empty database
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	err := store.SaveDeviceDeploymentLogObject(ctx, "123", deploymentID, "")
+	assert.EqualError(t, err, ErrStorageInvalidInput.Error())
+
+	// replaces the messages stored in the database
+	assert.NoError(t, store.SaveDeviceDeploymentLog(ctx, model.DeploymentLog{
+		DeviceID:     "123",
+		DeploymentID: deploymentID,
+		Messages: []model.LogMessage{
+			{
+				Level:     "notice",
+				Message:   "foo",
+				Timestamp: parseTime(t, "2006-01-02T15:04:05-07:00"),
+			},
+		},
+	}))
+	assert.NoError(t, store.SaveDeviceDeploymentLogObject(ctx,
+		"123", deploymentID, "logs/123.json.gz"))
+
+	dlog, err := store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Equal(t, "logs/123.json.gz", dlog.ObjectID)
+		assert.Empty(t, dlog.Messages)
+	}
+
+	// and is replaced by messages saved afterwards
+	assert.NoError(t, store.SaveDeviceDeploymentLog(ctx, model.DeploymentLog{
+		DeviceID:     "123",
+		DeploymentID: deploymentID,
+		Messages: []model.LogMessage{
+			{
+				Level:     "notice",
+				Message:   "bar",
+				Timestamp: parseTime(t, "2006-01-02T15:05:05-07:00"),
+			},
+		},
+	}))
+
+	dlog, err = store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Empty(t, dlog.ObjectID)
+		if assert.Len(t, dlog.Messages, 1) {
+			assert.Equal(t, "bar", dlog.Messages[0].Message)
+		}
+	}
+}
+
+func TestSaveDeviceDeploymentLogChunksPrefix(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestSaveDeviceDeploymentLogChunksPrefix in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	// Make sure we start test with empty database
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	err := store.SaveDeviceDeploymentLogChunksPrefix(ctx, "123", deploymentID, "")
+	assert.EqualError(t, err, ErrStorageInvalidInput.Error())
+
+	// kept along with the object of the log
+	assert.NoError(t, store.SaveDeviceDeploymentLogObject(ctx,
+		"123", deploymentID, "logs/123.json.gz"))
+	assert.NoError(t, store.SaveDeviceDeploymentLogChunksPrefix(ctx,
+		"123", deploymentID, "logs/123/"))
+
+	dlog, err := store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Equal(t, "logs/123.json.gz", dlog.ObjectID)
+		assert.Equal(t, "logs/123/", dlog.ChunksPrefix)
+	}
+
+	// and removed when the log is replaced
+	assert.NoError(t, store.SaveDeviceDeploymentLogObject(ctx,
+		"123", deploymentID, "logs/123.json.gz"))
+
+	dlog, err = store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Empty(t, dlog.ChunksPrefix)
+	}
+}
+
+func TestAppendDeviceDeploymentLog(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestAppendDeviceDeploymentLog in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	chunk := func(sequence uint64, message string) model.LogChunk {
+		return model.LogChunk{
+			Sequence: sequence,
+			Messages: []model.LogMessage{
+				{
+					Level:     "notice",
+					Message:   message,
+					Timestamp: parseTime(t, "2006-01-02T15:04:05-07:00"),
+				},
+			},
+		}
+	}
+
+	// Make sure we start test with empty database
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	err := store.AppendDeviceDeploymentLog(ctx, "", deploymentID, chunk(0, "foo"))
+	assert.EqualError(t, err, ErrStorageInvalidInput.Error())
+	err = store.AppendDeviceDeploymentLog(ctx, "123", deploymentID,
+		model.LogChunk{Sequence: 0})
+	assert.EqualError(t, err, "no messages: invalid log chunk")
+
+	assert.NoError(t, store.AppendDeviceDeploymentLog(ctx,
+		"123", deploymentID, chunk(1, "bar")))
+	assert.NoError(t, store.AppendDeviceDeploymentLog(ctx,
+		"123", deploymentID, chunk(0, "foo")))
+	// duplicate
+	assert.NoError(t, store.AppendDeviceDeploymentLog(ctx,
+		"123", deploymentID, chunk(1, "baz")))
+
+	count, err := session.DB(ctxstore.DbFromContext(ctx, DatabaseName)).
+		C(CollectionDeviceDeploymentLogs).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	dlog, err := store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) && assert.Len(t, dlog.Chunks, 2) {
+		assert.Empty(t, dlog.Messages)
+		assert.Equal(t, uint64(1), dlog.Chunks[0].Sequence)
+		assert.Equal(t, "bar", dlog.Chunks[0].Messages[0].Message)
+		assert.Equal(t, uint64(0), dlog.Chunks[1].Sequence)
+	}
+
+	// saving the complete log drops the chunks
+	assert.NoError(t, store.SaveDeviceDeploymentLog(ctx, model.DeploymentLog{
+		DeviceID:     "123",
+		DeploymentID: deploymentID,
+		Messages:     chunk(0, "foo").Messages,
+	}))
+	dlog, err = store.GetDeviceDeploymentLog(ctx, "123", deploymentID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dlog) {
+		assert.Empty(t, dlog.Chunks)
+		assert.Len(t, dlog.Messages, 1)
+	}
+}
@@ -342,6 +342,163 @@ func TestUpdateDeviceDeploymentStatus(t *testing.T) {
 	}
 }
 
+func TestUpdateDeviceDeploymentStatusFinal(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestUpdateDeviceDeploymentStatusFinal in short mode.")
+	}
+
+	for _, status := range []string{
+		model.DeviceDeploymentStatusAborted,
+		model.DeviceDeploymentStatusDecommissioned,
+	} {
+		t.Run(status, func(t *testing.T) {
+			db.Wipe()
+
+			session := db.Session()
+			defer session.Close()
+
+			store := NewDataStoreMongoWithSession(session)
+			ctx := context.Background()
+
+			dd, err := model.NewDeviceDeployment("foo",
+				"30b3e62c-9ec2-4312-a7fa-cff24cc7397a")
+			assert.NoError(t, err)
+			dd.Status = &status
+			assert.NoError(t, store.InsertMany(ctx, dd))
+
+			// status of aborted or decommissioned device deployment
+			// must not be overwritten by a late device report
+			_, err = store.UpdateDeviceDeploymentStatus(ctx,
+				"foo", "30b3e62c-9ec2-4312-a7fa-cff24cc7397a",
+				model.DeviceDeploymentStatus{
+					Status: model.DeviceDeploymentStatusSuccess,
+				})
+			assert.EqualError(t, err, ErrStorageNotFound.Error())
+
+			current, err := store.GetDeviceDeploymentStatus(ctx,
+				"30b3e62c-9ec2-4312-a7fa-cff24cc7397a", "foo")
+			assert.NoError(t, err)
+			assert.Equal(t, status, current)
+		})
+	}
+}
+
+func TestUpdateDeviceDeploymentStatusPrevious(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestUpdateDeviceDeploymentStatusPrevious in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	dd, err := model.NewDeviceDeployment("foo", deploymentID)
+	assert.NoError(t, err)
+	status := model.DeviceDeploymentStatusSuccess
+	dd.Status = &status
+	assert.NoError(t, store.InsertMany(ctx, dd))
+
+	// the status changed since the device deployment was read
+	_, err = store.UpdateDeviceDeploymentStatus(ctx, "foo", deploymentID,
+		model.DeviceDeploymentStatus{
+			Status:         model.DeviceDeploymentStatusInstalling,
+			PreviousStatus: model.DeviceDeploymentStatusDownloading,
+			Timestamp:      time.Now(),
+		})
+	assert.EqualError(t, err, ErrStorageNotFound.Error())
+
+	found, err := store.GetDeviceDeployment(ctx, deploymentID, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, status, *found.Status)
+		assert.Empty(t, found.Transitions)
+	}
+
+	now := time.Now().UTC().Round(time.Millisecond)
+	old, err := store.UpdateDeviceDeploymentStatus(ctx, "foo", deploymentID,
+		model.DeviceDeploymentStatus{
+			Status:         model.DeviceDeploymentStatusFailure,
+			PreviousStatus: model.DeviceDeploymentStatusSuccess,
+			Timestamp:      now,
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, status, old)
+
+	// the transition is recorded along with the status
+	found, err = store.GetDeviceDeployment(ctx, deploymentID, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, found) {
+		assert.Equal(t, model.DeviceDeploymentStatusFailure, *found.Status)
+		if assert.Len(t, found.Transitions, 1) {
+			assert.Equal(t, model.DeviceDeploymentStatusSuccess,
+				found.Transitions[0].From)
+			assert.Equal(t, model.DeviceDeploymentStatusFailure,
+				found.Transitions[0].To)
+			assert.True(t, now.Equal(found.Transitions[0].Timestamp))
+		}
+	}
+
+	found, err = store.GetDeviceDeployment(ctx, deploymentID, "bar")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestDeviceDeploymentTransitions(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestDeviceDeploymentTransitions in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	for _, device := range []string{"foo", "bar"} {
+		dd, err := model.NewDeviceDeployment(device, deploymentID)
+		assert.NoError(t, err)
+		assert.NoError(t, store.InsertMany(ctx, dd))
+	}
+
+	// only the latest transitions are kept
+	now := time.Now().Round(time.Millisecond)
+	for i := 0; i < model.MaxDeviceDeploymentTransitions+1; i++ {
+		assert.NoError(t, store.AddDeviceDeploymentTransition(ctx, "foo",
+			deploymentID, model.DeviceDeploymentTransition{
+				From:      model.DeviceDeploymentStatusRebooting,
+				To:        model.DeviceDeploymentStatusRebooting,
+				Timestamp: now.Add(time.Duration(i) * time.Second),
+			}))
+	}
+	dd, err := store.GetDeviceDeployment(ctx, deploymentID, "foo")
+	assert.NoError(t, err)
+	if assert.Len(t, dd.Transitions, model.MaxDeviceDeploymentTransitions) {
+		assert.True(t, now.Add(time.Second).Equal(dd.Transitions[0].Timestamp))
+	}
+
+	assert.Equal(t, ErrStorageNotFound, store.AddDeviceDeploymentTransition(ctx,
+		"baz", deploymentID, model.DeviceDeploymentTransition{}))
+
+	assert.NoError(t, store.AbortDeviceDeployments(ctx, deploymentID))
+	dd, err = store.GetDeviceDeployment(ctx, deploymentID, "bar")
+	assert.NoError(t, err)
+	if assert.Len(t, dd.Transitions, 1) {
+		assert.Equal(t, model.DeviceDeploymentStatusPending, dd.Transitions[0].From)
+		assert.Equal(t, model.DeviceDeploymentStatusAborted, dd.Transitions[0].To)
+	}
+}
+
 func TestUpdateDeviceDeploymentLogAvailability(t *testing.T) {
 
 	if testing.Short() {
@@ -466,6 +623,42 @@ func newDeviceDeploymentWithStatus(t *testing.T, deviceID string, deploymentID s
 	return d
 }
 
+func TestAssignArtifact(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestAssignArtifact in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	db.Wipe()
+	session := db.Session()
+	defer session.Close()
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	assert.Equal(t, ErrStorageInvalidID,
+		store.AssignArtifact(ctx, "", deploymentID, nil, "foo"))
+	assert.Equal(t, ErrStorageNotFound,
+		store.AssignArtifact(ctx, "456", deploymentID, nil, "foo"))
+
+	dd, err := model.NewDeviceDeployment("456", deploymentID)
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertMany(ctx, dd))
+
+	image := model.NewSoftwareImage("", &model.SoftwareImageMetaConstructor{},
+		&model.SoftwareImageMetaArtifactConstructor{Name: "bar"}, 0)
+	assert.NoError(t, store.AssignArtifact(ctx, "456", deploymentID, image,
+		"foo"))
+
+	dd, err = store.GetDeviceDeployment(ctx, deploymentID, "456")
+	assert.NoError(t, err)
+	if assert.NotNil(t, dd) {
+		assert.Equal(t, "bar", dd.Image.Name)
+		assert.Equal(t, pointers.StringToPointer("foo"), dd.DeviceType)
+	}
+}
+
 func TestAggregateDeviceDeploymentByStatus(t *testing.T) {
 
 	if testing.Short() {
@@ -584,6 +777,99 @@ func TestAggregateDeviceDeploymentByStatus(t *testing.T) {
 	}
 }
 
+func TestAggregateDeviceDeploymentProgress(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestAggregateDeviceDeploymentProgress in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	// Make sure we start test with empty database
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+	store := NewDataStoreMongoWithSession(session)
+
+	ctx := context.Background()
+
+	progress, err := store.AggregateDeviceDeploymentProgress(ctx, deploymentID)
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	err = store.InsertMany(ctx,
+		newDeviceDeploymentWithStatus(t, "a", deploymentID,
+			model.DeviceDeploymentStatusPending),
+		newDeviceDeploymentWithStatus(t, "b", deploymentID,
+			model.DeviceDeploymentStatusPending),
+		newDeviceDeploymentWithStatus(t, "c", deploymentID,
+			model.DeviceDeploymentStatusPending),
+	)
+	assert.NoError(t, err)
+
+	int64Ptr := func(v int64) *int64 { return &v }
+	intPtr := func(v int) *int { return &v }
+	reports := []struct {
+		device string
+		status model.DeviceDeploymentStatus
+	}{
+		{"a", model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusDownloading,
+			Progress: &model.DeviceDeploymentProgress{
+				BytesDownloaded: int64Ptr(10),
+				BytesTotal:      int64Ptr(100),
+				Percent:         intPtr(10),
+			},
+		}},
+		{"b", model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusInstalling,
+			Progress: &model.DeviceDeploymentProgress{
+				Percent: intPtr(30),
+			},
+		}},
+		{"c", model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusDownloading,
+			Progress: &model.DeviceDeploymentProgress{
+				BytesDownloaded: int64Ptr(10),
+			},
+		}},
+		// progress is cleared by a report without it
+		{"c", model.DeviceDeploymentStatus{
+			Status: model.DeviceDeploymentStatusRebooting,
+		}},
+	}
+	for _, r := range reports {
+		_, err := store.UpdateDeviceDeploymentStatus(ctx, r.device,
+			deploymentID, r.status)
+		assert.NoError(t, err)
+	}
+
+	statuses, _, err := store.GetDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: deploymentID})
+	assert.NoError(t, err)
+	for _, dd := range statuses {
+		switch *dd.DeviceId {
+		case "a":
+			assert.Equal(t, reports[0].status.Progress, dd.Progress)
+		case "b":
+			assert.Equal(t, reports[1].status.Progress, dd.Progress)
+		default:
+			assert.Nil(t, dd.Progress)
+		}
+	}
+
+	progress, err = store.AggregateDeviceDeploymentProgress(ctx, deploymentID)
+	assert.NoError(t, err)
+	percent := float64(20)
+	assert.Equal(t, &model.DeploymentProgress{
+		Devices:         2,
+		BytesDownloaded: 10,
+		BytesTotal:      100,
+		Percent:         &percent,
+	}, progress)
+}
+
 func TestGetDeviceStatusesForDeployment(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping GetDeviceStatusesForDeployment in short mode.")
@@ -653,8 +939,8 @@ func TestGetDeviceStatusesForDeployment(t *testing.T) {
 			err := store.InsertMany(ctx, input...)
 			assert.NoError(t, err)
 
-			statuses, err := store.GetDeviceStatusesForDeployment(ctx,
-				tc.inputDeploymentId)
+			statuses, _, err := store.GetDeviceStatusesForDeployment(ctx,
+				model.DeviceDeploymentsQuery{DeploymentID: tc.inputDeploymentId})
 			assert.NoError(t, err)
 
 			assert.Equal(t, len(tc.outputStatuses), len(statuses))
@@ -667,8 +953,8 @@ func TestGetDeviceStatusesForDeployment(t *testing.T) {
 				// deployment statuses are present in tenant's
 				// DB, verify that listing from default DB
 				// yields empty list
-				statuses, err := store.GetDeviceStatusesForDeployment(context.Background(),
-					tc.inputDeploymentId)
+				statuses, _, err := store.GetDeviceStatusesForDeployment(context.Background(),
+					model.DeviceDeploymentsQuery{DeploymentID: tc.inputDeploymentId})
 				assert.NoError(t, err)
 				assert.Len(t, statuses, 0)
 			}
@@ -678,6 +964,251 @@ func TestGetDeviceStatusesForDeployment(t *testing.T) {
 	}
 }
 
+func TestGetDeviceStatusesForDeploymentQuery(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestGetDeviceStatusesForDeploymentQuery in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	created := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	for i, device := range []string{"d1", "d2", "d3", "d4"} {
+		dd, err := model.NewDeviceDeployment(device, deploymentID)
+		assert.NoError(t, err)
+		// d1 and d2 are created at the same time
+		deviceCreated := created.Add(time.Duration(i/2) * time.Minute)
+		dd.Created = &deviceCreated
+		dd.DeviceType = pointers.StringToPointer("foo")
+		if i%2 == 1 {
+			finished := created.Add(time.Duration(10-i) * time.Minute)
+			dd.Finished = &finished
+			dd.Status = pointers.StringToPointer(model.DeviceDeploymentStatusFailure)
+			dd.IsLogAvailable = true
+		}
+		assert.NoError(t, store.InsertMany(ctx, dd))
+	}
+	other, err := model.NewDeviceDeployment("d1",
+		"1d1ce8bc-6c53-4c42-8a76-5c6b3a4f6d2e")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertMany(ctx, other))
+
+	withLog := true
+	testCases := map[string]struct {
+		query model.DeviceDeploymentsQuery
+
+		devices []string
+		total   int
+	}{
+		"all, by creation": {
+			query:   model.DeviceDeploymentsQuery{},
+			devices: []string{"d1", "d2", "d3", "d4"},
+			total:   4,
+		},
+		"page": {
+			query:   model.DeviceDeploymentsQuery{Skip: 1, Limit: 2},
+			devices: []string{"d2", "d3"},
+			total:   4,
+		},
+		"past the last page": {
+			query:   model.DeviceDeploymentsQuery{Skip: 4, Limit: 2},
+			devices: []string{},
+			total:   4,
+		},
+		"by creation, descending": {
+			query:   model.DeviceDeploymentsQuery{SortDescending: true},
+			devices: []string{"d4", "d3", "d2", "d1"},
+			total:   4,
+		},
+		"by finish, unfinished first": {
+			query: model.DeviceDeploymentsQuery{
+				SortBy: model.DeviceDeploymentsSortFinished,
+			},
+			devices: []string{"d1", "d3", "d4", "d2"},
+			total:   4,
+		},
+		"status": {
+			query: model.DeviceDeploymentsQuery{
+				Status: model.DeviceDeploymentStatusPending,
+			},
+			devices: []string{"d1", "d3"},
+			total:   2,
+		},
+		"log and device type": {
+			query: model.DeviceDeploymentsQuery{
+				IsLogAvailable: &withLog,
+				DeviceType:     "foo",
+				Limit:          1,
+			},
+			devices: []string{"d2"},
+			total:   2,
+		},
+		"other device type": {
+			query: model.DeviceDeploymentsQuery{
+				DeviceType: "bar",
+			},
+			devices: []string{},
+			total:   0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tc.query.DeploymentID = deploymentID
+			statuses, total, err := store.GetDeviceStatusesForDeployment(ctx,
+				tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.total, total)
+
+			devices := []string{}
+			for _, dd := range statuses {
+				devices = append(devices, *dd.DeviceId)
+			}
+			assert.Equal(t, tc.devices, devices)
+		})
+	}
+}
+
+func TestIterateDeviceStatusesForDeployment(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestIterateDeviceStatusesForDeployment in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	for _, device := range []string{"foo", "bar"} {
+		dd, err := model.NewDeviceDeployment(device, deploymentID)
+		assert.NoError(t, err)
+		assert.NoError(t, store.InsertMany(ctx, dd))
+	}
+	dd, err := model.NewDeviceDeployment("foo",
+		"1d1ce8bc-6c53-4c42-8a76-5c6b3a4f6d2e")
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertMany(ctx, dd))
+
+	assert.NoError(t, store.AddDeviceDeploymentTransition(ctx, "foo",
+		deploymentID, model.DeviceDeploymentTransition{
+			From: model.DeviceDeploymentStatusPending,
+			To:   model.DeviceDeploymentStatusDownloading,
+		}))
+
+	var devices []string
+	err = store.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: deploymentID},
+		func(dd *model.DeviceDeployment) error {
+			assert.Equal(t, deploymentID, *dd.DeploymentId)
+			assert.Nil(t, dd.Transitions)
+			devices = append(devices, *dd.DeviceId)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"foo", "bar"}, devices)
+
+	// filtered as requested
+	assert.NoError(t, store.UpdateDeviceDeploymentLogAvailability(ctx,
+		"bar", deploymentID, true))
+	devices = nil
+	isLogAvailable := true
+	err = store.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{
+			DeploymentID:   deploymentID,
+			IsLogAvailable: &isLogAvailable,
+		},
+		func(dd *model.DeviceDeployment) error {
+			devices = append(devices, *dd.DeviceId)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, devices)
+
+	calls := 0
+	err = store.IterateDeviceStatusesForDeployment(ctx,
+		model.DeviceDeploymentsQuery{DeploymentID: deploymentID},
+		func(dd *model.DeviceDeployment) error {
+			calls++
+			return errors.New("write failed")
+		})
+	assert.EqualError(t, err, "write failed")
+	assert.Equal(t, 1, calls)
+}
+
+func TestIterateDeviceDeploymentTransitions(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestIterateDeviceDeploymentTransitions in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+	for _, device := range []string{"foo", "bar"} {
+		dd, err := model.NewDeviceDeployment(device, deploymentID)
+		assert.NoError(t, err)
+		assert.NoError(t, store.InsertMany(ctx, dd))
+	}
+
+	assert.NoError(t, store.AddDeviceDeploymentTransition(ctx, "foo",
+		deploymentID, model.DeviceDeploymentTransition{
+			From: model.DeviceDeploymentStatusPending,
+			To:   model.DeviceDeploymentStatusDownloading,
+		}))
+
+	calls := 0
+	err := store.IterateDeviceDeploymentTransitions(ctx, deploymentID,
+		func(dd *model.DeviceDeployment) error {
+			calls++
+			// only what the timeline needs is read
+			assert.Nil(t, dd.DeviceId)
+			assert.Nil(t, dd.DeploymentId)
+			assert.NotNil(t, dd.Created)
+			if assert.NotNil(t, dd.Status) {
+				assert.Equal(t, model.DeviceDeploymentStatusPending, *dd.Status)
+			}
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	transitions := 0
+	err = store.IterateDeviceDeploymentTransitions(ctx, deploymentID,
+		func(dd *model.DeviceDeployment) error {
+			transitions += len(dd.Transitions)
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, transitions)
+
+	calls = 0
+	err = store.IterateDeviceDeploymentTransitions(ctx, deploymentID,
+		func(dd *model.DeviceDeployment) error {
+			calls++
+			return errors.New("write failed")
+		})
+	assert.EqualError(t, err, "write failed")
+	assert.Equal(t, 1, calls)
+}
+
 func TestHasDeploymentForDevice(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping GetDeviceStatusesForDeployment in short mode.")
@@ -1052,3 +1583,91 @@ func TestDecommissionDeviceDeployments(t *testing.T) {
 		})
 	}
 }
+
+func TestFindDeviceDeploymentHistory(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("skipping TestFindDeviceDeploymentHistory in short mode.")
+	}
+
+	db.Wipe()
+	session := db.Session()
+	defer session.Close()
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	after, before := base.Add(time.Minute), base.Add(90*time.Minute)
+	ids := []string{
+		"30b3e62c-9ec2-4312-a7fa-cff24cc7397a",
+		"9b4e6f8d-2d55-4d1c-a9a0-4a3c8c1b5f6e",
+		"4b9c7a0e-62a3-4fd2-8d0d-6e1f2cd4a8a1",
+	}
+	for i, id := range ids {
+		dd, err := model.NewDeviceDeployment("device", id)
+		assert.NoError(t, err)
+		created := base.Add(time.Duration(i) * time.Hour)
+		dd.Created = &created
+		if i < 2 {
+			dd.Status = pointers.StringToPointer(model.DeviceDeploymentStatusSuccess)
+		}
+		other, err := model.NewDeviceDeployment("other", id)
+		assert.NoError(t, err)
+		assert.NoError(t, store.InsertMany(ctx, dd, other))
+	}
+
+	testCases := map[string]struct {
+		query model.DeviceDeploymentHistoryQuery
+
+		deployments []string
+		err         error
+	}{
+		"all": {
+			query:       model.DeviceDeploymentHistoryQuery{DeviceID: "device"},
+			deployments: []string{ids[2], ids[1], ids[0]},
+		},
+		"status": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Status:   model.DeviceDeploymentStatusSuccess,
+			},
+			deployments: []string{ids[1], ids[0]},
+		},
+		"created range": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID:      "device",
+				CreatedAfter:  &after,
+				CreatedBefore: &before,
+			},
+			deployments: []string{ids[1]},
+		},
+		"skip, limit": {
+			query: model.DeviceDeploymentHistoryQuery{
+				DeviceID: "device",
+				Skip:     1,
+				Limit:    1,
+			},
+			deployments: []string{ids[1]},
+		},
+		"no device": {
+			err: ErrStorageInvalidID,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			found, err := store.FindDeviceDeploymentHistory(ctx, tc.query)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			deployments := []string{}
+			for _, dd := range found {
+				deployments = append(deployments, *dd.DeploymentId)
+			}
+			assert.Equal(t, tc.deployments, deployments)
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestGatewayDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestGatewayDevices in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	devices, err := db.GetGatewayDevices(ctx, "gateway")
+	assert.NoError(t, err)
+	assert.Nil(t, devices)
+
+	assert.NoError(t, db.SetGatewayDevices(ctx, "gateway",
+		model.GatewayDevices{Devices: []string{"a", "b"}}))
+	assert.NoError(t, db.SetGatewayDevices(ctx, "gateway",
+		model.GatewayDevices{Devices: []string{"b", "c"}}))
+
+	devices, err = db.GetGatewayDevices(ctx, "gateway")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.GatewayDevices{Devices: []string{"b", "c"}}, devices)
+
+	// gateways are kept per tenant
+	devices, err = db.GetGatewayDevices(context.Background(), "gateway")
+	assert.NoError(t, err)
+	assert.Nil(t, devices)
+
+	assert.Equal(t, ErrStorageInvalidID,
+		db.SetGatewayDevices(ctx, "", model.GatewayDevices{}))
+}
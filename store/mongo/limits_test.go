@@ -90,3 +90,25 @@ func TestGetLimit(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, lim3OtherTenant, *lim)
 }
+
+func TestUpsertLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestUpsertLimit in short mode.")
+	}
+
+	dbCtx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db := getDb(dbCtx)
+	defer db.session.Close()
+
+	assert.NoError(t, db.UpsertLimit(dbCtx, model.Limit{Name: "bar", Value: 1}))
+	assert.NoError(t, db.UpsertLimit(dbCtx, model.Limit{Name: "bar", Value: 2}))
+
+	lim, err := db.GetLimit(dbCtx, "bar")
+	assert.NoError(t, err)
+	assert.EqualValues(t, model.Limit{Name: "bar", Value: 2}, *lim)
+
+	_, err = db.GetLimit(context.Background(), "bar")
+	assert.EqualError(t, err, ErrLimitNotFound.Error())
+}
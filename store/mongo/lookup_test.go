@@ -0,0 +1,189 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestFindQuery(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindQuery in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	newDeployment := func(name, artifact string, created time.Time,
+		devices ...string) *model.Deployment {
+
+		deployment, err := model.NewDeploymentFromConstructor(
+			&model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &artifact,
+				Devices:      devices,
+			})
+		assert.NoError(t, err)
+		deployment.Created = &created
+		deployment.DeviceCount = len(devices)
+		return deployment
+	}
+
+	now := time.Now().UTC().Round(time.Millisecond)
+	earlier := now.Add(-time.Hour)
+	evenEarlier := now.Add(-2 * time.Hour)
+
+	pending := newDeployment("pending one", "app", now, "d1")
+	pending.Stats[model.DeviceDeploymentStatusPending] = 1
+
+	running := newDeployment("running", "other", earlier, "d1", "d2")
+	running.Stats[model.DeviceDeploymentStatusPending] = 1
+	running.Stats[model.DeviceDeploymentStatusSuccess] = 1
+
+	finished := newDeployment("finished", "app", evenEarlier, "d1")
+	finished.Stats[model.DeviceDeploymentStatusAborted] = 1
+	finished.Finished = &now
+
+	for _, d := range []*model.Deployment{finished, pending, running} {
+		assert.NoError(t, store.InsertDeployment(ctx, d))
+	}
+	dd, err := model.NewDeviceDeployment("d2", *running.Id)
+	assert.NoError(t, err)
+	assert.NoError(t, store.InsertMany(ctx, dd))
+
+	testCases := map[string]struct {
+		query model.Query
+		ids   []string
+		total int
+	}{
+		"all, newest first": {
+			ids:   []string{*pending.Id, *running.Id, *finished.Id},
+			total: 3,
+		},
+		"artifact name": {
+			query: model.Query{ArtifactName: "other"},
+			ids:   []string{*running.Id},
+			total: 1,
+		},
+		"device": {
+			query: model.Query{DeviceID: "d2"},
+			ids:   []string{*running.Id},
+			total: 1,
+		},
+		"unknown device": {
+			query: model.Query{DeviceID: "d3"},
+			ids:   []string{},
+			total: 0,
+		},
+		"aborted": {
+			query: model.Query{Status: model.StatusQueryAborted},
+			ids:   []string{*finished.Id},
+			total: 1,
+		},
+		"finished range": {
+			query: model.Query{FinishedAfter: &earlier},
+			ids:   []string{*finished.Id},
+			total: 1,
+		},
+		"oldest first": {
+			query: model.Query{SortBy: model.DeploymentsSortCreated},
+			ids:   []string{*finished.Id, *running.Id, *pending.Id},
+			total: 3,
+		},
+		"last finished first": {
+			query: model.Query{
+				SortBy:         model.DeploymentsSortFinished,
+				SortDescending: true,
+				Limit:          1,
+			},
+			ids:   []string{*finished.Id},
+			total: 3,
+		},
+		"skip and limit": {
+			query: model.Query{Skip: 1, Limit: 1},
+			ids:   []string{*running.Id},
+			total: 3,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			deployments, total, err := store.Find(ctx, tc.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.total, total)
+
+			ids := []string{}
+			for _, d := range deployments {
+				ids = append(ids, *d.Id)
+				// the device count is stored with the deployment
+				assert.NotZero(t, d.DeviceCount)
+			}
+			assert.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+func TestFindDeploymentsByIDs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindDeploymentsByIDs in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store := NewDataStoreMongoWithSession(session)
+	ctx := context.Background()
+
+	ids := []string{}
+	for _, name := range []string{"foo", "bar", "baz"} {
+		deployment, err := model.NewDeploymentFromConstructor(
+			&model.DeploymentConstructor{
+				Name:         &name,
+				ArtifactName: &name,
+				Devices:      []string{"d1"},
+			})
+		assert.NoError(t, err)
+		assert.NoError(t, store.InsertDeployment(ctx, deployment))
+		ids = append(ids, *deployment.Id)
+	}
+
+	found, err := store.FindDeploymentsByIDs(ctx, []string{
+		ids[0], ids[2], "9b4e6f8d-2d55-4d1c-a9a0-4a3c8c1b5f6e",
+	})
+	assert.NoError(t, err)
+	foundIDs := []string{}
+	for _, deployment := range found {
+		foundIDs = append(foundIDs, *deployment.Id)
+	}
+	assert.ElementsMatch(t, []string{ids[0], ids[2]}, foundIDs)
+
+	found, err = store.FindDeploymentsByIDs(ctx, []string{})
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
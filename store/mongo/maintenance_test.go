@@ -0,0 +1,65 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMaintenanceWindows in short mode.")
+	}
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	windows, err := db.GetMaintenanceWindows(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Nil(t, windows)
+
+	nightly := model.MaintenanceWindows{
+		Windows: []model.MaintenanceWindow{{
+			Start:    "02:00",
+			End:      "04:00",
+			TimeZone: "Europe/Oslo",
+			Weekdays: []string{"monday"},
+		}},
+	}
+	assert.NoError(t, db.SetMaintenanceWindows(ctx, "tenant",
+		model.MaintenanceWindows{Windows: []model.MaintenanceWindow{}}))
+	assert.NoError(t, db.SetMaintenanceWindows(ctx, "tenant", nightly))
+
+	windows, err = db.GetMaintenanceWindows(ctx, "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, &nightly, windows)
+
+	// windows are kept per tenant
+	windows, err = db.GetMaintenanceWindows(context.Background(), "tenant")
+	assert.NoError(t, err)
+	assert.Nil(t, windows)
+
+	assert.Equal(t, ErrStorageInvalidID,
+		db.SetMaintenanceWindows(ctx, "", model.MaintenanceWindows{}))
+}
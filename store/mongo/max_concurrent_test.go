@@ -0,0 +1,159 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestAdmitReleaseDeviceDeployment(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestAdmitReleaseDeviceDeployment in short mode.")
+	}
+
+	ctx := context.Background()
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:          &name,
+			ArtifactName:  &artifact,
+			Devices:       []string{"a", "b", "c"},
+			MaxConcurrent: 2,
+		})
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+	for _, device := range []string{"a", "b", "c"} {
+		dd, err := model.NewDeviceDeployment(device, *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+
+	admit := func(device string) bool {
+		admitted, err := db.AdmitDeviceDeployment(ctx, device,
+			*deployment.Id, deployment.MaxConcurrent)
+		assert.NoError(t, err)
+		return admitted
+	}
+
+	assert.True(t, admit("a"))
+	// each device takes a single slot
+	assert.False(t, admit("a"))
+	assert.True(t, admit("b"))
+	assert.False(t, admit("c"))
+
+	release := func(device string) bool {
+		released, err := db.ReleaseDeviceDeployment(ctx, device,
+			*deployment.Id)
+		assert.NoError(t, err)
+		return released
+	}
+
+	// devices not admitted hold no slot
+	assert.False(t, release("c"))
+	assert.False(t, admit("c"))
+
+	assert.True(t, release("a"))
+	assert.False(t, release("a"))
+	assert.True(t, admit("c"))
+
+	found, err := db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, found.AdmittedDevices)
+
+	dd, err := db.FindOldestDeploymentForDeviceIDWithStatuses(ctx, "c",
+		model.DeviceDeploymentStatusPending)
+	assert.NoError(t, err)
+	assert.True(t, dd.Admitted)
+
+	_, err = db.ReleaseDeviceDeployment(ctx, "", "")
+	assert.Equal(t, ErrStorageInvalidID, err)
+}
+
+func TestReleaseDeviceDeploymentsAdmittedBefore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestReleaseDeviceDeploymentsAdmittedBefore in short mode.")
+	}
+
+	ctx := context.Background()
+	db := getDb(ctx)
+	defer db.session.Close()
+
+	name, artifact := "foo", "bar"
+	deployment, err := model.NewDeploymentFromConstructor(
+		&model.DeploymentConstructor{
+			Name:          &name,
+			ArtifactName:  &artifact,
+			Devices:       []string{"a", "b", "c"},
+			MaxConcurrent: 2,
+		})
+	assert.NoError(t, err)
+	assert.NoError(t, db.InsertDeployment(ctx, deployment))
+	for _, device := range []string{"a", "b", "c"} {
+		dd, err := model.NewDeviceDeployment(device, *deployment.Id)
+		assert.NoError(t, err)
+		assert.NoError(t, db.InsertMany(ctx, dd))
+	}
+
+	admit := func(device string) bool {
+		admitted, err := db.AdmitDeviceDeployment(ctx, device,
+			*deployment.Id, deployment.MaxConcurrent)
+		assert.NoError(t, err)
+		return admitted
+	}
+
+	assert.True(t, admit("a"))
+	dd, err := db.FindOldestDeploymentForDeviceIDWithStatuses(ctx, "a",
+		model.DeviceDeploymentStatusPending)
+	assert.NoError(t, err)
+	if assert.NotNil(t, dd.AdmittedAt) {
+		assert.WithinDuration(t, time.Now(), *dd.AdmittedAt, time.Minute)
+	}
+	between := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, admit("b"))
+	assert.False(t, admit("c"))
+
+	released, err := db.ReleaseDeviceDeploymentsAdmittedBefore(ctx,
+		*deployment.Id, between)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.True(t, admit("c"))
+
+	released, err = db.ReleaseDeviceDeploymentsAdmittedBefore(ctx,
+		*deployment.Id, between)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	released, err = db.ReleaseDeviceDeploymentsAdmittedBefore(ctx,
+		*deployment.Id, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, released)
+
+	found, err := db.FindDeploymentByID(ctx, *deployment.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, found.AdmittedDevices)
+
+	_, err = db.ReleaseDeviceDeploymentsAdmittedBefore(ctx, "", time.Now())
+	assert.Equal(t, ErrStorageInvalidID, err)
+}
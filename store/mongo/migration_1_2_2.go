@@ -0,0 +1,87 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+type migration_1_2_2 struct {
+	session *mgo.Session
+	db      string
+}
+
+// DeviceDeploymentIndexes lists the indexes of the 'devices' collection, one
+// for each of the query shapes:
+//   - device's deployments by status, oldest first (devices/next polling,
+//     decommissioning)
+//   - single device deployment by deployment and device (status reports, logs)
+//   - device deployments of a deployment by status (stats, abort)
+//   - device deployments with assigned artifact by status (artifact removal)
+var DeviceDeploymentIndexes = []mgo.Index{
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentDeviceId,
+			StorageKeyDeviceDeploymentStatus,
+			StorageKeyDeviceDeploymentCreated,
+		},
+		Name:       IndexDeviceDeploymentDeviceStatusCreatedStr,
+		Background: true,
+	},
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentDeploymentID,
+			StorageKeyDeviceDeploymentDeviceId,
+		},
+		Name:       IndexDeviceDeploymentDeploymentDeviceStr,
+		Background: true,
+	},
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentDeploymentID,
+			StorageKeyDeviceDeploymentStatus,
+		},
+		Name:       IndexDeviceDeploymentDeploymentStatusStr,
+		Background: true,
+	},
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentAssignedImageId,
+			StorageKeyDeviceDeploymentStatus,
+		},
+		Name:       IndexDeviceDeploymentImageStatusStr,
+		Background: true,
+	},
+}
+
+// Up creates indexes of the 'devices' collection
+func (m *migration_1_2_2) Up(from migrate.Version) error {
+	s := m.session.Copy()
+	defer s.Close()
+
+	c := s.DB(m.db).C(CollectionDevices)
+	for _, idx := range DeviceDeploymentIndexes {
+		if err := c.EnsureIndex(idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *migration_1_2_2) Version() migrate.Version {
+	return migrate.MakeVersion(1, 2, 2)
+}
@@ -0,0 +1,235 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestMigration_1_2_2(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigration_1_2_2 in short mode.")
+	}
+
+	testCases := map[string]struct {
+		db    string
+		dbVer string
+	}{
+		"ST, 0.0.0": {
+			db: "deployments_service",
+		},
+		"ST, 1.2.1": {
+			db:    "deployments_service",
+			dbVer: "1.2.1",
+		},
+		"MT, 1.2.1": {
+			db:    "deployments_service-59afdb71c704db002a86ad95",
+			dbVer: "1.2.1",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+			s := db.Session()
+			defer s.Close()
+
+			if tc.dbVer != "" {
+				ver, err := migrate.NewVersion(tc.dbVer)
+				assert.NoError(t, err)
+				migrate.UpdateMigrationInfo(*ver, s, tc.db)
+			}
+
+			dd, err := model.NewDeviceDeployment("foo",
+				"30b3e62c-9ec2-4312-a7fa-cff24cc7397a")
+			assert.NoError(t, err)
+			assert.NoError(t, s.DB(tc.db).C(CollectionDevices).Insert(dd))
+
+			m := migrate.SimpleMigrator{
+				Session:     s,
+				Db:          tc.db,
+				Automigrate: true,
+			}
+			migrations := []migrate.Migration{
+				&migration_1_2_1{
+					session: s,
+					db:      tc.db,
+				},
+				&migration_1_2_2{
+					session: s,
+					db:      tc.db,
+				},
+			}
+
+			err = m.Apply(context.Background(), migrate.MakeVersion(1, 2, 2), migrations)
+			assert.NoError(t, err)
+
+			idxs, err := s.DB(tc.db).C(CollectionDevices).Indexes()
+			assert.NoError(t, err)
+			for _, idx := range DeviceDeploymentIndexes {
+				assert.True(t, hasIndex(idx.Name, idxs), "missing index %s", idx.Name)
+			}
+
+			// the migration is idempotent
+			assert.NoError(t, migrations[1].Up(migrate.MakeVersion(1, 2, 2)))
+		})
+	}
+}
+
+// winningPlan returns the stages of the winning query plan, e.g.
+// "FETCH <- IXSCAN(deviceIdStatusCreatedIndex)".
+func winningPlan(q *mgo.Query) (string, error) {
+	var explain bson.M
+	if err := q.Explain(&explain); err != nil {
+		return "", err
+	}
+
+	planner, _ := explain["queryPlanner"].(bson.M)
+	plan, _ := planner["winningPlan"].(bson.M)
+
+	stages := []string{}
+	for plan != nil {
+		stage := fmt.Sprint(plan["stage"])
+		if index, ok := plan["indexName"]; ok {
+			stage += fmt.Sprintf("(%v)", index)
+		}
+		stages = append(stages, stage)
+		plan, _ = plan["inputStage"].(bson.M)
+	}
+
+	return strings.Join(stages, " <- "), nil
+}
+
+// BenchmarkDeviceDeploymentQueries runs the queries of the 'devices'
+// collection with and without the indexes created by migration_1_2_2,
+// logging the winning query plans.
+func BenchmarkDeviceDeploymentQueries(b *testing.B) {
+	if testing.Short() {
+		b.Skip("skipping BenchmarkDeviceDeploymentQueries in short mode.")
+	}
+
+	const (
+		deployments = 50
+		devices     = 200
+	)
+
+	db.Wipe()
+	s := db.Session()
+	defer s.Close()
+
+	c := s.DB(DbName).C(CollectionDevices)
+
+	deploymentIDs := make([]string, deployments)
+	for i := range deploymentIDs {
+		uid, err := uuid.NewV4()
+		if err != nil {
+			b.Fatal(err)
+		}
+		deploymentIDs[i] = uid.String()
+
+		docs := make([]interface{}, 0, devices)
+		for j := 0; j < devices; j++ {
+			dd, err := model.NewDeviceDeployment(fmt.Sprintf("device-%d", j),
+				deploymentIDs[i])
+			if err != nil {
+				b.Fatal(err)
+			}
+			if i < deployments-1 {
+				status := model.DeviceDeploymentStatusSuccess
+				dd.Status = &status
+			}
+			dd.Image = &model.SoftwareImage{Id: fmt.Sprintf("image-%d", i)}
+			docs = append(docs, dd)
+		}
+		if err := c.Insert(docs...); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	queries := map[string]func() *mgo.Query{
+		"device, statuses, oldest": func() *mgo.Query {
+			return c.Find(bson.M{
+				StorageKeyDeviceDeploymentDeviceId: "device-7",
+				StorageKeyDeviceDeploymentStatus: bson.M{
+					"$in": model.ActiveDeploymentStatuses(),
+				},
+			}).Sort("created")
+		},
+		"deployment, device": func() *mgo.Query {
+			return c.Find(bson.M{
+				StorageKeyDeviceDeploymentDeploymentID: deploymentIDs[3],
+				StorageKeyDeviceDeploymentDeviceId:     "device-7",
+			})
+		},
+		"deployment, statuses": func() *mgo.Query {
+			return c.Find(bson.M{
+				StorageKeyDeviceDeploymentDeploymentID: deploymentIDs[3],
+				StorageKeyDeviceDeploymentStatus: bson.M{
+					"$in": model.ActiveDeploymentStatuses(),
+				},
+			})
+		},
+		"image, statuses": func() *mgo.Query {
+			return c.Find(bson.M{
+				StorageKeyDeviceDeploymentAssignedImageId: "image-3",
+				StorageKeyDeviceDeploymentStatus: bson.M{
+					"$in": model.ActiveDeploymentStatuses(),
+				},
+			})
+		},
+	}
+
+	run := func(b *testing.B) {
+		for name, query := range queries {
+			plan, err := winningPlan(query())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Logf("%s: %s", name, plan)
+
+			b.Run(name, func(b *testing.B) {
+				var result []model.DeviceDeployment
+				for i := 0; i < b.N; i++ {
+					if err := query().All(&result); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+
+	b.Run("without indexes", run)
+
+	m := &migration_1_2_2{
+		session: s,
+		db:      DbName,
+	}
+	if err := m.Up(migrate.MakeVersion(1, 2, 2)); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("with indexes", run)
+}
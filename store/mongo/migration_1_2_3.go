@@ -0,0 +1,68 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+type migration_1_2_3 struct {
+	session *mgo.Session
+	db      string
+}
+
+// DeviceDeploymentSortIndexes lists the indexes of the 'devices' collection
+// serving the pages of the device deployments of a deployment, sorted by the
+// creation or finish time.
+var DeviceDeploymentSortIndexes = []mgo.Index{
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentDeploymentID,
+			StorageKeyDeviceDeploymentCreated,
+			StorageKeyDeviceDeploymentDeviceId,
+		},
+		Name:       IndexDeviceDeploymentDeploymentCreatedStr,
+		Background: true,
+	},
+	{
+		Key: []string{
+			StorageKeyDeviceDeploymentDeploymentID,
+			StorageKeyDeviceDeploymentFinished,
+			StorageKeyDeviceDeploymentDeviceId,
+		},
+		Name:       IndexDeviceDeploymentDeploymentFinishedStr,
+		Background: true,
+	},
+}
+
+// Up creates the sort indexes of the 'devices' collection
+func (m *migration_1_2_3) Up(from migrate.Version) error {
+	s := m.session.Copy()
+	defer s.Close()
+
+	c := s.DB(m.db).C(CollectionDevices)
+	for _, idx := range DeviceDeploymentSortIndexes {
+		if err := c.EnsureIndex(idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *migration_1_2_3) Version() migrate.Version {
+	return migrate.MakeVersion(1, 2, 3)
+}
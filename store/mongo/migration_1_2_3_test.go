@@ -0,0 +1,81 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestMigration_1_2_3(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigration_1_2_3 in short mode.")
+	}
+
+	const deploymentID = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+
+	db.Wipe()
+	s := db.Session()
+	defer s.Close()
+
+	ver, err := migrate.NewVersion("1.2.2")
+	assert.NoError(t, err)
+	migrate.UpdateMigrationInfo(*ver, s, DbName)
+
+	dd, err := model.NewDeviceDeployment("foo", deploymentID)
+	assert.NoError(t, err)
+	c := s.DB(DbName).C(CollectionDevices)
+	assert.NoError(t, c.Insert(dd))
+
+	m := migrate.SimpleMigrator{
+		Session:     s,
+		Db:          DbName,
+		Automigrate: true,
+	}
+	migrations := []migrate.Migration{
+		&migration_1_2_3{
+			session: s,
+			db:      DbName,
+		},
+	}
+
+	err = m.Apply(context.Background(), migrate.MakeVersion(1, 2, 3), migrations)
+	assert.NoError(t, err)
+
+	idxs, err := c.Indexes()
+	assert.NoError(t, err)
+	for _, idx := range DeviceDeploymentSortIndexes {
+		assert.True(t, hasIndex(idx.Name, idxs), "missing index %s", idx.Name)
+	}
+
+	// the pages are read from the index, without sorting in memory
+	for _, sortBy := range [][]string{
+		{StorageKeyDeviceDeploymentCreated, StorageKeyDeviceDeploymentDeviceId},
+		{"-" + StorageKeyDeviceDeploymentFinished, "-" + StorageKeyDeviceDeploymentDeviceId},
+	} {
+		plan, err := winningPlan(c.Find(bson.M{
+			StorageKeyDeviceDeploymentDeploymentID: deploymentID,
+		}).Sort(sortBy...).Skip(20).Limit(20))
+		assert.NoError(t, err)
+		assert.False(t, strings.Contains(plan, "SORT"), plan)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+)
+
+type migration_1_2_4 struct {
+	session *mgo.Session
+	db      string
+}
+
+// Up stores the device count on the deployments created before it was set
+// on create.
+func (m *migration_1_2_4) Up(from migrate.Version) error {
+	s := m.session.Copy()
+	defer s.Close()
+
+	deployments := s.DB(m.db).C(CollectionDeployments)
+	devices := s.DB(m.db).C(CollectionDevices)
+
+	iter := deployments.Find(bson.M{
+		StorageKeyDeploymentDeviceCount: bson.M{"$exists": false},
+	}).Select(bson.M{"_id": 1}).Iter()
+
+	var deployment struct {
+		Id string `bson:"_id"`
+	}
+	for iter.Next(&deployment) {
+		count, err := devices.Find(bson.M{
+			StorageKeyDeviceDeploymentDeploymentID: deployment.Id,
+		}).Count()
+		if err != nil {
+			iter.Close()
+			return err
+		}
+
+		err = deployments.UpdateId(deployment.Id, bson.M{
+			"$set": bson.M{StorageKeyDeploymentDeviceCount: count},
+		})
+		if err != nil {
+			iter.Close()
+			return err
+		}
+	}
+
+	return iter.Close()
+}
+
+func (m *migration_1_2_4) Version() migrate.Version {
+	return migrate.MakeVersion(1, 2, 4)
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestMigration_1_2_4(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigration_1_2_4 in short mode.")
+	}
+
+	const (
+		legacyID  = "30b3e62c-9ec2-4312-a7fa-cff24cc7397a"
+		currentID = "1d1ce8bc-6c53-4c42-8a76-5c6b3a4f6d2e"
+	)
+
+	db.Wipe()
+	s := db.Session()
+	defer s.Close()
+
+	ver, err := migrate.NewVersion("1.2.3")
+	assert.NoError(t, err)
+	migrate.UpdateMigrationInfo(*ver, s, DbName)
+
+	deployments := s.DB(DbName).C(CollectionDeployments)
+	assert.NoError(t, deployments.Insert(
+		bson.M{"_id": legacyID},
+		bson.M{"_id": currentID, StorageKeyDeploymentDeviceCount: 5},
+	))
+	for _, device := range []string{"foo", "bar"} {
+		for _, id := range []string{legacyID, currentID} {
+			dd, err := model.NewDeviceDeployment(device, id)
+			assert.NoError(t, err)
+			assert.NoError(t, s.DB(DbName).C(CollectionDevices).Insert(dd))
+		}
+	}
+
+	m := migrate.SimpleMigrator{
+		Session:     s,
+		Db:          DbName,
+		Automigrate: true,
+	}
+	migrations := []migrate.Migration{
+		&migration_1_2_4{
+			session: s,
+			db:      DbName,
+		},
+	}
+
+	err = m.Apply(context.Background(), migrate.MakeVersion(1, 2, 4), migrations)
+	assert.NoError(t, err)
+
+	for id, count := range map[string]int{
+		legacyID: 2,
+		// deployments with the count are left as is
+		currentID: 5,
+	} {
+		var deployment bson.M
+		assert.NoError(t, deployments.FindId(id).One(&deployment))
+		assert.Equal(t, count, deployment[StorageKeyDeploymentDeviceCount])
+	}
+}
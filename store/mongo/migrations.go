@@ -24,7 +24,7 @@ import (
 )
 
 const (
-	DbVersion = "1.2.1"
+	DbVersion = "1.2.4"
 	DbName    = "deployment_service"
 )
 
@@ -85,6 +85,18 @@ func MigrateSingle(ctx context.Context,
 			session: session,
 			db:      db,
 		},
+		&migration_1_2_2{
+			session: session,
+			db:      db,
+		},
+		&migration_1_2_3{
+			session: session,
+			db:      db,
+		},
+		&migration_1_2_4{
+			session: session,
+			db:      db,
+		},
 	}
 
 	err = m.Apply(ctx, *ver, migrations)
@@ -0,0 +1,123 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Notifications are only needed by the replicas running at the time
+	// they are sent; the collection is cleaned up after this period.
+	deviceNotificationsTTL = time.Hour
+
+	// How long a single read of the change stream blocks.
+	deviceNotificationsAwait = 5 * time.Second
+
+	IndexDeviceNotificationsTTL = "created_ttl"
+
+	StorageKeyDeviceNotificationCreated = "created"
+)
+
+type deviceNotification struct {
+	Tenant  string    `bson:"tenant"`
+	Devices []string  `bson:"devices"`
+	Created time.Time `bson:"created"`
+}
+
+// DeploymentNotifier wakes up devices waiting for a deployment across all
+// replicas of the service, through a change stream of a collection in the
+// default database. Change streams require a replica set.
+type DeploymentNotifier struct {
+	session *mgo.Session
+}
+
+func NewDeploymentNotifier(session *mgo.Session) *DeploymentNotifier {
+	return &DeploymentNotifier{
+		session: session,
+	}
+}
+
+// NotifyDevices publishes the notification for the devices of the tenant
+// from the context.
+func (n *DeploymentNotifier) NotifyDevices(ctx context.Context,
+	devices []string) error {
+
+	notification := deviceNotification{
+		Devices: devices,
+		Created: time.Now(),
+	}
+	if id := identity.FromContext(ctx); id != nil {
+		notification.Tenant = id.Tenant
+	}
+
+	session := n.session.Copy()
+	defer session.Close()
+
+	return session.DB(DatabaseName).C(CollectionDeviceNotifications).
+		Insert(notification)
+}
+
+// Watch calls wake for each notification published after it started, until
+// the context is canceled or the change stream fails.
+func (n *DeploymentNotifier) Watch(ctx context.Context,
+	wake func(tenant string, devices []string)) error {
+
+	session := n.session.Copy()
+	defer session.Close()
+
+	coll := session.DB(DatabaseName).C(CollectionDeviceNotifications)
+
+	if err := coll.EnsureIndex(mgo.Index{
+		Key:         []string{StorageKeyDeviceNotificationCreated},
+		Name:        IndexDeviceNotificationsTTL,
+		ExpireAfter: deviceNotificationsTTL,
+		Background:  true,
+	}); err != nil {
+		return errors.Wrap(err, "failed to create notifications index")
+	}
+
+	stream, err := coll.Watch([]bson.M{
+		{"$match": bson.M{"operationType": "insert"}},
+	}, mgo.ChangeStreamOptions{
+		MaxAwaitTimeMS: deviceNotificationsAwait,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch notifications")
+	}
+	defer stream.Close()
+
+	var event struct {
+		Notification deviceNotification `bson:"fullDocument"`
+	}
+	for ctx.Err() == nil {
+		if stream.Next(&event) {
+			wake(event.Notification.Tenant, event.Notification.Devices)
+			continue
+		}
+		// no error means no notifications in the await time
+		if err := stream.Err(); err != nil {
+			return errors.Wrap(err, "failed to read notifications")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentNotifierNotifyDevices(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestDeploymentNotifierNotifyDevices in short mode.")
+	}
+
+	db.Wipe()
+	session := db.Session()
+	defer session.Close()
+
+	notifier := NewDeploymentNotifier(session)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	assert.NoError(t, notifier.NotifyDevices(ctx, []string{"a", "b"}))
+	assert.NoError(t, notifier.NotifyDevices(context.Background(),
+		[]string{"c"}))
+
+	// notifications of all tenants are kept in the default database
+	var notifications []deviceNotification
+	assert.NoError(t, session.DB(DatabaseName).C(CollectionDeviceNotifications).
+		Find(nil).Sort("created").All(&notifications))
+	if assert.Len(t, notifications, 2) {
+		assert.Equal(t, "foo", notifications[0].Tenant)
+		assert.Equal(t, []string{"a", "b"}, notifications[0].Devices)
+		assert.Equal(t, "", notifications[1].Tenant)
+		assert.Equal(t, []string{"c"}, notifications[1].Devices)
+	}
+}
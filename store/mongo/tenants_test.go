@@ -0,0 +1,132 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package mongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+func TestDeprovisionTenant(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestDeprovisionTenant in short mode.")
+	}
+
+	ctx := context.Background()
+	store := getDb(ctx)
+
+	assert.NoError(t, store.ProvisionTenant(ctx, "foo"))
+	assert.NoError(t, store.ProvisionTenant(ctx, "bar"))
+	fooCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "foo"})
+	assert.NoError(t, store.UpsertLimit(fooCtx,
+		model.Limit{Name: model.LimitStorage, Value: 100}))
+
+	assert.EqualError(t, store.DeprovisionTenant(ctx, ""),
+		ErrStorageInvalidInput.Error())
+
+	assert.NoError(t, store.DeprovisionTenant(ctx, "foo"))
+	tenants, err := store.ListTenants(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bar"}, tenants)
+
+	// noop if already removed
+	assert.NoError(t, store.DeprovisionTenant(ctx, "foo"))
+}
+
+func TestTenantDeprovisioning(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestTenantDeprovisioning in short mode.")
+	}
+
+	ctx := context.Background()
+	store := getDb(ctx)
+
+	deprovisioning, err := store.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, deprovisioning)
+
+	err = store.SaveTenantDeprovisioning(ctx, model.TenantDeprovisioning{})
+	assert.EqualError(t, err, ErrStorageInvalidInput.Error())
+
+	started := time.Now().UTC().Truncate(time.Millisecond)
+	progress := model.TenantDeprovisioning{
+		TenantID: "foo",
+		Status:   model.TenantDeprovisioningInProgress,
+		Started:  started,
+		Updated:  started,
+	}
+	assert.NoError(t, store.SaveTenantDeprovisioning(ctx, progress))
+
+	finished := started.Add(time.Minute)
+	progress.Status = model.TenantDeprovisioningFinished
+	progress.ObjectsDeleted = 10
+	progress.Updated = finished
+	progress.Finished = &finished
+	// stored in the default database regardless of the context
+	fooCtx := identity.WithContext(ctx, &identity.Identity{Tenant: "foo"})
+	assert.NoError(t, store.SaveTenantDeprovisioning(fooCtx, progress))
+
+	deprovisioning, err = store.GetTenantDeprovisioning(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, deprovisioning) {
+		assert.Equal(t, model.TenantDeprovisioningFinished, deprovisioning.Status)
+		assert.Equal(t, 10, deprovisioning.ObjectsDeleted)
+		assert.True(t, started.Equal(deprovisioning.Started))
+		assert.True(t, finished.Equal(*deprovisioning.Finished))
+	}
+}
+
+func TestFindUnfinishedTenantDeprovisionings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestFindUnfinishedTenantDeprovisionings in short mode.")
+	}
+
+	ctx := context.Background()
+	store := getDb(ctx)
+
+	unfinished, err := store.FindUnfinishedTenantDeprovisionings(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, unfinished)
+
+	started := time.Now().UTC().Truncate(time.Millisecond)
+	for i, status := range []string{
+		model.TenantDeprovisioningInProgress,
+		model.TenantDeprovisioningFinished,
+		model.TenantDeprovisioningPending,
+	} {
+		at := started.Add(-time.Duration(i) * time.Minute)
+		assert.NoError(t, store.SaveTenantDeprovisioning(ctx,
+			model.TenantDeprovisioning{
+				TenantID: status,
+				Status:   status,
+				Started:  at,
+				Updated:  at,
+			}))
+	}
+
+	// oldest first
+	unfinished, err = store.FindUnfinishedTenantDeprovisionings(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, unfinished, 2) {
+		assert.Equal(t, model.TenantDeprovisioningPending, unfinished[0].TenantID)
+		assert.Equal(t, model.TenantDeprovisioningInProgress, unfinished[1].TenantID)
+	}
+}
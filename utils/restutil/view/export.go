@@ -0,0 +1,241 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package view
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+
+	"github.com/mendersoftware/deployments/model"
+)
+
+// Media types
+const (
+	MediaTypeJSON   = "application/json"
+	MediaTypeCSV    = "text/csv"
+	MediaTypeNDJSON = "application/x-ndjson"
+)
+
+// NegotiateMediaType returns the offered media type the client prefers
+// according to the Accept header; the first one offered if the client
+// accepts any or none of them.
+func (p *RESTView) NegotiateMediaType(r *rest.Request, offers ...string) string {
+	type accepted struct {
+		mediaType string
+		quality   float64
+	}
+
+	var accepts []accepted
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(value, ";")
+		a := accepted{
+			mediaType: strings.ToLower(strings.TrimSpace(params[0])),
+			quality:   1,
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					a.quality = q
+				}
+			}
+		}
+		if a.mediaType != "" && a.quality > 0 {
+			accepts = append(accepts, a)
+		}
+	}
+	sort.SliceStable(accepts, func(i, j int) bool {
+		return accepts[i].quality > accepts[j].quality
+	})
+
+	for _, a := range accepts {
+		for _, offer := range offers {
+			if matchMediaType(a.mediaType, offer) {
+				return offer
+			}
+		}
+	}
+	return offers[0]
+}
+
+// matchMediaType checks if the accepted media type, possibly a wildcard like
+// "text/*", matches the offered one.
+func matchMediaType(accepted, offer string) bool {
+	if accepted == offer || accepted == "*/*" {
+		return true
+	}
+	return strings.HasSuffix(accepted, "/*") &&
+		strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*"))
+}
+
+// DeviceDeploymentExportRecord is a device deployment as exported in CSV
+// and NDJSON.
+type DeviceDeploymentExportRecord struct {
+	DeviceID     string     `json:"id"`
+	Status       string     `json:"status"`
+	SubState     string     `json:"substate,omitempty"`
+	DeviceType   string     `json:"device_type,omitempty"`
+	ArtifactID   string     `json:"artifact_id,omitempty"`
+	ArtifactName string     `json:"artifact_name,omitempty"`
+	Created      *time.Time `json:"created"`
+	Finished     *time.Time `json:"finished,omitempty"`
+	Log          bool       `json:"log"`
+}
+
+var deviceDeploymentExportColumns = []string{
+	"id", "status", "substate", "device_type", "artifact_id",
+	"artifact_name", "created", "finished", "log",
+}
+
+func NewDeviceDeploymentExportRecord(dd *model.DeviceDeployment) DeviceDeploymentExportRecord {
+	record := DeviceDeploymentExportRecord{
+		Created:  dd.Created,
+		Finished: dd.Finished,
+		Log:      dd.IsLogAvailable,
+	}
+	if dd.DeviceId != nil {
+		record.DeviceID = *dd.DeviceId
+	}
+	if dd.Status != nil {
+		record.Status = *dd.Status
+	}
+	if dd.SubState != nil {
+		record.SubState = *dd.SubState
+	}
+	if dd.DeviceType != nil {
+		record.DeviceType = *dd.DeviceType
+	}
+	if dd.Image != nil {
+		record.ArtifactID = dd.Image.Id
+		record.ArtifactName = dd.Image.Name
+	}
+	return record
+}
+
+// csvCell escapes the value reported by a device or a user, which a
+// spreadsheet would evaluate as a formula if it starts with one of =+-@.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (r DeviceDeploymentExportRecord) csv() []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		csvCell(r.DeviceID),
+		r.Status,
+		csvCell(r.SubState),
+		csvCell(r.DeviceType),
+		csvCell(r.ArtifactID),
+		csvCell(r.ArtifactName),
+		formatTime(r.Created),
+		formatTime(r.Finished),
+		strconv.FormatBool(r.Log),
+	}
+}
+
+// DeviceDeploymentEncoder streams device deployments in the response.
+type DeviceDeploymentEncoder interface {
+	Encode(dd *model.DeviceDeployment) error
+	// Close writes what is left of the response
+	Close() error
+	// Started tells if anything was written to the response already
+	Started() bool
+}
+
+// ErrStreamingUnsupported is returned for response writers the device
+// deployments cannot be streamed to.
+var ErrStreamingUnsupported = errors.New("response writer does not support streaming")
+
+// NewDeviceDeploymentEncoder returns the encoder of device deployments in
+// CSV or NDJSON. The response is started with the first device deployment.
+func (p *RESTView) NewDeviceDeploymentEncoder(w rest.ResponseWriter,
+	mediaType string) (DeviceDeploymentEncoder, error) {
+
+	h, ok := w.(http.ResponseWriter)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+	return &deviceDeploymentEncoder{
+		w:         h,
+		mediaType: mediaType,
+	}, nil
+}
+
+type deviceDeploymentEncoder struct {
+	w         http.ResponseWriter
+	mediaType string
+
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func (e *deviceDeploymentEncoder) Started() bool {
+	return e.csv != nil || e.json != nil
+}
+
+func (e *deviceDeploymentEncoder) start() error {
+	e.w.Header().Set("Content-Type", e.mediaType)
+	e.w.WriteHeader(http.StatusOK)
+
+	if e.mediaType == MediaTypeCSV {
+		e.csv = csv.NewWriter(e.w)
+		return e.csv.Write(deviceDeploymentExportColumns)
+	}
+	e.json = json.NewEncoder(e.w)
+	return nil
+}
+
+func (e *deviceDeploymentEncoder) Encode(dd *model.DeviceDeployment) error {
+	if !e.Started() {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	record := NewDeviceDeploymentExportRecord(dd)
+	if e.csv != nil {
+		return e.csv.Write(record.csv())
+	}
+	return e.json.Encode(record)
+}
+
+func (e *deviceDeploymentEncoder) Close() error {
+	if !e.Started() {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
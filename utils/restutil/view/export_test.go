@@ -0,0 +1,162 @@
+// Copyright 2019 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package view
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/deployments/model"
+	"github.com/mendersoftware/deployments/utils/pointers"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	offers := []string{MediaTypeJSON, MediaTypeCSV, MediaTypeNDJSON}
+
+	testCases := map[string]struct {
+		accept    string
+		mediaType string
+	}{
+		"no header": {
+			mediaType: MediaTypeJSON,
+		},
+		"any": {
+			accept:    "*/*",
+			mediaType: MediaTypeJSON,
+		},
+		"csv": {
+			accept:    "text/csv",
+			mediaType: MediaTypeCSV,
+		},
+		"text wildcard": {
+			accept:    "text/*",
+			mediaType: MediaTypeCSV,
+		},
+		"quality": {
+			accept:    "application/json;q=0.5, application/x-ndjson",
+			mediaType: MediaTypeNDJSON,
+		},
+		"not acceptable": {
+			accept:    "text/csv;q=0, application/xml",
+			mediaType: MediaTypeJSON,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost/test", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			mediaType := new(RESTView).NegotiateMediaType(&rest.Request{Request: req},
+				offers...)
+			assert.Equal(t, tc.mediaType, mediaType)
+		})
+	}
+}
+
+func TestDeviceDeploymentEncoder(t *testing.T) {
+	created := time.Date(2019, 5, 6, 12, 0, 0, 0, time.UTC)
+	finished := created.Add(time.Hour)
+
+	dd := &model.DeviceDeployment{
+		DeviceId:       pointers.StringToPointer("dev1"),
+		Status:         pointers.StringToPointer(model.DeviceDeploymentStatusFailure),
+		DeviceType:     pointers.StringToPointer("foo"),
+		Created:        &created,
+		Finished:       &finished,
+		IsLogAvailable: true,
+		Image: &model.SoftwareImage{
+			Id: "a1",
+			SoftwareImageMetaArtifactConstructor: model.SoftwareImageMetaArtifactConstructor{
+				Name: "artifact",
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		mediaType string
+		dds       []*model.DeviceDeployment
+
+		body string
+	}{
+		"csv": {
+			mediaType: MediaTypeCSV,
+			dds:       []*model.DeviceDeployment{dd},
+			body: "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n" +
+				"dev1,failure,,foo,a1,artifact,2019-05-06T12:00:00Z,2019-05-06T13:00:00Z,true\n",
+		},
+		"csv, formulas escaped": {
+			mediaType: MediaTypeCSV,
+			dds: []*model.DeviceDeployment{{
+				DeviceId:   pointers.StringToPointer("dev1"),
+				Status:     pointers.StringToPointer(model.DeviceDeploymentStatusFailure),
+				SubState:   pointers.StringToPointer("-1+2"),
+				DeviceType: pointers.StringToPointer("=HYPERLINK(\"http://foo\")"),
+				Created:    &created,
+				Image: &model.SoftwareImage{
+					Id: "a1",
+					SoftwareImageMetaArtifactConstructor: model.SoftwareImageMetaArtifactConstructor{
+						Name: "@artifact",
+					},
+				},
+			}},
+			body: "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n" +
+				"dev1,failure,'-1+2,\"'=HYPERLINK(\"\"http://foo\"\")\",a1,'@artifact,2019-05-06T12:00:00Z,,false\n",
+		},
+		"csv, empty": {
+			mediaType: MediaTypeCSV,
+			body:      "id,status,substate,device_type,artifact_id,artifact_name,created,finished,log\n",
+		},
+		"ndjson": {
+			mediaType: MediaTypeNDJSON,
+			dds:       []*model.DeviceDeployment{dd, dd},
+			body: `{"id":"dev1","status":"failure","device_type":"foo","artifact_id":"a1","artifact_name":"artifact","created":"2019-05-06T12:00:00Z","finished":"2019-05-06T13:00:00Z","log":true}` + "\n" +
+				`{"id":"dev1","status":"failure","device_type":"foo","artifact_id":"a1","artifact_name":"artifact","created":"2019-05-06T12:00:00Z","finished":"2019-05-06T13:00:00Z","log":true}` + "\n",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			router, err := rest.MakeRouter(rest.Get("/test", func(w rest.ResponseWriter, r *rest.Request) {
+				encoder, err := new(RESTView).NewDeviceDeploymentEncoder(w, tc.mediaType)
+				assert.NoError(t, err)
+				assert.False(t, encoder.Started())
+				for _, dd := range tc.dds {
+					assert.NoError(t, encoder.Encode(dd))
+				}
+				assert.NoError(t, encoder.Close())
+				assert.True(t, encoder.Started())
+			}))
+			assert.NoError(t, err)
+
+			api := rest.NewApi()
+			api.SetApp(router)
+
+			recorded := test.RunRequest(t, api.MakeHandler(),
+				test.MakeSimpleRequest("GET", "http://localhost/test", nil))
+
+			recorded.CodeIs(http.StatusOK)
+			recorded.HeaderIs("Content-Type", tc.mediaType)
+			recorded.BodyIs(tc.body)
+		})
+	}
+}
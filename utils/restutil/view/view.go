@@ -29,7 +29,8 @@ import (
 
 // Headers
 const (
-	HttpHeaderLocation = "Location"
+	HttpHeaderLocation   = "Location"
+	HttpHeaderTotalCount = "X-Total-Count"
 )
 
 // Errors